@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+)
+
+// Drawings exported for the laser still carry the annotations of the
+// drawing: dimensions with their arrowheads and values, notes, centre
+// lines and construction lines. None of it should be cut. Like the sheet
+// chrome nothing marks these elements, so they are told apart from the
+// part geometry by how they are drawn and what they are drawn with. How
+// thin a line is says nothing, parts have thin lines too. Neither does
+// text or a dashed line on its own, text can be engraved and a dashed line
+// can be a fold or a perforation, so they need another sign.
+
+const (
+	// annotationMaxSize is the largest an arrowhead or a glyph of text
+	// can be, as a fraction of the page size
+	annotationMaxSize = .02
+	// labelDistance is how far the value of a dimension can be from its
+	// dimension line or arrowheads, as a fraction of the page size
+	labelDistance = .05
+)
+
+// annotations finds the annotations among the shapes of a document and
+// what each of them is. chrome are the elements of the drawing sheet,
+// which are no part. A line drawn dash dot is a centre line. A small
+// filled triangle with a line ending at it is an arrowhead and the line a
+// dimension line. Drawings group elements drawn alike, so straight lines,
+// text and dashed lines in a group that is mostly annotations are
+// annotations too, and small filled shapes in one are glyphs of text
+// drawn as outlines. Other text is the value of a dimension when it is
+// next to one, and a note when it is on no part of a drawing that has
+// dimensions.
+func annotations(shapes []docShape, page bounds, chrome map[*xmltree.Element]string) map[*xmltree.Element]string {
+	size := annotationMaxSize * math.Max(page.width(), page.height())
+	tol := chromeTolerance * math.Max(page.width(), page.height())
+
+	found := map[*xmltree.Element]string{}
+	var triangles []docShape
+	for _, s := range shapes {
+		switch {
+		case s.stroked && s.dashDot:
+			found[s.el] = "dashed line"
+		case smallFilled(s, size) && len(openRing(s.points)) == 3:
+			triangles = append(triangles, s)
+		}
+	}
+
+	var dimensions []docShape
+	for _, s := range shapes {
+		if _, ok := found[s.el]; ok || !s.stroked || s.closed || len(s.points) < 2 {
+			continue
+		}
+		for _, t := range triangles {
+			if near(t.bounds, s.points[0], tol) || near(t.bounds, s.points[len(s.points)-1], tol) {
+				if _, ok := found[s.el]; !ok {
+					dimensions = append(dimensions, s)
+				}
+				if _, ok := found[t.el]; !ok {
+					dimensions = append(dimensions, t)
+				}
+				found[s.el] = "dimension line"
+				found[t.el] = "arrowhead"
+			}
+		}
+	}
+
+	total, annotated := map[*xmltree.Element]int{}, map[*xmltree.Element]int{}
+	for _, s := range shapes {
+		if len(s.ancestors) == 0 {
+			continue
+		}
+		total[s.ancestors[0]]++
+		if _, ok := found[s.el]; ok {
+			annotated[s.ancestors[0]]++
+		}
+	}
+	for _, s := range shapes {
+		if _, ok := found[s.el]; ok || len(s.ancestors) == 0 || 2*annotated[s.ancestors[0]] <= total[s.ancestors[0]] {
+			continue
+		}
+		switch {
+		case s.el.Name.Local == "text":
+			found[s.el] = "text"
+		case s.stroked && s.dashed:
+			found[s.el] = "dashed line"
+		case s.straightLine(tol):
+			found[s.el] = "extension line"
+		case smallFilled(s, size) && !s.stroked:
+			found[s.el] = "text"
+		}
+	}
+
+	if len(dimensions) == 0 {
+		return found
+	}
+	label := labelDistance * math.Max(page.width(), page.height())
+	for _, s := range shapes {
+		if _, ok := found[s.el]; ok || s.el.Name.Local != "text" || len(s.points) == 0 {
+			continue
+		}
+		for _, d := range dimensions {
+			if near(d.bounds, s.points[0], label) {
+				found[s.el] = "text"
+				break
+			}
+		}
+		if _, ok := found[s.el]; !ok && !onPart(s.points[0], shapes, found, chrome) {
+			found[s.el] = "text"
+		}
+	}
+	return found
+}
+
+// onPart reports if p is inside a closed outline that is neither an
+// annotation nor chrome
+func onPart(p [2]float64, shapes []docShape, found, chrome map[*xmltree.Element]string) bool {
+	for _, s := range shapes {
+		if !s.closed || !near(s.bounds, p, 0) {
+			continue
+		}
+		if _, ok := found[s.el]; ok {
+			continue
+		}
+		if _, ok := chrome[s.el]; ok {
+			continue
+		}
+		if pointInRing(p, s.points) {
+			return true
+		}
+	}
+	return false
+}
+
+// smallFilled reports if the shape is a filled outline no bigger than size
+func smallFilled(s docShape, size float64) bool {
+	return s.filled && s.closed && !s.bounds.isEmpty() && s.bounds.width() <= size && s.bounds.height() <= size
+}
+
+// near reports if p is within tol of b
+func near(b bounds, p [2]float64, tol float64) bool {
+	return p[0] >= b.MinX-tol && p[0] <= b.MaxX+tol && p[1] >= b.MinY-tol && p[1] <= b.MaxY+tol
+}
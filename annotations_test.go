@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+	"github.com/matryer/is"
+)
+
+// dimensionedPart is a part drawn with thick lines and dimensioned with
+// thin ones, the way Onshape groups elements by how they are drawn. The
+// extension line ends at an arrowhead, the centre line is drawn dash dot
+// and the note is on no part.
+const dimensionedPart = `<svg width="100mm" height="100mm" viewBox="0 0 1000 1000" xmlns="http://www.w3.org/2000/svg">
+<g fill="#000000" stroke="#000000" stroke-width="5">
+<polyline id="part" fill="none" points="100,100 500,100 500,500 100,500 100,100"/>
+<polyline id="hole" fill="none" points="200,200 210,200 210,210 200,210 200,200"/>
+</g>
+<g id="dimension" fill="#000000" stroke="#000000" stroke-width="5">
+<polyline id="dim-line" fill="none" points="110,50 490,50"/>
+<polygon id="arrow-left" points="100,50 110,45 110,55"/>
+<polygon id="arrow-right" points="500,50 490,45 490,55"/>
+<path id="glyph" stroke="none" d="M290,30 L300,30 L300,40 L290,40 Z"/>
+</g>
+<g fill="none" stroke="#000000" stroke-width="1">
+<polyline id="extension" points="100,95 100,40"/>
+</g>
+<g fill="none" stroke="#000000" stroke-width="5" stroke-dasharray="20,5,5,5">
+<polyline id="centre" points="300,80 300,520"/>
+</g>
+<text id="note" x="600" y="600">ALL HOLES 3MM</text>
+</svg>`
+
+func TestAnnotations(t *testing.T) {
+	is := is.New(t)
+	root, err := xmltree.Parse([]byte(dimensionedPart))
+	is.NoErr(err)
+
+	removed := cleanup(root, bounds{MaxX: 1000, MaxY: 1000}, defaultCleanOptions)
+	kinds := map[string]int{}
+	for _, r := range removed {
+		kinds[r.Kind]++
+	}
+	is.Equal(kinds["arrowhead"], 2)
+	is.Equal(kinds["dimension line"], 2) // the dimension and extension lines
+	is.Equal(kinds["text"], 2)           // the glyph and the note
+	is.Equal(kinds["dashed line"], 1)
+	is.Equal(len(removed), 7)
+
+	out := root.String()
+	is.True(strings.Contains(out, `id="part"`))
+	is.True(strings.Contains(out, `id="hole"`))
+}
+
+func TestAnnotationsKeepThinLines(t *testing.T) {
+	is := is.New(t)
+	// a slot drawn thinner than the outline around it, and a small filled
+	// square, are still part of the part
+	root, err := xmltree.Parse([]byte(`<svg width="100mm" height="100mm" viewBox="0 0 100 100" xmlns="http://www.w3.org/2000/svg">
+<g fill="none" stroke="#000000" stroke-width="0.5">
+<polyline id="outline" points="10,10 90,10 90,90 10,90 10,10"/>
+</g>
+<g fill="none" stroke="#000000" stroke-width="0.25">
+<polyline id="slot-top" points="30,40 70,40"/>
+<polyline id="slot-bottom" points="30,45 70,45"/>
+</g>
+<rect id="dot" x="50" y="70" width="1" height="1" fill="#000000"/>
+</svg>`))
+	is.NoErr(err)
+	is.Equal(len(cleanup(root, bounds{MaxX: 100, MaxY: 100}, defaultCleanOptions)), 0)
+	out := root.String()
+	for _, id := range []string{"outline", "slot-top", "slot-bottom", "dot"} {
+		is.True(strings.Contains(out, `id="`+id+`"`))
+	}
+}
+
+func TestAnnotationsKeepTextAndDashedLines(t *testing.T) {
+	is := is.New(t)
+	// text engraved on a part and a fold line dashed across it, one drawing
+	// with a dimension and one without
+	const part = `<svg width="100mm" height="100mm" viewBox="0 0 1000 1000" xmlns="http://www.w3.org/2000/svg">
+<g fill="none" stroke="#000000" stroke-width="5">
+<polyline id="part" points="100,100 900,100 900,900 100,900 100,100"/>
+</g>
+<g fill="none" stroke="#000000" stroke-width="5" stroke-dasharray="10,5">
+<polyline id="fold" points="100,500 900,500"/>
+</g>
+<text id="engraved" x="400" y="700">TEAM 1234</text>
+%s</svg>`
+	const dimension = `<g id="dimension" fill="#000000" stroke="#000000" stroke-width="5">
+<polyline id="dim-line" fill="none" points="110,50 890,50"/>
+<polygon id="arrow-left" points="100,50 110,45 110,55"/>
+<polygon id="arrow-right" points="900,50 890,45 890,55"/>
+</g>
+<text id="value" x="480" y="40">80</text>
+<text id="note" x="950" y="950">SCALE 1:1</text>`
+	for _, extra := range []string{"", dimension} {
+		root, err := xmltree.Parse([]byte(fmt.Sprintf(part, extra)))
+		is.NoErr(err)
+		cleanup(root, bounds{MaxX: 1000, MaxY: 1000}, defaultCleanOptions)
+		out := root.String()
+		for _, id := range []string{"part", "fold", "engraved"} {
+			is.True(strings.Contains(out, `id="`+id+`"`))
+		}
+		// the value next to the dimension and the note off the part go
+		for _, id := range []string{"dim-line", "value", "note"} {
+			is.True(!strings.Contains(out, `id="`+id+`"`))
+		}
+	}
+}
+
+func TestAnnotationsOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    CleanOptions
+		kept    []string
+		removed []string
+	}{
+		{"keep kind", CleanOptions{Keep: []string{"text"}}, []string{"note", "glyph"}, []string{"centre"}},
+		{"keep group", CleanOptions{Keep: []string{"dimension"}}, []string{"dim-line", "arrow-left", "glyph"}, []string{"note"}},
+		{"drop", CleanOptions{Drop: []string{"hole"}}, []string{"part"}, []string{"hole"}},
+		{"keep annotations", CleanOptions{KeepAnnotations: true}, []string{"dim-line", "note", "centre"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			root, err := xmltree.Parse([]byte(dimensionedPart))
+			is.NoErr(err)
+			cleanup(root, bounds{MaxX: 1000, MaxY: 1000}, tt.opts)
+			out := root.String()
+			for _, id := range tt.kept {
+				is.True(strings.Contains(out, `id="`+id+`"`))
+			}
+			for _, id := range tt.removed {
+				is.True(!strings.Contains(out, `id="`+id+`"`))
+			}
+		})
+	}
+}
+
+func TestFixStokeKeepsThinLines(t *testing.T) {
+	is := is.New(t)
+	file, err := ioutil.ReadFile("./samples/Circles for Cutting Drawing 1 Copy 1.svg")
+	is.NoErr(err)
+
+	out := bytes.Buffer{}
+	is.NoErr(fixStoke(bytes.NewReader(file), &out, defaultStrokeOptions, defaultCleanOptions))
+	// the two lines along the axes are drawn thinner than the part, which
+	// does not make them annotations
+	is.Equal(strings.Count(out.String(), "<polyline"), strings.Count(string(file), "<polyline"))
+}
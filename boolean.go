@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// BooleanOp combines the areas of two shapes
+type BooleanOp int
+
+const (
+	// Union is the area inside either shape
+	Union BooleanOp = iota
+	// Intersection is the area inside both shapes
+	Intersection
+	// Difference is the area inside the first shape but not the second
+	Difference
+	// Xor is the area inside exactly one of the shapes
+	Xor
+)
+
+func (op BooleanOp) String() string {
+	switch op {
+	case Union:
+		return "union"
+	case Intersection:
+		return "intersection"
+	case Difference:
+		return "difference"
+	case Xor:
+		return "xor"
+	}
+	return fmt.Sprintf("BooleanOp(%d)", int(op))
+}
+
+// Shape is the area bounded by a set of closed rings. Which parts of it
+// are filled, where rings overlap or are inside each other, is decided by
+// its svg fill rule.
+type Shape struct {
+	Rings    [][][2]float64
+	FillRule string // nonzero or evenodd, empty is nonzero like in svg
+}
+
+// filled reports if an area with the given winding number is inside s
+func (s Shape) filled(winding int) bool {
+	if s.FillRule == "evenodd" {
+		return winding%2 != 0
+	}
+	return winding != 0
+}
+
+// shapeOf is the shape of the closed segments. Segments from the svg
+// package carry the fill rule of their group, the shape takes the fill
+// rule of the first segment.
+func shapeOf(segments []svg.Segment) Shape {
+	var s Shape
+	for _, seg := range segments {
+		if !seg.Closed {
+			continue
+		}
+		ring := openRing(seg.Points)
+		if len(ring) < 3 {
+			continue
+		}
+		if len(s.Rings) == 0 {
+			s.FillRule = seg.FillRule
+		}
+		s.Rings = append(s.Rings, ring)
+	}
+	return s
+}
+
+// boolean combines the areas of a and b with op. The result is simple,
+// non overlapping rings with the area on their left, so outer boundaries
+// have a positive area and holes a negative one, and is the same under
+// either fill rule.
+func boolean(op BooleanOp, a, b Shape) [][][2]float64 {
+	keep := func(windings []int) bool {
+		inA, inB := a.filled(windings[0]), b.filled(windings[1])
+		switch op {
+		case Union:
+			return inA || inB
+		case Intersection:
+			return inA && inB
+		case Difference:
+			return inA && !inB
+		case Xor:
+			return inA != inB
+		}
+		return false
+	}
+	return resolveOperands([][][][2]float64{a.Rings, b.Rings}, keep)
+}
+
+// booleanSegments combines the closed segments of a and b with op and
+// returns the result as closed segments painted like the first segment of
+// a, or of b when a has none.
+func booleanSegments(op BooleanOp, a, b []svg.Segment) []svg.Segment {
+	var style svg.Segment
+	for _, s := range append(append([]svg.Segment{}, a...), b...) {
+		if s.Closed {
+			style = s
+			break
+		}
+	}
+	var result []svg.Segment
+	for _, ring := range boolean(op, shapeOf(a), shapeOf(b)) {
+		s := style
+		s.Closed = true
+		s.FillRule = "nonzero"
+		s.Points = closeRing(ring)
+		result = append(result, s)
+	}
+	return result
+}
+
+// overlapMinArea is the area, in square millimetres, two contours must
+// have in common to be merged, contours that only share an edge have none
+const overlapMinArea = 1e-6
+
+// mergeOverlaps replaces the closed contours that are cut and overlap each
+// other by the outline of their union, the way a part drawn as several
+// overlapping shapes is cut. Contours inside another one without crossing
+// it, like holes, and contours that only share an edge are left alone.
+func (j *Job) mergeOverlaps() {
+	masked := j.cutSegments()
+	var closed []int
+	for i, s := range masked {
+		if s.Closed && len(openRing(s.Points)) > 2 {
+			closed = append(closed, i)
+		}
+	}
+
+	// contours that overlap end up with the same root
+	root := map[int]int{}
+	for _, i := range closed {
+		root[i] = i
+	}
+	find := func(i int) int {
+		for root[i] != i {
+			i = root[i]
+		}
+		return i
+	}
+	for a := range closed {
+		for b := a + 1; b < len(closed); b++ {
+			ra, rb := openRing(masked[closed[a]].Points), openRing(masked[closed[b]].Points)
+			if ringsOverlap(ra, rb) {
+				root[find(closed[b])] = find(closed[a])
+			}
+		}
+	}
+
+	groups := map[int][]svg.Segment{}
+	for _, i := range closed {
+		// the union is taken with every contour wound the same way, so
+		// their areas add up whichever way they were drawn
+		s := j.Segments[i]
+		s.FillRule = "nonzero"
+		if ringArea(openRing(s.Points)) < 0 {
+			s.Points = closeRing(reverseRing(openRing(s.Points)))
+		}
+		groups[find(i)] = append(groups[find(i)], s)
+	}
+	var merged []svg.Segment
+	for i, s := range j.Segments {
+		if _, ok := root[i]; !ok || len(groups[find(i)]) == 1 {
+			merged = append(merged, s)
+		} else if find(i) == i {
+			merged = append(merged, booleanSegments(Union, groups[i], nil)...)
+		}
+	}
+	j.Segments = merged
+}
+
+// ringsOverlap reports if two rings share some area without one being
+// inside the other
+func ringsOverlap(a, b [][2]float64) bool {
+	if !pointsBounds(a).overlaps(pointsBounds(b)) || ringInsideRing(a, b) || ringInsideRing(b, a) {
+		return false
+	}
+	area := 0.0
+	for _, r := range boolean(Intersection, Shape{Rings: [][][2]float64{a}}, Shape{Rings: [][][2]float64{b}}) {
+		area += ringArea(r)
+	}
+	return area > overlapMinArea
+}
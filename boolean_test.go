@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+// shapeArea is the filled area of a result of boolean, holes have a
+// negative area so they are subtracted
+func shapeArea(rings [][][2]float64) float64 {
+	area := 0.0
+	for _, r := range rings {
+		area += ringArea(r)
+	}
+	return area
+}
+
+func TestBoolean(t *testing.T) {
+	overlapping := Shape{Rings: [][][2]float64{square(5, 5, 10)}}
+	// a square with a smaller square drawn inside it in the same direction,
+	// it only has a hole with the evenodd fill rule
+	framed := [][][2]float64{square(0, 0, 10), square(2, 2, 6)}
+
+	tests := []struct {
+		name      string
+		op        BooleanOp
+		a, b      Shape
+		wantArea  float64
+		wantRings int
+	}{
+		{"union", Union, Shape{Rings: [][][2]float64{square(0, 0, 10)}}, overlapping, 175, 1},
+		{"intersection", Intersection, Shape{Rings: [][][2]float64{square(0, 0, 10)}}, overlapping, 25, 1},
+		{"difference", Difference, Shape{Rings: [][][2]float64{square(0, 0, 10)}}, overlapping, 75, 1},
+		{"xor", Xor, Shape{Rings: [][][2]float64{square(0, 0, 10)}}, overlapping, 150, 2},
+		{"disjoint intersection", Intersection, Shape{Rings: [][][2]float64{square(0, 0, 1)}}, overlapping, 0, 0},
+		{"nonzero frame", Union, Shape{Rings: framed, FillRule: "nonzero"}, Shape{}, 100, 1},
+		{"evenodd frame", Union, Shape{Rings: framed, FillRule: "evenodd"}, Shape{}, 100 - 36, 2},
+		{"evenodd frame filled in", Union, Shape{Rings: framed, FillRule: "evenodd"}, Shape{Rings: [][][2]float64{square(3, 3, 4)}}, 100 - 36 + 16, 3},
+		{"subtract the hole", Difference, Shape{Rings: [][][2]float64{square(0, 0, 10)}}, Shape{Rings: framed, FillRule: "evenodd"}, 36, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			rings := boolean(tt.op, tt.a, tt.b)
+			is.Equal(len(rings), tt.wantRings)
+			if math.Abs(shapeArea(rings)-tt.wantArea) > 1e-6 {
+				t.Errorf("area %f, want %f", shapeArea(rings), tt.wantArea)
+			}
+		})
+	}
+}
+
+func TestBooleanSegmentsFillRule(t *testing.T) {
+	is := is.New(t)
+	doc, err := svg.ParseSvg(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 20">
+	<g fill-rule="evenodd" stroke="black"><path d="M0,0 L10,0 L10,10 L0,10 Z M2,2 L8,2 L8,8 L2,8 Z"/></g>
+	<g fill-rule="nonzero" stroke="red"><path d="M0,0 L10,0 L10,10 L0,10 Z M2,2 L8,2 L8,8 L2,8 Z"/></g>
+	</svg>`, "fillrule", 0)
+	is.NoErr(err)
+	segments, err := doc.Segments()
+	is.NoErr(err)
+	is.Equal(len(segments), 4)
+
+	evenodd, nonzero := segments[:2], segments[2:]
+	is.Equal(evenodd[0].FillRule, "evenodd")
+
+	// the same drawing has a hole with one fill rule and not the other
+	is.Equal(len(booleanSegments(Union, evenodd, nil)), 2)
+	is.Equal(len(booleanSegments(Union, nonzero, nil)), 1)
+
+	// what is left of the nonzero square when the evenodd frame is taken away
+	rest := booleanSegments(Difference, nonzero, evenodd)
+	is.Equal(len(rest), 1)
+	is.True(rest[0].Closed)
+	is.Equal(normalizeColor(rest[0].Stroke), "#ff0000")
+	is.True(math.Abs(math.Abs(ringArea(openRing(rest[0].Points)))-36) < 1e-6)
+}
+
+func TestMergeOverlaps(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "bracket",
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments: []svg.Segment{
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(0, 0, 20))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(reverseRing(square(10, 10, 20)))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(2, 2, 4))},    // a hole
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(30, 0, 10))},  // shares an edge
+			{Closed: true, Stroke: "#0000ff", Points: closeRing(square(25, 25, 10))}, // scored
+			{Stroke: "#000000", Points: [][2]float64{{50, 50}, {60, 60}}},
+		},
+	}
+	job.mergeOverlaps()
+	is.Equal(len(job.Segments), 5)
+	outline := job.Segments[0]
+	is.True(outline.Closed)
+	is.True(math.Abs(ringArea(openRing(outline.Points))-(400+400-100)) < 1e-6)
+	is.Equal(job.Segments[1].Points, closeRing(square(2, 2, 4)))
+	is.Equal(job.Segments[2].Points, closeRing(square(30, 0, 10)))
+
+	// nesting keeps the overlapping shapes together as one part
+	parts := extractParts(&Job{Name: "bracket", Operations: job.Operations, Segments: []svg.Segment{
+		{Closed: true, Stroke: "#000000", Points: closeRing(square(0, 0, 20))},
+		{Closed: true, Stroke: "#000000", Points: closeRing(square(10, 10, 20))},
+	}})
+	is.Equal(len(parts), 1)
+	is.Equal(pointsBounds(parts[0].Outline), bounds{MaxX: 30, MaxY: 30})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"math"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+)
+
+// Onshape drawing exports carry the chrome of the drawing sheet along with
+// the geometry: a white rectangle behind the whole page, the border frame
+// with its zone markings and the title block in the bottom right corner.
+// None of it should be cut. There is nothing in the export marking these
+// elements, so they are found by where they are on the page. A part can
+// look just like a border, so the border is only looked for in Onshape
+// exports, or when asked to, and only taken for one with a title block or
+// zone ticks along it.
+
+const (
+	// chromeTolerance is how close, as a fraction of the page size, shapes
+	// must be to line up with the page or each other
+	chromeTolerance = .005
+	// borderMinSpan is the fraction of the page a line must span to be
+	// part of the border frame
+	borderMinSpan = .8
+	// borderMaxInset is how far, as a fraction of the page, the border can
+	// be from the edge of the page
+	borderMaxInset = .05
+	// titleBlockMaxWidth and titleBlockMaxHeight limit the size of a title
+	// block, as a fraction of the inside of the border
+	titleBlockMaxWidth  = .6
+	titleBlockMaxHeight = .4
+)
+
+// onshapeChrome finds the drawing sheet chrome among the shapes of a
+// document and what each part of it is. page is the viewBox of the
+// document. The background is a filled rectangle covering the page. When
+// border is set, the border is made of rectangles and long straight lines
+// near the edges of the page, everything between it and the edge of the
+// page goes with it. The title block is the box of lines in the bottom
+// right corner of the border, everything inside it goes too. Without a
+// title block or zone ticks, short lines between the border and the edge
+// of the page, the lines are left alone.
+func onshapeChrome(shapes []docShape, page bounds, border bool) map[*xmltree.Element]string {
+	tol := chromeTolerance * math.Max(page.width(), page.height())
+
+	remove := map[*xmltree.Element]string{}
+	var frame []docShape
+	for _, s := range shapes {
+		if s.bounds.isEmpty() {
+			continue
+		}
+		spansX := s.bounds.width() >= borderMinSpan*page.width()
+		spansY := s.bounds.height() >= borderMinSpan*page.height()
+		insetX, insetY := borderMaxInset*page.width(), borderMaxInset*page.height()
+		switch {
+		case s.filled && s.closed && s.bounds.contains(page, tol):
+			remove[s.el] = "background"
+		case !border:
+		case s.rectangular(tol) && s.bounds.contains(bounds{
+			MinX: page.MinX + insetX, MinY: page.MinY + insetY, MaxX: page.MaxX - insetX, MaxY: page.MaxY - insetY,
+		}, 0):
+			remove[s.el] = "border"
+			frame = append(frame, s)
+		case s.straight(tol) && (spansX || spansY) && nearPageEdge(s.bounds, page):
+			remove[s.el] = "border"
+			frame = append(frame, s)
+		}
+	}
+
+	if len(frame) == 0 {
+		return remove
+	}
+	inside := innerFrame(frame, page)
+	// shapes touching the frame from outside, like zone ticks, are outside
+	// too
+	shrunk := bounds{MinX: inside.MinX + tol, MinY: inside.MinY + tol, MaxX: inside.MaxX - tol, MaxY: inside.MaxY - tol}
+	var outside []docShape
+	ticks := false
+	for _, s := range shapes {
+		if _, ok := remove[s.el]; !ok && !s.bounds.isEmpty() && !s.bounds.overlaps(shrunk) {
+			outside = append(outside, s)
+			if s.straight(tol) && s.bounds.width() < borderMinSpan*page.width() && s.bounds.height() < borderMinSpan*page.height() {
+				ticks = true
+			}
+		}
+	}
+	block, hasBlock := titleBlock(shapes, inside, tol)
+	if !ticks && !hasBlock {
+		// a rectangle on its own is as likely the outline of a part
+		for _, s := range frame {
+			delete(remove, s.el)
+		}
+		return remove
+	}
+	for _, s := range outside {
+		remove[s.el] = "border"
+	}
+	if hasBlock {
+		for _, s := range shapes {
+			if _, ok := remove[s.el]; !ok && !s.bounds.isEmpty() && block.contains(s.bounds, tol) {
+				remove[s.el] = "title block"
+			}
+		}
+	}
+	return remove
+}
+
+// onshapeExport reports if the document was written by Onshape, which
+// exports drawings as SVG Tiny 1.2
+func onshapeExport(root *xmltree.Element) bool {
+	return root.Attr("", "version") == "1.2" && root.Attr("", "baseProfile") == "tiny"
+}
+
+// nearPageEdge reports if a line is close to one of the edges of the page
+func nearPageEdge(b bounds, page bounds) bool {
+	insetX, insetY := borderMaxInset*page.width(), borderMaxInset*page.height()
+	if b.width() > b.height() {
+		return b.MinY-page.MinY <= insetY || page.MaxY-b.MaxY <= insetY
+	}
+	return b.MinX-page.MinX <= insetX || page.MaxX-b.MaxX <= insetX
+}
+
+// innerFrame is the area inside the innermost of the border lines
+func innerFrame(frame []docShape, page bounds) bounds {
+	inside := page
+	center := page.center()
+	for _, s := range frame {
+		b := s.bounds
+		if s.closed {
+			inside = bounds{
+				MinX: math.Max(inside.MinX, b.MinX), MinY: math.Max(inside.MinY, b.MinY),
+				MaxX: math.Min(inside.MaxX, b.MaxX), MaxY: math.Min(inside.MaxY, b.MaxY),
+			}
+			continue
+		}
+		switch {
+		case b.width() > b.height() && b.MaxY < center[1]:
+			inside.MinY = math.Max(inside.MinY, b.MaxY)
+		case b.width() > b.height():
+			inside.MaxY = math.Min(inside.MaxY, b.MinY)
+		case b.MaxX < center[0]:
+			inside.MinX = math.Max(inside.MinX, b.MaxX)
+		default:
+			inside.MaxX = math.Min(inside.MaxX, b.MinX)
+		}
+	}
+	return inside
+}
+
+// titleBlock finds the box in the bottom right corner of the frame. Its
+// top edge is a horizontal line running to the right side of the frame
+// and its left edge a vertical line running to the bottom, from the same
+// corner. The biggest such box that is not too big to be a title block is
+// returned.
+func titleBlock(shapes []docShape, frame bounds, tol float64) (bounds, bool) {
+	var tops, lefts []bounds
+	for _, s := range shapes {
+		if !s.straight(tol) || !frame.contains(s.bounds, tol) {
+			continue
+		}
+		b := s.bounds
+		if b.width() > b.height() && math.Abs(b.MaxX-frame.MaxX) <= tol {
+			tops = append(tops, b)
+		}
+		if b.height() > b.width() && math.Abs(b.MaxY-frame.MaxY) <= tol {
+			lefts = append(lefts, b)
+		}
+	}
+
+	var best bounds
+	found := false
+	for _, top := range tops {
+		for _, left := range lefts {
+			if math.Abs(top.MinX-left.MinX) > tol || math.Abs(top.MinY-left.MinY) > tol {
+				continue
+			}
+			block := bounds{MinX: top.MinX, MinY: top.MinY, MaxX: frame.MaxX, MaxY: frame.MaxY}
+			if block.width() > titleBlockMaxWidth*frame.width() || block.height() > titleBlockMaxHeight*frame.height() {
+				continue
+			}
+			if !found || block.width()*block.height() > best.width()*best.height() {
+				best, found = block, true
+			}
+		}
+	}
+	return best, found
+}
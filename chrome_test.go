@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+	"github.com/matryer/is"
+)
+
+// onshapeSheet is laid out like an Onshape drawing on a 1000x800 page with
+// a double border, zone ticks, a title block and one part
+const onshapeSheet = `<svg width="100mm" height="80mm" viewBox="0 0 1000 800" version="1.2" baseProfile="tiny" xmlns="http://www.w3.org/2000/svg">
+<g fill="none" stroke="black">
+<g fill="#ffffff" stroke="none" transform="matrix(1,0,0,1,0,0)"><rect x="0" y="0" width="1000" height="800"/></g>
+<g fill="none" stroke="#000000" transform="matrix(1,0,0,1,0,0)">
+<polyline points="10,10 990,10 990,790 10,790 10,10"/>
+<polyline id="top" points="20,20 980,20"/>
+<polyline id="right" points="980,20 980,780"/>
+<polyline id="bottom" points="980,780 20,780"/>
+<polyline id="left" points="20,780 20,20"/>
+<polyline id="tick" points="500,10 500,20"/>
+<polyline id="block-top" points="600,650 980,650"/>
+<polyline id="block-left" points="600,650 600,780"/>
+<polyline id="block-row" points="600,700 980,700"/>
+<polyline id="block-text" points="620,720 640,740 660,720"/>
+<text x="700" y="760">PART NAME</text>
+<polyline id="part" points="100,100 300,100 300,300 100,300 100,100"/>
+<polyline id="part-line" points="100,400 900,400"/>
+</g>
+</g>
+</svg>`
+
+func TestCleanOnshapeExport(t *testing.T) {
+	is := is.New(t)
+	root, err := xmltree.Parse([]byte(onshapeSheet))
+	is.NoErr(err)
+
+	removed := cleanup(root, bounds{MaxX: 1000, MaxY: 800}, CleanOptions{KeepAnnotations: true})
+	kinds := map[string]int{}
+	for _, r := range removed {
+		kinds[r.Kind]++
+	}
+	is.Equal(kinds["background"], 1)
+	is.Equal(kinds["border"], 1+4+1) // the outer frame, the inner frame and the tick
+	is.Equal(kinds["title block"], 5)
+
+	out := root.String()
+	is.True(strings.Contains(out, `id="part"`))
+	is.True(strings.Contains(out, `id="part-line"`))
+	for _, id := range []string{"top", "tick", "block-top", "block-text"} {
+		is.True(!strings.Contains(out, `id="`+id+`"`))
+	}
+	is.True(!strings.Contains(out, "<rect"))
+	is.True(!strings.Contains(out, "PART NAME"))
+}
+
+func TestCleanKeepsPartFillingPage(t *testing.T) {
+	is := is.New(t)
+	const part = `<svg width="100mm" height="50mm" viewBox="0 0 100 50"%s xmlns="http://www.w3.org/2000/svg">
+<rect id="outline" x="0.5" y="0.5" width="99" height="49" fill="none" stroke="black"/>
+<circle id="hole" cx="20" cy="25" r="5" fill="none" stroke="black"/>
+</svg>`
+	for _, attrs := range []string{"", ` version="1.2" baseProfile="tiny"`} {
+		for _, opts := range []CleanOptions{defaultCleanOptions, {StripBorder: true}} {
+			root, err := xmltree.Parse([]byte(fmt.Sprintf(part, attrs)))
+			is.NoErr(err)
+			// a rectangle without a title block or zone ticks is a part
+			is.Equal(len(cleanup(root, bounds{MaxX: 100, MaxY: 50}, opts)), 0)
+			is.True(strings.Contains(root.String(), `id="outline"`))
+			is.True(strings.Contains(root.String(), `id="hole"`))
+		}
+	}
+
+	// the same sheet with a title block is only stripped when asked to,
+	// it is not an Onshape export
+	sheet := strings.Replace(onshapeSheet, ` version="1.2" baseProfile="tiny"`, "", 1)
+	root, err := xmltree.Parse([]byte(sheet))
+	is.NoErr(err)
+	is.Equal(len(cleanup(root, bounds{MaxX: 1000, MaxY: 800}, CleanOptions{KeepAnnotations: true})), 1)
+	root, err = xmltree.Parse([]byte(sheet))
+	is.NoErr(err)
+	is.Equal(len(cleanup(root, bounds{MaxX: 1000, MaxY: 800}, CleanOptions{KeepAnnotations: true, StripBorder: true})), 12)
+}
+
+func TestCleanOnshapeExportEmptyGroup(t *testing.T) {
+	is := is.New(t)
+	root, err := xmltree.Parse([]byte(`<svg viewBox="0 0 100 100"><g fill="white"><rect width="100" height="100"/></g><polyline points="10,10 20,20"/></svg>`))
+	is.NoErr(err)
+	is.Equal(len(cleanup(root, bounds{MaxX: 100, MaxY: 100}, defaultCleanOptions)), 1)
+	// the group is written without the rect it held
+	is.True(!strings.Contains(root.String(), "rect"))
+}
+
+func TestFixStokeRemovesChrome(t *testing.T) {
+	is := is.New(t)
+	file, err := ioutil.ReadFile("./samples/Circles for Cutting Drawing 1 Copy 1.svg")
+	is.NoErr(err)
+
+	out := bytes.Buffer{}
+	is.NoErr(fixStoke(bytes.NewReader(file), &out, defaultStrokeOptions, CleanOptions{KeepAnnotations: true}))
+	is.True(!strings.Contains(out.String(), "<rect"))
+	is.Equal(strings.Count(out.String(), "<polyline"), strings.Count(string(file), "<polyline"))
+}
+
+func TestParseTransformAttr(t *testing.T) {
+	tests := []struct {
+		transform string
+		want      [2]float64
+	}{
+		{"", [2]float64{1, 2}},
+		{"matrix(1,0,0,1,10,20)", [2]float64{11, 22}},
+		{"translate(5) scale(2)", [2]float64{7, 4}},
+		{"scale(2,3)", [2]float64{2, 6}},
+		{"rotate(90)", [2]float64{-2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transform, func(t *testing.T) {
+			is := is.New(t)
+			got := parseTransformAttr(tt.transform).apply([2]float64{1, 2})
+			is.True(distance(got, tt.want) < 1e-9)
+		})
+	}
+}
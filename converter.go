@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Converter turns a drawing into a file for the laser. Formats are file
+// extensions without the dot, like svg or pdf.
+type Converter interface {
+	// Name is what the converter is chosen by
+	Name() string
+	// Supports reports if the converter converts drawings in the format
+	// from to the format to
+	Supports(from, to string) bool
+	// Version is the version of the program that converts, an error when
+	// it is missing or too old to work
+	Version() (string, error)
+	// Convert writes the drawing in input, in the format from, to out in
+	// the format to. It gives up when ctx is done.
+	Convert(ctx context.Context, input []byte, from, to string, opts ConvertOptions, out io.Writer) error
+}
+
+// ConvertOptions are what every converter does to a drawing on the way
+type ConvertOptions struct {
+	// Name is the file name of the drawing, for messages
+	Name    string
+	Strokes StrokeOptions
+	Clean   CleanOptions
+	// Material and Job are what the drawing is processed for, its kerf
+	// among them
+	Material Material
+	Job      JobOptions
+}
+
+// converters are the converters by name, inkscape and rsvg-convert are
+// found on the path unless SVG2LASER_INKSCAPE_PATH or SVG2LASER_RSVG_PATH
+// say where they are
+var converters = map[string]Converter{
+	"native":   nativeConverter{},
+	"inkscape": newInkscapeConverter(inkscapeBin),
+	"rsvg":     newRSVGConverter(envOr("SVG2LASER_RSVG_PATH", "rsvg-convert")),
+}
+
+func envOr(name, fallback string) string {
+	if v, isSet := os.LookupEnv(name); isSet && v != "" {
+		return v
+	}
+	return fallback
+}
+
+// defaultConverter is the converter named by SVG2LASER_BACKEND, native
+// when it is not set
+func defaultConverter() string {
+	return envOr("SVG2LASER_BACKEND", "native")
+}
+
+func converterNames() []string {
+	var names []string
+	for name := range converters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// drawingFormat is the format of the drawing in the file name, svg for
+// anything loadJob does not have a reader for
+func drawingFormat(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if _, ok := jobReaders[ext]; ok {
+		return strings.TrimPrefix(ext, ".")
+	}
+	return "svg"
+}
+
+// readableFormat reports if drawings in the format can be read
+func readableFormat(format string) bool {
+	return drawingFormat("."+format) == format
+}
+
+// convert writes the drawing in file, named opts.Name, to out in the
+// format to with the converter named backend
+func convert(ctx context.Context, backend string, file []byte, to string, opts ConvertOptions, out io.Writer) error {
+	c, ok := converters[backend]
+	if !ok {
+		return fmt.Errorf("unknown converter '%s', expected one of %s", backend, strings.Join(converterNames(), ", "))
+	}
+	from := drawingFormat(opts.Name)
+	if !c.Supports(from, to) {
+		return fmt.Errorf("the %s converter can not convert %s to %s", c.Name(), from, to)
+	}
+	if _, err := c.Version(); err != nil {
+		return fmt.Errorf("the %s converter is not available - %w", c.Name(), err)
+	}
+	return c.Convert(ctx, file, from, to, opts, out)
+}
+
+// laserSVG is the drawing as an svg document with the strokes drawn for
+// the laser, what the external converters are given. When processing
+// changes the geometry, like the kerf of the material does, the processed
+// job is drawn instead of the drawing. Otherwise the drawing is kept as it
+// is, the converters draw text and images the job does not have.
+func laserSVG(ctx context.Context, input []byte, from string, opts ConvertOptions) ([]byte, error) {
+	name := drawingFile(opts.Name, from)
+	var clean CleanOptions
+	var drawing []byte
+	if opts.Job.reshapes(opts.Material) {
+		job, err := loadJob(ctx, name, input, opts.Material, opts.Clean)
+		if err != nil {
+			return nil, err
+		}
+		job.process(opts.Job)
+		processed := bytes.Buffer{}
+		if err := job.writeSVG(&processed, SVGOptions{}); err != nil {
+			return nil, err
+		}
+		// the job was cleaned when it was loaded
+		drawing, clean = processed.Bytes(), cleanedOptions
+		opts.Strokes.Operations = job.Operations
+	} else {
+		var err error
+		if drawing, clean, err = drawingSVG(ctx, name, input, opts.Clean); err != nil {
+			return nil, err
+		}
+	}
+	out := bytes.Buffer{}
+	if err := fixStoke(bytes.NewReader(drawing), &out, opts.Strokes, clean); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// drawingFile is the file name of a drawing in the format, which is how
+// loadJob tells formats apart
+func drawingFile(name, format string) string {
+	if name == "" {
+		name = "drawing"
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "." + format
+}
+
+// nativeConverter writes pdf and svg files itself
+type nativeConverter struct{}
+
+func (nativeConverter) Name() string {
+	return "native"
+}
+
+func (nativeConverter) Supports(from, to string) bool {
+	return readableFormat(from) && (to == "pdf" || to == "svg")
+}
+
+func (nativeConverter) Version() (string, error) {
+	return "built in", nil
+}
+
+func (nativeConverter) Convert(ctx context.Context, input []byte, from, to string, opts ConvertOptions, out io.Writer) error {
+	if to == "svg" {
+		drawing, err := laserSVG(ctx, input, from, opts)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(drawing)
+		return err
+	}
+	job, err := loadJob(ctx, drawingFile(opts.Name, from), input, opts.Material, opts.Clean)
+	if err != nil {
+		return err
+	}
+	job.process(opts.Job)
+	pdfOpts := defaultPDFOptions
+	pdfOpts.Strokes = opts.Strokes
+	return job.writePDF(out, pdfOpts)
+}
+
+// versionExecOptions limit the run of a program asked for its version
+var versionExecOptions = ExecOptions{Timeout: 10 * time.Second, MaxOutput: 64 << 10}
+
+var versionRegex = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// programConverter converts with another program, which reads the laser
+// ready svg on stdin and writes the converted file on stdout. Its version
+// is probed once, the first time it is asked for.
+type programConverter struct {
+	name    string
+	bin     string
+	formats []string
+	// minMajor is the oldest major version args works with
+	minMajor int
+	args     func(to string) []string
+
+	probe      sync.Once
+	version    string
+	versionErr error
+}
+
+func (c *programConverter) Name() string {
+	return c.name
+}
+
+func (c *programConverter) Supports(from, to string) bool {
+	return readableFormat(from) && containsString(c.formats, to)
+}
+
+func (c *programConverter) Version() (string, error) {
+	c.probe.Do(func() {
+		out := bytes.Buffer{}
+		err := execPipe(context.Background(), c.bin, []string{"--version"}, nil, &out, nil, versionExecOptions)
+		if err != nil {
+			c.versionErr = fmt.Errorf("unable to run %s - %w", c.bin, err)
+			return
+		}
+		m := versionRegex.FindStringSubmatch(out.String())
+		if m == nil {
+			c.versionErr = fmt.Errorf("unable to read the version of %s from '%s'", c.bin, strings.TrimSpace(out.String()))
+			return
+		}
+		c.version = strings.TrimSuffix(strings.Join(m[1:], "."), ".")
+		if major, _ := strconv.Atoi(m[1]); major < c.minMajor {
+			c.versionErr = fmt.Errorf("%s is version %s, %d or newer is needed", c.bin, c.version, c.minMajor)
+		}
+	})
+	return c.version, c.versionErr
+}
+
+func (c *programConverter) Convert(ctx context.Context, input []byte, from, to string, opts ConvertOptions, out io.Writer) error {
+	drawing, err := laserSVG(ctx, input, from, opts)
+	if err != nil {
+		return err
+	}
+	return execPipe(ctx, c.bin, c.args(to), bytes.NewReader(drawing), out, nil, defaultExecOptions)
+}
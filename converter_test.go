@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+)
+
+// fakeProgram writes a shell script standing in for a converter. It
+// prints version for --version and otherwise its args and then stdin.
+func fakeProgram(t *testing.T, version string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake converter is a shell script")
+	}
+	bin := filepath.Join(t.TempDir(), "converter")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"--version\" ]; then echo '" + version + "'; exit 0; fi\n" +
+		"echo \"$@\"\n" +
+		"cat\n"
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+const converterSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="1in" height="1in" viewBox="0 0 96 96"><path d="M10 10 L80 10" stroke="green" stroke-width="4"/></svg>`
+
+func TestProgramConverter(t *testing.T) {
+	is := is.New(t)
+	c := newInkscapeConverter(fakeProgram(t, "Inkscape 1.2.1 (9c6d41e410, 2022-07-14)"))
+	version, err := c.Version()
+	is.NoErr(err)
+	is.Equal(version, "1.2.1")
+
+	is.True(c.Supports("svg", "png"))
+	is.True(c.Supports("dxf", "pdf"))
+	is.True(!c.Supports("svg", "dxf"))
+	is.True(!c.Supports("png", "pdf"))
+
+	out := bytes.Buffer{}
+	is.NoErr(c.Convert(context.Background(), []byte(converterSVG), "svg", "eps", ConvertOptions{Name: "part.svg", Strokes: defaultStrokeOptions}, &out))
+	lines := strings.SplitN(out.String(), "\n", 2)
+	is.Equal(lines[0], "--pipe --export-filename=- --export-type=eps")
+	// the program is given the svg with the strokes drawn for the laser
+	is.True(strings.Contains(lines[1], `stroke-width="0.096"`))
+	is.True(strings.Contains(lines[1], `stroke="#000000"`))
+
+	// the command line changed in inkscape 1.0
+	old := newInkscapeConverter(fakeProgram(t, "Inkscape 0.92.4 (5da689c313, 2019-01-14)"))
+	version, err = old.Version()
+	is.True(err != nil)
+	is.Equal(version, "0.92.4")
+
+	rsvg := newRSVGConverter(fakeProgram(t, "rsvg-convert version 2.54.4"))
+	version, err = rsvg.Version()
+	is.NoErr(err)
+	is.Equal(version, "2.54.4")
+	out.Reset()
+	is.NoErr(rsvg.Convert(context.Background(), []byte(converterSVG), "svg", "pdf", ConvertOptions{Strokes: defaultStrokeOptions}, &out))
+	is.True(strings.HasPrefix(out.String(), "--format=pdf\n"))
+
+	broken := newRSVGConverter(fakeProgram(t, "no version here"))
+	_, err = broken.Version()
+	is.True(err != nil)
+}
+
+func TestConvert(t *testing.T) {
+	is := is.New(t)
+	opts := ConvertOptions{Name: "part.svg", Strokes: defaultStrokeOptions, Job: defaultJobOptions}
+	out := bytes.Buffer{}
+	is.NoErr(convert(context.Background(), "native", []byte(converterSVG), "pdf", opts, &out))
+	is.True(strings.HasPrefix(out.String(), "%PDF-"))
+
+	is.True(convert(context.Background(), "nope", []byte(converterSVG), "pdf", opts, &out) != nil)
+	err := convert(context.Background(), "native", []byte(converterSVG), "png", opts, &out)
+	is.True(err != nil && strings.Contains(err.Error(), "can not convert svg to png"))
+
+	is.Equal(drawingFormat("Part.DXF"), "dxf")
+	is.Equal(drawingFormat("part"), "svg")
+	is.Equal(drawingFile("part.svg", "pdf"), "part.pdf")
+}
+
+// kerfSVG is a 50mm square cut out of a 100mm page
+const kerfSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="100mm" height="100mm" viewBox="0 0 100 100"><rect x="10" y="10" width="50" height="50" fill="none" stroke="#000000"/></svg>`
+
+func TestConvertKerf(t *testing.T) {
+	is := is.New(t)
+	opts := ConvertOptions{Name: "part.svg", Strokes: defaultStrokeOptions, Material: materialPresets["plywood-3mm"], Job: defaultJobOptions}
+
+	// the pdf the laser driver cuts has the square grown by half the kerf
+	out := bytes.Buffer{}
+	is.NoErr(convert(context.Background(), "native", []byte(kerfSVG), "pdf", opts, &out))
+	read, err := loadPDFJob("part.pdf", out.Bytes(), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.Equal(len(read.Segments), 1)
+	b := segmentsBounds(read.Segments)
+	is.True(math.Abs(b.width()-50.15) < 1e-3)
+	is.True(math.Abs(b.MinX-9.925) < 1e-3)
+
+	// and so has the svg other converters are given
+	c := newInkscapeConverter(fakeProgram(t, "Inkscape 1.2.1 (9c6d41e410, 2022-07-14)"))
+	out.Reset()
+	is.NoErr(c.Convert(context.Background(), []byte(kerfSVG), "svg", "pdf", opts, &out))
+	is.True(strings.Contains(out.String(), ` L60.075,60 `))
+	is.True(strings.Contains(out.String(), ` L9.925,10 Z"`))
+
+	// without a kerf the drawing is given as it is
+	opts.Material = materialPresets["none"]
+	out.Reset()
+	is.NoErr(c.Convert(context.Background(), []byte(kerfSVG), "svg", "pdf", opts, &out))
+	is.True(strings.Contains(out.String(), "<rect"))
+}
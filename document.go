@@ -0,0 +1,450 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+)
+
+// CleanOptions controls the passes that strip what should not be cut from
+// a drawing before anything else is done with it
+type CleanOptions struct {
+	// KeepChrome skips removing the Onshape drawing sheet chrome
+	KeepChrome bool
+	// StripBorder looks for the border and title block of a drawing sheet
+	// in drawings that are not Onshape exports too
+	StripBorder bool
+	// KeepAnnotations skips removing dimensions and notes
+	KeepAnnotations bool
+	// Keep lists elements that are never removed and Drop elements that
+	// always are. An entry matches the id, label or class of an element
+	// or of a group it is in. Keep also takes the kind of a removal, like
+	// text or border, to keep everything of that kind.
+	Keep []string
+	Drop []string
+	// Actions are inkscape actions run on the drawing before it is read,
+	// like select-all and object-stroke-to-path, for what only inkscape
+	// turns into paths well
+	Actions []string
+}
+
+var defaultCleanOptions = CleanOptions{}
+
+// cleanDocument runs the clean up passes on a parsed svg document before
+// it is cut, logging what they removed with the given prefix
+func cleanDocument(root *xmltree.Element, attrs SVGAttrs, opts CleanOptions, prefix string) {
+	viewBox, err := parseViewBox(attrs.viewbox)
+	if err != nil {
+		return
+	}
+	if viewBox == nil {
+		widthIn, heightIn, err := attrs.pageSizeIn()
+		if err != nil {
+			return
+		}
+		viewBox = []float64{0, 0, widthIn * defaultPxPerIn, heightIn * defaultPxPerIn}
+	}
+	page := bounds{MinX: viewBox[0], MinY: viewBox[1], MaxX: viewBox[0] + viewBox[2], MaxY: viewBox[1] + viewBox[3]}
+	for _, removed := range cleanup(root, page, opts) {
+		log.Printf("%s - removed %s", prefix, removed)
+	}
+}
+
+// cleanup removes the drawing sheet chrome and the annotations from the
+// document and reports what it removed. page is the viewBox.
+func cleanup(root *xmltree.Element, page bounds, opts CleanOptions) []removedElement {
+	shapes := collectShapes(root, rootStyle)
+
+	remove := map[*xmltree.Element]string{}
+	if !opts.KeepChrome {
+		for el, kind := range onshapeChrome(shapes, page, opts.StripBorder || onshapeExport(root)) {
+			remove[el] = kind
+		}
+	}
+	if !opts.KeepAnnotations {
+		for el, kind := range annotations(shapes, page, remove) {
+			if _, ok := remove[el]; !ok {
+				remove[el] = kind
+			}
+		}
+	}
+
+	var removed []removedElement
+	for _, s := range shapes {
+		kind, ok := remove[s.el]
+		if s.matches(opts.Drop) {
+			kind, ok = "override", true
+		}
+		if !ok || s.matches(opts.Keep) || containsString(opts.Keep, kind) {
+			delete(remove, s.el)
+			continue
+		}
+		remove[s.el] = kind
+		removed = append(removed, removedElement{Kind: kind, Element: s.el.Name.Local, Bounds: s.bounds})
+	}
+	removeElements(root, remove)
+	return removed
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// removedElement is an element removed by cleanup
+type removedElement struct {
+	Kind    string // what the element was taken for, like border or text
+	Element string // name of the svg element
+	Bounds  bounds // in user units of the document
+}
+
+func (r removedElement) String() string {
+	return fmt.Sprintf("%s <%s> at (%.1f, %.1f) %.1fx%.1f",
+		r.Kind, r.Element, r.Bounds.MinX, r.Bounds.MinY, r.Bounds.width(), r.Bounds.height())
+}
+
+// docShape is a drawable element with its outline and the style it is
+// drawn with, in the user units of the document. The outline of elements
+// elementOutline can not follow is empty.
+type docShape struct {
+	el          *xmltree.Element
+	ancestors   []*xmltree.Element
+	points      [][2]float64
+	bounds      bounds
+	closed      bool
+	filled      bool
+	stroked     bool
+	strokeWidth float64
+	dashed      bool
+	// dashDot is drawn with dashes of more than one length, the way centre
+	// lines are
+	dashDot bool
+}
+
+// matches reports if an entry of list is the id, label or class of the
+// element or of one of its groups
+func (s docShape) matches(list []string) bool {
+	if len(list) == 0 {
+		return false
+	}
+	for _, el := range append([]*xmltree.Element{s.el}, s.ancestors...) {
+		names := append(strings.Fields(el.Attr("", "class")), el.Attr("", "id"), el.Attr("", "label"))
+		for _, name := range names {
+			if name != "" && containsString(list, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// straight reports if the shape is a single horizontal or vertical line
+func (s docShape) straight(tol float64) bool {
+	return !s.closed && len(s.points) >= 2 && (s.bounds.width() <= tol || s.bounds.height() <= tol)
+}
+
+// straightLine reports if the shape is a single line in any direction,
+// every point lies within tol of the line between its ends
+func (s docShape) straightLine(tol float64) bool {
+	if s.closed || len(s.points) < 2 {
+		return false
+	}
+	a, b := s.points[0], s.points[len(s.points)-1]
+	d := distance(a, b)
+	if d == 0 {
+		return false
+	}
+	for _, p := range s.points {
+		if math.Abs(cross(sub(b, a), sub(p, a)))/d > tol {
+			return false
+		}
+	}
+	return true
+}
+
+// rectangular reports if the shape is an axis aligned rectangle
+func (s docShape) rectangular(tol float64) bool {
+	ring := openRing(s.points)
+	if !s.closed || len(ring) != 4 {
+		return false
+	}
+	for _, p := range ring {
+		onX := math.Abs(p[0]-s.bounds.MinX) <= tol || math.Abs(p[0]-s.bounds.MaxX) <= tol
+		onY := math.Abs(p[1]-s.bounds.MinY) <= tol || math.Abs(p[1]-s.bounds.MaxY) <= tol
+		if !onX || !onY {
+			return false
+		}
+	}
+	return true
+}
+
+// removeElements drops the elements in remove from the tree
+func removeElements(el *xmltree.Element, remove map[*xmltree.Element]string) {
+	kept := el.Children[:0]
+	dropped := false
+	for i := range el.Children {
+		child := &el.Children[i]
+		if _, ok := remove[child]; ok {
+			dropped = true
+			continue
+		}
+		removeElements(child, remove)
+		kept = append(kept, *child)
+	}
+	el.Children = kept
+	// an element without children is written out from its raw content,
+	// which still has the removed elements in it
+	if dropped && len(kept) == 0 {
+		el.Content = nil
+	}
+}
+
+// matrix is an svg transform matrix a b c d e f
+type matrix [6]float64
+
+var identityMatrix = matrix{1, 0, 0, 1, 0, 0}
+
+func (m matrix) apply(p [2]float64) [2]float64 {
+	return [2]float64{m[0]*p[0] + m[2]*p[1] + m[4], m[1]*p[0] + m[3]*p[1] + m[5]}
+}
+
+// then is m followed by n
+func (m matrix) then(n matrix) matrix {
+	return matrix{
+		n[0]*m[0] + n[2]*m[1], n[1]*m[0] + n[3]*m[1],
+		n[0]*m[2] + n[2]*m[3], n[1]*m[2] + n[3]*m[3],
+		n[0]*m[4] + n[2]*m[5] + n[4], n[1]*m[4] + n[3]*m[5] + n[5],
+	}
+}
+
+// invert is the matrix that undoes m, if m can be undone
+func (m matrix) invert() (matrix, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return matrix{}, false
+	}
+	return matrix{
+		m[3] / det, -m[1] / det,
+		-m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det,
+	}, true
+}
+
+var transformRegex = regexp.MustCompile(`(matrix|translate|scale|rotate)\s*\(([^)]*)\)`)
+var numberRegex = regexp.MustCompile(`[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`)
+
+func parseNumbers(s string) []float64 {
+	var numbers []float64
+	for _, n := range numberRegex.FindAllString(s, -1) {
+		v, err := strconv.ParseFloat(n, 64)
+		if err == nil {
+			numbers = append(numbers, v)
+		}
+	}
+	return numbers
+}
+
+// parseTransformAttr reads a transform attribute, transforms it does not
+// know are ignored
+func parseTransformAttr(transform string) matrix {
+	m := identityMatrix
+	for _, t := range transformRegex.FindAllStringSubmatch(transform, -1) {
+		args := parseNumbers(t[2])
+		next := identityMatrix
+		switch {
+		case t[1] == "matrix" && len(args) == 6:
+			copy(next[:], args)
+		case t[1] == "translate" && len(args) >= 1:
+			next[4] = args[0]
+			if len(args) > 1 {
+				next[5] = args[1]
+			}
+		case t[1] == "scale" && len(args) >= 1:
+			next[0], next[3] = args[0], args[0]
+			if len(args) > 1 {
+				next[3] = args[1]
+			}
+		case t[1] == "rotate" && len(args) >= 1:
+			s, c := math.Sincos(args[0] * math.Pi / 180)
+			next = matrix{c, s, -s, c, 0, 0}
+			if len(args) == 3 {
+				next = matrix{1, 0, 0, 1, -args[1], -args[2]}.then(next).then(matrix{1, 0, 0, 1, args[1], args[2]})
+			}
+		}
+		// the transforms of a list apply right to left
+		m = next.then(m)
+	}
+	return m
+}
+
+// paintAttr is the value of a presentation attribute of el, from its
+// style attribute or the attribute itself
+func paintAttr(el *xmltree.Element, name string) string {
+	for _, decl := range strings.Split(el.Attr("", "style"), ";") {
+		kv := strings.SplitN(decl, ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == name {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return el.Attr("", name)
+}
+
+// docStyle is the state inherited down the document tree
+type docStyle struct {
+	m           matrix
+	fill        string
+	stroke      string
+	strokeWidth float64
+	dashed      bool
+	dashDot     bool
+	ancestors   []*xmltree.Element
+}
+
+// rootStyle holds the initial values of the svg presentation attributes
+var rootStyle = docStyle{m: identityMatrix, fill: "black", stroke: "none", strokeWidth: 1}
+
+// drawable are the elements collectShapes reports
+var drawable = map[string]bool{
+	"rect": true, "line": true, "polyline": true, "polygon": true, "path": true,
+	"circle": true, "ellipse": true, "text": true,
+}
+
+// collectShapes walks the tree, collecting the drawable elements with
+// their outlines and style. Elements in defs are not drawn.
+func collectShapes(el *xmltree.Element, style docStyle) []docShape {
+	switch el.Name.Local {
+	case "defs", "clipPath", "mask", "symbol", "marker", "pattern":
+		return nil
+	}
+
+	style.m = parseTransformAttr(el.Attr("", "transform")).then(style.m)
+	if fill := paintAttr(el, "fill"); fill != "" {
+		style.fill = fill
+	}
+	if stroke := paintAttr(el, "stroke"); stroke != "" {
+		style.stroke = stroke
+	}
+	if width := parseNumbers(paintAttr(el, "stroke-width")); len(width) > 0 {
+		// a stroke width is in the units of the element using it, so it
+		// is kept in the units of the document
+		style.strokeWidth = width[0] * math.Sqrt(math.Abs(style.m[0]*style.m[3]-style.m[1]*style.m[2]))
+	}
+	if dash := paintAttr(el, "stroke-dasharray"); dash != "" {
+		style.dashed, style.dashDot = dash != "none", dashDot(parseNumbers(dash))
+	}
+
+	var shapes []docShape
+	if drawable[el.Name.Local] {
+		s := docShape{
+			el:          el,
+			ancestors:   style.ancestors,
+			bounds:      emptyBounds(),
+			filled:      normalizeColor(style.fill) != "none",
+			stroked:     normalizeColor(style.stroke) != "none",
+			strokeWidth: style.strokeWidth,
+			dashed:      style.dashed,
+			dashDot:     style.dashDot,
+		}
+		if points, closed, ok := elementOutline(el); ok {
+			for _, p := range points {
+				s.points = append(s.points, style.m.apply(p))
+			}
+			s.bounds = pointsBounds(s.points)
+			s.closed = closed
+		}
+		shapes = append(shapes, s)
+	}
+
+	style.ancestors = append([]*xmltree.Element{el}, style.ancestors...)
+	for i := range el.Children {
+		shapes = append(shapes, collectShapes(&el.Children[i], style)...)
+	}
+	return shapes
+}
+
+// dashDot reports if a dash array has dashes of more than one length. An
+// odd number of values is repeated to make an even number.
+func dashDot(dashes []float64) bool {
+	if len(dashes)%2 == 1 {
+		dashes = append(dashes, dashes...)
+	}
+	for i := 2; i < len(dashes); i += 2 {
+		if dashes[i] != dashes[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// simplePathRegex matches path data made of absolute moves and lines only
+var simplePathRegex = regexp.MustCompile(`^[MLZ\d\s,.eE+-]*$`)
+
+// elementOutline returns the points of the outline of el, before its
+// transform. Curves are not followed so only what chrome is made of, lines
+// and rectangles, is read. Text is a single point where it starts.
+func elementOutline(el *xmltree.Element) ([][2]float64, bool, bool) {
+	attr := func(name string) float64 {
+		v := parseNumbers(el.Attr("", name))
+		if len(v) == 0 {
+			return 0
+		}
+		return v[0]
+	}
+	pairs := func(numbers []float64) [][2]float64 {
+		var points [][2]float64
+		for i := 0; i+1 < len(numbers); i += 2 {
+			points = append(points, [2]float64{numbers[i], numbers[i+1]})
+		}
+		return points
+	}
+
+	switch el.Name.Local {
+	case "rect":
+		x, y, w, h := attr("x"), attr("y"), attr("width"), attr("height")
+		return closeRing([][2]float64{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}), true, true
+	case "line":
+		return [][2]float64{{attr("x1"), attr("y1")}, {attr("x2"), attr("y2")}}, false, true
+	case "polyline", "polygon":
+		points := pairs(parseNumbers(el.Attr("", "points")))
+		closed := el.Name.Local == "polygon"
+		if n := len(points); n > 2 && points[0] == points[n-1] {
+			closed = true
+		}
+		if closed && len(points) > 0 && points[0] != points[len(points)-1] {
+			points = closeRing(points)
+		}
+		return points, closed, len(points) > 0
+	case "path":
+		d := el.Attr("", "d")
+		if !simplePathRegex.MatchString(d) {
+			return nil, false, false
+		}
+		points := pairs(parseNumbers(d))
+		closed := strings.Contains(d, "Z")
+		if closed && len(points) > 0 && points[0] != points[len(points)-1] {
+			points = closeRing(points)
+		}
+		return points, closed, len(points) > 0
+	case "circle", "ellipse":
+		rx, ry := attr("r"), attr("r")
+		if el.Name.Local == "ellipse" {
+			rx, ry = attr("rx"), attr("ry")
+		}
+		cx, cy := attr("cx"), attr("cy")
+		return [][2]float64{{cx - rx, cy - ry}, {cx + rx, cy + ry}}, true, true
+	case "text":
+		return [][2]float64{{attr("x"), attr("y")}}, false, true
+	}
+	return nil, false, false
+}
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// A DXF file is a list of group codes, each followed by its value on the
+// next line. Code 0 starts a new section, table entry or entity, the codes
+// after it up to the next 0 are its properties. Drawings are in the units
+// of $INSUNITS with the y axis up.
+
+// dxfMaxDepth limits how deep blocks are inserted in each other, so a
+// block inserting itself does not run forever
+const dxfMaxDepth = 16
+
+// dxfUnitsMm is the size in millimetres of the $INSUNITS units
+var dxfUnitsMm = map[int]float64{
+	1:  MILIMETERS_PER_INCH,
+	2:  12 * MILIMETERS_PER_INCH,
+	3:  63360 * MILIMETERS_PER_INCH,
+	4:  1,
+	5:  10,
+	6:  1000,
+	7:  1e6,
+	8:  MILIMETERS_PER_INCH / 1e6,
+	9:  MILIMETERS_PER_INCH / 1e3,
+	10: 36 * MILIMETERS_PER_INCH,
+	11: 1e-7,
+	12: 1e-6,
+	13: 1e-3,
+	14: 100,
+	15: 1e4,
+	16: 1e5,
+	17: 1e12,
+	18: 1.495978707e14,
+	19: 9.4607304725808e18,
+	20: 3.0856775814914e19,
+}
+
+// dxfColors are the first colours of the AutoCAD colour index. 7 is
+// white on a dark screen and black on paper. Other indexes are cut.
+var dxfColors = map[int]string{
+	1: "#ff0000",
+	2: "#ffff00",
+	3: "#00ff00",
+	4: "#00ffff",
+	5: "#0000ff",
+	6: "#ff00ff",
+	7: "#000000",
+	8: "#808080",
+	9: "#c0c0c0",
+}
+
+// dxfPair is a group code and its value
+type dxfPair struct {
+	code  int
+	value string
+}
+
+// dxfEntity is an entity with its properties. A POLYLINE holds the VERTEX
+// entities following it.
+type dxfEntity struct {
+	kind     string
+	pairs    []dxfPair
+	vertices []dxfEntity
+}
+
+func (e dxfEntity) str(code int) string {
+	for _, p := range e.pairs {
+		if p.code == code {
+			return p.value
+		}
+	}
+	return ""
+}
+
+// float is the value of the code, or def when the entity does not have it
+func (e dxfEntity) float(code int, def float64) float64 {
+	v, err := strconv.ParseFloat(e.str(code), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func (e dxfEntity) int(code int, def int) int {
+	return int(e.float(code, float64(def)))
+}
+
+// floats are the values of every occurrence of the code
+func (e dxfEntity) floats(code int) []float64 {
+	var values []float64
+	for _, p := range e.pairs {
+		if p.code == code {
+			v, _ := strconv.ParseFloat(p.value, 64)
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// points are the points of every occurrence of the x code, with y from
+// the code 10 after it
+func (e dxfEntity) points(code int) [][2]float64 {
+	var points [][2]float64
+	for _, p := range e.pairs {
+		v, _ := strconv.ParseFloat(p.value, 64)
+		switch {
+		case p.code == code:
+			points = append(points, [2]float64{v, 0})
+		case p.code == code+10 && len(points) > 0:
+			points[len(points)-1][1] = v
+		}
+	}
+	return points
+}
+
+func (e dxfEntity) point(code int) [2]float64 {
+	return [2]float64{e.float(code, 0), e.float(code+10, 0)}
+}
+
+type dxfLayer struct {
+	color  string
+	hidden bool
+}
+
+type dxfBlock struct {
+	base     [2]float64
+	entities []dxfEntity
+}
+
+// dxfDrawing is the content of a DXF file that is drawn
+type dxfDrawing struct {
+	unitsMm  float64
+	layers   map[string]dxfLayer
+	blocks   map[string]dxfBlock
+	entities []dxfEntity
+}
+
+// readDXFPairs reads the group codes and values of an ASCII DXF file
+func readDXFPairs(data []byte) ([]dxfPair, error) {
+	if bytes.HasPrefix(data, []byte("AutoCAD Binary DXF")) {
+		return nil, fmt.Errorf("binary DXF is not supported, export it as ASCII")
+	}
+	var pairs []dxfPair
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		code, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: expected a group code, got '%s'", line, strings.TrimSpace(scanner.Text()))
+		}
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("line %d: group code %d has no value", line, code)
+		}
+		line++
+		pairs = append(pairs, dxfPair{code: code, value: strings.TrimSpace(scanner.Text())})
+	}
+	return pairs, scanner.Err()
+}
+
+// parseDXF reads the header, layers, blocks and entities of a DXF file
+func parseDXF(data []byte) (*dxfDrawing, error) {
+	pairs, err := readDXFPairs(data)
+	if err != nil {
+		return nil, err
+	}
+	d := &dxfDrawing{unitsMm: 1, layers: map[string]dxfLayer{}, blocks: map[string]dxfBlock{}}
+	insUnits, measurement := 0, 1
+
+	for i := 0; i < len(pairs); i++ {
+		if pairs[i] != (dxfPair{0, "SECTION"}) || i+1 >= len(pairs) {
+			continue
+		}
+		section := pairs[i+1].value
+		i += 2
+		var entities []dxfEntity
+		entities, i = readDXFEntities(pairs, i)
+		switch section {
+		case "HEADER":
+			// the header is a single run of variables, code 9 names
+			// the variable the values after it belong to
+			if len(entities) == 0 {
+				break
+			}
+			name := ""
+			for _, p := range entities[0].pairs {
+				switch {
+				case p.code == 9:
+					name = p.value
+				case name == "$INSUNITS" && p.code == 70:
+					insUnits, _ = strconv.Atoi(p.value)
+				case name == "$MEASUREMENT" && p.code == 70:
+					measurement, _ = strconv.Atoi(p.value)
+				}
+			}
+		case "TABLES":
+			for _, e := range entities {
+				if e.kind != "LAYER" {
+					continue
+				}
+				color := e.int(62, 7)
+				d.layers[e.str(2)] = dxfLayer{
+					color:  dxfColor(e, color),
+					hidden: color < 0 || e.int(70, 0)&1 != 0,
+				}
+			}
+		case "BLOCKS":
+			name := ""
+			for _, e := range entities {
+				switch e.kind {
+				case "BLOCK":
+					name = e.str(2)
+					d.blocks[name] = dxfBlock{base: e.point(10)}
+				case "ENDBLK":
+					name = ""
+				default:
+					if block, ok := d.blocks[name]; ok {
+						block.entities = append(block.entities, e)
+						d.blocks[name] = block
+					}
+				}
+			}
+		case "ENTITIES":
+			d.entities = entities
+		}
+	}
+
+	if mm, ok := dxfUnitsMm[insUnits]; ok {
+		d.unitsMm = mm
+	} else if measurement == 0 {
+		// unitless imperial drawings are in inches
+		d.unitsMm = MILIMETERS_PER_INCH
+	}
+	return d, nil
+}
+
+// readDXFEntities reads entities from pairs[i] up to the end of the
+// section and returns where the section ends. The vertices of a POLYLINE
+// are gathered into it. A header is read as one entity without a kind.
+func readDXFEntities(pairs []dxfPair, i int) ([]dxfEntity, int) {
+	var entities []dxfEntity
+	for ; i < len(pairs) && pairs[i] != (dxfPair{0, "ENDSEC"}); i++ {
+		p := pairs[i]
+		switch {
+		case p.code == 0:
+			entities = append(entities, dxfEntity{kind: p.value})
+		case len(entities) == 0:
+			entities = append(entities, dxfEntity{pairs: []dxfPair{p}})
+		default:
+			last := &entities[len(entities)-1]
+			last.pairs = append(last.pairs, p)
+		}
+	}
+
+	var grouped []dxfEntity
+	polyline := -1
+	for _, e := range entities {
+		switch {
+		case e.kind == "VERTEX" && polyline >= 0:
+			grouped[polyline].vertices = append(grouped[polyline].vertices, e)
+			continue
+		case e.kind == "SEQEND":
+			polyline = -1
+			continue
+		case e.kind == "POLYLINE":
+			polyline = len(grouped)
+		}
+		grouped = append(grouped, e)
+	}
+	return grouped, i
+}
+
+// dxfColor is the colour of an entity or layer with the colour index
+// color, its true colour wins when it has one
+func dxfColor(e dxfEntity, color int) string {
+	if rgb := e.str(420); rgb != "" {
+		if v, err := strconv.Atoi(rgb); err == nil {
+			return fmt.Sprintf("#%06x", v&0xffffff)
+		}
+	}
+	if color < 0 {
+		color = -color
+	}
+	if c, ok := dxfColors[color]; ok {
+		return c
+	}
+	return dxfColors[7]
+}
+
+// dxfContext is what the entities of a block inherit from the INSERT
+// drawing it
+type dxfContext struct {
+	m     matrix
+	layer string
+	color string
+	depth int
+}
+
+// segments flattens the entities into segments in millimetres, still with
+// the y axis up. Curves stay within tolerance millimetres of the true
+// curve. Entities on hidden layers or in paper space, text and dimensions
+// are left out.
+func (d *dxfDrawing) segments(tolerance float64) []svg.Segment {
+	var segments []svg.Segment
+	element := 0
+	top := dxfContext{m: matrix{d.unitsMm, 0, 0, d.unitsMm, 0, 0}, layer: "0", color: dxfColors[7]}
+	d.addEntities(&segments, &element, d.entities, top, tolerance)
+	return segments
+}
+
+func (d *dxfDrawing) addEntities(segments *[]svg.Segment, element *int, entities []dxfEntity, ctx dxfContext, tolerance float64) {
+	for _, e := range entities {
+		if e.int(67, 0) == 1 || e.int(60, 0) == 1 {
+			continue
+		}
+		// entities on layer 0 of a block and in colour BYBLOCK take the
+		// layer and colour of the insert
+		layer := e.str(8)
+		if layer == "" || layer == "0" && ctx.depth > 0 {
+			layer = ctx.layer
+		}
+		if d.layers[layer].hidden {
+			continue
+		}
+		color := ctx.color
+		switch index := e.int(62, 256); {
+		case e.str(420) != "":
+			color = dxfColor(e, index)
+		case index == 256:
+			if l, ok := d.layers[layer]; ok {
+				color = l.color
+			}
+		case index != 0:
+			color = dxfColor(e, index)
+		}
+
+		m := ctx.m
+		// entities drawn from below are mirrored
+		if e.float(230, 1) < 0 {
+			m = matrix{-1, 0, 0, 1, 0, 0}.then(m)
+		}
+
+		if e.kind == "INSERT" {
+			block, ok := d.blocks[e.str(2)]
+			if !ok || ctx.depth >= dxfMaxDepth {
+				continue
+			}
+			cols, rows := e.int(70, 1), e.int(71, 1)
+			if cols < 1 {
+				cols = 1
+			}
+			if rows < 1 {
+				rows = 1
+			}
+			sx, sy := e.float(41, 1), e.float(42, 1)
+			angle := e.float(50, 0) * math.Pi / 180
+			rotation := matrix{math.Cos(angle), math.Sin(angle), -math.Sin(angle), math.Cos(angle), 0, 0}
+			for r := 0; r < rows; r++ {
+				for c := 0; c < cols; c++ {
+					at := e.point(10)
+					offset := [2]float64{float64(c) * e.float(44, 0), float64(r) * e.float(45, 0)}
+					inner := matrix{1, 0, 0, 1, -block.base[0], -block.base[1]}.
+						then(matrix{sx, 0, 0, sy, 0, 0}).
+						then(matrix{1, 0, 0, 1, offset[0], offset[1]}).
+						then(rotation).
+						then(matrix{1, 0, 0, 1, at[0], at[1]}).
+						then(m)
+					d.addEntities(segments, element, block.entities, dxfContext{m: inner, layer: layer, color: color, depth: ctx.depth + 1}, tolerance)
+				}
+			}
+			continue
+		}
+
+		scale := math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+		paths, closed := dxfEntityPaths(e, tolerance/scale)
+		if len(paths) == 0 {
+			continue
+		}
+		for _, path := range paths {
+			points := make([][2]float64, len(path))
+			for i, p := range path {
+				points[i] = m.apply(p)
+			}
+			if n := len(points); closed && n > 2 {
+				// full circles end where they start give or take rounding
+				if distance(points[0], points[n-1]) < 1e-9 {
+					points = points[:n-1]
+				}
+				points = closeRing(points)
+			}
+			*segments = append(*segments, svg.Segment{
+				Closed:  closed && len(points) > 2,
+				Points:  points,
+				Stroke:  color,
+				Layer:   layer,
+				Element: *element,
+			})
+		}
+		*element++
+	}
+}
+
+// dxfEntityPaths is the outline of an entity as polylines in its own
+// units and if they are closed. Entities that are not lines are skipped.
+func dxfEntityPaths(e dxfEntity, tolerance float64) ([][][2]float64, bool) {
+	switch e.kind {
+	case "LINE":
+		return [][][2]float64{{e.point(10), e.point(11)}}, false
+	case "CIRCLE":
+		return [][][2]float64{arcAngles(e.point(10), e.float(40, 0), 0, 2*math.Pi, tolerance)}, true
+	case "ARC":
+		start, end := e.float(50, 0)*math.Pi/180, e.float(51, 360)*math.Pi/180
+		return [][][2]float64{arcAngles(e.point(10), e.float(40, 0), start, positiveSweep(end-start), tolerance)}, false
+	case "ELLIPSE":
+		return dxfEllipse(e, tolerance)
+	case "LWPOLYLINE":
+		var bulges []float64
+		points := e.points(10)
+		// a bulge belongs to the vertex before it
+		n := -1
+		for _, p := range e.pairs {
+			switch p.code {
+			case 10:
+				n++
+				bulges = append(bulges, 0)
+			case 42:
+				if n >= 0 {
+					bulges[n], _ = strconv.ParseFloat(p.value, 64)
+				}
+			}
+		}
+		closed := e.int(70, 0)&1 != 0
+		return [][][2]float64{bulgePath(points, bulges, closed, tolerance)}, closed
+	case "POLYLINE":
+		// polygon meshes and polyface meshes are surfaces
+		if e.int(70, 0)&(16|64) != 0 {
+			return nil, false
+		}
+		var points [][2]float64
+		var bulges []float64
+		for _, v := range e.vertices {
+			// frame control points of a spline fit polyline are not on it
+			if v.int(70, 0)&16 != 0 {
+				continue
+			}
+			points = append(points, v.point(10))
+			bulges = append(bulges, v.float(42, 0))
+		}
+		closed := e.int(70, 0)&1 != 0
+		return [][][2]float64{bulgePath(points, bulges, closed, tolerance)}, closed
+	case "SPLINE":
+		return dxfSpline(e, tolerance)
+	}
+	return nil, false
+}
+
+// positiveSweep turns a sweep into one between 0 and a full turn
+func positiveSweep(sweep float64) float64 {
+	for sweep <= 0 {
+		sweep += 2 * math.Pi
+	}
+	for sweep > 2*math.Pi {
+		sweep -= 2 * math.Pi
+	}
+	return sweep
+}
+
+// arcAngles is the arc around center from the angle start, turning counter
+// clockwise by sweep
+func arcAngles(center [2]float64, radius, start, sweep, tolerance float64) [][2]float64 {
+	steps := arcSteps(radius, sweep, tolerance)
+	points := make([][2]float64, 0, steps+1)
+	for i := 0; i <= steps; i++ {
+		angle := start + sweep*float64(i)/float64(steps)
+		points = append(points, [2]float64{center[0] + radius*math.Cos(angle), center[1] + radius*math.Sin(angle)})
+	}
+	return points
+}
+
+// bulgePath follows polyline vertices, the bulge of a vertex curves the
+// line to the next one into an arc. The bulge is the tangent of a quarter
+// of the angle of the arc, negative when it turns clockwise.
+func bulgePath(points [][2]float64, bulges []float64, closed bool, tolerance float64) [][2]float64 {
+	if len(points) == 0 {
+		return nil
+	}
+	path := [][2]float64{points[0]}
+	n := len(points) - 1
+	if closed {
+		n = len(points)
+	}
+	for i := 0; i < n; i++ {
+		a, b := points[i], points[(i+1)%len(points)]
+		bulge := bulges[i]
+		chord := distance(a, b)
+		if bulge == 0 || chord == 0 {
+			path = append(path, b)
+			continue
+		}
+		center, radius, _ := bulgeArc(a, b, bulge)
+		path = append(path, arcPoints(center, a, b, radius, bulge < 0, tolerance)[1:]...)
+	}
+	return path
+}
+
+// bulgeArc is the centre, radius and signed sweep of the arc from a to b
+// with the given bulge. The centre is on the left of the chord for a
+// counter clockwise arc, at a distance given by the bulge.
+func bulgeArc(a, b [2]float64, bulge float64) ([2]float64, float64, float64) {
+	chord := distance(a, b)
+	u := mul(sub(b, a), 1/chord)
+	left := [2]float64{-u[1], u[0]}
+	center := add(lerp(a, b, .5), mul(left, chord/2*(1-bulge*bulge)/(2*bulge)))
+	return center, chord * (1 + bulge*bulge) / (4 * math.Abs(bulge)), 4 * math.Atan(bulge)
+}
+
+// dxfEllipse is the outline of an ELLIPSE. Its major axis is given from
+// the centre, the minor axis is ratio as long at right angles to it, and
+// it runs between two parameters of the ellipse.
+func dxfEllipse(e dxfEntity, tolerance float64) ([][][2]float64, bool) {
+	center, major := e.point(10), e.point(11)
+	minor := mul([2]float64{-major[1], major[0]}, e.float(40, 1))
+	start, end := e.float(41, 0), e.float(42, 2*math.Pi)
+	sweep := positiveSweep(end - start)
+	closed := math.Abs(sweep-2*math.Pi) < 1e-9
+	steps := arcSteps(length(major), sweep, tolerance)
+	var points [][2]float64
+	for i := 0; i <= steps; i++ {
+		t := start + sweep*float64(i)/float64(steps)
+		points = append(points, add(center, add(mul(major, math.Cos(t)), mul(minor, math.Sin(t)))))
+	}
+	return [][][2]float64{points}, closed
+}
+
+// dxfSpline is the outline of a SPLINE, a NURBS curve given by its degree,
+// knots, control points and their weights. A spline given only by the
+// points it passes through is drawn through them with straight lines.
+func dxfSpline(e dxfEntity, tolerance float64) ([][][2]float64, bool) {
+	closed := e.int(70, 0)&1 != 0
+	degree := e.int(71, 3)
+	control := e.points(10)
+	if len(control) == 0 {
+		return [][][2]float64{e.points(11)}, closed
+	}
+	if degree < 1 || len(control) <= degree {
+		return [][][2]float64{control}, closed
+	}
+	knots := e.floats(40)
+	if len(knots) != len(control)+degree+1 {
+		// a clamped uniform knot vector
+		knots = make([]float64, len(control)+degree+1)
+		for i := range knots {
+			knots[i] = math.Min(math.Max(float64(i-degree), 0), float64(len(control)-degree))
+		}
+	}
+	weights := e.floats(41)
+	if len(weights) != len(control) {
+		weights = make([]float64, len(control))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+
+	// every span is split into as many lines as the control polygon it
+	// follows needs at the tolerance of a gentle curve
+	var points [][2]float64
+	for span := degree; span < len(control); span++ {
+		t0, t1 := knots[span], knots[span+1]
+		if t1 <= t0 {
+			continue
+		}
+		var polygon float64
+		for i := span - degree; i < span; i++ {
+			polygon += distance(control[i], control[i+1])
+		}
+		steps := int(math.Max(4, math.Ceil(math.Sqrt(polygon/math.Max(tolerance, 1e-9)))))
+		for i := 0; i <= steps; i++ {
+			if i == 0 && len(points) > 0 {
+				continue
+			}
+			t := t0 + (t1-t0)*float64(i)/float64(steps)
+			points = append(points, deBoor(span, t, degree, knots, control, weights))
+		}
+	}
+	return [][][2]float64{points}, closed
+}
+
+// deBoor evaluates a NURBS curve at t, in the knot span starting at
+// knots[span]
+func deBoor(span int, t float64, degree int, knots []float64, control [][2]float64, weights []float64) [2]float64 {
+	// the points are weighted, x and y multiplied by their weight
+	d := make([][3]float64, degree+1)
+	for j := range d {
+		i := j + span - degree
+		w := weights[i]
+		d[j] = [3]float64{control[i][0] * w, control[i][1] * w, w}
+	}
+	for r := 1; r <= degree; r++ {
+		for j := degree; j >= r; j-- {
+			i := j + span - degree
+			denominator := knots[i+degree-r+1] - knots[i]
+			alpha := 0.0
+			if denominator != 0 {
+				alpha = (t - knots[i]) / denominator
+			}
+			for k := range d[j] {
+				d[j][k] = (1-alpha)*d[j-1][k] + alpha*d[j][k]
+			}
+		}
+	}
+	p := d[degree]
+	if p[2] == 0 {
+		return [2]float64{p[0], p[1]}
+	}
+	return [2]float64{p[0] / p[2], p[1] / p[2]}
+}
+
+// loadDXFJob reads a DXF drawing into a job. The drawing is moved so the
+// top left corner of its geometry is at the origin, with the y axis down
+// like svg. Layers listed in clean.Drop are left out. The separate lines
+// CAD programs export for every edge are joined back into contours.
+func loadDXFJob(name string, file []byte, material Material, clean CleanOptions) (*Job, error) {
+	d, err := parseDXF(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse dxf - %w", err)
+	}
+	for _, layer := range clean.Drop {
+		d.layers[layer] = dxfLayer{color: d.layers[layer].color, hidden: true}
+	}
+	segments := d.segments(defaultOffsetOptions.Tolerance)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("%s has no geometry to cut", name)
+	}
+	b := segmentsBounds(segments)
+	transformSegments(segments, func(p [2]float64) [2]float64 {
+		return [2]float64{p[0] - b.MinX, b.MaxY - p[1]}
+	})
+
+	return &Job{
+		Name:       name,
+		WidthMm:    b.width(),
+		HeightMm:   b.height(),
+		Material:   material,
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments:   joinSegments(segments, joinTolerance),
+	}, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+)
+
+// dxfFile writes group codes and values, one per line, like a DXF file
+func dxfFile(pairs ...string) []byte {
+	return []byte(strings.Join(pairs, "\r\n") + "\r\n")
+}
+
+// dxfSection wraps entities in a section
+func dxfSection(name string, pairs ...string) []string {
+	return append(append([]string{"0", "SECTION", "2", name}, pairs...), "0", "ENDSEC")
+}
+
+func TestParseDXF(t *testing.T) {
+	is := is.New(t)
+	var pairs []string
+	pairs = append(pairs, dxfSection("HEADER", "9", "$INSUNITS", "70", "1")...)
+	pairs = append(pairs, dxfSection("TABLES",
+		"0", "TABLE", "2", "LAYER",
+		"0", "LAYER", "2", "score", "70", "0", "62", "5",
+		"0", "LAYER", "2", "hidden", "70", "0", "62", "-7",
+		"0", "ENDTAB")...)
+	pairs = append(pairs, dxfSection("BLOCKS",
+		"0", "BLOCK", "2", "square", "10", "1", "20", "1",
+		"0", "LWPOLYLINE", "8", "0", "90", "4", "70", "1",
+		"10", "1", "20", "1", "10", "2", "20", "1", "10", "2", "20", "2", "10", "1", "20", "2",
+		"0", "ENDBLK")...)
+	pairs = append(pairs, dxfSection("ENTITIES",
+		"0", "LINE", "8", "0", "10", "0", "20", "0", "11", "1", "21", "0",
+		"0", "CIRCLE", "8", "score", "10", "5", "20", "5", "40", "1",
+		"0", "ARC", "8", "0", "10", "0", "20", "0", "40", "1", "50", "0", "51", "90",
+		"0", "LINE", "8", "hidden", "10", "0", "20", "0", "11", "1", "21", "1",
+		"0", "TEXT", "8", "0", "10", "0", "20", "0", "1", "NOTE",
+		"0", "INSERT", "8", "parts", "2", "square", "10", "10", "20", "0", "41", "2", "42", "2",
+		"0", "POLYLINE", "8", "0", "70", "1",
+		"0", "VERTEX", "10", "0", "20", "0", "42", "1",
+		"0", "VERTEX", "10", "2", "20", "0", "42", "1",
+		"0", "SEQEND",
+		"0", "ELLIPSE", "8", "0", "10", "0", "20", "0", "11", "2", "21", "0", "40", ".5", "41", "0", "42", "6.283185307179586",
+		"0", "SPLINE", "8", "0", "70", "8", "71", "2", "72", "6", "73", "3",
+		"40", "0", "40", "0", "40", "0", "40", "1", "40", "1", "40", "1",
+		"10", "0", "20", "0", "10", "1", "20", "2", "10", "2", "20", "0")...)
+	pairs = append(pairs, "0", "EOF")
+
+	d, err := parseDXF(dxfFile(pairs...))
+	is.NoErr(err)
+	is.Equal(d.unitsMm, MILIMETERS_PER_INCH)
+	is.True(d.layers["hidden"].hidden)
+	is.Equal(len(d.blocks["square"].entities), 1)
+
+	segments := d.segments(.01)
+	is.Equal(len(segments), 7) // not the hidden line or the text
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+	line := segments[0]
+	is.True(near(line.Points[1][0], 25.4))
+	is.Equal(line.Stroke, "#000000")
+
+	circle := segments[1]
+	is.True(circle.Closed)
+	is.Equal(circle.Layer, "score")
+	is.Equal(circle.Stroke, "#0000ff") // from the layer
+	b := pointsBounds(circle.Points)
+	is.True(math.Abs(b.width()-2*25.4) < .011 && math.Abs(b.center()[0]-5*25.4) < .011)
+
+	arc := segments[2]
+	is.True(near(arc.Points[0][0], 25.4) && near(arc.Points[len(arc.Points)-1][1], 25.4))
+
+	// the block is scaled around its base point and put at the insert
+	square := segments[3]
+	is.True(square.Closed)
+	is.Equal(square.Layer, "parts") // layer 0 in a block takes the layer of the insert
+	b = pointsBounds(square.Points)
+	is.True(near(b.MinX, 10*25.4) && near(b.MinY, 0) && near(b.width(), 2*25.4))
+
+	// two half circles bulging out make a circle around (1, 0)
+	polyline := segments[4]
+	is.True(polyline.Closed)
+	for _, p := range polyline.Points {
+		is.True(math.Abs(distance(p, [2]float64{25.4, 0})-25.4) < .011)
+	}
+
+	ellipse := segments[5]
+	is.True(ellipse.Closed)
+	b = pointsBounds(ellipse.Points)
+	is.True(math.Abs(b.width()-4*25.4) < .011 && math.Abs(b.height()-2*25.4) < .011)
+
+	// a quadratic bezier from (0,0) through the control point (1,2) to (2,0)
+	spline := segments[6]
+	first, last := spline.Points[0], spline.Points[len(spline.Points)-1]
+	is.True(near(first[0], 0) && near(last[0], 2*25.4))
+	is.True(math.Abs(pointsBounds(spline.Points).height()-25.4) < .011)
+}
+
+func TestReadDXFPairsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"binary", "AutoCAD Binary DXF\r\n\x1a\x00"},
+		{"not a code", "  0\nSECTION\nLINE\n"},
+		{"missing value", "  0\nSECTION\n  2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			_, err := readDXFPairs([]byte(tt.file))
+			is.True(err != nil)
+		})
+	}
+}
+
+func TestLoadDXFJobOnshape(t *testing.T) {
+	is := is.New(t)
+	file, err := ioutil.ReadFile("./samples/Top Drawer Drawing 1.dxf")
+	is.NoErr(err)
+
+	job, err := loadJob(context.Background(), "Top Drawer Drawing 1.dxf", file, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	// the drawing is in inches, the lines of every edge join up into
+	// closed contours and the view label is left out
+	is.True(job.WidthMm > 500 && job.WidthMm < 600)
+	is.True(len(job.Segments) > 0)
+	for _, s := range job.Segments {
+		is.True(s.Closed)
+		is.Equal(s.Layer, "Visible")
+	}
+	b := segmentsBounds(job.Segments)
+	is.True(math.Abs(b.MinX) < 1e-9 && math.Abs(b.MinY) < 1e-9)
+}
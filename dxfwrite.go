@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// arcFitTolerance is how far, in millimetres, the points of a segment may
+// be from an arc and still be written as one. It is a little more than
+// the tolerance curves are flattened to.
+const arcFitTolerance = 2 * .01
+
+// dxfUnit is a unit a DXF file can be written in
+type dxfUnit struct {
+	insUnits int
+	mm       float64
+}
+
+// dxfUnits are the units writeDXF takes, by name
+var dxfUnits = map[string]dxfUnit{
+	"mm": {insUnits: 4, mm: 1},
+	"in": {insUnits: 1, mm: MILIMETERS_PER_INCH},
+}
+
+// dxfVertex is a vertex of a polyline. The bulge curves the line to the
+// next vertex into an arc, it is the tangent of a quarter of the angle the
+// arc turns through, positive counter clockwise.
+type dxfVertex struct {
+	p     [2]float64
+	bulge float64
+}
+
+// dxfWriter writes group codes and their values
+type dxfWriter struct {
+	*bufio.Writer
+}
+
+func (w dxfWriter) pair(code int, value string) {
+	fmt.Fprintf(w, "%3d\n%s\n", code, value)
+}
+
+func (w dxfWriter) float(code int, v float64) {
+	w.pair(code, formatDXF(v))
+}
+
+func (w dxfWriter) point(code int, p [2]float64) {
+	w.float(code, p[0])
+	w.float(code+10, p[1])
+}
+
+// writeDXF writes the job as an R12 DXF file in units, mm or in, which
+// every CAD and laser program reads. The y axis points up in DXF, so the
+// drawing is flipped over with the bottom of the page at 0. Segments go
+// on their own layers in the closest colour of the AutoCAD colour index,
+// in the order they are in the job. Straight lines are written as LINE,
+// circles as CIRCLE, single arcs as ARC and everything else as POLYLINE,
+// with runs of points along an arc turned back into arcs.
+func (j *Job) writeDXF(w io.Writer, units string) error {
+	unit, ok := dxfUnits[units]
+	if !ok {
+		return fmt.Errorf("unknown dxf units '%s', expected mm or in", units)
+	}
+	toDXF := func(p [2]float64) [2]float64 {
+		return [2]float64{p[0] / unit.mm, (j.HeightMm - p[1]) / unit.mm}
+	}
+
+	var layers []string
+	layerColors := map[string]int{}
+	for _, s := range j.Segments {
+		layer := dxfLayerName(s.Layer)
+		if _, ok := layerColors[layer]; !ok {
+			layers = append(layers, layer)
+			layerColors[layer] = aciColor(s.Stroke)
+		}
+	}
+
+	out := dxfWriter{bufio.NewWriter(w)}
+	out.pair(0, "SECTION")
+	out.pair(2, "HEADER")
+	out.pair(9, "$ACADVER")
+	out.pair(1, "AC1009")
+	out.pair(9, "$INSUNITS")
+	out.pair(70, strconv.Itoa(unit.insUnits))
+	out.pair(9, "$MEASUREMENT")
+	if units == "in" {
+		out.pair(70, "0")
+	} else {
+		out.pair(70, "1")
+	}
+	out.pair(9, "$EXTMIN")
+	out.point(10, [2]float64{0, 0})
+	out.pair(9, "$EXTMAX")
+	out.point(10, [2]float64{j.WidthMm / unit.mm, j.HeightMm / unit.mm})
+	out.pair(0, "ENDSEC")
+
+	out.pair(0, "SECTION")
+	out.pair(2, "TABLES")
+	out.pair(0, "TABLE")
+	out.pair(2, "LTYPE")
+	out.pair(70, "1")
+	out.pair(0, "LTYPE")
+	out.pair(2, "CONTINUOUS")
+	out.pair(70, "0")
+	out.pair(3, "Solid line")
+	out.pair(72, "65")
+	out.pair(73, "0")
+	out.float(40, 0)
+	out.pair(0, "ENDTAB")
+	out.pair(0, "TABLE")
+	out.pair(2, "LAYER")
+	out.pair(70, strconv.Itoa(len(layers)))
+	for _, layer := range layers {
+		out.pair(0, "LAYER")
+		out.pair(2, layer)
+		out.pair(70, "0")
+		out.pair(62, strconv.Itoa(layerColors[layer]))
+		out.pair(6, "CONTINUOUS")
+	}
+	out.pair(0, "ENDTAB")
+	out.pair(0, "ENDSEC")
+
+	out.pair(0, "SECTION")
+	out.pair(2, "ENTITIES")
+	for _, s := range j.Segments {
+		if len(s.Points) < 2 {
+			continue
+		}
+		points := make([][2]float64, len(s.Points))
+		for i, p := range s.Points {
+			points[i] = toDXF(p)
+		}
+		out.writeSegment(s, points, layerColors, arcFitTolerance/unit.mm)
+	}
+	out.pair(0, "ENDSEC")
+	out.pair(0, "EOF")
+	return out.Flush()
+}
+
+// writeSegment writes the segment s with its points in the units and
+// orientation of the file
+func (w dxfWriter) writeSegment(s svg.Segment, points [][2]float64, layerColors map[string]int, tolerance float64) {
+	layer := dxfLayerName(s.Layer)
+	header := func(kind string) {
+		w.pair(0, kind)
+		w.pair(8, layer)
+		if color := aciColor(s.Stroke); color != layerColors[layer] {
+			w.pair(62, strconv.Itoa(color))
+		}
+	}
+
+	closed := s.Closed && len(openRing(points)) > 2
+	if closed {
+		points = closeRing(openRing(points))
+	}
+	if !closed && len(points) == 2 {
+		header("LINE")
+		w.point(10, points[0])
+		w.point(11, points[1])
+		return
+	}
+
+	if closed {
+		if center, radius, ok := fitCircle(openRing(points), tolerance); ok {
+			header("CIRCLE")
+			w.point(10, center)
+			w.float(40, radius)
+			return
+		}
+	}
+
+	vertices := fitArcs(points, tolerance)
+	switch {
+	case !closed && len(vertices) == 2 && vertices[0].bulge != 0:
+		center, radius, sweep := bulgeArc(vertices[0].p, vertices[1].p, vertices[0].bulge)
+		from, to := vertices[0].p, vertices[1].p
+		if sweep < 0 {
+			from, to = to, from
+		}
+		header("ARC")
+		w.point(10, center)
+		w.float(40, radius)
+		w.float(50, math.Atan2(from[1]-center[1], from[0]-center[0])*180/math.Pi)
+		w.float(51, math.Atan2(to[1]-center[1], to[0]-center[0])*180/math.Pi)
+	default:
+		if closed {
+			// the closing vertex is implied by the closed flag
+			vertices = vertices[:len(vertices)-1]
+		}
+		header("POLYLINE")
+		w.pair(66, "1")
+		w.point(10, [2]float64{0, 0})
+		if closed {
+			w.pair(70, "1")
+		} else {
+			w.pair(70, "0")
+		}
+		for _, v := range vertices {
+			w.pair(0, "VERTEX")
+			w.pair(8, layer)
+			w.point(10, v.p)
+			if v.bulge != 0 {
+				w.float(42, v.bulge)
+			}
+		}
+		w.pair(0, "SEQEND")
+		w.pair(8, layer)
+	}
+}
+
+// fitArcs turns the points of a polyline into vertices, replacing every
+// run of at least four points that lies on an arc with a single bulged
+// vertex. A run is only an arc when every point and every line between
+// them stays within tolerance of it and it keeps turning the same way, so
+// the corners of a regular polygon are left alone.
+func fitArcs(points [][2]float64, tolerance float64) []dxfVertex {
+	var vertices []dxfVertex
+	for i := 0; i < len(points); {
+		end, bulge := i, 0.0
+		for j := i + 3; j < len(points); j++ {
+			b, ok := arcThrough(points[i:j+1], tolerance)
+			if !ok {
+				break
+			}
+			end, bulge = j, b
+		}
+		if end == i {
+			vertices = append(vertices, dxfVertex{p: points[i]})
+			i++
+			continue
+		}
+		vertices = append(vertices, dxfVertex{p: points[i], bulge: bulge})
+		i = end
+		if i == len(points)-1 {
+			vertices = append(vertices, dxfVertex{p: points[i]})
+			break
+		}
+	}
+	return vertices
+}
+
+// arcThrough returns the bulge of the arc run lies on, if it does
+func arcThrough(run [][2]float64, tolerance float64) (float64, bool) {
+	a, m, b := run[0], run[len(run)/2], run[len(run)-1]
+	center, ok := circleCenter(a, m, b)
+	if !ok {
+		return 0, false
+	}
+	radius := distance(center, m)
+	sweep := 0.0
+	for k, p := range run {
+		if math.Abs(distance(center, p)-radius) > tolerance {
+			return 0, false
+		}
+		if k == 0 {
+			continue
+		}
+		q := run[k-1]
+		turn := math.Atan2(cross(sub(q, center), sub(p, center)), dot(sub(q, center), sub(p, center)))
+		chord := distance(q, p)
+		if turn == 0 || sweep != 0 && (turn > 0) != (sweep > 0) || chord > 2*radius ||
+			radius-math.Sqrt(radius*radius-chord*chord/4) > tolerance {
+			return 0, false
+		}
+		sweep += turn
+	}
+	// the bulge of a full turn is infinite
+	if math.Abs(sweep) > 2*math.Pi-1e-6 {
+		return 0, false
+	}
+	return math.Tan(sweep / 4), true
+}
+
+// fitCircle returns the circle a closed ring of at least eight points lies
+// on, if it does
+func fitCircle(ring [][2]float64, tolerance float64) ([2]float64, float64, bool) {
+	n := len(ring)
+	if n < 8 {
+		return [2]float64{}, 0, false
+	}
+	center, ok := circleCenter(ring[0], ring[n/3], ring[2*n/3])
+	if !ok {
+		return [2]float64{}, 0, false
+	}
+	radius := distance(center, ring[0])
+	for k, p := range ring {
+		chord := distance(p, ring[(k+1)%n])
+		if math.Abs(distance(center, p)-radius) > tolerance || chord > 2*radius ||
+			radius-math.Sqrt(radius*radius-chord*chord/4) > tolerance {
+			return [2]float64{}, 0, false
+		}
+	}
+	return center, radius, true
+}
+
+// circleCenter is the centre of the circle through three points, which
+// must not lie on a line
+func circleCenter(a, b, c [2]float64) ([2]float64, bool) {
+	d := 2 * cross(sub(b, a), sub(c, a))
+	if math.Abs(d) < 1e-12 {
+		return [2]float64{}, false
+	}
+	ab, ac := sub(b, a), sub(c, a)
+	lab, lac := dot(ab, ab), dot(ac, ac)
+	center := [2]float64{
+		a[0] + (ac[1]*lab-ab[1]*lac)/d,
+		a[1] + (ab[0]*lac-ac[0]*lab)/d,
+	}
+	return center, true
+}
+
+// formatDXF writes a number with no more digits than it needs
+func formatDXF(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 6, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// dxfLayerName is a layer name that is allowed in a DXF file, segments
+// with no layer go on layer 0
+func dxfLayerName(layer string) string {
+	layer = strings.TrimSpace(layer)
+	if layer == "" {
+		return "0"
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("<>/\\\":;?*|=`", r) {
+			return '_'
+		}
+		return r
+	}, layer)
+}
+
+// aciColor is the index of the colour in the AutoCAD colour index closest
+// to stroke. Strokes that are not a colour are 7, black on paper.
+func aciColor(stroke string) int {
+	rgb, ok := parseHexColor(normalizeColor(stroke))
+	if !ok {
+		return 7
+	}
+	best, bestDist := 7, math.Inf(1)
+	for index := 1; index <= len(dxfColors); index++ {
+		c, _ := parseHexColor(dxfColors[index])
+		d := 0.0
+		for i := range c {
+			d += (c[i] - rgb[i]) * (c[i] - rgb[i])
+		}
+		if d < bestDist {
+			best, bestDist = index, d
+		}
+	}
+	return best
+}
+
+// parseHexColor reads a #rrggbb colour
+func parseHexColor(color string) ([3]float64, bool) {
+	var rgb [3]float64
+	if len(color) != 7 || color[0] != '#' {
+		return rgb, false
+	}
+	for i := range rgb {
+		v, err := strconv.ParseUint(color[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return rgb, false
+		}
+		rgb[i] = float64(v)
+	}
+	return rgb, true
+}
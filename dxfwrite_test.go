@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestWriteDXF(t *testing.T) {
+	is := is.New(t)
+	arc := arcPoints([2]float64{50, 50}, [2]float64{60, 50}, [2]float64{50, 60}, 10, false, .01)
+	job := &Job{
+		Name:     "parts",
+		WidthMm:  100,
+		HeightMm: 100,
+		Segments: []svg.Segment{
+			{Closed: true, Stroke: "#000000", Layer: "outside", Points: closeRing(square(10, 10, 30))},
+			{Closed: true, Stroke: "#0000ff", Layer: "holes", Points: closeRing(circleRing(70, 30, 5, 64))},
+			{Stroke: "#ff0000", Layer: "outside", Points: [][2]float64{{0, 90}, {20, 90}}},
+			{Stroke: "#000000", Points: arc},
+		},
+	}
+
+	for _, units := range []string{"mm", "in"} {
+		t.Run(units, func(t *testing.T) {
+			is := is.New(t)
+			out := bytes.Buffer{}
+			is.NoErr(job.writeDXF(&out, units))
+
+			d, err := parseDXF(out.Bytes())
+			is.NoErr(err)
+			is.Equal(d.unitsMm, dxfUnits[units].mm)
+			is.Equal(d.layers["outside"].color, "#000000")
+			is.Equal(d.layers["holes"].color, "#0000ff")
+			kinds := map[string]int{}
+			for _, e := range d.entities {
+				kinds[e.kind]++
+			}
+			is.Equal(kinds, map[string]int{"POLYLINE": 1, "CIRCLE": 1, "LINE": 1, "ARC": 1})
+
+			segments := d.segments(.01)
+			is.Equal(len(segments), 4)
+			// the square is flipped back to the same place
+			b := pointsBounds(segments[0].Points)
+			is.True(math.Abs(b.MinX-10) < 1e-4 && math.Abs(b.MinY-60) < 1e-4 && math.Abs(b.width()-30) < 1e-4)
+			is.True(segments[0].Closed)
+
+			circle := segments[1]
+			is.Equal(circle.Layer, "holes")
+			for _, p := range circle.Points {
+				is.True(math.Abs(distance(p, [2]float64{70, 70})-5) < .01)
+			}
+
+			// the red line keeps its colour on a black layer
+			is.Equal(segments[2].Stroke, "#ff0000")
+			is.Equal(segments[3].Layer, "0")
+			for _, p := range segments[3].Points {
+				is.True(math.Abs(distance(p, [2]float64{50, 50})-10) < .02)
+			}
+		})
+	}
+
+	is.True(job.writeDXF(&bytes.Buffer{}, "ft") != nil)
+}
+
+func TestFitArcs(t *testing.T) {
+	tests := []struct {
+		name       string
+		points     [][2]float64
+		wantN      int
+		wantBulges int
+	}{
+		{name: "hexagon stays a polygon", points: closeRing(circleRing(0, 0, 10, 6)), wantN: 7},
+		{name: "rounded corner", points: append(append([][2]float64{{0, -20}},
+			arcPoints([2]float64{0, 0}, [2]float64{10, 0}, [2]float64{0, 10}, 10, false, .01)...), [2]float64{-20, 10}), wantN: 4, wantBulges: 1},
+		{name: "straight line", points: [][2]float64{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}, wantN: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			vertices := fitArcs(tt.points, arcFitTolerance)
+			is.Equal(len(vertices), tt.wantN)
+			bulges := 0
+			for _, v := range vertices {
+				if v.bulge != 0 {
+					bulges++
+				}
+			}
+			is.Equal(bulges, tt.wantBulges)
+		})
+	}
+}
+
+func TestDXFNames(t *testing.T) {
+	is := is.New(t)
+	is.Equal(dxfLayerName(""), "0")
+	is.Equal(dxfLayerName("cut/inside"), "cut_inside")
+	is.Equal(aciColor("blue"), 5)
+	is.Equal(aciColor("#fe0101"), 1)
+	is.Equal(aciColor("none"), 7)
+	is.Equal(formatDXF(-0.0000001), "0")
+	is.Equal(formatDXF(12.5), "12.5")
+	is.True(!strings.Contains(formatDXF(1e20), "e"))
+}
@@ -122,7 +122,7 @@ func generate_prn(
 	fmt.Print(HPGL_START)
 	fmt.Print(HPGL_PEN_UP)
 	fmt.Print(PCL_RESET)
-	fmt.Print(PJL_FOOTER)
+	fmt.Printf("%s", PJL_FOOTER)
 
 	fmt.Print(strings.Repeat(" ", 4092))
 	fmt.Print("Mini]\n")
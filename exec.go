@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExecOptions limit a program run by execPipe
+type ExecOptions struct {
+	// Timeout is how long the program may run, 0 leaves it to the context
+	Timeout time.Duration
+	// MaxOutput is how many bytes the program may write to stdout, 0 for
+	// no limit
+	MaxOutput int64
+}
+
+var defaultExecOptions = ExecOptions{
+	Timeout:   2 * time.Minute,
+	MaxOutput: 256 << 20,
+}
+
+// maxStderr is how much of what a program writes to stderr is kept for
+// its ExecError, the start of it, which is where the cause usually is
+const maxStderr = 64 << 10
+
+// errOutputTooLarge is the cause of an ExecError of a program that wrote
+// more than ExecOptions.MaxOutput
+var errOutputTooLarge = errors.New("output is larger than the limit")
+
+// ExecError is a program run by execPipe that failed
+type ExecError struct {
+	Bin  string
+	Args []string
+	// ExitCode is the exit code of the program, -1 when it did not exit by
+	// itself or never started
+	ExitCode int
+	// Stderr is the start of what the program wrote to stderr
+	Stderr string
+	// Err is the cause, like the exit status or context.DeadlineExceeded
+	Err error
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("%s %s - %s", e.Bin, strings.Join(e.Args, " "), e.Err)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// execPipe runs bin with args, feeding it stdin and copying what it writes
+// to stdout. The three streams are copied at the same time, so a program
+// that writes before it has read all of its input does not block. stderr
+// may be nil, what the program writes there is kept for the error anyway.
+// The program is killed when ctx is done, when it runs longer than
+// opts.Timeout or writes more than opts.MaxOutput. Any failure, an exit
+// code other than 0 included, is an *ExecError.
+func execPipe(ctx context.Context, bin string, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer, opts ExecOptions) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	ctx, kill := context.WithCancel(ctx)
+	defer kill()
+
+	out := &limitWriter{w: stdout, limit: opts.MaxOutput, exceeded: kill}
+	errOut := &headBuffer{max: maxStderr}
+	var errDest io.Writer = errOut
+	if stderr != nil {
+		errDest = io.MultiWriter(errOut, stderr)
+	}
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdin = stdin
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return &ExecError{Bin: bin, Args: args, ExitCode: -1, Err: err}
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return &ExecError{Bin: bin, Args: args, ExitCode: -1, Err: err}
+	}
+	if err := cmd.Start(); err != nil {
+		return &ExecError{Bin: bin, Args: args, ExitCode: -1, Err: err}
+	}
+
+	// the output is copied here rather than by cmd, a killed program may
+	// have left children holding the pipes open and Wait would wait for
+	// them
+	var copyErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if _, err := io.Copy(out, stdoutPipe); err != nil {
+			copyErr = err
+			kill()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(errDest, stderrPipe)
+	}()
+	copied := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(copied)
+	}()
+	select {
+	case <-copied:
+	case <-ctx.Done():
+	}
+	// Wait closes the pipes, which ends the copies
+	err = cmd.Wait()
+	<-copied
+	if err == nil {
+		err = copyErr
+	}
+	if err == nil {
+		return nil
+	}
+	execErr := &ExecError{Bin: bin, Args: args, ExitCode: -1, Stderr: errOut.String(), Err: err}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		execErr.ExitCode = exitErr.ExitCode()
+	}
+	switch {
+	case out.over:
+		execErr.Err = errOutputTooLarge
+	case ctx.Err() != nil:
+		// killed, the exit status only says it was by a signal
+		execErr.Err = ctx.Err()
+	}
+	return execErr
+}
+
+// limitWriter passes writes on until more than limit bytes have been
+// written, then calls exceeded and fails. A limit of 0 is no limit.
+type limitWriter struct {
+	w        io.Writer
+	limit    int64
+	written  int64
+	exceeded func()
+	over     bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.written+int64(len(p)) > l.limit {
+		l.over = true
+		l.exceeded()
+		return 0, errOutputTooLarge
+	}
+	l.written += int64(len(p))
+	return l.w.Write(p)
+}
+
+// headBuffer keeps the first max bytes written to it and drops the rest
+type headBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if room := h.max - h.buf.Len(); room > 0 {
+		if len(p) > room {
+			h.buf.Write(p[:room])
+		} else {
+			h.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Reset empties the buffer, so it keeps the first max bytes written from
+// then on
+func (h *headBuffer) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf.Reset()
+}
+
+func (h *headBuffer) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.buf.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/matryer/is"
+)
+
+func TestExecPipe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the programs are shell scripts")
+	}
+	is := is.New(t)
+	sh := func(script string, stdin []byte, opts ExecOptions) (string, error) {
+		out := bytes.Buffer{}
+		err := execPipe(context.Background(), "/bin/sh", []string{"-c", script}, bytes.NewReader(stdin), &out, nil, opts)
+		return out.String(), err
+	}
+
+	// more than fits in the pipes goes every way at once
+	big := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	out, err := sh("head -c 1000000 /dev/zero >&2; cat", big, defaultExecOptions)
+	is.NoErr(err)
+	is.Equal(out, string(big))
+
+	// a failure has the exit code and what went to stderr
+	_, err = sh("echo bad drawing >&2; exit 3", nil, defaultExecOptions)
+	var execErr *ExecError
+	is.True(errors.As(err, &execErr))
+	is.Equal(execErr.ExitCode, 3)
+	is.Equal(execErr.Stderr, "bad drawing\n")
+	is.True(strings.HasSuffix(err.Error(), ": bad drawing"))
+
+	start := time.Now()
+	_, err = sh("sleep 10", nil, ExecOptions{Timeout: 100 * time.Millisecond})
+	is.True(errors.Is(err, context.DeadlineExceeded))
+	is.True(time.Since(start) < 5*time.Second)
+
+	_, err = sh("head -c 100000 /dev/zero", nil, ExecOptions{MaxOutput: 1000})
+	is.True(errors.Is(err, errOutputTooLarge))
+	out, err = sh("head -c 1000 /dev/zero", nil, ExecOptions{MaxOutput: 1000})
+	is.NoErr(err)
+	is.Equal(len(out), 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = execPipe(ctx, "/bin/sh", []string{"-c", "sleep 10"}, nil, &bytes.Buffer{}, nil, defaultExecOptions)
+	is.True(errors.Is(err, context.Canceled))
+
+	err = execPipe(context.Background(), "./no-such-program", nil, nil, &bytes.Buffer{}, nil, defaultExecOptions)
+	is.True(errors.As(err, &execErr))
+	is.Equal(execErr.ExitCode, -1)
+}
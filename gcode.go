@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// GCodeOptions are the settings of the grbl machine a G-code file is for
+type GCodeOptions struct {
+	// MaxPower is the S value of full power, $30 in grbl
+	MaxPower float64
+	// Dynamic runs the laser with M4, its power following the speed so
+	// corners are not burnt, rather than with the constant power of M3.
+	// It needs laser mode, $32=1 in grbl.
+	Dynamic bool
+	// Arcs writes runs of points along an arc as G2 and G3 moves
+	Arcs bool
+	// AirAssist turns the air on with M8 while the job runs
+	AirAssist bool
+}
+
+var defaultGCodeOptions = GCodeOptions{
+	MaxPower: 1000,
+	Dynamic:  true,
+}
+
+// gcodeWriter writes lines of G-code, leaving out the feed rate and power
+// when they are the same as the last ones
+type gcodeWriter struct {
+	*bufio.Writer
+	feed, power float64
+}
+
+func (w *gcodeWriter) line(words ...string) {
+	fmt.Fprintln(w, strings.Join(words, " "))
+}
+
+// cut writes a cutting move, G1, G2 or G3, to p with its extra words
+func (w *gcodeWriter) cut(code string, p [2]float64, feed float64, power float64, extra ...string) {
+	words := append([]string{code, "X" + formatMm(p[0]), "Y" + formatMm(p[1])}, extra...)
+	if power != w.power {
+		words = append(words, "S"+formatMm(power))
+		w.power = power
+	}
+	if feed != w.feed {
+		words = append(words, "F"+formatMm(feed))
+		w.feed = feed
+	}
+	w.line(words...)
+}
+
+// arc writes an arc from a to b around center, counter clockwise when
+// sweep is positive
+func (w *gcodeWriter) arc(a, b, center [2]float64, sweep float64, feed float64, power float64) {
+	code := "G2"
+	if sweep > 0 {
+		code = "G3"
+	}
+	w.cut(code, b, feed, power, "I"+formatMm(center[0]-a[0]), "J"+formatMm(center[1]-a[1]))
+}
+
+// writeGCode writes the job as G-code for a grbl laser. The job should be
+// processed so its segments are in the order they are cut. The origin is
+// the bottom left corner of the page with y up, like grbl machines home.
+// Travel is G0, the laser is off for it in laser mode. Each segment is run
+// as many times as its operation has passes before the next one, so a part
+// is cut free before the head moves on. The speed, power and passes come
+// from the settings of the material of the job.
+func (j *Job) writeGCode(w io.Writer, opts GCodeOptions) error {
+	out := &gcodeWriter{Writer: bufio.NewWriter(w), feed: -1, power: -1}
+	toGCode := func(p [2]float64) [2]float64 {
+		return [2]float64{p[0], j.HeightMm - p[1]}
+	}
+
+	out.line("; " + j.Name)
+	out.line("; material " + j.Material.Name)
+	out.line("G21", "G90", "G17")
+	laserOn := "M3"
+	if opts.Dynamic {
+		laserOn = "M4"
+	}
+	out.line(laserOn, "S0")
+	if opts.AirAssist {
+		out.line("M8")
+	}
+
+	var last *Operation
+	for _, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || len(s.Points) < 2 {
+			continue
+		}
+		settings := j.Material.settings(op.Kind)
+		passes := settings.Passes
+		if passes < 1 {
+			passes = 1
+		}
+		if op != last {
+			out.line(fmt.Sprintf("; %s %s, %s mm/min, %s%% power, %d pass(es)", op.Kind, op.Name,
+				formatMm(settings.SpeedMmPerMin), formatMm(settings.PowerPercent), passes))
+			last = op
+		}
+		power := settings.PowerPercent / 100 * opts.MaxPower
+
+		points := make([][2]float64, len(s.Points))
+		for i, p := range s.Points {
+			points[i] = toGCode(p)
+		}
+		closed := s.Closed && len(openRing(points)) > 2
+		if closed {
+			points = closeRing(openRing(points))
+		}
+		for pass := 0; pass < passes; pass++ {
+			out.line("G0", "X"+formatMm(points[0][0]), "Y"+formatMm(points[0][1]))
+			out.writePath(points, closed, opts.Arcs, settings.SpeedMmPerMin, power)
+		}
+	}
+
+	out.line("S0")
+	if opts.AirAssist {
+		out.line("M9")
+	}
+	out.line("M5")
+	out.line("G0", "X0", "Y0")
+	out.line("M2")
+	return out.Flush()
+}
+
+// writePath writes the cutting moves along points, from the first one on,
+// with arcs for the runs of points along one when arcs is set
+func (w *gcodeWriter) writePath(points [][2]float64, closed bool, arcs bool, feed float64, power float64) {
+	if !arcs {
+		for _, p := range points[1:] {
+			w.cut("G1", p, feed, power)
+		}
+		return
+	}
+	if closed {
+		// a full circle is two half circles, the centre of a whole one is
+		// too close to call from its ends
+		if center, _, ok := fitCircle(openRing(points), arcFitTolerance); ok {
+			start := points[0]
+			half := sub(mul(center, 2), start)
+			sweep := math.Atan2(cross(sub(points[0], center), sub(points[1], center)), dot(sub(points[0], center), sub(points[1], center)))
+			w.arc(start, half, center, sweep, feed, power)
+			w.arc(half, start, center, sweep, feed, power)
+			return
+		}
+	}
+	vertices := fitArcs(points, arcFitTolerance)
+	for i, v := range vertices[1:] {
+		from := vertices[i]
+		if from.bulge == 0 {
+			w.cut("G1", v.p, feed, power)
+			continue
+		}
+		center, _, sweep := bulgeArc(from.p, v.p, from.bulge)
+		w.arc(from.p, v.p, center, sweep, feed, power)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+// gcodeMove is a move of a G-code program, with the power and feed rate
+// it is made at
+type gcodeMove struct {
+	code        string
+	from, to    [2]float64
+	center      [2]float64
+	power, feed float64
+}
+
+// runGCode follows a G-code program and returns its moves and the other
+// commands in it
+func runGCode(t *testing.T, program string) ([]gcodeMove, []string) {
+	var moves []gcodeMove
+	var commands []string
+	var head [2]float64
+	power, feed := 0.0, 0.0
+	for _, line := range strings.Split(program, "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		words := strings.Fields(line)
+		if words[0] != "G0" && words[0] != "G1" && words[0] != "G2" && words[0] != "G3" {
+			commands = append(commands, line)
+		}
+		move := gcodeMove{code: words[0], from: head, to: head}
+		var offset [2]float64
+		for _, word := range words[1:] {
+			v, err := strconv.ParseFloat(word[1:], 64)
+			if err != nil {
+				t.Fatalf("bad word %s in %s", word, line)
+			}
+			switch word[0] {
+			case 'X':
+				move.to[0] = v
+			case 'Y':
+				move.to[1] = v
+			case 'I':
+				offset[0] = v
+			case 'J':
+				offset[1] = v
+			case 'S':
+				power = v
+			case 'F':
+				feed = v
+			}
+		}
+		switch move.code {
+		case "G0", "G1", "G2", "G3":
+			move.center = add(move.from, offset)
+			move.power, move.feed = power, feed
+			moves = append(moves, move)
+			head = move.to
+		}
+	}
+	return moves, commands
+}
+
+func TestWriteGCode(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "parts",
+		WidthMm:    100,
+		HeightMm:   100,
+		Material:   materialPresets["acrylic-6mm"],
+		Operations: defaultOperations,
+		Segments: []svg.Segment{
+			{Stroke: "#0000ff", Points: [][2]float64{{0, 90}, {20, 90}}},
+			{Closed: true, Stroke: "#000000", Points: closeRing(circleRing(70, 30, 5, 64))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(10, 10, 30))},
+			{Stroke: "none", Fill: "#000000", Points: closeRing(square(50, 50, 10))},
+		},
+	}
+
+	out := bytes.Buffer{}
+	is.NoErr(job.writeGCode(&out, defaultGCodeOptions))
+	moves, commands := runGCode(t, out.String())
+	is.Equal(commands, []string{"G21 G90 G17", "M4 S0", "S0", "M5", "M2"})
+
+	// the score, the circle and the square twice each, y flipped
+	is.Equal(moves[0], gcodeMove{code: "G0", to: [2]float64{0, 10}})
+	is.Equal(moves[1], gcodeMove{code: "G1", from: [2]float64{0, 10}, to: [2]float64{20, 10}, center: [2]float64{0, 10}, power: 200, feed: 1200})
+	var travel [][2]float64
+	for i, m := range moves {
+		if m.code == "G0" {
+			travel = append(travel, m.to)
+			continue
+		}
+		is.Equal(m.code, "G1")
+		if i > 1 {
+			is.Equal(m.power, 1000.0)
+			is.Equal(m.feed, 120.0)
+		}
+	}
+	is.Equal(travel, [][2]float64{{0, 10}, {75, 70}, {75, 70}, {10, 90}, {10, 90}, {0, 0}})
+	is.Equal(moves[len(moves)-2].to, [2]float64{10, 90})
+
+	// arcs and air
+	out.Reset()
+	is.NoErr(job.writeGCode(&out, GCodeOptions{MaxPower: 255, Arcs: true, AirAssist: true}))
+	moves, commands = runGCode(t, out.String())
+	is.Equal(commands, []string{"G21 G90 G17", "M3 S0", "M8", "S0", "M9", "M5", "M2"})
+	arcs := 0
+	for _, m := range moves {
+		if m.code != "G2" && m.code != "G3" {
+			continue
+		}
+		arcs++
+		is.True(math.Abs(distance(m.center, [2]float64{70, 70})) < .01)
+		is.True(math.Abs(distance(m.center, m.from)-distance(m.center, m.to)) < .01)
+		is.Equal(m.power, 255.0)
+	}
+	// two half circles for each pass
+	is.Equal(arcs, 4)
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// Points are [2]float64{x, y} like the svg package uses. Unless noted
+// otherwise coordinates are millimetres with the y axis pointing down, the
+// same orientation as the svg the drawing came from.
+
+func add(a, b [2]float64) [2]float64 { return [2]float64{a[0] + b[0], a[1] + b[1]} }
+func sub(a, b [2]float64) [2]float64 { return [2]float64{a[0] - b[0], a[1] - b[1]} }
+func mul(a [2]float64, s float64) [2]float64 {
+	return [2]float64{a[0] * s, a[1] * s}
+}
+func dot(a, b [2]float64) float64   { return a[0]*b[0] + a[1]*b[1] }
+func cross(a, b [2]float64) float64 { return a[0]*b[1] - a[1]*b[0] }
+func length(a [2]float64) float64   { return math.Hypot(a[0], a[1]) }
+func distance(a, b [2]float64) float64 {
+	return math.Hypot(a[0]-b[0], a[1]-b[1])
+}
+func lerp(a, b [2]float64, t float64) [2]float64 {
+	return [2]float64{a[0] + (b[0]-a[0])*t, a[1] + (b[1]-a[1])*t}
+}
+
+// normalize returns a with a length of 1, or the zero vector if a has no length
+func normalize(a [2]float64) [2]float64 {
+	l := length(a)
+	if l == 0 {
+		return [2]float64{}
+	}
+	return [2]float64{a[0] / l, a[1] / l}
+}
+
+// rotate turns a by angle radians around the origin
+func rotate(a [2]float64, angle float64) [2]float64 {
+	s, c := math.Sincos(angle)
+	return [2]float64{a[0]*c - a[1]*s, a[0]*s + a[1]*c}
+}
+
+// A ring is a closed contour without the repeated closing point that
+// closed svg.Segments carry.
+
+// openRing drops the closing point of a closed contour
+func openRing(points [][2]float64) [][2]float64 {
+	n := len(points)
+	if n > 1 && points[0] == points[n-1] {
+		return points[:n-1]
+	}
+	return points
+}
+
+// closeRing appends the closing point to a ring
+func closeRing(ring [][2]float64) [][2]float64 {
+	if len(ring) == 0 {
+		return nil
+	}
+	closed := make([][2]float64, 0, len(ring)+1)
+	closed = append(closed, ring...)
+	return append(closed, ring[0])
+}
+
+// ringArea is the signed area of a ring. It is positive when the ring
+// turns left, which is counter clockwise with the y axis up and clockwise
+// on screen.
+func ringArea(ring [][2]float64) float64 {
+	var area float64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		area += cross(ring[i], ring[j])
+	}
+	return area / 2
+}
+
+// reverseRing returns a copy of ring in the opposite direction
+func reverseRing(ring [][2]float64) [][2]float64 {
+	reversed := make([][2]float64, len(ring))
+	for i, p := range ring {
+		reversed[len(ring)-1-i] = p
+	}
+	return reversed
+}
+
+// windingNumber counts how many times ring winds around p. Rings with a
+// positive area add one, negative rings subtract one.
+func windingNumber(p [2]float64, ring [][2]float64) int {
+	w := 0
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		if a[1] <= p[1] {
+			if b[1] > p[1] && cross(sub(b, a), sub(p, a)) > 0 {
+				w++
+			}
+		} else if b[1] <= p[1] && cross(sub(b, a), sub(p, a)) < 0 {
+			w--
+		}
+	}
+	return w
+}
+
+// pointInRing reports if p is inside ring. Points on the boundary may go
+// either way.
+func pointInRing(p [2]float64, ring [][2]float64) bool {
+	return windingNumber(p, ring) != 0
+}
+
+// bounds is an axis aligned bounding box
+type bounds struct {
+	MinX, MinY, MaxX, MaxY float64
+}
+
+func emptyBounds() bounds {
+	return bounds{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+}
+
+func (b bounds) isEmpty() bool      { return b.MinX > b.MaxX || b.MinY > b.MaxY }
+func (b bounds) width() float64     { return b.MaxX - b.MinX }
+func (b bounds) height() float64    { return b.MaxY - b.MinY }
+func (b bounds) center() [2]float64 { return [2]float64{(b.MinX + b.MaxX) / 2, (b.MinY + b.MaxY) / 2} }
+
+func (b bounds) extend(p [2]float64) bounds {
+	return bounds{
+		MinX: math.Min(b.MinX, p[0]),
+		MinY: math.Min(b.MinY, p[1]),
+		MaxX: math.Max(b.MaxX, p[0]),
+		MaxY: math.Max(b.MaxY, p[1]),
+	}
+}
+
+func (b bounds) union(o bounds) bounds {
+	if o.isEmpty() {
+		return b
+	}
+	return b.extend([2]float64{o.MinX, o.MinY}).extend([2]float64{o.MaxX, o.MaxY})
+}
+
+// contains reports if o lies within b, allowing tol of slack
+func (b bounds) contains(o bounds, tol float64) bool {
+	return o.MinX >= b.MinX-tol && o.MinY >= b.MinY-tol && o.MaxX <= b.MaxX+tol && o.MaxY <= b.MaxY+tol
+}
+
+func (b bounds) overlaps(o bounds) bool {
+	return b.MinX <= o.MaxX && o.MinX <= b.MaxX && b.MinY <= o.MaxY && o.MinY <= b.MaxY
+}
+
+func pointsBounds(points [][2]float64) bounds {
+	b := emptyBounds()
+	for _, p := range points {
+		b = b.extend(p)
+	}
+	return b
+}
+
+func segmentsBounds(segments []svg.Segment) bounds {
+	b := emptyBounds()
+	for _, s := range segments {
+		b = b.union(pointsBounds(s.Points))
+	}
+	return b
+}
+
+// transformSegments applies f to every point of every segment, in place
+func transformSegments(segments []svg.Segment, f func([2]float64) [2]float64) {
+	for i := range segments {
+		for j, p := range segments[i].Points {
+			segments[i].Points[j] = f(p)
+		}
+	}
+}
+
+// joinSegments chains open segments whose end points are within tol of
+// each other into longer segments. Onshape exports every edge of a
+// contour as its own polyline, joining them gives back the closed
+// contours. Only segments with the same stroke and layer are joined.
+func joinSegments(segments []svg.Segment, tol float64) []svg.Segment {
+	type cell [2]int64
+	cellOf := func(p [2]float64) cell {
+		return cell{int64(math.Floor(p[0] / tol)), int64(math.Floor(p[1] / tol))}
+	}
+
+	var joined []svg.Segment
+	var open []int
+	for i, s := range segments {
+		if s.Closed || len(s.Points) < 2 {
+			joined = append(joined, s)
+			continue
+		}
+		open = append(open, i)
+	}
+
+	// index the end points of the open segments on a grid of tol sized cells
+	ends := map[cell][]int{}
+	for _, i := range open {
+		s := segments[i]
+		for _, p := range [][2]float64{s.Points[0], s.Points[len(s.Points)-1]} {
+			c := cellOf(p)
+			ends[c] = append(ends[c], i)
+		}
+	}
+	used := map[int]bool{}
+	// next finds an unused segment with an end point near p, returning its
+	// points oriented to start at p
+	next := func(p [2]float64, like svg.Segment) [][2]float64 {
+		c := cellOf(p)
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for _, i := range ends[cell{c[0] + dx, c[1] + dy}] {
+					s := segments[i]
+					if used[i] || s.Stroke != like.Stroke || s.Layer != like.Layer {
+						continue
+					}
+					if distance(s.Points[0], p) <= tol {
+						used[i] = true
+						return s.Points
+					}
+					if distance(s.Points[len(s.Points)-1], p) <= tol {
+						used[i] = true
+						return reverseRing(s.Points)
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, i := range open {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		chain := segments[i]
+		chain.Points = append([][2]float64{}, segments[i].Points...)
+		for {
+			more := next(chain.Points[len(chain.Points)-1], chain)
+			if more == nil {
+				break
+			}
+			chain.Points = append(chain.Points, more[1:]...)
+		}
+		for {
+			more := next(chain.Points[0], chain)
+			if more == nil {
+				break
+			}
+			more = reverseRing(more)
+			chain.Points = append(more[:len(more)-1], chain.Points...)
+		}
+		n := len(chain.Points)
+		if n > 3 && distance(chain.Points[0], chain.Points[n-1]) <= tol {
+			chain.Points[n-1] = chain.Points[0]
+			chain.Closed = true
+		}
+		joined = append(joined, chain)
+	}
+	return joined
+}
+
+// contourNode is a closed contour in the containment tree of a drawing.
+// Contours at an even depth are outer profiles of parts, contours at an
+// odd depth are holes in the part they are in.
+type contourNode struct {
+	Index    int // index of the segment the contour came from
+	Ring     [][2]float64
+	Area     float64 // absolute area
+	Bounds   bounds
+	Parent   *contourNode
+	Children []*contourNode
+	Depth    int
+}
+
+func (n *contourNode) isHole() bool { return n.Depth%2 == 1 }
+
+// containmentTree builds the tree of which closed contours are inside
+// which. It returns the contours that are not inside any other contour
+// and all nodes indexed like segments, with nil for open segments.
+func containmentTree(segments []svg.Segment) (roots []*contourNode, nodes []*contourNode) {
+	nodes = make([]*contourNode, len(segments))
+	var sorted []*contourNode
+	for i, s := range segments {
+		if !s.Closed {
+			continue
+		}
+		ring := openRing(s.Points)
+		if len(ring) < 3 {
+			continue
+		}
+		n := &contourNode{Index: i, Ring: ring, Area: math.Abs(ringArea(ring)), Bounds: pointsBounds(ring)}
+		nodes[i] = n
+		sorted = append(sorted, n)
+	}
+	// a contour can only be inside a bigger one
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Area > sorted[j].Area })
+
+	for i, n := range sorted {
+		// the smallest containing contour is the parent, so try the
+		// candidates from small to big
+		for j := i - 1; j >= 0; j-- {
+			candidate := sorted[j]
+			if candidate.Area <= n.Area || !candidate.Bounds.contains(n.Bounds, 0) {
+				continue
+			}
+			if ringInsideRing(n.Ring, candidate.Ring) {
+				n.Parent = candidate
+				break
+			}
+		}
+		if n.Parent == nil {
+			roots = append(roots, n)
+			continue
+		}
+		n.Parent.Children = append(n.Parent.Children, n)
+	}
+	for _, n := range sorted {
+		if n.Parent != nil {
+			n.Depth = n.Parent.Depth + 1
+		}
+	}
+	return roots, nodes
+}
+
+// ringInsideRing tests if inner is inside outer by sampling a few of its
+// vertices, so contours that touch outer in a point still count as inside.
+func ringInsideRing(inner, outer [][2]float64) bool {
+	samples := 5
+	if len(inner) < samples {
+		samples = len(inner)
+	}
+	inside := 0
+	for k := 0; k < samples; k++ {
+		if pointInRing(inner[k*len(inner)/samples], outer) {
+			inside++
+		}
+	}
+	return inside*2 > samples
+}
+
+// pathLengths returns the distance along a polyline to each of its points
+func pathLengths(points [][2]float64) []float64 {
+	lengths := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		lengths[i] = lengths[i-1] + distance(points[i-1], points[i])
+	}
+	return lengths
+}
+
+// pointAlong returns the point at distance s along a polyline
+func pointAlong(points [][2]float64, lengths []float64, s float64) [2]float64 {
+	if s <= 0 {
+		return points[0]
+	}
+	i := sort.SearchFloat64s(lengths, s)
+	if i >= len(points) {
+		return points[len(points)-1]
+	}
+	if i == 0 || lengths[i] == lengths[i-1] {
+		return points[i]
+	}
+	return lerp(points[i-1], points[i], (s-lengths[i-1])/(lengths[i]-lengths[i-1]))
+}
+
+// slicePath returns the part of a polyline between the distances s0 and
+// s1 along it.
+func slicePath(points [][2]float64, lengths []float64, s0, s1 float64) [][2]float64 {
+	path := [][2]float64{pointAlong(points, lengths, s0)}
+	for i, l := range lengths {
+		if l > s0 && l < s1 {
+			path = append(path, points[i])
+		}
+	}
+	return append(path, pointAlong(points, lengths, s1))
+}
+
+// sliceClosedPath is slicePath for a closed contour, where s1 may be past
+// the end of the contour to wrap around through its start.
+func sliceClosedPath(points [][2]float64, lengths []float64, s0, s1 float64) [][2]float64 {
+	total := lengths[len(lengths)-1]
+	for s0 >= total {
+		s0 -= total
+		s1 -= total
+	}
+	for s0 < 0 {
+		s0 += total
+		s1 += total
+	}
+	if s1 <= total {
+		return slicePath(points, lengths, s0, s1)
+	}
+	first := slicePath(points, lengths, s0, total)
+	return append(first, slicePath(points, lengths, 0, s1-total)[1:]...)
+}
+
+// closestAlong returns the distance along a polyline of the point on it
+// that is closest to p, and how far away from p that point is.
+func closestAlong(points [][2]float64, lengths []float64, p [2]float64) (s float64, dist float64) {
+	dist = math.Inf(1)
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		d := sub(b, a)
+		t := 0.0
+		if l := dot(d, d); l > 0 {
+			t = math.Max(0, math.Min(1, dot(sub(p, a), d)/l))
+		}
+		if dd := distance(p, lerp(a, b, t)); dd < dist {
+			dist = dd
+			s = lengths[i-1] + t*(lengths[i]-lengths[i-1])
+		}
+	}
+	return s, dist
+}
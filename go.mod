@@ -7,9 +7,14 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/magefile/mage v1.13.0
 	github.com/matryer/is v1.4.0
+	github.com/rustyoz/svg v0.0.0
 )
 
 require (
+	github.com/rustyoz/Mtransform v0.0.0-20190224104252-60c8c35a3681 // indirect
+	github.com/rustyoz/genericlexer v0.0.0-20190224115003-eb82fd2987bd // indirect
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
 	golang.org/x/text v0.3.7 // indirect
 )
+
+replace github.com/rustyoz/svg => ./svg
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// HatchOptions controls how filled areas are shaded with vector lines
+type HatchOptions struct {
+	// SpacingMm is the distance between hatch lines, 0 disables hatching
+	SpacingMm float64
+	// AngleDeg is the direction of the lines, 0 is horizontal
+	AngleDeg float64
+	// Crosshatch adds a second set of lines at right angles to the first
+	Crosshatch bool
+}
+
+var defaultHatchOptions = HatchOptions{
+	SpacingMm: 0,
+	AngleDeg:  45,
+}
+
+// applyHatch fills the filled areas of the job with hatch lines in the
+// colour of the first engrave operation, the hatch operation by default, a quick alternative to raster
+// engraving logos. The closed sub paths of an element make up one area,
+// filled by the fill rule of the element. Areas on the same layer are
+// merged first so overlapping shapes are not engraved twice. White is the
+// colour of the page, so white areas are not filled. The hatched areas
+// lose their fill, so the laser driver does not raster engrave them too.
+func (j *Job) applyHatch(opts HatchOptions) {
+	if opts.SpacingMm <= 0 {
+		return
+	}
+	color := engraveColor(j)
+
+	var elements []int
+	areas := map[int][]svg.Segment{}
+	for i, s := range j.Segments {
+		fill := normalizeColor(s.Fill)
+		if !s.Closed || fill == "" || fill == "none" || fill == "#ffffff" {
+			continue
+		}
+		if _, ok := areas[s.Element]; !ok {
+			elements = append(elements, s.Element)
+		}
+		areas[s.Element] = append(areas[s.Element], s)
+		j.Segments[i].Fill = "none"
+	}
+
+	// the resolved rings of every element have their area on the left,
+	// so together they are filled wherever any element is
+	var layers []svg.Segment
+	merged := map[string]*Shape{}
+	for _, element := range elements {
+		area := areas[element]
+		layer, ok := merged[area[0].Layer]
+		if !ok {
+			layer = &Shape{}
+			merged[area[0].Layer] = layer
+			layers = append(layers, area[0])
+		}
+		layer.Rings = append(layer.Rings, boolean(Union, shapeOf(area), Shape{})...)
+	}
+
+	angles := []float64{opts.AngleDeg}
+	if opts.Crosshatch {
+		angles = append(angles, opts.AngleDeg+90)
+	}
+	for _, like := range layers {
+		rings := boolean(Union, *merged[like.Layer], Shape{})
+		for _, angle := range angles {
+			for _, line := range hatchLines(rings, opts.SpacingMm, angle*math.Pi/180) {
+				j.Segments = append(j.Segments, svg.Segment{
+					Width:  like.Width,
+					Stroke: color,
+					Layer:  like.Layer,
+					Points: line,
+				})
+			}
+		}
+	}
+}
+
+// engraveColor is the colour of the first engrave operation of the job
+func engraveColor(j *Job) string {
+	for _, op := range j.Operations {
+		if op.Kind == Engrave {
+			return op.Color
+		}
+	}
+	return defaultOperations[2].Color
+}
+
+// hatchLines returns the lines, spacing apart at angle, covering the area
+// of rings. The rings must be simple and not overlap, like the ones
+// boolean returns. Lines run back and forth so the head does not travel
+// back across the area for every line. They sit half way between
+// multiples of spacing, so the lines of neighbouring areas line up and
+// do not run along edges drawn on round numbers.
+func hatchLines(rings [][][2]float64, spacing, angle float64) [][][2]float64 {
+	// turn the rings so the hatch lines are horizontal
+	var turned [][][2]float64
+	b := emptyBounds()
+	for _, r := range rings {
+		t := make([][2]float64, len(r))
+		for i, p := range r {
+			t[i] = rotate(p, -angle)
+		}
+		turned = append(turned, t)
+		b = b.union(pointsBounds(t))
+	}
+	if b.isEmpty() {
+		return nil
+	}
+
+	var lines [][][2]float64
+	forward := true
+	for k := math.Ceil(b.MinY/spacing - .5); (k+.5)*spacing <= b.MaxY; k++ {
+		y := (k + .5) * spacing
+		// every crossing of the line with an edge, an edge counts from
+		// its lower end up to but not including its upper end
+		var xs []float64
+		for _, r := range turned {
+			for i := range r {
+				a, c := r[i], r[(i+1)%len(r)]
+				if (a[1] <= y) == (c[1] <= y) {
+					continue
+				}
+				xs = append(xs, a[0]+(y-a[1])*(c[0]-a[0])/(c[1]-a[1]))
+			}
+		}
+		sort.Float64s(xs)
+		if !forward {
+			sort.Sort(sort.Reverse(sort.Float64Slice(xs)))
+		}
+		for i := 0; i+1 < len(xs); i += 2 {
+			if xs[i] == xs[i+1] {
+				continue
+			}
+			lines = append(lines, [][2]float64{rotate([2]float64{xs[i], y}, angle), rotate([2]float64{xs[i+1], y}, angle)})
+		}
+		if len(xs) > 1 {
+			forward = !forward
+		}
+	}
+	return lines
+}
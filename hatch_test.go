@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func hatchLength(lines [][][2]float64) float64 {
+	total := 0.0
+	for _, l := range lines {
+		total += distance(l[0], l[1])
+	}
+	return total
+}
+
+func TestHatchLines(t *testing.T) {
+	donut := boolean(Union, Shape{Rings: [][][2]float64{square(0, 0, 10), square(2, 2, 6)}, FillRule: "evenodd"}, Shape{})
+	tests := []struct {
+		name       string
+		rings      [][][2]float64
+		angle      float64
+		wantLines  int
+		wantLength float64
+		tolerance  float64
+	}{
+		{"square", [][][2]float64{square(0, 0, 10)}, 0, 10, 100, 1e-9},
+		{"donut", donut, 0, 2 + 2*6 + 2, 64, 1e-9},
+		{"upright", [][][2]float64{square(0, 0, 10)}, math.Pi / 2, 10, 100, 1e-9},
+		{"diagonal", [][][2]float64{square(0, 0, 10)}, math.Pi / 4, 14, 100, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			lines := hatchLines(tt.rings, 1, tt.angle)
+			is.Equal(len(lines), tt.wantLines)
+			if math.Abs(hatchLength(lines)-tt.wantLength) > tt.tolerance {
+				t.Errorf("hatched %f, want %f", hatchLength(lines), tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestHatchLinesAlternate(t *testing.T) {
+	is := is.New(t)
+	lines := hatchLines([][][2]float64{square(0, 0, 10)}, 1, 0)
+	is.Equal(lines[0], [][2]float64{{0, .5}, {10, .5}})
+	is.Equal(lines[1], [][2]float64{{10, 1.5}, {0, 1.5}})
+}
+
+func TestApplyHatch(t *testing.T) {
+	is := is.New(t)
+	doc, err := svg.ParseSvg(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 100 100">
+	<g fill-rule="evenodd"><path fill="black" stroke="none" d="M0,0 L10,0 L10,10 L0,10 Z M2,2 L8,2 L8,8 L2,8 Z"/></g>
+	<rect x="20" y="0" width="10" height="10" fill="#000"/>
+	<rect x="22" y="2" width="6" height="6" fill="#000"/>
+	<rect x="40" y="0" width="10" height="10" fill="white" stroke="black"/>
+	<polyline points="60,0 70,0 70,10" fill="black" stroke="black"/>
+	</svg>`, "logo", 0)
+	is.NoErr(err)
+	segments, err := doc.Segments()
+	is.NoErr(err)
+
+	hatched := func(opts HatchOptions) []svg.Segment {
+		job := &Job{Operations: append([]Operation{}, defaultOperations...), Segments: append([]svg.Segment{}, segments...)}
+		job.applyHatch(opts)
+		return job.Segments[len(segments):]
+	}
+
+	lines := hatched(HatchOptions{SpacingMm: 1})
+	var length float64
+	for _, l := range lines {
+		is.Equal(l.Stroke, "#ff8000")
+		length += distance(l.Points[0], l.Points[1])
+	}
+	// the path has a hole, the rect inside the other one is not hatched twice
+	is.True(math.Abs(length-(64+100)) < 1e-9)
+
+	lines = hatched(HatchOptions{SpacingMm: 1, Crosshatch: true})
+	length = 0
+	for _, l := range lines {
+		length += distance(l.Points[0], l.Points[1])
+	}
+	is.True(math.Abs(length-2*(64+100)) < 1e-9)
+
+	is.Equal(len(hatched(HatchOptions{})), 0)
+}
+
+func TestConvertHatch(t *testing.T) {
+	is := is.New(t)
+	request := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("hatch=1&hatch-angle=0&crosshatch=on"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	jobOpts, err := formJobOptions(request, defaultJobOptions)
+	is.NoErr(err)
+	is.Equal(jobOpts.Hatch, HatchOptions{SpacingMm: 1, AngleDeg: 0, Crosshatch: true})
+
+	// the pdf for the laser driver has the logo hatched rather than filled
+	const logo = `<svg xmlns="http://www.w3.org/2000/svg" width="100mm" height="100mm" viewBox="0 0 100 100"><rect x="10" y="10" width="10" height="10" fill="#000000"/></svg>`
+	out := bytes.Buffer{}
+	opts := ConvertOptions{Name: "logo.svg", Strokes: defaultStrokeOptions, Material: materialPresets["none"], Job: jobOpts}
+	is.NoErr(convert(context.Background(), "native", []byte(logo), "pdf", opts, &out))
+	read, err := loadPDFJob("logo.pdf", out.Bytes(), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.Equal(len(read.Segments), 20)
+	for _, s := range read.Segments {
+		is.Equal(normalizeColor(s.Stroke), "#ff8000")
+		is.Equal(s.Fill, "none")
+	}
+}
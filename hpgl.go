@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// hpglUnitsPerMm is the size of a plotter unit, a fortieth of a millimetre
+const hpglUnitsPerMm = 40
+
+// hpglPenColors are the stroke colours of the pens of an HPGL drawing.
+// Pens 1 to 3 are in the colours of the default operations, so the pens
+// of defaultHPGLOptions come back as the operations they were written for.
+var hpglPenColors = []string{"#000000", "#000000", "#0000ff", "#ff0000", "#00ff00", "#ffff00", "#ff00ff", "#00ffff", "#808080"}
+
+// HPGLOptions are the settings of an HPGL file
+type HPGLOptions struct {
+	// UnitsPerMm is how many plotter units there are in a millimetre
+	UnitsPerMm float64
+	// Pens are the pen of each operation by name, operations not in it
+	// are drawn with pen 1
+	Pens map[string]int
+}
+
+var defaultHPGLOptions = HPGLOptions{
+	UnitsPerMm: hpglUnitsPerMm,
+	Pens:       map[string]int{"cut": 1, "score": 2, "hatch": 3},
+}
+
+// hpglInstruction is an HPGL instruction, two letters and its numbers
+type hpglInstruction struct {
+	name   string
+	params []float64
+}
+
+// scanHPGL splits an HPGL program into its instructions. PCL escape
+// sequences and PJL lines around it are skipped, as are labels.
+func scanHPGL(data []byte) ([]hpglInstruction, error) {
+	var instructions []hpglInstruction
+	isLetter := func(c byte) bool { return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' }
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == 0x1b:
+			// ESC E, or ESC % 1 B with an upper case letter at the end
+			i++
+			if i < len(data) && strings.IndexByte("%&*()", data[i]) >= 0 {
+				for i++; i < len(data) && !(data[i] >= 'A' && data[i] <= 'Z'); i++ {
+				}
+			}
+			i++
+		case bytes.HasPrefix(data[i:], []byte("@PJL")):
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case isLetter(c):
+			if i+1 >= len(data) || !isLetter(data[i+1]) {
+				return nil, fmt.Errorf("bad instruction at byte %d", i)
+			}
+			name := strings.ToUpper(string(data[i : i+2]))
+			i += 2
+			if name == "LB" {
+				// the label runs to the end of text character
+				for i < len(data) && data[i] != 0x03 {
+					i++
+				}
+				i++
+				continue
+			}
+			instruction := hpglInstruction{name: name}
+			for i < len(data) && data[i] != ';' && !isLetter(data[i]) && data[i] != 0x1b {
+				start := i
+				for i < len(data) && strings.IndexByte("+-.0123456789", data[i]) >= 0 {
+					i++
+				}
+				if i == start {
+					i++
+					continue
+				}
+				v, err := strconv.ParseFloat(string(data[start:i]), 64)
+				if err != nil {
+					return nil, fmt.Errorf("bad number in %s - %w", name, err)
+				}
+				instruction.params = append(instruction.params, v)
+			}
+			instructions = append(instructions, instruction)
+		default:
+			i++
+		}
+	}
+	return instructions, nil
+}
+
+// hpglPlotter follows an HPGL program, collecting what the pens draw in
+// millimetres with y up
+type hpglPlotter struct {
+	segments []svg.Segment
+	pos      [2]float64
+	down     bool
+	relative bool
+	pen      int
+	line     [][2]float64
+	element  int
+}
+
+// flush ends the line being drawn
+func (p *hpglPlotter) flush() {
+	if len(p.line) > 1 {
+		p.add(p.line, false)
+	}
+	p.line = nil
+}
+
+func (p *hpglPlotter) add(points [][2]float64, closed bool) {
+	color := "#000000"
+	if p.pen >= 0 && p.pen < len(hpglPenColors) {
+		color = hpglPenColors[p.pen]
+	}
+	p.segments = append(p.segments, svg.Segment{
+		Closed:  closed,
+		Points:  points,
+		Stroke:  color,
+		Layer:   "pen " + strconv.Itoa(p.pen),
+		Element: p.element,
+	})
+	p.element++
+}
+
+// moveTo moves the pen, drawing when it is down
+func (p *hpglPlotter) moveTo(to [2]float64) {
+	if p.down {
+		if len(p.line) == 0 {
+			p.line = append(p.line, p.pos)
+		}
+		p.line = append(p.line, to)
+	}
+	p.pos = to
+}
+
+// moves moves the pen through the pairs of numbers in params
+func (p *hpglPlotter) moves(params []float64) {
+	for k := 0; k+1 < len(params); k += 2 {
+		to := [2]float64{params[k] / hpglUnitsPerMm, params[k+1] / hpglUnitsPerMm}
+		if p.relative {
+			to = add(p.pos, to)
+		}
+		p.moveTo(to)
+	}
+}
+
+func (p *hpglPlotter) run(in hpglInstruction, tolerance float64) {
+	switch in.name {
+	case "IN":
+		// pen 1 rather than none, plenty of files never pick one
+		p.flush()
+		p.pos, p.down, p.relative, p.pen = [2]float64{}, false, false, 1
+	case "SP":
+		p.flush()
+		p.pen = 0
+		if len(in.params) > 0 {
+			p.pen = int(in.params[0])
+		}
+	case "PU":
+		p.flush()
+		p.down = false
+		p.moves(in.params)
+	case "PD":
+		p.down = true
+		p.moves(in.params)
+	case "PA":
+		p.relative = false
+		p.moves(in.params)
+	case "PR":
+		p.relative = true
+		p.moves(in.params)
+	case "CI":
+		// a circle around the pen, which stays where it is
+		if len(in.params) == 0 {
+			return
+		}
+		radius := math.Abs(in.params[0]) / hpglUnitsPerMm
+		steps := int(math.Max(8, float64(arcSteps(radius, 2*math.Pi, tolerance))))
+		var ring [][2]float64
+		for k := 0; k < steps; k++ {
+			angle := 2 * math.Pi * float64(k) / float64(steps)
+			ring = append(ring, [2]float64{p.pos[0] + radius*math.Cos(angle), p.pos[1] + radius*math.Sin(angle)})
+		}
+		p.add(closeRing(ring), true)
+	case "AA":
+		// an arc around an absolute centre through an angle in degrees,
+		// counter clockwise when positive
+		if len(in.params) < 3 {
+			return
+		}
+		center := [2]float64{in.params[0] / hpglUnitsPerMm, in.params[1] / hpglUnitsPerMm}
+		radius := distance(center, p.pos)
+		sweep := in.params[2] * math.Pi / 180
+		start := math.Atan2(p.pos[1]-center[1], p.pos[0]-center[0])
+		steps := arcSteps(radius, math.Abs(sweep), tolerance)
+		for k := 1; k <= steps; k++ {
+			angle := start + sweep*float64(k)/float64(steps)
+			p.moveTo([2]float64{center[0] + radius*math.Cos(angle), center[1] + radius*math.Sin(angle)})
+		}
+	}
+}
+
+// parseHPGL reads the lines the pens of an HPGL program draw, in
+// millimetres with y up. Arcs and circles are flattened to tolerance.
+func parseHPGL(data []byte, tolerance float64) ([]svg.Segment, error) {
+	instructions, err := scanHPGL(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &hpglPlotter{pen: 1}
+	for _, in := range instructions {
+		p.run(in, tolerance)
+	}
+	p.flush()
+	return p.segments, nil
+}
+
+// loadHPGLJob reads an HPGL or .plt file into a job. Pens that draw in a
+// layer named in clean.Drop, like pen 4, are left out.
+func loadHPGLJob(name string, file []byte, material Material, clean CleanOptions) (*Job, error) {
+	segments, err := parseHPGL(file, defaultOffsetOptions.Tolerance)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse hpgl - %w", err)
+	}
+	var kept []svg.Segment
+	for _, s := range segments {
+		if !containsString(clean.Drop, s.Layer) {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("%s has no geometry to cut", name)
+	}
+	b := segmentsBounds(kept)
+	transformSegments(kept, func(p [2]float64) [2]float64 {
+		return [2]float64{p[0] - b.MinX, b.MaxY - p[1]}
+	})
+
+	return &Job{
+		Name:       name,
+		WidthMm:    b.width(),
+		HeightMm:   b.height(),
+		Material:   material,
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments:   joinSegments(kept, joinTolerance),
+	}, nil
+}
+
+// writeHPGL writes the job as HPGL for plotters and vinyl cutters, with y
+// up and the bottom of the page at 0. Each operation is drawn with its pen
+// in opts.Pens, circles are written as CI and everything else as lines.
+func (j *Job) writeHPGL(w io.Writer, opts HPGLOptions) error {
+	if opts.UnitsPerMm <= 0 {
+		return fmt.Errorf("hpgl units per mm must be more than 0, not %g", opts.UnitsPerMm)
+	}
+	units := func(v float64) string {
+		return strconv.FormatInt(int64(math.Round(v*opts.UnitsPerMm)), 10)
+	}
+	point := func(p [2]float64) string {
+		return units(p[0]) + "," + units(j.HeightMm-p[1])
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprint(out, "IN;PA;")
+	pen := 0
+	for _, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || len(s.Points) < 2 {
+			continue
+		}
+		segmentPen, ok := opts.Pens[op.Name]
+		if !ok {
+			segmentPen = 1
+		}
+		if segmentPen != pen {
+			fmt.Fprintf(out, "\nSP%d;", segmentPen)
+			pen = segmentPen
+		}
+		points := s.Points
+		closed := s.Closed && len(openRing(points)) > 2
+		if closed {
+			if center, radius, ok := fitCircle(openRing(points), arcFitTolerance); ok {
+				fmt.Fprintf(out, "\nPU%s;CI%s;", point(center), units(radius))
+				continue
+			}
+			points = closeRing(openRing(points))
+		}
+		fmt.Fprintf(out, "\nPU%s;PD", point(points[0]))
+		for i, p := range points[1:] {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			out.WriteString(point(p))
+		}
+		out.WriteString(";")
+	}
+	fmt.Fprint(out, "\nPU;SP0;\n")
+	return out.Flush()
+}
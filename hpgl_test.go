@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestParseHPGL(t *testing.T) {
+	is := is.New(t)
+	program := "\x1b%-12345X@PJL JOB NAME=part\r\n\x1bE\x1b%1B" +
+		"IN;SP1;PU0,0;PD400,0,400,400;" +
+		"PR;PD-400,0;PA;" +
+		"LBnot; PD a line\x03" +
+		"SP2;PU800,800;CI200;" +
+		"sp3;pu1200,0 pd;AA1200,400,90;PU;" +
+		"\x1b%0B"
+	segments, err := parseHPGL([]byte(program), .01)
+	is.NoErr(err)
+	is.Equal(len(segments), 3)
+
+	is.Equal(segments[0].Points, [][2]float64{{0, 0}, {10, 0}, {10, 10}, {0, 10}})
+	is.Equal(segments[0].Stroke, "#000000")
+	is.Equal(segments[0].Layer, "pen 1")
+	is.True(!segments[0].Closed)
+
+	circle := segments[1]
+	is.True(circle.Closed)
+	is.Equal(circle.Stroke, "#0000ff")
+	for _, p := range circle.Points {
+		is.True(math.Abs(distance(p, [2]float64{20, 20})-5) < 1e-9)
+	}
+
+	arc := segments[2]
+	is.Equal(arc.Stroke, "#ff0000")
+	is.Equal(arc.Points[0], [2]float64{30, 0})
+	end := arc.Points[len(arc.Points)-1]
+	is.True(distance(end, [2]float64{40, 10}) < 1e-9)
+
+	_, err = parseHPGL([]byte("IN;P"), .01)
+	is.True(err != nil)
+}
+
+func TestWriteHPGL(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "parts",
+		WidthMm:    100,
+		HeightMm:   100,
+		Operations: defaultOperations,
+		Segments: []svg.Segment{
+			{Stroke: "#0000ff", Points: [][2]float64{{0, 90}, {20, 90}, {20, 80}}},
+			{Closed: true, Stroke: "#000000", Points: closeRing(circleRing(70, 30, 5, 64))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(10, 10, 30))},
+			{Stroke: "none", Fill: "#000000", Points: closeRing(square(50, 50, 10))},
+		},
+	}
+	out := bytes.Buffer{}
+	is.NoErr(job.writeHPGL(&out, defaultHPGLOptions))
+	is.Equal(out.String(), "IN;PA;\n"+
+		"SP2;\nPU0,400;PD800,400,800,800;\n"+
+		"SP1;\nPU2800,2800;CI200;\n"+
+		"PU400,3600;PD1600,3600,1600,2400,400,2400,400,3600;\n"+
+		"PU;SP0;\n")
+
+	// read back the drawing spans from the score to the square, y down again
+	read, err := loadHPGLJob("parts.plt", out.Bytes(), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.Equal(read.WidthMm, 75.0)
+	is.Equal(read.HeightMm, 80.0)
+	is.Equal(len(read.Segments), 3)
+	for _, s := range read.Segments {
+		switch {
+		case !s.Closed:
+			is.Equal(read.operationFor(s).Name, "score")
+			is.Equal(s.Points, [][2]float64{{0, 80}, {20, 80}, {20, 70}})
+		case len(s.Points) == 5:
+			is.Equal(read.operationFor(s).Name, "cut")
+			is.Equal(s.Points, closeRing(square(10, 0, 30)))
+		default:
+			is.Equal(read.operationFor(s).Name, "cut")
+		}
+	}
+
+	// other units and pens
+	out.Reset()
+	is.NoErr(job.writeHPGL(&out, HPGLOptions{UnitsPerMm: 10, Pens: map[string]int{"score": 5}}))
+	is.True(strings.HasPrefix(out.String(), "IN;PA;\nSP5;\nPU0,100;PD200,100,200,200;\nSP1;\nPU700,700;CI50;"))
+	is.True(job.writeHPGL(&out, HPGLOptions{}) != nil)
+}
+
+func TestParsePens(t *testing.T) {
+	is := is.New(t)
+	pens, err := parsePens("cut=1, score = 4")
+	is.NoErr(err)
+	is.Equal(pens, map[string]int{"cut": 1, "score": 4})
+	is.Equal(formatPens(defaultHPGLOptions.Pens), "cut=1,score=2,hatch=3")
+	_, err = parsePens("cut")
+	is.True(err != nil)
+	_, err = parsePens("cut=x")
+	is.True(err != nil)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"regexp"
+	"strings"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+)
+
+// JobImage is a raster image on the job, which the laser engraves
+type JobImage struct {
+	// Matrix maps the unit square of the image to millimetres on the page.
+	// Like in pdf the bottom left corner of the image is at 0,0.
+	Matrix matrix
+	// Data is the png or jpeg file of the image
+	Data []byte
+}
+
+var dataURIRegex = regexp.MustCompile(`^data:image/(png|jpe?g);base64,`)
+
+// svgImages collects the images embedded in the document as data uris. m
+// maps the user units of the document to millimetres. Linked images are
+// not read, the file they are in is not there when the document is
+// uploaded.
+func svgImages(el *xmltree.Element, m matrix) []JobImage {
+	switch el.Name.Local {
+	case "defs", "clipPath", "mask", "symbol", "marker", "pattern":
+		return nil
+	}
+	m = parseTransformAttr(el.Attr("", "transform")).then(m)
+
+	var images []JobImage
+	if el.Name.Local == "image" {
+		if img, ok := svgImage(el, m); ok {
+			images = append(images, img)
+		}
+	}
+	for i := range el.Children {
+		images = append(images, svgImages(&el.Children[i], m)...)
+	}
+	return images
+}
+
+// svgImage reads an image element, fitting the image into its box as
+// preserveAspectRatio says. A sliced image is not clipped to the box.
+func svgImage(el *xmltree.Element, m matrix) (JobImage, bool) {
+	href := strings.TrimSpace(el.Attr("", "href"))
+	loc := dataURIRegex.FindStringIndex(href)
+	if loc == nil {
+		return JobImage{}, false
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(href[loc[1]:]), ""))
+	if err != nil {
+		return JobImage{}, false
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return JobImage{}, false
+	}
+
+	attr := func(name string) float64 {
+		if v := parseNumbers(el.Attr("", name)); len(v) > 0 {
+			return v[0]
+		}
+		return 0
+	}
+	x, y, w, h := attr("x"), attr("y"), attr("width"), attr("height")
+	if w <= 0 || h <= 0 {
+		return JobImage{}, false
+	}
+
+	fields := strings.Fields(el.Attr("", "preserveAspectRatio"))
+	align, slice := "xMidYMid", false
+	if len(fields) > 0 && validAlign(fields[0]) {
+		align = fields[0]
+	}
+	if len(fields) > 1 {
+		slice = fields[1] == "slice"
+	}
+	if align != "none" {
+		scale := math.Min(w/float64(config.Width), h/float64(config.Height))
+		if slice {
+			scale = math.Max(w/float64(config.Width), h/float64(config.Height))
+		}
+		iw, ih := float64(config.Width)*scale, float64(config.Height)*scale
+		position := map[string]float64{"Min": 0, "Mid": .5, "Max": 1}
+		x += (w - iw) * position[align[1:4]]
+		y += (h - ih) * position[align[5:8]]
+		w, h = iw, ih
+	}
+
+	// the top of the image is at y, pdf puts the first row at the top of
+	// the unit square
+	return JobImage{Matrix: matrix{w, 0, 0, -h, x, y + h}.then(m), Data: data}, true
+}
@@ -2,81 +2,71 @@ package main
 
 import (
 	"bytes"
-	"io"
-	"io/ioutil"
-	"log"
-	"os"
-	"os/exec"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
 )
 
-// svgConvertBuffer uses inkscape to convert to a supported output format. (pdf default)
-// By default supported output types are: svg, png, ps, eps, pdf, emf, wmf
+// inkscapeBin is the inkscape executable, found on the path unless
+// SVG2LASER_INKSCAPE_PATH says where it is
+var inkscapeBin = envOr("SVG2LASER_INKSCAPE_PATH", "inkscape")
+
+// newInkscapeConverter converts with the inkscape executable bin. The
+// command line changed in inkscape 1.0, older versions do not work.
 // see: https://inkscape.org/doc/inkscape-man.html#export-type-TYPE-TYPE
-func svgConvertBuffer(inputBytes []byte, outputBuffer io.Writer, stderrBuffer io.Writer) error {
-	inkscapeExecutable := "inkscape"
-	if exePath, isSet := os.LookupEnv("SVG2LASER_INKSCAPE_PATH"); isSet {
-		inkscapeExecutable = exePath
+func newInkscapeConverter(bin string) *programConverter {
+	return &programConverter{
+		name:     "inkscape",
+		bin:      bin,
+		formats:  []string{"pdf", "ps", "eps", "png", "emf", "wmf", "svg"},
+		minMajor: 1,
+		args: func(to string) []string {
+			return []string{"--pipe", "--export-filename=-", "--export-type=" + to}
+		},
 	}
-	return execPipe(inkscapeExecutable, []string{"--pipe", "--export-filename=-", "--export-type=pdf"}, inputBytes, outputBuffer, stderrBuffer)
 }
 
-func execPipe(bin string, args []string, stdin []byte, outputBuffer io.Writer, stderrBuffer io.Writer) error {
-
-	cmd := exec.Command(bin, args...)
-	in, err := cmd.StdinPipe()
-	if err != nil {
-		return err
-	}
-	out, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
-	}
-	if cmd.Start() != nil {
-		return err
+// splitActions splits a list of inkscape actions separated by semicolons,
+// the way inkscape takes them
+func splitActions(list string) []string {
+	var actions []string
+	for _, action := range strings.Split(list, ";") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions = append(actions, action)
+		}
 	}
+	return actions
+}
 
-	_, err = in.Write(stdin)
-	if err != nil {
-		return err
+// runInkscapeActions runs clean.Actions with inkscape on the drawing in
+// file, named name, until ctx is done. Inkscape is given the drawing as
+// svg and the plain svg it writes back is returned, with name changed to
+// an svg file and the clean options it still needs, without the actions
+// so they are run once. The actions run in a shell of the pool of the
+// inkscape converter when it has one. Without actions everything is
+// returned as it is.
+// see: inkscape --action-list
+func runInkscapeActions(ctx context.Context, name string, file []byte, clean CleanOptions) (string, []byte, CleanOptions, error) {
+	if len(clean.Actions) == 0 {
+		return name, file, clean, nil
 	}
-	if in.Close() != nil {
-		return err
-	}
-
-	fileBytes, err := ioutil.ReadAll(out)
+	actions := clean.Actions
+	clean.Actions = nil
+	drawing, clean, err := drawingSVG(ctx, name, file, clean)
 	if err != nil {
-		return err
-	}
-	if out.Close() != nil {
-		return err
+		return name, nil, clean, err
 	}
 
-	_, err = io.Copy(outputBuffer, bytes.NewReader(fileBytes))
-	if err != nil {
-		return err
+	out := bytes.Buffer{}
+	if shells, ok := converters["inkscape"].(inkscapeShellConverter); ok {
+		err = shells.pool.runActions(ctx, drawing, actions, &out)
+	} else {
+		args := []string{"--pipe", "--actions=" + strings.Join(actions, ";"), "--export-type=svg", "--export-plain-svg", "--export-filename=-"}
+		err = execPipe(ctx, inkscapeBin, args, bytes.NewReader(drawing), &out, nil, defaultExecOptions)
 	}
-
-	stderrB, err := ioutil.ReadAll(stderr)
 	if err != nil {
-		return err
+		return name, nil, clean, fmt.Errorf("unable to run the inkscape actions - %w", err)
 	}
-
-	if stderr.Close() != nil {
-		return err
-	}
-
-	if err = cmd.Wait(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() != 3 {
-			log.Printf("ERROR: %s - %s\n", stderrB, err)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".svg", out.Bytes(), clean, nil
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/matryer/is"
+)
+
+// fakeInkscapeActions points inkscapeBin at a shell script standing in for
+// inkscape running actions. It keeps its args and stdin next to it and
+// writes a drawing of a 10mm square, as if it had turned text into paths.
+func fakeInkscapeActions(t *testing.T) (dir string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake inkscape is a shell script")
+	}
+	dir = t.TempDir()
+	bin := filepath.Join(dir, "inkscape")
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > " + filepath.Join(dir, "args") + "\n" +
+		"cat > " + filepath.Join(dir, "stdin") + "\n" +
+		"echo '<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"100mm\" height=\"100mm\" viewBox=\"0 0 100 100\"><path d=\"M10 10 H20 V20 H10 Z\" stroke=\"black\" fill=\"none\"/></svg>'\n"
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	previous := inkscapeBin
+	inkscapeBin = bin
+	t.Cleanup(func() { inkscapeBin = previous })
+	return dir
+}
+
+func TestRunInkscapeActions(t *testing.T) {
+	is := is.New(t)
+	dir := fakeInkscapeActions(t)
+	text := `<svg xmlns="http://www.w3.org/2000/svg" width="100mm" height="100mm" viewBox="0 0 100 100"><text x="10" y="20">A</text></svg>`
+
+	clean := defaultCleanOptions
+	clean.Actions = splitActions(" select-all; object-to-path ;")
+	is.Equal(clean.Actions, []string{"select-all", "object-to-path"})
+	job, err := loadJob(context.Background(), "part.svg", []byte(text), materialPresets["none"], clean)
+	is.NoErr(err)
+	is.Equal(len(job.Segments), 1)
+	is.Equal(job.Segments[0].Points[0][0], 10.0)
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	is.NoErr(err)
+	is.Equal(strings.TrimSpace(string(args)), "--pipe --actions=select-all;object-to-path --export-type=svg --export-plain-svg --export-filename=-")
+	stdin, err := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	is.NoErr(err)
+	is.Equal(string(stdin), text)
+
+	// other drawings are given to inkscape as svg
+	dxf := "0\nSECTION\n2\nENTITIES\n0\nLINE\n8\n0\n10\n0\n20\n0\n11\n50\n21\n0\n0\nENDSEC\n0\nEOF\n"
+	drawing, rest, err := drawingSVG(context.Background(), "part.dxf", []byte(dxf), clean)
+	is.NoErr(err)
+	is.True(strings.Contains(string(drawing), `d="M10 10 H20 V20 H10 Z"`))
+	is.Equal(rest, cleanedOptions) // it was cleaned when it was read
+	stdin, err = ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	is.NoErr(err)
+	is.True(strings.Contains(string(stdin), "<svg"))
+
+	// without actions inkscape is not run
+	name, file, _, err := runInkscapeActions(context.Background(), "part.svg", []byte(text), defaultCleanOptions)
+	is.NoErr(err)
+	is.Equal(name, "part.svg")
+	is.Equal(string(file), text)
+}
+
+func TestRunInkscapeActionsContext(t *testing.T) {
+	is := is.New(t)
+	fakeInkscapeActions(t)
+	clean := CleanOptions{Actions: []string{"select-all"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := loadJob(ctx, "part.svg", []byte(`<svg viewBox="0 0 10 10"/>`), materialPresets["none"], clean)
+	is.True(errors.Is(err, context.Canceled))
+}
+
+func TestRunInkscapeActionsPool(t *testing.T) {
+	is := is.New(t)
+	bin, starts := fakeInkscapeShell(t)
+	previous := converters["inkscape"]
+	shells := newInkscapeShellConverter(bin, InkscapePoolOptions{Workers: 1, Queue: 1, Timeout: 10 * time.Second, HealthAfter: time.Minute})
+	converters["inkscape"] = shells
+	t.Cleanup(func() {
+		shells.pool.close()
+		converters["inkscape"] = previous
+	})
+
+	// the fake shell exports the drawing as it was opened
+	text := `<svg xmlns="http://www.w3.org/2000/svg" width="100mm" height="100mm" viewBox="0 0 100 100"><path d="M10 10 H20 V20 H10 Z" stroke="black" fill="none"/></svg>`
+	for i := 0; i < 2; i++ {
+		job, err := loadJob(context.Background(), "part.svg", []byte(text), materialPresets["none"], CleanOptions{Actions: []string{"select-all"}})
+		is.NoErr(err)
+		is.Equal(len(job.Segments), 1)
+	}
+	is.Equal(startedShells(t, starts), 1)
+}
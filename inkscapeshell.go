@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InkscapePoolOptions size a pool of inkscape shells
+type InkscapePoolOptions struct {
+	// Workers is how many conversions run at once, each in its own shell
+	Workers int
+	// MaxJobs is how many conversions a shell does before it is replaced,
+	// inkscape grows the longer it runs
+	MaxJobs int
+	// Queue is how many conversions may wait for a shell, more are turned
+	// away
+	Queue int
+	// Timeout is how long a shell may take to start or to convert
+	Timeout time.Duration
+	// HealthAfter is how long a shell may sit idle before it is checked
+	// to still answer before it is used
+	HealthAfter time.Duration
+}
+
+var defaultInkscapePoolOptions = InkscapePoolOptions{
+	Workers:     0,
+	MaxJobs:     50,
+	Queue:       32,
+	Timeout:     2 * time.Minute,
+	HealthAfter: time.Minute,
+}
+
+// errPoolFull is returned for a conversion when the queue of the pool is
+// full
+var errPoolFull = errors.New("too many conversions waiting, try again later")
+
+// shellPrompt is what inkscape prints when it is ready for the next line
+const shellPrompt = "> "
+
+// inkscapePool keeps inkscape running in shell mode, so a conversion does
+// not pay for starting it. Shells are started when they are needed, up to
+// Workers of them.
+type inkscapePool struct {
+	bin  string
+	opts InkscapePoolOptions
+	// admitted holds a token for every conversion running or waiting,
+	// running holds one for every conversion running
+	admitted chan struct{}
+	running  chan struct{}
+
+	mu     sync.Mutex
+	idle   []*inkscapeShell
+	closed bool
+}
+
+func newInkscapePool(bin string, opts InkscapePoolOptions) *inkscapePool {
+	return &inkscapePool{
+		bin:      bin,
+		opts:     opts,
+		admitted: make(chan struct{}, opts.Workers+opts.Queue),
+		running:  make(chan struct{}, opts.Workers),
+	}
+}
+
+// convert converts the svg document to the format to, pdf or png for
+// example, with one of the shells of the pool
+func (p *inkscapePool) convert(ctx context.Context, svgData []byte, to string, out io.Writer) error {
+	return p.export(ctx, svgData, []string{"export-type:" + to}, to, out)
+}
+
+// runActions runs the inkscape actions on the svg document with one of the
+// shells of the pool and writes the plain svg inkscape exports after them
+func (p *inkscapePool) runActions(ctx context.Context, svgData []byte, actions []string, out io.Writer) error {
+	actions = append(append([]string{}, actions...), "export-type:svg", "export-plain-svg")
+	return p.export(ctx, svgData, actions, "svg", out)
+}
+
+// export opens the svg document in one of the shells of the pool, runs the
+// actions on it and writes what inkscape exports after them to a file
+// with the extension ext
+func (p *inkscapePool) export(ctx context.Context, svgData []byte, actions []string, ext string, out io.Writer) error {
+	select {
+	case p.admitted <- struct{}{}:
+		defer func() { <-p.admitted }()
+	default:
+		return errPoolFull
+	}
+	select {
+	case p.running <- struct{}{}:
+		defer func() { <-p.running }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+	shell, err := p.shell(ctx)
+	if err != nil {
+		return err
+	}
+	// what inkscape wrote for earlier conversions is not this one's
+	shell.stderr.Reset()
+
+	dir, err := ioutil.TempDir("", "svg2laser")
+	if err != nil {
+		p.put(shell)
+		return err
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "drawing.svg"), filepath.Join(dir, "exported."+ext)
+	if err := ioutil.WriteFile(input, svgData, 0600); err != nil {
+		p.put(shell)
+		return err
+	}
+
+	line := fmt.Sprintf("file-open:%s; %s; export-filename:%s; export-do; file-close", input, strings.Join(actions, "; "), output)
+	if err := shell.run(ctx, line); err != nil {
+		shell.stop()
+		return err
+	}
+	// the shell may be running the next conversion once it is put back
+	stderr := shell.stderr.String()
+	shell.jobs++
+	p.put(shell)
+
+	converted, err := ioutil.ReadFile(output)
+	if err != nil {
+		return &ExecError{Bin: p.bin, Args: []string{"--shell", line}, ExitCode: -1, Stderr: stderr, Err: errors.New("nothing was exported")}
+	}
+	_, err = out.Write(converted)
+	return err
+}
+
+// shell is an idle shell that still answers, or a new one
+func (p *inkscapePool) shell(ctx context.Context) (*inkscapeShell, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errors.New("the inkscape pool is closed")
+		}
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			return startInkscapeShell(ctx, p.bin)
+		}
+		shell := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if shell.healthy(ctx, p.opts.HealthAfter) {
+			return shell, nil
+		}
+		shell.stop()
+	}
+}
+
+// put hands a shell back after a conversion, it is stopped when it has
+// done its share of them
+func (p *inkscapePool) put(shell *inkscapeShell) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.opts.MaxJobs > 0 && shell.jobs >= p.opts.MaxJobs {
+		go shell.stop()
+		return
+	}
+	shell.used = time.Now()
+	p.idle = append(p.idle, shell)
+}
+
+// close stops the idle shells, the busy ones stop when they are done. The
+// pool converts nothing after it is closed.
+func (p *inkscapePool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle, p.closed = nil, true
+	p.mu.Unlock()
+	for _, shell := range idle {
+		shell.stop()
+	}
+}
+
+// inkscapeShell is an inkscape process in shell mode. It reads a line of
+// actions at a time and prints the prompt when it is done with it.
+type inkscapeShell struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *headBuffer
+	// exited is closed when the process has exited
+	exited chan struct{}
+	jobs   int
+	used   time.Time
+}
+
+func startInkscapeShell(ctx context.Context, bin string) (*inkscapeShell, error) {
+	shell := &inkscapeShell{
+		cmd:    exec.Command(bin, "--shell"),
+		stderr: &headBuffer{max: maxStderr},
+		exited: make(chan struct{}),
+	}
+	shell.cmd.Stderr = shell.stderr
+	stdin, err := shell.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := shell.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	shell.stdin, shell.stdout = stdin, bufio.NewReader(stdout)
+	if err := shell.cmd.Start(); err != nil {
+		return nil, &ExecError{Bin: bin, Args: []string{"--shell"}, ExitCode: -1, Err: err}
+	}
+	go func() {
+		shell.cmd.Wait()
+		close(shell.exited)
+	}()
+
+	// the banner ends with the first prompt
+	if err := shell.wait(ctx); err != nil {
+		shell.stop()
+		return nil, err
+	}
+	shell.used = time.Now()
+	return shell, nil
+}
+
+// run sends a line of actions and waits for inkscape to finish them
+func (s *inkscapeShell) run(ctx context.Context, line string) error {
+	if _, err := io.WriteString(s.stdin, line+"\n"); err != nil {
+		return s.error(line, err)
+	}
+	if err := s.wait(ctx); err != nil {
+		return s.error(line, err)
+	}
+	return nil
+}
+
+// wait reads the output up to the next prompt, a prompt is at the start
+// of a line. The shell is killed if ctx is done first.
+func (s *inkscapeShell) wait(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		lineStart := true
+		for {
+			b, err := s.stdout.ReadByte()
+			if err != nil {
+				done <- fmt.Errorf("inkscape exited - %w", err)
+				return
+			}
+			if lineStart && b == shellPrompt[0] {
+				if next, err := s.stdout.Peek(1); err == nil && next[0] == shellPrompt[1] {
+					s.stdout.ReadByte()
+					done <- nil
+					return
+				}
+			}
+			lineStart = b == '\n'
+		}
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		s.cmd.Process.Kill()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// healthy reports if the shell is still running and, when it has been
+// idle for longer than after, still answers
+func (s *inkscapeShell) healthy(ctx context.Context, after time.Duration) bool {
+	select {
+	case <-s.exited:
+		return false
+	default:
+	}
+	if time.Since(s.used) <= after {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return s.run(ctx, "") == nil
+}
+
+// stop ends the shell, killing it if it does not quit by itself
+func (s *inkscapeShell) stop() {
+	s.stdin.Close()
+	select {
+	case <-s.exited:
+	case <-time.After(5 * time.Second):
+		s.cmd.Process.Kill()
+		<-s.exited
+	}
+}
+
+func (s *inkscapeShell) error(line string, err error) error {
+	return &ExecError{Bin: s.cmd.Path, Args: []string{"--shell", line}, ExitCode: -1, Stderr: s.stderr.String(), Err: err}
+}
+
+// inkscapeShellConverter is the inkscape converter using a pool of shells
+// instead of starting inkscape for every conversion
+type inkscapeShellConverter struct {
+	*programConverter
+	pool *inkscapePool
+}
+
+func newInkscapeShellConverter(bin string, opts InkscapePoolOptions) inkscapeShellConverter {
+	return inkscapeShellConverter{
+		programConverter: newInkscapeConverter(bin),
+		pool:             newInkscapePool(bin, opts),
+	}
+}
+
+func (c inkscapeShellConverter) Convert(ctx context.Context, input []byte, from, to string, opts ConvertOptions, out io.Writer) error {
+	drawing, err := laserSVG(ctx, input, from, opts)
+	if err != nil {
+		return err
+	}
+	converted := bytes.Buffer{}
+	if err := c.pool.convert(ctx, drawing, to, &converted); err != nil {
+		return err
+	}
+	_, err = out.Write(converted.Bytes())
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/matryer/is"
+)
+
+// fakeInkscapeShell writes a shell script standing in for inkscape in
+// shell mode. It copies the file it opens to the file it exports, taking
+// a second for files with slow in them, complains about files with broken
+// in them, and notes every start in the file starts next to it.
+func fakeInkscapeShell(t *testing.T) (bin string, starts string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake inkscape is a shell script")
+	}
+	dir := t.TempDir()
+	bin, starts = filepath.Join(dir, "inkscape"), filepath.Join(dir, "starts")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"--version\" ]; then echo 'Inkscape 1.2.1 (9c6d41e410, 2022-07-14)'; exit 0; fi\n" +
+		"[ \"$1\" = \"--shell\" ] || exit 2\n" +
+		"echo $$ >> " + starts + "\n" +
+		"printf 'Inkscape interactive shell mode.\\n> '\n" +
+		"while IFS= read -r line; do\n" +
+		"  in=$(echo \"$line\" | sed -n 's/.*file-open:\\([^;]*\\).*/\\1/p')\n" +
+		"  out=$(echo \"$line\" | sed -n 's/.*export-filename:\\([^;]*\\).*/\\1/p')\n" +
+		"  if [ -n \"$in\" ]; then\n" +
+		"    grep -q slow \"$in\" && sleep 1\n" +
+		"    if grep -q broken \"$in\"; then echo \"nothing to export in $in\" >&2; else cp \"$in\" \"$out\"; fi\n" +
+		"  fi\n" +
+		"  printf '> '\n" +
+		"done\n"
+	if err := ioutil.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return bin, starts
+}
+
+func startedShells(t *testing.T, starts string) int {
+	data, err := ioutil.ReadFile(starts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestInkscapePool(t *testing.T) {
+	is := is.New(t)
+	bin, starts := fakeInkscapeShell(t)
+	ctx := context.Background()
+
+	// shells are reused and replaced after MaxJobs conversions
+	pool := newInkscapePool(bin, InkscapePoolOptions{Workers: 1, MaxJobs: 2, Queue: 4, Timeout: 10 * time.Second, HealthAfter: time.Minute})
+	defer pool.close()
+	for i := 0; i < 5; i++ {
+		out := bytes.Buffer{}
+		is.NoErr(pool.convert(ctx, []byte("<svg/>"), "pdf", &out))
+		is.Equal(out.String(), "<svg/>")
+	}
+	is.Equal(startedShells(t, starts), 3)
+
+	// a shell that died is replaced
+	pool.mu.Lock()
+	pool.idle[0].cmd.Process.Kill()
+	<-pool.idle[0].exited
+	pool.mu.Unlock()
+	is.NoErr(pool.convert(ctx, []byte("<svg/>"), "pdf", &bytes.Buffer{}))
+	is.Equal(startedShells(t, starts), 4)
+
+	// a shell idle for too long is asked if it still answers
+	pool.opts.HealthAfter = 0
+	is.NoErr(pool.convert(ctx, []byte("<svg/>"), "pdf", &bytes.Buffer{}))
+	is.Equal(startedShells(t, starts), 4)
+
+	// nothing exported, the error has none of what inkscape wrote for the
+	// conversions before
+	for i := 0; i < 3; i++ {
+		err := pool.convert(ctx, []byte("<svg>broken</svg>"), "pdf", &bytes.Buffer{})
+		var execErr *ExecError
+		is.True(errors.As(err, &execErr))
+		is.True(strings.Count(execErr.Stderr, "nothing to export") <= 1)
+	}
+}
+
+func TestInkscapePoolQueue(t *testing.T) {
+	is := is.New(t)
+	bin, starts := fakeInkscapeShell(t)
+	pool := newInkscapePool(bin, InkscapePoolOptions{Workers: 2, MaxJobs: 10, Queue: 1, Timeout: 10 * time.Second, HealthAfter: time.Minute})
+	defer pool.close()
+
+	// two run at once, one waits and the fourth is turned away
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = pool.convert(context.Background(), []byte("<svg>slow</svg>"), "pdf", &bytes.Buffer{})
+		}(i)
+	}
+	time.Sleep(300 * time.Millisecond)
+	is.Equal(pool.convert(context.Background(), []byte("<svg/>"), "pdf", &bytes.Buffer{}), errPoolFull)
+	wg.Wait()
+	for _, err := range errs {
+		is.NoErr(err)
+	}
+	is.Equal(startedShells(t, starts), 2)
+
+	// a conversion waiting for a shell gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			pool.convert(context.Background(), []byte("<svg>slow</svg>"), "pdf", &bytes.Buffer{})
+		}()
+	}
+	time.Sleep(300 * time.Millisecond)
+	is.Equal(pool.convert(ctx, []byte("<svg/>"), "pdf", &bytes.Buffer{}), context.DeadlineExceeded)
+	wg.Wait()
+
+	// a conversion taking too long kills its shell
+	pool.opts.Timeout = 100 * time.Millisecond
+	err := pool.convert(context.Background(), []byte("<svg>slow</svg>"), "pdf", &bytes.Buffer{})
+	is.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestInkscapeShellConverter(t *testing.T) {
+	is := is.New(t)
+	bin, _ := fakeInkscapeShell(t)
+	c := newInkscapeShellConverter(bin, InkscapePoolOptions{Workers: 1, MaxJobs: 10, Queue: 1, Timeout: 10 * time.Second, HealthAfter: time.Minute})
+	defer c.pool.close()
+	is.Equal(c.Name(), "inkscape")
+
+	out := bytes.Buffer{}
+	is.NoErr(c.Convert(context.Background(), []byte(converterSVG), "svg", "pdf", ConvertOptions{Name: "part.svg", Strokes: defaultStrokeOptions}, &out))
+	// the shell is given the svg with the strokes drawn for the laser
+	is.True(strings.Contains(out.String(), `stroke-width="0.096"`))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+	"github.com/rustyoz/svg"
+)
+
+// joinTolerance is how far apart, in millimetres, the ends of two
+// segments may be and still be joined into one contour
+const joinTolerance = .01
+
+// Job is a drawing prepared for the laser. Coordinates are millimetres
+// from the top left corner of the page.
+type Job struct {
+	Name       string
+	WidthMm    float64
+	HeightMm   float64
+	Material   Material
+	Operations []Operation
+	Segments   []svg.Segment
+	Images     []JobImage
+}
+
+// JobOptions are the settings for the processing steps run on a job
+type JobOptions struct {
+	Offset OffsetOptions
+	Tabs   TabOptions
+	Hatch  HatchOptions
+	// Leads are the leads of operations by name, they take the place of
+	// the leads the operations of the job have
+	Leads map[string]LeadOptions
+}
+
+var defaultJobOptions = JobOptions{
+	Offset: defaultOffsetOptions,
+	Tabs:   defaultTabOptions,
+	Hatch:  defaultHatchOptions,
+}
+
+// process runs the processing steps on the job in order. Hatching only
+// adds engraved lines so it goes first. Kerf comes next so the other steps
+// work on the path the beam really takes. The cut order is settled while
+// the contours are still whole, tabs split outer profiles. Leads only go
+// on contours that are still closed after the tabs split them, a tabbed
+// contour starts and ends at a tab that gets broken off anyway.
+func (j *Job) process(opts JobOptions) {
+	for i, op := range j.Operations {
+		if lead, ok := opts.Leads[op.Name]; ok {
+			j.Operations[i].Lead = lead
+		}
+	}
+	j.applyHatch(opts.Hatch)
+	j.applyKerf(opts.Offset)
+	j.applyOrder()
+	j.applyTabs(opts.Tabs)
+	j.applyLeads(opts.Offset.Tolerance)
+}
+
+// reshapes reports if processing a job cut from the material changes its
+// geometry, rather than only the order it is cut in
+func (o JobOptions) reshapes(m Material) bool {
+	for _, lead := range o.Leads {
+		if lead.enabled() {
+			return true
+		}
+	}
+	return m.KerfMm > 0 || o.Tabs.Count > 0 || o.Hatch.SpacingMm > 0
+}
+
+// jobReaders load the drawing formats other than svg, by file extension
+var jobReaders = map[string]func(name string, file []byte, material Material, clean CleanOptions) (*Job, error){
+	".dxf":  loadDXFJob,
+	".pdf":  loadPDFJob,
+	".ps":   loadPSJob,
+	".eps":  loadPSJob,
+	".plt":  loadHPGLJob,
+	".hpgl": loadHPGLJob,
+	".hpg":  loadHPGLJob,
+}
+
+// loadJob reads a drawing into a job, with the reader for the extension
+// of name. Anything else is read as svg. Inkscape actions are run on the
+// drawing first, until ctx is done.
+func loadJob(ctx context.Context, name string, file []byte, material Material, clean CleanOptions) (*Job, error) {
+	name, file, clean, err := runInkscapeActions(ctx, name, file, clean)
+	if err != nil {
+		return nil, err
+	}
+	if read, ok := jobReaders[strings.ToLower(filepath.Ext(name))]; ok {
+		return read(name, file, material, clean)
+	}
+	return loadSVGJob(name, file, material, clean)
+}
+
+// cleanedOptions are the clean options of a drawing that has been cleaned
+// already, which leave it as it is
+var cleanedOptions = CleanOptions{KeepChrome: true, KeepAnnotations: true}
+
+// drawingSVG is the drawing in file as an svg document, with the clean
+// options it still needs. Svg documents are returned as they are, to be
+// cleaned with clean. Other drawings are cleaned when they are loaded and
+// written out as svg, they need no more cleaning.
+func drawingSVG(ctx context.Context, name string, file []byte, clean CleanOptions) ([]byte, CleanOptions, error) {
+	name, file, clean, err := runInkscapeActions(ctx, name, file, clean)
+	if err != nil {
+		return nil, clean, err
+	}
+	read, ok := jobReaders[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return file, clean, nil
+	}
+	job, err := read(name, file, materialPresets["none"], clean)
+	if err != nil {
+		return nil, clean, err
+	}
+	out := bytes.Buffer{}
+	if err := job.writeSVG(&out, SVGOptions{}); err != nil {
+		return nil, clean, err
+	}
+	return out.Bytes(), cleanedOptions, nil
+}
+
+// loadSVGJob parses an svg document into a job. The document is cleaned
+// up with clean, the drawing is converted to millimetres and the separate
+// polylines Onshape exports for every edge are joined back into contours.
+func loadSVGJob(name string, file []byte, material Material, clean CleanOptions) (*Job, error) {
+	rootEle, err := xmltree.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse svg - %w", err)
+	}
+	if rootEle.StartElement.Name.Local != "svg" {
+		return nil, fmt.Errorf("root element is not svg, it is '%s'", rootEle.StartElement.Name.Local)
+	}
+	attrs := SVGAttrs{
+		width:               rootEle.Attr("", "width"),
+		height:              rootEle.Attr("", "height"),
+		viewbox:             rootEle.Attr("", "viewBox"),
+		preserveAspectRatio: rootEle.Attr("", "preserveAspectRatio"),
+	}
+	pxPerInX, pxPerInY, err := attrs.getResolutionPxPerIn()
+	if err != nil {
+		return nil, fmt.Errorf("loadSVGJob - %w", err)
+	}
+	widthIn, heightIn, err := attrs.pageSizeIn()
+	fitDrawing := errors.Is(err, errPageSize)
+	if err != nil && !fitDrawing {
+		return nil, fmt.Errorf("loadSVGJob - %w", err)
+	}
+	viewBox, err := parseViewBox(attrs.viewbox)
+	if err != nil {
+		return nil, fmt.Errorf("loadSVGJob - %w", err)
+	}
+	if viewBox == nil {
+		viewBox = []float64{0, 0, widthIn * pxPerInX, heightIn * pxPerInY}
+	}
+	mmPerUnitX, mmPerUnitY := MILIMETERS_PER_INCH/pxPerInX, MILIMETERS_PER_INCH/pxPerInY
+	cleanDocument(rootEle, attrs, clean, name)
+	images := svgImages(rootEle, matrix{mmPerUnitX, 0, 0, mmPerUnitY, -viewBox[0] * mmPerUnitX, -viewBox[1] * mmPerUnitY})
+
+	doc, err := svg.ParseSvg(rootEle.String(), name, 0)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := doc.Segments()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read geometry of %s - %w", name, err)
+	}
+
+	transformSegments(segments, func(p [2]float64) [2]float64 {
+		return [2]float64{(p[0] - viewBox[0]) * mmPerUnitX, (p[1] - viewBox[1]) * mmPerUnitY}
+	})
+	for i := range segments {
+		segments[i].Width *= math.Sqrt(mmPerUnitX * mmPerUnitY)
+	}
+	if fitDrawing {
+		// without a viewBox the user units are css pixels, like for the
+		// resolution, and a page of unknown size reaches to the far side
+		// of the drawing
+		b := segmentsBounds(segments)
+		if w, ok, _ := parseLengthIn("width", attrs.width); ok {
+			widthIn = w
+		} else if !b.isEmpty() {
+			widthIn = math.Max(b.MaxX, 0) / MILIMETERS_PER_INCH
+		}
+		if h, ok, _ := parseLengthIn("height", attrs.height); ok {
+			heightIn = h
+		} else if !b.isEmpty() {
+			heightIn = math.Max(b.MaxY, 0) / MILIMETERS_PER_INCH
+		}
+	}
+
+	return &Job{
+		Name:       name,
+		WidthMm:    widthIn * MILIMETERS_PER_INCH,
+		HeightMm:   heightIn * MILIMETERS_PER_INCH,
+		Material:   material,
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments:   joinSegments(segments, joinTolerance),
+		Images:     images,
+	}, nil
+}
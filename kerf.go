@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// applyKerf compensates the closed contours that are cut for the material
+// the beam removes. Outer profiles of parts are moved out by half the
+// kerf of the material and holes are moved in, which one a contour is
+// comes from the containment tree. Open segments are left alone since
+// there is no telling which side of them is the part.
+func (j *Job) applyKerf(opts OffsetOptions) {
+	half := j.Material.KerfMm / 2
+	if half <= 0 {
+		return
+	}
+
+	nodes := j.cutContours()
+	var compensated []svg.Segment
+	for i, s := range j.Segments {
+		node := nodes[i]
+		if node == nil {
+			compensated = append(compensated, s)
+			continue
+		}
+		delta := half
+		if node.isHole() {
+			delta = -half
+		}
+		rings := offsetRing(node.Ring, delta, opts)
+		if len(rings) == 0 {
+			log.Printf("WARNING: %s: a hole at (%.2f, %.2f) is smaller than the kerf of %s, leaving it uncompensated",
+				j.Name, node.Bounds.MinX, node.Bounds.MinY, j.Material.Name)
+			compensated = append(compensated, s)
+			continue
+		}
+		for _, r := range rings {
+			offset := s
+			offset.Points = closeRing(r)
+			compensated = append(compensated, offset)
+		}
+	}
+	j.Segments = compensated
+}
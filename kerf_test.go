@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func square(x, y, size float64) [][2]float64 {
+	return [][2]float64{{x, y}, {x + size, y}, {x + size, y + size}, {x, y + size}}
+}
+
+func TestOffsetRing(t *testing.T) {
+	tests := []struct {
+		name     string
+		ring     [][2]float64
+		delta    float64
+		join     JoinStyle
+		wantArea float64
+		wantN    int
+	}{
+		{name: "grow miter", ring: square(0, 0, 10), delta: 1, join: JoinMiter, wantArea: 144, wantN: 1},
+		{name: "grow round", ring: square(0, 0, 10), delta: 1, join: JoinRound, wantArea: 100 + 40 + math.Pi, wantN: 1},
+		{name: "shrink", ring: square(0, 0, 10), delta: -1, join: JoinRound, wantArea: 64, wantN: 1},
+		{name: "reversed ring keeps direction", ring: reverseRing(square(0, 0, 10)), delta: 1, join: JoinMiter, wantArea: -144, wantN: 1},
+		{name: "collapse", ring: square(0, 0, 2), delta: -1.5, join: JoinRound, wantN: 0},
+		{
+			// two squares joined by a 1mm wide neck that disappears when
+			// shrunk by more than half a millimetre
+			name: "neck splits",
+			ring: [][2]float64{
+				{0, 0}, {10, 0}, {10, 4.5}, {20, 4.5}, {20, 0}, {30, 0},
+				{30, 10}, {20, 10}, {20, 5.5}, {10, 5.5}, {10, 10}, {0, 10},
+			},
+			delta:    -1,
+			join:     JoinMiter,
+			wantArea: 2 * 64,
+			wantN:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			opts := defaultOffsetOptions
+			opts.Join = tt.join
+			opts.Tolerance = 1e-4
+
+			rings := offsetRing(tt.ring, tt.delta, opts)
+			is.Equal(len(rings), tt.wantN)
+			area := 0.0
+			for _, r := range rings {
+				area += ringArea(r)
+			}
+			if math.Abs(area-tt.wantArea) > 1e-2 {
+				t.Errorf("area %f, want %f", area, tt.wantArea)
+			}
+		})
+	}
+}
+
+func TestOffsetRingConcaveCorner(t *testing.T) {
+	is := is.New(t)
+	// an L shape, the inner corner must not leave a loop behind
+	l := [][2]float64{{0, 0}, {10, 0}, {10, 5}, {5, 5}, {5, 10}, {0, 10}}
+	rings := offsetRing(l, 1, OffsetOptions{Join: JoinMiter, MiterLimit: 4})
+	is.Equal(len(rings), 1)
+	is.Equal(len(rings[0]), 6) // still an L
+	is.True(math.Abs(ringArea(rings[0])-(12*12-5*5)) < 1e-6)
+}
+
+func TestContainmentTree(t *testing.T) {
+	is := is.New(t)
+	segments := []svg.Segment{
+		{Closed: true, Points: closeRing(square(2, 2, 2))},     // hole
+		{Closed: true, Points: closeRing(square(0, 0, 10))},    // part
+		{Closed: true, Points: closeRing(square(2.5, 2.5, 1))}, // part inside the hole
+		{Points: [][2]float64{{1, 1}, {9, 9}}},                 // open
+		{Closed: true, Points: closeRing(square(20, 0, 5))},    // another part
+	}
+	roots, nodes := containmentTree(segments)
+	is.Equal(len(roots), 2)
+	is.True(nodes[3] == nil)
+	is.Equal(nodes[1].Depth, 0)
+	is.Equal(nodes[0].Depth, 1)
+	is.True(nodes[0].isHole())
+	is.Equal(nodes[2].Depth, 2)
+	is.True(nodes[2].Parent == nodes[0])
+	is.Equal(nodes[4].Depth, 0)
+}
+
+func TestApplyKerf(t *testing.T) {
+	is := is.New(t)
+	// a 30mm square part with a 10mm square hole, drawn at 96 px per inch
+	file := []byte(`<svg width="50.8mm" height="50.8mm" viewBox="0 0 192 192">
+<g fill="none" stroke="black" stroke-width="1">
+<polyline points="0,0 113.385827,0 113.385827,113.385827"/>
+<polyline points="113.385827,113.385827 0,113.385827 0,0"/>
+<polygon points="37.795276,37.795276 75.590551,37.795276 75.590551,75.590551 37.795276,75.590551"/>
+</g>
+</svg>`)
+	job, err := loadSVGJob("test", file, materialPresets["plywood-3mm"], defaultCleanOptions)
+	is.NoErr(err)
+	is.Equal(len(job.Segments), 2) // the two polylines are joined into one contour
+	is.True(math.Abs(job.WidthMm-50.8) < 1e-6)
+
+	job.applyKerf(OffsetOptions{Join: JoinMiter, MiterLimit: 4})
+	is.Equal(len(job.Segments), 2)
+
+	var sizes []float64
+	for _, s := range job.Segments {
+		is.True(s.Closed)
+		sizes = append(sizes, pointsBounds(s.Points).width())
+	}
+	// the hole shrinks by the kerf and the part grows by it
+	is.True(math.Abs(sizes[0]-(10-.15)) < 1e-4)
+	is.True(math.Abs(sizes[1]-(30+.15)) < 1e-4)
+}
+
+func TestLoadSVGJobOnshape(t *testing.T) {
+	is := is.New(t)
+	file, err := ioutil.ReadFile("./samples/Circles for Cutting Drawing 1 Copy 1.svg")
+	is.NoErr(err)
+
+	job, err := loadSVGJob("circles", file, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	// 3600 user units on a 304.8mm page, exactly 300 per inch
+	is.True(math.Abs(job.WidthMm-304.8) < 1e-9)
+	is.True(math.Abs(job.HeightMm-304.8) < 1e-9)
+
+	closed := 0
+	for _, s := range job.Segments {
+		if s.Closed {
+			closed++
+		}
+	}
+	// the polylines of the background, border and circles all join up
+	is.True(closed > 200)
+	is.True(closed >= len(job.Segments)-1)
+}
+
+func TestLoadSVGJobWithoutSize(t *testing.T) {
+	is := is.New(t)
+	// no viewBox and no size, the user units are css pixels
+	job, err := loadSVGJob("part", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><rect x="96" y="0" width="96" height="192" fill="none" stroke="#000000"/></svg>`), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.True(math.Abs(job.WidthMm-50.8) < 1e-9)
+	is.True(math.Abs(job.HeightMm-50.8) < 1e-9)
+	b := segmentsBounds(job.Segments)
+	is.True(math.Abs(b.MinX-25.4) < 1e-9)
+	is.True(math.Abs(b.width()-25.4) < 1e-9)
+
+	// a width on its own is kept
+	job, err = loadSVGJob("part", []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="4in"><rect x="96" y="0" width="96" height="192" fill="none" stroke="#000000"/></svg>`), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.True(math.Abs(job.WidthMm-101.6) < 1e-9)
+	is.True(math.Abs(job.HeightMm-50.8) < 1e-9)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LeadStyle is the shape of the move onto or off a contour
+type LeadStyle int
+
+const (
+	LeadNone LeadStyle = iota
+	// LeadLine comes in square to the contour
+	LeadLine
+	// LeadArc curves onto the contour so it is entered tangentially
+	LeadArc
+)
+
+// LeadOptions controls how the laser starts and finishes a closed contour.
+// Piercing and stopping on the contour leaves a burn mark on the edge of
+// the part, a lead moves that mark onto the waste side.
+type LeadOptions struct {
+	In  LeadStyle
+	Out LeadStyle
+	// LengthMm is the length of a straight lead and the radius of an arc
+	LengthMm float64
+	// OvercutMm is how far past the start the contour is cut again, so the
+	// end of the cut overlaps its start and no sliver is left
+	OvercutMm float64
+}
+
+// leadStyles are the lead styles by name
+var leadStyles = map[string]LeadStyle{"none": LeadNone, "line": LeadLine, "arc": LeadArc}
+
+// parseLeads reads the leads of operations, like cut=arc:2:0.5. Each is
+// operation=style:length with an optional :overcut in millimetres. The
+// style is none, line or arc, or the lead in and lead out apart like
+// arc/line. The operation must be one of operations.
+func parseLeads(list string, operations []Operation) (map[string]LeadOptions, error) {
+	leads := map[string]LeadOptions{}
+	for _, entry := range splitList(list) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("lead '%s' is not operation=style:length", entry)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !hasOperation(operations, name) {
+			var names []string
+			for _, op := range operations {
+				names = append(names, op.Name)
+			}
+			return nil, fmt.Errorf("lead '%s' is not for an operation, expected one of %s", entry, strings.Join(names, ", "))
+		}
+		fields := strings.Split(strings.TrimSpace(parts[1]), ":")
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("lead '%s' is not operation=style:length:overcut", entry)
+		}
+		styles := strings.SplitN(strings.ToLower(fields[0]), "/", 2)
+		in, okIn := leadStyles[styles[0]]
+		out, okOut := in, okIn
+		if len(styles) == 2 {
+			out, okOut = leadStyles[styles[1]]
+		}
+		if !okIn || !okOut {
+			return nil, fmt.Errorf("lead style of '%s' is not none, line or arc", entry)
+		}
+		lead := LeadOptions{In: in, Out: out}
+		var err error
+		if lead.LengthMm, err = strconv.ParseFloat(fields[1], 64); err != nil || lead.LengthMm < 0 {
+			return nil, fmt.Errorf("lead length of '%s' is not a length in mm", entry)
+		}
+		if len(fields) == 3 {
+			if lead.OvercutMm, err = strconv.ParseFloat(fields[2], 64); err != nil || lead.OvercutMm < 0 {
+				return nil, fmt.Errorf("overcut of '%s' is not a length in mm", entry)
+			}
+		}
+		leads[name] = lead
+	}
+	return leads, nil
+}
+
+func hasOperation(operations []Operation, name string) bool {
+	for _, op := range operations {
+		if op.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o LeadOptions) enabled() bool {
+	return ((o.In != LeadNone || o.Out != LeadNone) && o.LengthMm > 0) || o.OvercutMm > 0
+}
+
+// applyLeads adds the lead in, overcut and lead out of its operation to
+// every closed contour of an operation with leads. The waste side is
+// outside of the outer profile of a part and inside of a hole, which one
+// comes from the containment tree of the cut contours. A contour of
+// another operation is treated like a cut contour where it is, inside a
+// part it is a hole. A contour with leads starts and ends off the contour
+// so it is no longer closed.
+func (j *Job) applyLeads(tolerance float64) {
+	nodes := j.cutContours()
+	for i, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || !op.Lead.enabled() || !s.Closed || len(openRing(s.Points)) < 3 {
+			continue
+		}
+		lead := op.Lead
+		hole := cutDepth(i, j.Segments, nodes)%2 == 1
+		// a lead must stay inside the hole it is in
+		if hole {
+			b := pointsBounds(s.Points)
+			lead.LengthMm = math.Min(lead.LengthMm, math.Min(b.width(), b.height())/4)
+		}
+		j.Segments[i].Points = leadPath(s.Points, hole, lead, tolerance)
+		j.Segments[i].Closed = false
+	}
+}
+
+// leadPath builds the path that cuts a closed contour with leads on the
+// waste side. The cut starts on the straight edge nearest to the start of
+// the contour.
+func leadPath(points [][2]float64, hole bool, lead LeadOptions, tolerance float64) [][2]float64 {
+	ring := openRing(points)
+	area := ringArea(ring)
+	points = startOnSpan(ring, 2*lead.LengthMm)
+	// the outside of a ring with a positive area is to the right of its edges
+	waste := func(direction [2]float64) [2]float64 {
+		outside := [2]float64{direction[1], -direction[0]}
+		if area < 0 {
+			outside = mul(outside, -1)
+		}
+		if hole {
+			return mul(outside, -1)
+		}
+		return outside
+	}
+
+	lengths := pathLengths(points)
+	total := lengths[len(lengths)-1]
+	start := points[0]
+	startDirection := normalize(sub(points[1], points[0]))
+
+	var path [][2]float64
+	switch lead.In {
+	case LeadLine:
+		path = append(path, add(start, mul(waste(startDirection), lead.LengthMm)))
+	case LeadArc:
+		// a quarter circle on the waste side that ends tangent to the contour
+		center := add(start, mul(waste(startDirection), lead.LengthMm))
+		from := sub(center, mul(startDirection, lead.LengthMm))
+		path = append(path, leadArc(center, from, start, lead.LengthMm, tolerance)...)
+		path = path[:len(path)-1]
+	}
+	path = append(path, points...)
+
+	end, endDirection := start, startDirection
+	if lead.OvercutMm > 0 {
+		overcut := math.Min(lead.OvercutMm, total)
+		path = append(path, slicePath(points, lengths, 0, overcut)[1:]...)
+		end = path[len(path)-1]
+		endDirection = normalize(sub(end, path[len(path)-2]))
+	} else if n := len(points); n > 1 {
+		endDirection = normalize(sub(points[n-1], points[n-2]))
+	}
+
+	switch lead.Out {
+	case LeadLine:
+		path = append(path, add(end, mul(waste(endDirection), lead.LengthMm)))
+	case LeadArc:
+		// leave tangentially and curve away into the waste
+		center := add(end, mul(waste(endDirection), lead.LengthMm))
+		to := add(center, mul(endDirection, lead.LengthMm))
+		path = append(path, leadArc(center, end, to, lead.LengthMm, tolerance)[1:]...)
+	}
+	return path
+}
+
+// startOnSpan returns the closed ring starting on a straight edge at
+// least span long, as close as it can to where the ring starts now, which
+// is where ordering the cuts had it start. A lead that starts next to a
+// corner would cross the contour around it, so the start stays half of
+// span away from the ends of the edge. A ring without an edge that long is
+// a curve and keeps its start.
+func startOnSpan(ring [][2]float64, span float64) [][2]float64 {
+	first := ring[0]
+	at, best := first, math.Inf(1)
+	edge := -1
+	for i := range ring {
+		a, b := ring[i], ring[(i+1)%len(ring)]
+		l := distance(a, b)
+		if l == 0 || l < span {
+			continue
+		}
+		margin := span / 2 / l
+		t := math.Max(margin, math.Min(1-margin, dot(sub(first, a), sub(b, a))/(l*l)))
+		p := lerp(a, b, t)
+		if d := distance(p, first); d < best {
+			at, best, edge = p, d, i
+		}
+	}
+	if edge == -1 {
+		return closeRing(ring)
+	}
+	// the start may be a corner of the edge, which is not repeated
+	started := [][2]float64{at}
+	for i := 1; i <= len(ring); i++ {
+		if p := ring[(edge+i)%len(ring)]; distance(p, started[len(started)-1]) > 1e-9 {
+			started = append(started, p)
+		}
+	}
+	if distance(started[len(started)-1], at) > 1e-9 {
+		started = append(started, at)
+	}
+	return started
+}
+
+// leadArc is the quarter circle around center from a to b
+func leadArc(center, from, to [2]float64, radius, tolerance float64) [][2]float64 {
+	clockwise := cross(sub(from, center), sub(to, center)) < 0
+	return arcPoints(center, from, to, radius, clockwise, tolerance)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestApplyLeads(t *testing.T) {
+	is := is.New(t)
+	lead := LeadOptions{In: LeadArc, Out: LeadLine, LengthMm: 2, OvercutMm: 1}
+	job := &Job{
+		Operations: []Operation{
+			{Name: "cut", Color: "#000000", Kind: Cut, Lead: lead},
+			{Name: "score", Color: "#0000ff", Kind: Score, Lead: lead},
+			{Name: "mark", Color: "#ff00ff", Kind: Score},
+		},
+		Segments: []svg.Segment{
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(0, 0, 50))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(reverseRing(square(20, 20, 10)))},
+			{Closed: true, Stroke: "#0000ff", Points: closeRing(square(60, 0, 5))},
+			{Closed: true, Stroke: "#0000ff", Points: closeRing(square(5, 5, 8))},
+			{Closed: true, Stroke: "#ff00ff", Points: closeRing(square(80, 0, 5))},
+		},
+	}
+	job.applyLeads(.01)
+
+	outer, hole, scored, marked := job.Segments[0], job.Segments[1], job.Segments[2], job.Segments[3]
+	is.True(!outer.Closed)
+	is.True(!hole.Closed)
+	is.True(job.Segments[4].Closed) // an operation without leads
+
+	// the outer profile starts and ends outside the part
+	ring := square(0, 0, 50)
+	is.True(!pointInRing(outer.Points[0], ring))
+	is.True(!pointInRing(outer.Points[len(outer.Points)-1], ring))
+	// the cut starts on the first edge next to the corner ordering started
+	// it at, far enough from the corner for the lead in arc, which ends
+	// tangent to the edge
+	is.True(math.Abs(distance(outer.Points[0], [2]float64{2, 0})-2*math.Sqrt2) < 1e-9)
+	is.True(outer.Points[0][1] < 0)
+
+	// the hole starts and ends inside the hole
+	holeRing := square(20, 20, 10)
+	is.True(pointInRing(hole.Points[0], holeRing))
+	is.True(pointInRing(hole.Points[len(hole.Points)-1], holeRing))
+
+	// a scored contour gets the leads of the score operation, on the
+	// outside of it away from the parts and on the inside of it on a part
+	is.True(!scored.Closed)
+	is.True(!pointInRing(scored.Points[0], square(60, 0, 5)))
+	is.True(!marked.Closed)
+	is.True(pointInRing(marked.Points[0], square(5, 5, 8)))
+
+	// the overcut cuts the first millimetre of the hole again before the lead out
+	last := hole.Points[len(hole.Points)-2]
+	is.True(distance(last, [2]float64{23, 30}) < 1e-9)
+}
+
+func TestStartOnSpan(t *testing.T) {
+	is := is.New(t)
+	// a square started at its top right corner starts next to it
+	ring := [][2]float64{{10, 0}, {10, 10}, {0, 10}, {0, 0}}
+	is.Equal(startOnSpan(ring, 4), [][2]float64{{10, 2}, {10, 10}, {0, 10}, {0, 0}, {10, 0}, {10, 2}})
+	// without room for a lead it keeps its start
+	is.Equal(startOnSpan(ring, 0), closeRing(ring))
+	is.Equal(startOnSpan(ring, 20), closeRing(ring))
+}
+
+func TestApplyLeadsDisabled(t *testing.T) {
+	is := is.New(t)
+	job := &Job{Segments: []svg.Segment{{Closed: true, Stroke: "#000000", Points: closeRing(square(0, 0, 10))}}}
+	job.applyLeads(.01)
+	is.True(job.Segments[0].Closed)
+	is.Equal(len(job.Segments[0].Points), 5)
+}
+
+func TestParseLeads(t *testing.T) {
+	is := is.New(t)
+	leads, err := parseLeads("cut=arc/line:2:0.5, score = none:0:0.3", defaultOperations)
+	is.NoErr(err)
+	is.Equal(leads, map[string]LeadOptions{
+		"cut":   {In: LeadArc, Out: LeadLine, LengthMm: 2, OvercutMm: .5},
+		"score": {OvercutMm: .3},
+	})
+	leads, err = parseLeads("cut=line:1", defaultOperations)
+	is.NoErr(err)
+	is.Equal(leads["cut"], LeadOptions{In: LeadLine, Out: LeadLine, LengthMm: 1})
+	for _, bad := range []string{"cut", "cut=arc", "cut=curve:1", "cut=arc:x", "cut=arc:1:-1", "cutt=arc:1", "etch=line:1"} {
+		_, err = parseLeads(bad, defaultOperations)
+		is.True(err != nil)
+	}
+
+	// the leads of the job options go on the operations of the job
+	job := &Job{
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments:   []svg.Segment{{Closed: true, Stroke: "#000000", Points: closeRing(square(0, 0, 10))}},
+	}
+	opts := defaultJobOptions
+	opts.Leads = map[string]LeadOptions{"cut": {In: LeadLine, Out: LeadLine, LengthMm: 1}}
+	is.True(opts.reshapes(materialPresets["none"]))
+	job.process(opts)
+	is.True(!job.Segments[0].Closed)
+	is.Equal(defaultOperations[0].Lead, LeadOptions{})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// lightBurnColors are the colours of the first LightBurn layers, a layer
+// is known by its index and shown in its colour
+var lightBurnColors = []string{
+	"#000000", "#0000ff", "#ff0000", "#00e000", "#d0d000", "#ff8000", "#00e0e0", "#ff00ff",
+	"#b4b4b4", "#0000a0", "#a00000", "#00a000", "#a0a000", "#c08000", "#00a0ff", "#a000a0",
+}
+
+// lightBurnLayer is the cut setting of an operation in a LightBurn project
+type lightBurnLayer struct {
+	index    int
+	op       *Operation
+	settings LaserSettings
+}
+
+// writeLightBurn writes the job as a LightBurn project, .lbrn2. Every
+// operation gets a cut setting, on the layer of the LightBurn colour
+// closest to its own, with the speed, power and passes of the material.
+// LightBurn works in millimetres with y up, the drawing is flipped over
+// with the bottom of the page at 0. Rectangles and circles are written as
+// Rect and Ellipse shapes, everything else as a Path.
+func (j *Job) writeLightBurn(w io.Writer) error {
+	var layers []*lightBurnLayer
+	layerOf := map[*Operation]*lightBurnLayer{}
+	used := map[int]bool{}
+	for _, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || len(s.Points) < 2 {
+			continue
+		}
+		if _, ok := layerOf[op]; ok {
+			continue
+		}
+		layer := &lightBurnLayer{index: lightBurnIndex(op.Color, used), op: op, settings: j.Material.settings(op.Kind)}
+		used[layer.index] = true
+		layerOf[op] = layer
+		layers = append(layers, layer)
+	}
+	toLightBurn := func(p [2]float64) [2]float64 {
+		return [2]float64{p[0], j.HeightMm - p[1]}
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprint(out, xml.Header)
+	fmt.Fprintln(out, `<LightBurnProject AppVersion="1.4.00" FormatVersion="1" MaterialHeight="0" MirrorX="False" MirrorY="False">`)
+	fmt.Fprintf(out, "    <!-- %s, %s -->\n", lightBurnComment(j.Name), lightBurnComment(j.Material.Name))
+	for priority, layer := range layers {
+		passes := layer.settings.Passes
+		if passes < 1 {
+			passes = 1
+		}
+		fmt.Fprintln(out, `    <CutSetting type="Cut">`)
+		fmt.Fprintf(out, "        <index Value=\"%d\"/>\n", layer.index)
+		fmt.Fprintf(out, "        <name Value=\"%s\"/>\n", xmlAttr(layer.op.Name))
+		fmt.Fprintf(out, "        <minPower Value=\"%s\"/>\n", formatMm(layer.settings.PowerPercent))
+		fmt.Fprintf(out, "        <maxPower Value=\"%s\"/>\n", formatMm(layer.settings.PowerPercent))
+		fmt.Fprintf(out, "        <speed Value=\"%s\"/>\n", formatMm(layer.settings.SpeedMmPerMin/60))
+		fmt.Fprintf(out, "        <numPasses Value=\"%d\"/>\n", passes)
+		fmt.Fprintf(out, "        <priority Value=\"%d\"/>\n", priority)
+		fmt.Fprintln(out, `    </CutSetting>`)
+	}
+
+	for _, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || len(s.Points) < 2 {
+			continue
+		}
+		index := layerOf[op].index
+		points := make([][2]float64, len(s.Points))
+		for i, p := range s.Points {
+			points[i] = toLightBurn(p)
+		}
+		closed := s.Closed && len(openRing(points)) > 2
+		if closed {
+			ring := openRing(points)
+			if min, max, ok := axisRect(ring); ok {
+				center := lerp(min, max, .5)
+				fmt.Fprintf(out, "    <Shape Type=\"Rect\" CutIndex=\"%d\" W=\"%s\" H=\"%s\" Cr=\"0\">\n", index, formatMm(max[0]-min[0]), formatMm(max[1]-min[1]))
+				fmt.Fprintf(out, "        <XForm>1 0 0 1 %s %s</XForm>\n", formatMm(center[0]), formatMm(center[1]))
+				fmt.Fprintln(out, `    </Shape>`)
+				continue
+			}
+			if center, radius, ok := fitCircle(ring, arcFitTolerance); ok {
+				fmt.Fprintf(out, "    <Shape Type=\"Ellipse\" CutIndex=\"%d\" Rx=\"%s\" Ry=\"%s\">\n", index, formatMm(radius), formatMm(radius))
+				fmt.Fprintf(out, "        <XForm>1 0 0 1 %s %s</XForm>\n", formatMm(center[0]), formatMm(center[1]))
+				fmt.Fprintln(out, `    </Shape>`)
+				continue
+			}
+			points = ring
+		}
+
+		var verts, prims strings.Builder
+		for i, p := range points {
+			fmt.Fprintf(&verts, "V%s %s", formatMm(p[0]), formatMm(p[1]))
+			if i > 0 {
+				fmt.Fprintf(&prims, "L%d %d", i-1, i)
+			}
+		}
+		if closed {
+			fmt.Fprintf(&prims, "L%d 0", len(points)-1)
+		}
+		fmt.Fprintf(out, "    <Shape Type=\"Path\" CutIndex=\"%d\">\n", index)
+		fmt.Fprintln(out, `        <XForm>1 0 0 1 0 0</XForm>`)
+		fmt.Fprintf(out, "        <VertList>%s</VertList>\n", verts.String())
+		fmt.Fprintf(out, "        <PrimList>%s</PrimList>\n", prims.String())
+		fmt.Fprintln(out, `    </Shape>`)
+	}
+	fmt.Fprintln(out, `</LightBurnProject>`)
+	return out.Flush()
+}
+
+// lightBurnIndex is the LightBurn layer whose colour is closest to color
+// and not used yet
+func lightBurnIndex(color string, used map[int]bool) int {
+	rgb, ok := parseHexColor(normalizeColor(color))
+	best, bestDist := -1, math.Inf(1)
+	for index, c := range lightBurnColors {
+		if used[index] {
+			continue
+		}
+		if !ok {
+			return index
+		}
+		layer, _ := parseHexColor(c)
+		d := 0.0
+		for i := range layer {
+			d += (layer[i] - rgb[i]) * (layer[i] - rgb[i])
+		}
+		if d < bestDist {
+			best, bestDist = index, d
+		}
+	}
+	if best < 0 {
+		// more operations than colours, the layers past them are grey
+		best = len(lightBurnColors)
+		for used[best] {
+			best++
+		}
+	}
+	return best
+}
+
+// axisRect returns the corners of a ring that is a rectangle with its
+// sides along the axes
+func axisRect(ring [][2]float64) ([2]float64, [2]float64, bool) {
+	if len(ring) != 4 {
+		return [2]float64{}, [2]float64{}, false
+	}
+	const tolerance = 1e-6
+	for i, p := range ring {
+		q := ring[(i+1)%4]
+		if math.Abs(p[0]-q[0]) > tolerance && math.Abs(p[1]-q[1]) > tolerance {
+			return [2]float64{}, [2]float64{}, false
+		}
+		if distance(p, q) < tolerance {
+			return [2]float64{}, [2]float64{}, false
+		}
+	}
+	min, max := ring[0], ring[0]
+	for _, p := range ring {
+		min = [2]float64{math.Min(min[0], p[0]), math.Min(min[1], p[1])}
+		max = [2]float64{math.Max(max[0], p[0]), math.Max(max[1], p[1])}
+	}
+	return min, max, true
+}
+
+// xmlAttr escapes s for an attribute value
+func xmlAttr(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// lightBurnComment is s without what would end an xml comment
+func lightBurnComment(s string) string {
+	return strings.ReplaceAll(s, "--", "- -")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+// lightBurnValue is a setting of a LightBurn cut setting
+type lightBurnValue struct {
+	Value string `xml:"Value,attr"`
+}
+
+// lightBurnProject is what the tests read back of a LightBurn project
+type lightBurnProject struct {
+	CutSettings []struct {
+		Index     lightBurnValue `xml:"index"`
+		Name      lightBurnValue `xml:"name"`
+		MaxPower  lightBurnValue `xml:"maxPower"`
+		Speed     lightBurnValue `xml:"speed"`
+		NumPasses lightBurnValue `xml:"numPasses"`
+	} `xml:"CutSetting"`
+	Shapes []struct {
+		Type     string  `xml:"Type,attr"`
+		CutIndex int     `xml:"CutIndex,attr"`
+		W        float64 `xml:"W,attr"`
+		H        float64 `xml:"H,attr"`
+		Rx       float64 `xml:"Rx,attr"`
+		XForm    string
+		VertList string
+		PrimList string
+	} `xml:"Shape"`
+}
+
+func TestWriteLightBurn(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "parts",
+		WidthMm:    100,
+		HeightMm:   100,
+		Material:   materialPresets["acrylic-6mm"],
+		Operations: defaultOperations,
+		Segments: []svg.Segment{
+			{Stroke: "#0000ff", Points: [][2]float64{{0, 90}, {20, 90}, {20, 80}}},
+			{Closed: true, Stroke: "#000000", Points: closeRing(circleRing(70, 30, 5, 64))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(10, 10, 30))},
+			{Closed: true, Stroke: "#000000", Points: closeRing([][2]float64{{50, 50}, {60, 50}, {55, 60}})},
+			{Stroke: "none", Fill: "#000000", Points: closeRing(square(50, 50, 10))},
+		},
+	}
+	out := bytes.Buffer{}
+	is.NoErr(job.writeLightBurn(&out))
+	var project lightBurnProject
+	is.NoErr(xml.Unmarshal(out.Bytes(), &project))
+
+	// the score is on the blue layer and the cut on the black one
+	is.Equal(len(project.CutSettings), 2)
+	score, cut := project.CutSettings[0], project.CutSettings[1]
+	is.Equal(score.Index.Value, "1")
+	is.Equal(score.Name.Value, "score")
+	is.Equal(score.MaxPower.Value, "20")
+	is.Equal(score.Speed.Value, "20")
+	is.Equal(cut.Index.Value, "0")
+	is.Equal(cut.MaxPower.Value, "100")
+	is.Equal(cut.Speed.Value, "2")
+	is.Equal(cut.NumPasses.Value, "2")
+
+	is.Equal(len(project.Shapes), 4)
+	path := project.Shapes[0]
+	is.Equal(path.Type, "Path")
+	is.Equal(path.CutIndex, 1)
+	is.Equal(path.VertList, "V0 10V20 10V20 20")
+	is.Equal(path.PrimList, "L0 1L1 2")
+
+	circle := project.Shapes[1]
+	is.Equal(circle.Type, "Ellipse")
+	is.Equal(circle.CutIndex, 0)
+	is.Equal(circle.Rx, 5.0)
+	is.Equal(circle.XForm, "1 0 0 1 70 70")
+
+	rect := project.Shapes[2]
+	is.Equal(rect.Type, "Rect")
+	is.Equal(rect.W, 30.0)
+	is.Equal(rect.H, 30.0)
+	is.Equal(rect.XForm, "1 0 0 1 25 75")
+
+	triangle := project.Shapes[3]
+	is.Equal(triangle.Type, "Path")
+	is.True(strings.HasSuffix(triangle.PrimList, "L2 0"))
+}
+
+func TestLightBurnIndex(t *testing.T) {
+	is := is.New(t)
+	used := map[int]bool{}
+	is.Equal(lightBurnIndex("#ff0000", used), 2)
+	used[2] = true
+	is.Equal(lightBurnIndex("red", used), 10)
+	is.Equal(lightBurnIndex("none", used), 0)
+	for i := range lightBurnColors {
+		used[i] = true
+	}
+	is.Equal(lightBurnIndex("#ff0000", used), len(lightBurnColors))
+}
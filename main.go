@@ -3,19 +3,26 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	_ "embed"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 import (
@@ -26,14 +33,96 @@ import (
 //go:embed index.html
 var indexTemplate string
 
+// shutdownTimeout is how long the server waits for the uploads it is
+// converting when it is stopped
+const shutdownTimeout = 2 * time.Minute
+
 func main() {
 	serve := flag.Bool("serve", false, "enable rest api and web server. If specified f and o flags are ignored")
 	port := flag.Int("port", 8080, "port to listen on. Only used if serve flag is passed")
-	inFile := flag.String("f", "", "input svg file to convert to pdf for laser")
-	outFile := flag.String("o", "", "output filename, defaults to input file name with -for-laser.svg appended")
+	inFile := flag.String("f", "", "input svg, dxf, pdf, ps, eps or hpgl file to convert to pdf for laser")
+	outFile := flag.String("o", "", "output filename, defaults to input file name with -for-laser.svg appended. A .dxf file gets the processed geometry for other cutting programs, a .gcode or .nc file G-code for a grbl laser, a .rd file a job for a Ruida controller, a .lbrn2 file a LightBurn project, a .plt or .hpgl file HPGL for plotters and vinyl cutters, a .pdf file what the laser driver cuts")
+	material := flag.String("material", "none", "material the job is cut from, sets the kerf of every output but a plain .svg and the speed, power and passes of .gcode, .rd and .lbrn2 outputs: "+strings.Join(materialNames(), ", "))
+	tabCount := flag.Int("tabs", defaultTabOptions.Count, "holding tabs left on the outer contour of every part, 0 only puts tabs on markers in a layer named tabs")
+	tabWidth := flag.Float64("tab-width", defaultTabOptions.WidthMm, "length in mm of contour left uncut for a tab")
+	leads := flag.String("leads", "", "lead in, lead out and overcut of the closed contours of each operation, as comma separated operation=style:length:overcut in mm. The style is none, line or arc, or in/out like arc/line, as in cut=arc:2:0.5")
+	hatch := flag.Float64("hatch", defaultHatchOptions.SpacingMm, "distance in mm between the engraved lines filled areas are hatched with, 0 leaves them to be raster engraved")
+	hatchAngle := flag.Float64("hatch-angle", defaultHatchOptions.AngleDeg, "direction of the hatch lines in degrees, 0 is horizontal")
+	crosshatch := flag.Bool("crosshatch", defaultHatchOptions.Crosshatch, "hatch filled areas a second time at right angles")
+	units := flag.String("units", defaultOutputOptions.Units, "units of a .dxf output, mm or in")
+	maxPower := flag.Float64("max-power", defaultGCodeOptions.MaxPower, "S value of full power in a .gcode or .nc output, $30 in grbl")
+	dynamicPower := flag.Bool("dynamic-power", defaultGCodeOptions.Dynamic, "run the laser of a .gcode or .nc output with M4, its power following the speed, rather than M3")
+	arcs := flag.Bool("arcs", defaultGCodeOptions.Arcs, "write arcs in a .gcode or .nc output as G2 and G3 moves")
+	hpglUnits := flag.Float64("hpgl-units", defaultHPGLOptions.UnitsPerMm, "plotter units in a millimetre in a .plt or .hpgl output")
+	pens := flag.String("pens", formatPens(defaultHPGLOptions.Pens), "pen of each operation in a .plt or .hpgl output, as comma separated operation=pen")
+	processed := flag.Bool("processed", false, "write the processed geometry to a .svg output, kerf compensated and in the order it is cut, rather than the drawing with its strokes fixed")
+	annotate := flag.String("annotate", "", "annotations drawn on a processed .svg output, comma separated: "+strings.Join(svgAnnotations, ", "))
+	airAssist := flag.Bool("air-assist", defaultGCodeOptions.AirAssist, "turn air assist on with M8 in a .gcode or .nc output")
+	nestParts := flag.Bool("nest", false, "nest the parts of the svg, dxf, pdf, ps, eps or hpgl files given as arguments onto sheets. Append :N to a file name to cut N copies of it")
+	sheet := flag.String("sheet", fmt.Sprintf("%gx%g", defaultNestOptions.SheetWidthMm, defaultNestOptions.SheetHeightMm), "sheet size in mm for nesting, as WIDTHxHEIGHT")
+	spacing := flag.Float64("spacing", defaultNestOptions.SpacingMm, "gap between nested parts in mm")
+	margin := flag.Float64("margin", defaultNestOptions.MarginMm, "gap along the edges of the sheet in mm")
+	rotation := flag.Float64("rotate", defaultNestOptions.RotationStepDeg, "rotation step in degrees tried while nesting, 0 disables rotation")
+	tileDrawing := flag.Bool("tile", false, "split the drawing in the f flag into tiles the size of the sheet flag")
+	overlap := flag.Float64("overlap", defaultTileOptions.OverlapMm, "overlap between tiles in mm")
+	marks := flag.Bool("marks", true, "score registration marks and tile numbers on tiles")
+	keepChrome := flag.Bool("keep-chrome", false, "keep the border, title block and background of Onshape drawings")
+	stripBorder := flag.Bool("strip-border", false, "remove the border and title block of drawings that are not Onshape exports too")
+	keepAnnotations := flag.Bool("keep-annotations", false, "keep dimensions, text, centre lines and construction lines")
+	keep := flag.String("keep", "", "comma separated ids, labels, classes or kinds of elements never to remove, like text,logo")
+	drop := flag.String("drop", "", "comma separated ids, labels or classes of elements always to remove")
+	strokeWidth := flag.Float64("stroke-width", defaultStrokeOptions.WidthIn, "width in inches every stroke is drawn with, the hairline the laser driver cuts")
+	vectorColor := flag.String("vector-color", defaultStrokeOptions.Color, "colour strokes not in the colour of an operation are drawn in")
+	backend := flag.String("backend", defaultConverter(), "converter making pdf, ps, eps, png, emf and wmf files: "+strings.Join(converterNames(), ", ")+". Defaults to $SVG2LASER_BACKEND, or native when it is not set")
+	listBackends := flag.Bool("backends", false, "list the converters, their versions and the formats they write")
+	inkscapeActions := flag.String("inkscape-actions", "", "inkscape actions run on every drawing before it is read, separated by semicolons, like select-all;object-stroke-to-path. Needs inkscape 1.0 or later")
+	inkscapeWorkers := flag.Int("inkscape-workers", defaultInkscapePoolOptions.Workers, "inkscape processes kept running in shell mode by the server, 0 starts inkscape for every conversion. Only used if serve flag is passed")
+	inkscapeJobs := flag.Int("inkscape-jobs", defaultInkscapePoolOptions.MaxJobs, "conversions an inkscape process does before it is restarted, 0 never restarts it")
+	inkscapeQueue := flag.Int("inkscape-queue", defaultInkscapePoolOptions.Queue, "conversions waiting for an inkscape process, more are turned away")
 	flag.Parse()
 
+	strokes := StrokeOptions{WidthIn: *strokeWidth, Color: *vectorColor}
+	if _, ok := converters[*backend]; !ok {
+		log.Printf("Error: unknown converter '%s', expected one of %s", *backend, strings.Join(converterNames(), ", "))
+		os.Exit(1)
+	}
+
+	if *listBackends {
+		printConverters(os.Stdout)
+		return
+	}
+
+	jobOpts := defaultJobOptions
+	jobOpts.Tabs.Count, jobOpts.Tabs.WidthMm = *tabCount, *tabWidth
+	if *tabCount > 0 && *tabWidth <= 0 {
+		log.Printf("Error: tab width must be more than 0 mm, not %g", *tabWidth)
+		os.Exit(1)
+	}
+	jobOpts.Hatch = HatchOptions{SpacingMm: *hatch, AngleDeg: *hatchAngle, Crosshatch: *crosshatch}
+	var err error
+	if jobOpts.Leads, err = parseLeads(*leads, defaultOperations); err != nil {
+		log.Printf("Error: %s", err)
+		os.Exit(1)
+	}
+
+	clean := CleanOptions{
+		KeepChrome:      *keepChrome,
+		StripBorder:     *stripBorder,
+		KeepAnnotations: *keepAnnotations,
+		Keep:            splitList(*keep),
+		Drop:            splitList(*drop),
+		Actions:         splitActions(*inkscapeActions),
+	}
+
 	if *serve {
+		var pool *inkscapePool
+		if *inkscapeWorkers > 0 {
+			opts := defaultInkscapePoolOptions
+			opts.Workers, opts.MaxJobs, opts.Queue = *inkscapeWorkers, *inkscapeJobs, *inkscapeQueue
+			shells := newInkscapeShellConverter(inkscapeBin, opts)
+			converters["inkscape"], pool = shells, shells.pool
+		}
+
 		r := mux.NewRouter()
 		r.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
 			fmt.Fprintf(writer, indexTemplate)
@@ -53,17 +142,74 @@ func main() {
 			}
 			defer uploadedFile.Close()
 
-			svgReadyForCutting := bytes.Buffer{}
-			err = fixStoke(uploadedFile, &svgReadyForCutting, .001)
+			clean := defaultCleanOptions
+			clean.Keep = splitList(request.FormValue("keep"))
+			clean.Drop = splitList(request.FormValue("drop"))
+			clean.StripBorder = request.FormValue("strip-border") != ""
+			// the actions are the server's to set, inkscape actions can
+			// write files
+			clean.Actions = splitActions(*inkscapeActions)
+			uploaded, err := ioutil.ReadAll(uploadedFile)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-
 			fileWithoutSuffix := strings.TrimSuffix(filepath.Base(fileHeader.Filename), filepath.Ext(fileHeader.Filename))
 
+			converter := *backend
+			if requested := request.FormValue("backend"); requested != "" {
+				converter = requested
+			}
+			if _, ok := converters[converter]; !ok {
+				http.Error(w, fmt.Sprintf("unknown converter '%s'", converter), http.StatusBadRequest)
+				return
+			}
+
+			material, err := lookupMaterial(request.FormValue("material"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			processing, err := formJobOptions(request, jobOpts)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if format := request.FormValue("format"); format != "" && format != "pdf" {
+				writer, ok := jobWriters["."+format]
+				if !ok {
+					http.Error(w, fmt.Sprintf("unknown format '%s'", format), http.StatusBadRequest)
+					return
+				}
+				opts := defaultOutputOptions
+				if opts.SVG, err = parseAnnotations(request.Form["annotate"]); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				out := bytes.Buffer{}
+				err := writeJob(request.Context(), fileHeader.Filename, uploaded, "."+format, material, processing, opts, clean, &out)
+				if errors.Is(err, errPoolFull) {
+					http.Error(w, err.Error(), http.StatusServiceUnavailable)
+					return
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Add("Content-Type", writer.contentType)
+				w.Header().Add("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileWithoutSuffix+"."+format))
+				_, _ = w.Write(out.Bytes())
+				return
+			}
+
 			pdfReadyForCutting := bytes.Buffer{}
-			err = svgConvertBuffer(svgReadyForCutting.Bytes(), &pdfReadyForCutting, os.Stderr)
+			opts := ConvertOptions{Name: fileHeader.Filename, Strokes: defaultStrokeOptions, Clean: clean, Material: material, Job: processing}
+			err = convert(request.Context(), converter, uploaded, "pdf", opts, &pdfReadyForCutting)
+			if errors.Is(err, errPoolFull) {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -80,7 +226,39 @@ func main() {
 
 		}).Methods(http.MethodPost)
 
-		err := http.ListenAndServe(fmt.Sprintf(":%d", *port), r)
+		// on an interrupt the uploads being converted are finished before
+		// the inkscape shells are stopped
+		server := &http.Server{Addr: fmt.Sprintf(":%d", *port), Handler: r}
+		interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		stopped := make(chan struct{})
+		go func() {
+			<-interrupted.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("Error: %s", err)
+			}
+			if pool != nil {
+				pool.close()
+			}
+			close(stopped)
+		}()
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error: %s", err)
+			os.Exit(1)
+		}
+		<-stopped
+		return
+	}
+
+	if *nestParts {
+		opts := NestOptions{SpacingMm: *spacing, MarginMm: *margin, RotationStepDeg: *rotation}
+		var err error
+		opts.SheetWidthMm, opts.SheetHeightMm, err = parseSheetSize(*sheet)
+		if err == nil {
+			err = nestFiles(flag.Args(), *outFile, opts, clean)
+		}
 		if err != nil {
 			log.Printf("Error: %s", err)
 			os.Exit(1)
@@ -88,28 +266,83 @@ func main() {
 		return
 	}
 
-	if err := fixFile(*inFile, *outFile); err != nil {
+	if *tileDrawing {
+		opts := defaultTileOptions
+		opts.OverlapMm = *overlap
+		if !*marks {
+			opts.MarkSizeMm, opts.NumberSizeMm = 0, 0
+		}
+		var err error
+		opts.SheetWidthMm, opts.SheetHeightMm, err = parseSheetSize(*sheet)
+		if err == nil {
+			err = tileFile(*inFile, *outFile, opts, clean)
+		}
+		if err != nil {
+			log.Printf("Error: %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// a .svg output is the drawing with its strokes fixed unless asked for
+	// the processed one
+	if ext := strings.ToLower(filepath.Ext(*outFile)); jobWriters[ext].write != nil && (ext != ".svg" || *processed) {
+		opts := OutputOptions{
+			Units: *units,
+			GCode: GCodeOptions{MaxPower: *maxPower, Dynamic: *dynamicPower, Arcs: *arcs, AirAssist: *airAssist},
+			HPGL:  HPGLOptions{UnitsPerMm: *hpglUnits},
+		}
+		var err error
+		if opts.HPGL.Pens, err = parsePens(*pens); err == nil {
+			opts.SVG, err = parseAnnotations(splitList(*annotate))
+		}
+		if err != nil {
+			log.Printf("Error: %s", err)
+			os.Exit(1)
+		}
+		if err := exportJob(*inFile, *outFile, *material, jobOpts, opts, clean); err != nil {
+			log.Printf("Error: %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if format := strings.ToLower(strings.TrimPrefix(filepath.Ext(*outFile), ".")); converted[format] {
+		m, err := lookupMaterial(*material)
+		if err == nil {
+			opts := ConvertOptions{Strokes: strokes, Clean: clean, Material: m, Job: jobOpts}
+			err = exportConverted(*inFile, *outFile, format, *backend, opts)
+		}
+		if err != nil {
+			log.Printf("Error: %s", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := fixFile(*inFile, *outFile, strokes, clean); err != nil {
 		log.Printf("Error: %s", err)
 		os.Exit(1)
 	}
 }
-func fixFile(inFile string, outFile string) error {
-	file, err := os.Open(inFile)
+func fixFile(inFile string, outFile string, strokes StrokeOptions, clean CleanOptions) error {
+	file, err := ioutil.ReadFile(inFile)
 	if err != nil {
 		return fmt.Errorf("unable to open %s - %w", inFile, err)
 	}
-	defer file.Close()
+	drawing, clean, err := drawingSVG(context.Background(), filepath.Base(inFile), file, clean)
+	if err != nil {
+		return fmt.Errorf("unable to load %s - %w", inFile, err)
+	}
 
 	outStream := bytes.Buffer{}
 
-	desiredStrokeWidthIn := .001
-
-	if err := fixStoke(file, &outStream, desiredStrokeWidthIn); err != nil {
+	if err := fixStoke(bytes.NewReader(drawing), &outStream, strokes, clean); err != nil {
 		return fmt.Errorf("unable to fixStroke - %w", err)
 	}
 
 	if len(outFile) == 0 {
-		outFile = strings.TrimSuffix(inFile, ".svg") + "-for-laser.svg"
+		outFile = strings.TrimSuffix(inFile, filepath.Ext(inFile)) + "-for-laser.svg"
 	}
 
 	err = ioutil.WriteFile(outFile, outStream.Bytes(), fs.ModePerm)
@@ -120,7 +353,317 @@ func fixFile(inFile string, outFile string) error {
 	return nil
 }
 
-func fixStoke(inStream io.Reader, outStream io.Writer, desiredStrokeWidthIn float64) error {
+// OutputOptions are the settings of the formats in jobWriters
+type OutputOptions struct {
+	// Units of a dxf file, mm or in
+	Units string
+	GCode GCodeOptions
+	HPGL  HPGLOptions
+	SVG   SVGOptions
+}
+
+var defaultOutputOptions = OutputOptions{
+	Units: "mm",
+	GCode: defaultGCodeOptions,
+	HPGL:  defaultHPGLOptions,
+}
+
+// jobWriter writes a processed job in a format for other cutting programs
+// or for a laser directly
+type jobWriter struct {
+	contentType string
+	write       func(j *Job, w io.Writer, opts OutputOptions) error
+}
+
+// jobWriters are the formats a processed job is written in, by file
+// extension
+var jobWriters = map[string]jobWriter{
+	".dxf": {"application/dxf", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeDXF(w, opts.Units)
+	}},
+	".gcode": {"text/plain", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeGCode(w, opts.GCode)
+	}},
+	".nc": {"text/plain", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeGCode(w, opts.GCode)
+	}},
+	".rd": {"application/octet-stream", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeRD(w)
+	}},
+	".lbrn2": {"application/xml", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeLightBurn(w)
+	}},
+	".svg": {"image/svg+xml", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeSVG(w, opts.SVG)
+	}},
+	".plt": {"application/vnd.hp-hpgl", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeHPGL(w, opts.HPGL)
+	}},
+	".hpgl": {"application/vnd.hp-hpgl", func(j *Job, w io.Writer, opts OutputOptions) error {
+		return j.writeHPGL(w, opts.HPGL)
+	}},
+}
+
+// writeJob writes the drawing in file, named name, to out in the format
+// of the file extension ext after processing it with jobOpts for the
+// material: cleaned, kerf compensated, in the order it is cut and tabbed.
+// Loading it gives up when ctx is done.
+func writeJob(ctx context.Context, name string, file []byte, ext string, material Material, jobOpts JobOptions, opts OutputOptions, clean CleanOptions, out io.Writer) error {
+	writer, ok := jobWriters[strings.ToLower(ext)]
+	if !ok {
+		return fmt.Errorf("unknown output format '%s'", ext)
+	}
+	job, err := loadJob(ctx, name, file, material, clean)
+	if err != nil {
+		return fmt.Errorf("unable to load %s - %w", name, err)
+	}
+	job.process(jobOpts)
+	return writer.write(job, out, opts)
+}
+
+// exportJob writes the drawing in inFile to outFile, in the format of its
+// extension in jobWriters
+func exportJob(inFile string, outFile string, materialName string, jobOpts JobOptions, opts OutputOptions, clean CleanOptions) error {
+	material, err := lookupMaterial(materialName)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		return fmt.Errorf("unable to open %s - %w", inFile, err)
+	}
+	out := bytes.Buffer{}
+	if err := writeJob(context.Background(), filepath.Base(inFile), file, filepath.Ext(outFile), material, jobOpts, opts, clean, &out); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outFile, out.Bytes(), fs.ModePerm)
+}
+
+// formJobOptions are the job options of the upload form, fields left
+// empty keep what they are in opts
+func formJobOptions(request *http.Request, opts JobOptions) (JobOptions, error) {
+	if v := request.FormValue("tabs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("tabs must be a whole number, not '%s'", v)
+		}
+		opts.Tabs.Count = n
+	}
+	if v := request.FormValue("tab-width"); v != "" {
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil || w <= 0 {
+			return opts, fmt.Errorf("tab width must be more than 0 mm, not '%s'", v)
+		}
+		opts.Tabs.WidthMm = w
+	}
+	if v := request.FormValue("hatch"); v != "" {
+		spacing, err := strconv.ParseFloat(v, 64)
+		if err != nil || spacing < 0 {
+			return opts, fmt.Errorf("hatch spacing must be a length in mm, not '%s'", v)
+		}
+		opts.Hatch.SpacingMm = spacing
+	}
+	if v := request.FormValue("hatch-angle"); v != "" {
+		angle, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("hatch angle must be in degrees, not '%s'", v)
+		}
+		opts.Hatch.AngleDeg = angle
+	}
+	if request.FormValue("crosshatch") != "" {
+		opts.Hatch.Crosshatch = true
+	}
+	if v := request.FormValue("leads"); v != "" {
+		leads, err := parseLeads(v, defaultOperations)
+		if err != nil {
+			return opts, err
+		}
+		opts.Leads = leads
+	}
+	return opts, nil
+}
+
+// converted are the output formats written by a converter
+var converted = map[string]bool{"pdf": true, "ps": true, "eps": true, "png": true, "emf": true, "wmf": true}
+
+// exportConverted writes the drawing in inFile to outFile in the format,
+// converted by the converter named backend
+func exportConverted(inFile string, outFile string, format string, backend string, opts ConvertOptions) error {
+	file, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		return fmt.Errorf("unable to open %s - %w", inFile, err)
+	}
+	opts.Name = filepath.Base(inFile)
+	out := bytes.Buffer{}
+	if err := convert(context.Background(), backend, file, format, opts, &out); err != nil {
+		return fmt.Errorf("unable to convert %s - %w", inFile, err)
+	}
+	return ioutil.WriteFile(outFile, out.Bytes(), fs.ModePerm)
+}
+
+// printConverters writes every converter with its version, or why it can
+// not be used, and the formats it writes
+func printConverters(w io.Writer) {
+	formats := []string{"pdf", "svg", "ps", "eps", "png", "emf", "wmf"}
+	for _, name := range converterNames() {
+		c := converters[name]
+		version, err := c.Version()
+		if err != nil {
+			version = "unavailable - " + err.Error()
+		}
+		var writes []string
+		for _, format := range formats {
+			if c.Supports("svg", format) {
+				writes = append(writes, format)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, strings.Join(writes, ","), version)
+	}
+}
+
+// nestFiles nests the parts of the drawings in args and writes a file for
+// every sheet, named after outFile with the sheet number appended. An
+// argument of file.svg:12 cuts 12 copies of file.svg.
+func nestFiles(args []string, outFile string, opts NestOptions, clean CleanOptions) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no drawings to nest")
+	}
+	var inputs []NestInput
+	for _, arg := range args {
+		name, copies, err := parseNestArg(arg)
+		if err != nil {
+			return err
+		}
+		file, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("unable to open %s - %w", name, err)
+		}
+		job, err := loadJob(context.Background(), filepath.Base(name), file, materialPresets["none"], clean)
+		if err != nil {
+			return fmt.Errorf("unable to load %s - %w", name, err)
+		}
+		inputs = append(inputs, NestInput{Job: job, Copies: copies})
+	}
+
+	sheets, err := nest(inputs, opts)
+	if err != nil {
+		return err
+	}
+	if len(outFile) == 0 {
+		outFile = "nested.svg"
+	}
+	return writeSheets(sheets, outFile)
+}
+
+// parseNestArg reads a drawing to nest, a file name with an optional
+// :copies of at least 1. A colon followed by a path, like in C:\parts.svg,
+// is part of the file name.
+func parseNestArg(arg string) (string, int, error) {
+	i := strings.LastIndex(arg, ":")
+	if i <= 0 || strings.ContainsAny(arg[i+1:], `/\`) {
+		return arg, 1, nil
+	}
+	copies, err := strconv.Atoi(arg[i+1:])
+	if err != nil || copies < 1 {
+		return "", 0, fmt.Errorf("copies of %s must be a whole number of at least 1, not '%s'", arg[:i], arg[i+1:])
+	}
+	return arg[:i], copies, nil
+}
+
+// tileFile splits the svg inFile into tiles and writes a file for every
+// tile, named after outFile with the tile number appended
+func tileFile(inFile string, outFile string, opts TileOptions, clean CleanOptions) error {
+	file, err := ioutil.ReadFile(inFile)
+	if err != nil {
+		return fmt.Errorf("unable to open %s - %w", inFile, err)
+	}
+	job, err := loadJob(context.Background(), filepath.Base(inFile), file, materialPresets["none"], clean)
+	if err != nil {
+		return fmt.Errorf("unable to load %s - %w", inFile, err)
+	}
+	tiles, err := tile(job, opts)
+	if err != nil {
+		return err
+	}
+	if len(outFile) == 0 {
+		outFile = strings.TrimSuffix(inFile, filepath.Ext(inFile)) + "-tile.svg"
+	}
+	return writeSheets(tiles, outFile)
+}
+
+// writeSheets writes every job to an svg file named after outFile with
+// its number appended
+func writeSheets(sheets []*Job, outFile string) error {
+	for i, sheet := range sheets {
+		name := fmt.Sprintf("%s-%d.svg", strings.TrimSuffix(outFile, ".svg"), i+1)
+		out := bytes.Buffer{}
+		if err := sheet.writeSVG(&out, SVGOptions{}); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name, out.Bytes(), fs.ModePerm); err != nil {
+			return err
+		}
+		log.Printf("wrote %s with %d segments", name, len(sheet.Segments))
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parsePens reads pens like cut=1,score=2 into the pen of each operation
+func parsePens(list string) (map[string]int, error) {
+	pens := map[string]int{}
+	for _, entry := range splitList(list) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("pen '%s' is not operation=pen", entry)
+		}
+		pen, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || pen < 0 {
+			return nil, fmt.Errorf("pen of '%s' is not a pen number", entry)
+		}
+		pens[strings.TrimSpace(parts[0])] = pen
+	}
+	return pens, nil
+}
+
+// formatPens writes pens the way parsePens reads them, in the order of the
+// default operations
+func formatPens(pens map[string]int) string {
+	var entries []string
+	for _, op := range defaultOperations {
+		if pen, ok := pens[op.Name]; ok {
+			entries = append(entries, fmt.Sprintf("%s=%d", op.Name, pen))
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// parseSheetSize reads a sheet size like 600x300 in millimetres
+func parseSheetSize(size string) (float64, float64, error) {
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) == 2 {
+		w, errW := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		h, errH := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if errW == nil && errH == nil && w > 0 && h > 0 {
+			return w, h, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid sheet size '%s', expected WIDTHxHEIGHT in mm", size)
+}
+
+// fixStoke draws every stroke of the svg document as a hairline the laser
+// cuts, after removing what clean says should not be cut
+func fixStoke(inStream io.Reader, outStream io.Writer, strokes StrokeOptions, clean CleanOptions) error {
 	file, err := ioutil.ReadAll(inStream)
 	if err != nil {
 		return fmt.Errorf("unable to read file to fix strokes - %w", err)
@@ -134,31 +677,22 @@ func fixStoke(inStream io.Reader, outStream io.Writer, desiredStrokeWidthIn floa
 		return fmt.Errorf("root element is not svg, it is '%s'", rootEle.StartElement.Name.Local)
 	}
 	attrs := SVGAttrs{
-		width:   rootEle.Attr("", "width"),
-		height:  rootEle.Attr("", "height"),
-		viewbox: rootEle.Attr("", "viewBox"),
+		width:               rootEle.Attr("", "width"),
+		height:              rootEle.Attr("", "height"),
+		viewbox:             rootEle.Attr("", "viewBox"),
+		preserveAspectRatio: rootEle.Attr("", "preserveAspectRatio"),
 	}
 
-	resPxPerIn, err := attrs.getResolutionPxPerIn()
+	pxPerInX, pxPerInY, err := attrs.getResolutionPxPerIn()
 	if err != nil {
 		return fmt.Errorf("fixStoke - %w", err)
 	}
 
-	desiredStrokeWidthSVGUnits := desiredStrokeWidthIn * float64(resPxPerIn)
+	cleanDocument(rootEle, attrs, clean, "fixStoke")
 
-	// find elements with a stroke-width that need to be changed
-	elementsNeedChanges := rootEle.SearchFunc(func(ele *xmltree.Element) bool {
-		for _, attr := range ele.StartElement.Attr {
-			if attr.Name.Local == "stroke-width" {
-				return true
-			}
-		}
-		return false
-	})
-	// change the stroke width
-	for _, ele := range elementsNeedChanges {
-		ele.SetAttr("", "stroke-width", fmt.Sprintf("%.3f", desiredStrokeWidthSVGUnits))
-	}
+	// a stroke is as wide in every direction, so a viewBox stretched more
+	// one way than the other gets the average
+	normalizeStrokes(rootEle, math.Sqrt(pxPerInX*pxPerInY), strokes)
 
 	// output the resulting file
 	_, err = fmt.Fprintf(outStream, xml.Header)
@@ -35,12 +35,13 @@ func Test_xmltree(t *testing.T) {
 		return // fmt.Errorf("root element is not svg")
 	}
 	attrs := SVGAttrs{
-		width:   rootEle.Attr("", "width"),
-		height:  rootEle.Attr("", "height"),
-		viewbox: rootEle.Attr("", "viewBox"),
+		width:               rootEle.Attr("", "width"),
+		height:              rootEle.Attr("", "height"),
+		viewbox:             rootEle.Attr("", "viewBox"),
+		preserveAspectRatio: rootEle.Attr("", "preserveAspectRatio"),
 	}
 
-	resPxPerIn, err := attrs.getResolutionPxPerIn()
+	resPxPerIn, _, err := attrs.getResolutionPxPerIn()
 	is.NoErr(err)
 
 	desiredStrokeWidthIn := .001
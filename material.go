@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Material is the stock being cut and the settings that depend on it
+type Material struct {
+	Name        string
+	ThicknessMm float64
+	// KerfMm is the width of the material the beam removes
+	KerfMm float64
+	// Settings are how the laser runs for each kind of operation, kinds
+	// that are not in it use defaultLaserSettings
+	Settings map[OperationKind]LaserSettings
+}
+
+// LaserSettings are the speed, power and passes of an operation, for the
+// laser programs that carry them
+type LaserSettings struct {
+	SpeedMmPerMin float64
+	// PowerPercent is the share of full power, 0 to 100
+	PowerPercent float64
+	// Passes is how many times every segment is run
+	Passes int
+}
+
+// defaultLaserSettings are gentle enough to not set anything on fire,
+// a cut may well not go through
+var defaultLaserSettings = map[OperationKind]LaserSettings{
+	Cut:     {SpeedMmPerMin: 300, PowerPercent: 100, Passes: 1},
+	Score:   {SpeedMmPerMin: 1500, PowerPercent: 30, Passes: 1},
+	Engrave: {SpeedMmPerMin: 3000, PowerPercent: 20, Passes: 1},
+}
+
+// materialPresets are the materials we commonly cut on the Helix. The kerf
+// values are measured from test cuts of press fit slots, the settings are
+// a starting point for the smaller laser and want a test cut.
+var materialPresets = map[string]Material{
+	"none": {Name: "none"},
+	"plywood-3mm": {Name: "plywood-3mm", ThicknessMm: 3.2, KerfMm: .15, Settings: map[OperationKind]LaserSettings{
+		Cut: {SpeedMmPerMin: 400, PowerPercent: 100, Passes: 2},
+	}},
+	"plywood-6mm": {Name: "plywood-6mm", ThicknessMm: 6.4, KerfMm: .2, Settings: map[OperationKind]LaserSettings{
+		Cut: {SpeedMmPerMin: 200, PowerPercent: 100, Passes: 3},
+	}},
+	"mdf-3mm": {Name: "mdf-3mm", ThicknessMm: 3, KerfMm: .18, Settings: map[OperationKind]LaserSettings{
+		Cut: {SpeedMmPerMin: 300, PowerPercent: 100, Passes: 2},
+	}},
+	"acrylic-3mm": {Name: "acrylic-3mm", ThicknessMm: 3, KerfMm: .15, Settings: map[OperationKind]LaserSettings{
+		Cut:   {SpeedMmPerMin: 250, PowerPercent: 100, Passes: 1},
+		Score: {SpeedMmPerMin: 1200, PowerPercent: 20, Passes: 1},
+	}},
+	"acrylic-6mm": {Name: "acrylic-6mm", ThicknessMm: 6, KerfMm: .2, Settings: map[OperationKind]LaserSettings{
+		Cut:   {SpeedMmPerMin: 120, PowerPercent: 100, Passes: 2},
+		Score: {SpeedMmPerMin: 1200, PowerPercent: 20, Passes: 1},
+	}},
+	"cardboard": {Name: "cardboard", ThicknessMm: 4, KerfMm: .3, Settings: map[OperationKind]LaserSettings{
+		Cut:     {SpeedMmPerMin: 1000, PowerPercent: 80, Passes: 1},
+		Score:   {SpeedMmPerMin: 3000, PowerPercent: 15, Passes: 1},
+		Engrave: {SpeedMmPerMin: 6000, PowerPercent: 10, Passes: 1},
+	}},
+}
+
+// settings are the laser settings of the material for an operation kind
+func (m Material) settings(kind OperationKind) LaserSettings {
+	if s, ok := m.Settings[kind]; ok {
+		return s
+	}
+	return defaultLaserSettings[kind]
+}
+
+// lookupMaterial finds a preset by name
+func lookupMaterial(name string) (Material, error) {
+	if name == "" {
+		name = "none"
+	}
+	m, ok := materialPresets[strings.ToLower(name)]
+	if !ok {
+		return Material{}, fmt.Errorf("unknown material '%s', expected one of %s", name, strings.Join(materialNames(), ", "))
+	}
+	return m, nil
+}
+
+func materialNames() []string {
+	var names []string
+	for name := range materialPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
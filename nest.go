@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// NestOptions controls how parts are packed onto sheets
+type NestOptions struct {
+	SheetWidthMm  float64
+	SheetHeightMm float64
+	// SpacingMm is the gap left between parts
+	SpacingMm float64
+	// MarginMm is the gap left along the edges of the sheet
+	MarginMm float64
+	// RotationStepDeg is the step parts are rotated by while looking for
+	// the best fit, 0 keeps every part as drawn
+	RotationStepDeg float64
+}
+
+// defaultNestOptions fit the 24 by 18 inch bed of the Helix
+var defaultNestOptions = NestOptions{
+	SheetWidthMm:    609.6,
+	SheetHeightMm:   457.2,
+	SpacingMm:       2,
+	MarginMm:        5,
+	RotationStepDeg: 90,
+}
+
+// NestInput is a job to nest and the number of copies of it to cut
+type NestInput struct {
+	Job    *Job
+	Copies int
+}
+
+// nestPart is one part to place: a closed outer contour that is cut and
+// everything drawn inside of it
+type nestPart struct {
+	Name     string
+	Outline  [][2]float64
+	Segments []svg.Segment
+}
+
+// fitTolerance is the slack allowed when a part exactly fills a free
+// rectangle, rotating its points leaves rounding errors
+const fitTolerance = 1e-9
+
+// nestSheet is a sheet being filled, free holds the empty rectangles of it
+type nestSheet struct {
+	free     []bounds
+	segments []svg.Segment
+}
+
+// nest packs the parts of the inputs onto as many sheets as needed and
+// returns a job for every sheet. Parts are packed by their bounding boxes
+// using the maximal rectangles method, biggest parts first, trying every
+// rotation step on every sheet before starting a new one.
+func nest(inputs []NestInput, opts NestOptions) ([]*Job, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("nothing to nest")
+	}
+	usable := bounds{
+		MaxX: opts.SheetWidthMm - 2*opts.MarginMm + opts.SpacingMm,
+		MaxY: opts.SheetHeightMm - 2*opts.MarginMm + opts.SpacingMm,
+	}
+	if usable.width() <= opts.SpacingMm || usable.height() <= opts.SpacingMm {
+		return nil, fmt.Errorf("sheet of %gx%gmm leaves no room inside a margin of %gmm",
+			opts.SheetWidthMm, opts.SheetHeightMm, opts.MarginMm)
+	}
+
+	var parts []nestPart
+	for _, in := range inputs {
+		found := extractParts(in.Job)
+		for c := 0; c < in.Copies; c++ {
+			parts = append(parts, found...)
+		}
+	}
+	// big parts are the hardest to place, the small ones fill in around them
+	sort.SliceStable(parts, func(i, j int) bool {
+		a, b := pointsBounds(parts[i].Outline), pointsBounds(parts[j].Outline)
+		return a.width()*a.height() > b.width()*b.height()
+	})
+
+	var sheets []*nestSheet
+	for _, part := range parts {
+		placed := false
+		for _, sheet := range sheets {
+			if sheet.place(part, opts) {
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+		sheet := &nestSheet{free: []bounds{usable}}
+		if !sheet.place(part, opts) {
+			b := pointsBounds(part.Outline)
+			return nil, fmt.Errorf("a %.1fx%.1fmm part of %s does not fit on a %gx%gmm sheet",
+				b.width(), b.height(), part.Name, opts.SheetWidthMm, opts.SheetHeightMm)
+		}
+		sheets = append(sheets, sheet)
+	}
+
+	first := inputs[0].Job
+	var jobs []*Job
+	for i, sheet := range sheets {
+		jobs = append(jobs, &Job{
+			Name:       fmt.Sprintf("sheet-%d", i+1),
+			WidthMm:    opts.SheetWidthMm,
+			HeightMm:   opts.SheetHeightMm,
+			Material:   first.Material,
+			Operations: append([]Operation{}, first.Operations...),
+			Segments:   sheet.segments,
+		})
+	}
+	return jobs, nil
+}
+
+// extractParts splits a job into its parts. A part is an outer contour
+// that is cut, with its holes and anything else inside of it. Outlines
+// drawn as overlapping shapes are merged first, so they stay one part.
+// Segments that are not inside any outer contour can not be placed and
+// are dropped.
+func extractParts(j *Job) []nestPart {
+	merged := *j
+	merged.mergeOverlaps()
+	j = &merged
+	roots, nodes := containmentTree(j.cutSegments())
+	parts := make([]nestPart, len(roots))
+	rootOf := map[*contourNode]int{}
+	for i, r := range roots {
+		parts[i] = nestPart{Name: j.Name, Outline: r.Ring}
+		rootOf[r] = i
+	}
+
+	dropped := 0
+	for i, s := range j.Segments {
+		owner := -1
+		if n := nodes[i]; n != nil {
+			for n.Parent != nil {
+				n = n.Parent
+			}
+			owner = rootOf[n]
+		} else if len(s.Points) > 0 {
+			// the smallest outer contour around the segment owns it
+			area := math.Inf(1)
+			for k, r := range roots {
+				if r.Area < area && r.Bounds.contains(pointsBounds(s.Points), 0) && pointInRing(s.Points[0], r.Ring) {
+					owner, area = k, r.Area
+				}
+			}
+		}
+		if owner < 0 {
+			dropped++
+			continue
+		}
+		parts[owner].Segments = append(parts[owner].Segments, s)
+	}
+	if dropped > 0 {
+		log.Printf("WARNING: %s: %d segments are not inside a part and are left out of the nest", j.Name, dropped)
+	}
+	return parts
+}
+
+// place puts the part on the sheet in the free rectangle and rotation it
+// fits best, reporting false if it does not fit anywhere. The best fit
+// leaves the least space along the short side of the free rectangle.
+func (s *nestSheet) place(part nestPart, opts NestOptions) bool {
+	steps := 1
+	if opts.RotationStepDeg > 0 {
+		steps = int(math.Round(360 / opts.RotationStepDeg))
+	}
+
+	bestShort, bestLong := math.Inf(1), math.Inf(1)
+	var bestAngle float64
+	var bestBox, bestSpot bounds
+	for k := 0; k < steps; k++ {
+		angle := float64(k) * opts.RotationStepDeg * math.Pi / 180
+		box := emptyBounds()
+		for _, p := range part.Outline {
+			box = box.extend(rotate(p, angle))
+		}
+		w, h := box.width()+opts.SpacingMm, box.height()+opts.SpacingMm
+		for _, free := range s.free {
+			if w > free.width()+fitTolerance || h > free.height()+fitTolerance {
+				continue
+			}
+			dw, dh := free.width()-w, free.height()-h
+			short, long := math.Min(dw, dh), math.Max(dw, dh)
+			if short < bestShort || (short == bestShort && long < bestLong) {
+				bestShort, bestLong = short, long
+				bestAngle, bestBox = angle, box
+				bestSpot = bounds{MinX: free.MinX, MinY: free.MinY, MaxX: free.MinX + w, MaxY: free.MinY + h}
+			}
+		}
+	}
+	if math.IsInf(bestShort, 1) {
+		return false
+	}
+
+	offset := [2]float64{opts.MarginMm + bestSpot.MinX - bestBox.MinX, opts.MarginMm + bestSpot.MinY - bestBox.MinY}
+	for _, seg := range part.Segments {
+		placed := seg
+		placed.Points = make([][2]float64, len(seg.Points))
+		for i, p := range seg.Points {
+			placed.Points[i] = add(rotate(p, bestAngle), offset)
+		}
+		s.segments = append(s.segments, placed)
+	}
+	s.split(bestSpot)
+	return true
+}
+
+// split removes used from the free rectangles. Every free rectangle it
+// overlaps is replaced by the up to four maximal rectangles around it, and
+// rectangles inside of others are dropped.
+func (s *nestSheet) split(used bounds) {
+	var free []bounds
+	for _, f := range s.free {
+		if used.MinX >= f.MaxX || used.MaxX <= f.MinX || used.MinY >= f.MaxY || used.MaxY <= f.MinY {
+			free = append(free, f)
+			continue
+		}
+		if used.MinX > f.MinX {
+			free = append(free, bounds{MinX: f.MinX, MinY: f.MinY, MaxX: used.MinX, MaxY: f.MaxY})
+		}
+		if used.MaxX < f.MaxX {
+			free = append(free, bounds{MinX: used.MaxX, MinY: f.MinY, MaxX: f.MaxX, MaxY: f.MaxY})
+		}
+		if used.MinY > f.MinY {
+			free = append(free, bounds{MinX: f.MinX, MinY: f.MinY, MaxX: f.MaxX, MaxY: used.MinY})
+		}
+		if used.MaxY < f.MaxY {
+			free = append(free, bounds{MinX: f.MinX, MinY: used.MaxY, MaxX: f.MaxX, MaxY: f.MaxY})
+		}
+	}
+
+	s.free = s.free[:0]
+	for i, f := range free {
+		redundant := false
+		for k, o := range free {
+			if i != k && o.contains(f, 0) && (o != f || k < i) {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			s.free = append(s.free, f)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func plateJob() *Job {
+	return &Job{
+		Name:       "plate",
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments: []svg.Segment{
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(100, 100, 50))},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(110, 110, 10))},
+			{Stroke: "#0000ff", Points: [][2]float64{{130, 130}, {140, 140}}},
+			{Stroke: "#000000", Points: [][2]float64{{0, 0}, {5, 5}}}, // outside of every part
+		},
+	}
+}
+
+func TestNest(t *testing.T) {
+	is := is.New(t)
+	opts := NestOptions{SheetWidthMm: 120, SheetHeightMm: 120, SpacingMm: 2, MarginMm: 5, RotationStepDeg: 90}
+	sheets, err := nest([]NestInput{{Job: plateJob(), Copies: 6}}, opts)
+	is.NoErr(err)
+	is.Equal(len(sheets), 2) // four plates fit on a sheet
+
+	is.Equal(len(sheets[0].Segments), 4*3)
+	is.Equal(len(sheets[1].Segments), 2*3)
+
+	for _, sheet := range sheets {
+		is.Equal(sheet.WidthMm, 120.0)
+		inside := bounds{MinX: 5, MinY: 5, MaxX: 115, MaxY: 115}
+		is.True(inside.contains(segmentsBounds(sheet.Segments), 1e-9))
+
+		var outlines []bounds
+		roots, _ := containmentTree(sheet.cutSegments())
+		for _, r := range roots {
+			outlines = append(outlines, r.Bounds)
+		}
+		for i := range outlines {
+			for k := i + 1; k < len(outlines); k++ {
+				a, b := outlines[i], outlines[k]
+				gap := bounds{MinX: a.MinX - 2 + 1e-9, MinY: a.MinY - 2 + 1e-9, MaxX: a.MaxX + 2 - 1e-9, MaxY: a.MaxY + 2 - 1e-9}
+				is.True(!gap.overlaps(b)) // parts are spaced apart
+			}
+		}
+	}
+}
+
+func TestNestRotation(t *testing.T) {
+	is := is.New(t)
+	bar := &Job{Name: "bar", Segments: []svg.Segment{
+		{Closed: true, Stroke: "#000000", Points: closeRing([][2]float64{{0, 0}, {100, 0}, {100, 20}, {0, 20}})},
+	}}
+	opts := NestOptions{SheetWidthMm: 40, SheetHeightMm: 120}
+
+	_, err := nest([]NestInput{{Job: bar, Copies: 1}}, opts)
+	is.True(err != nil) // too long without rotating
+
+	opts.RotationStepDeg = 90
+	sheets, err := nest([]NestInput{{Job: bar, Copies: 2}}, opts)
+	is.NoErr(err)
+	is.Equal(len(sheets), 1)
+	b := segmentsBounds(sheets[0].Segments)
+	is.True(b.width() <= 40+1e-9 && b.height() <= 100+1e-9)
+}
+
+func TestWriteSVG(t *testing.T) {
+	is := is.New(t)
+	opts := NestOptions{SheetWidthMm: 200, SheetHeightMm: 100, SpacingMm: 2, MarginMm: 5}
+	sheets, err := nest([]NestInput{{Job: plateJob(), Copies: 2}}, opts)
+	is.NoErr(err)
+	is.Equal(len(sheets), 1)
+
+	out := bytes.Buffer{}
+	is.NoErr(sheets[0].writeSVG(&out, SVGOptions{}))
+	doc, err := svg.ParseSvg(out.String(), "sheet", 0)
+	is.NoErr(err)
+	is.Equal(doc.Width, "200mm")
+	is.Equal(doc.ViewBox, "0 0 200 100")
+	segments, err := doc.Segments()
+	is.NoErr(err)
+	is.Equal(len(segments), len(sheets[0].Segments))
+	want, got := segmentsBounds(sheets[0].Segments), segmentsBounds(segments)
+	is.True(want.contains(got, 1e-3) && got.contains(want, 1e-3))
+
+	// and it loads back at the same size
+	job, err := loadSVGJob("sheet", out.Bytes(), materialPresets["none"], CleanOptions{KeepChrome: true, KeepAnnotations: true})
+	is.NoErr(err)
+	is.Equal(job.WidthMm, 200.0)
+	is.Equal(job.HeightMm, 100.0)
+	got = segmentsBounds(job.Segments)
+	is.True(want.contains(got, 1e-3) && got.contains(want, 1e-3))
+}
+
+func TestParseNestArg(t *testing.T) {
+	tests := []struct {
+		arg     string
+		name    string
+		copies  int
+		wantErr bool
+	}{
+		{arg: "plate.svg", name: "plate.svg", copies: 1},
+		{arg: "plate.svg:12", name: "plate.svg", copies: 12},
+		{arg: `C:\parts\plate.svg`, name: `C:\parts\plate.svg`, copies: 1},
+		{arg: `C:\parts\plate.svg:3`, name: `C:\parts\plate.svg`, copies: 3},
+		{arg: "plate.svg:0", wantErr: true},
+		{arg: "plate.svg:-3", wantErr: true},
+		{arg: "plate.svg:two", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			is := is.New(t)
+			name, copies, err := parseNestArg(tt.arg)
+			if tt.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(name, tt.name)
+			is.Equal(copies, tt.copies)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"math"
+)
+
+// JoinStyle is how an offset contour goes around a corner that opens up
+// when the contour is moved outwards
+type JoinStyle int
+
+const (
+	// JoinRound follows an arc around the corner, this is the path the
+	// edge of a round beam takes
+	JoinRound JoinStyle = iota
+	// JoinMiter extends the two edges until they meet, corners that are
+	// sharper than the miter limit are cut off square
+	JoinMiter
+)
+
+// OffsetOptions controls how contours are offset
+type OffsetOptions struct {
+	Join JoinStyle
+	// MiterLimit is the longest a miter may be, as a multiple of the offset
+	MiterLimit float64
+	// Tolerance is the largest distance an arc may deviate from a true circle
+	Tolerance float64
+}
+
+var defaultOffsetOptions = OffsetOptions{
+	Join:       JoinRound,
+	MiterLimit: 4,
+	Tolerance:  .01,
+}
+
+// offsetRing moves every edge of a ring delta to its outside, where a
+// positive delta grows the area of the ring and a negative one shrinks it.
+// The raw offset contour loops back on itself around concave corners and
+// where the ring is narrower than the offset, these loops are removed so
+// the result is zero or more simple rings. The rings are returned in the
+// same direction as the input ring.
+func offsetRing(ring [][2]float64, delta float64, opts OffsetOptions) [][][2]float64 {
+	ring = simplifyRing(openRing(ring), 0)
+	if len(ring) < 3 {
+		return nil
+	}
+	reversed := ringArea(ring) < 0
+	if reversed {
+		ring = reverseRing(ring)
+	}
+	if delta == 0 {
+		return [][][2]float64{orient(ring, reversed)}
+	}
+
+	raw := rawOffset(ring, delta, opts)
+	// the raw contour winds positively around the area that should stay,
+	// loops that turned inside out wind negatively or not at all
+	rings := resolveRings([][][2]float64{raw}, func(w int) bool { return w > 0 })
+	var result [][][2]float64
+	for _, r := range rings {
+		if ringArea(r) < 0 {
+			// a hole that appeared where the offset closed off part of the
+			// ring, like a slot that is narrower than the beam. Those areas
+			// can not be cut so they are dropped.
+			continue
+		}
+		result = append(result, orient(r, reversed))
+	}
+	return result
+}
+
+func orient(ring [][2]float64, reversed bool) [][2]float64 {
+	if reversed {
+		return reverseRing(ring)
+	}
+	return ring
+}
+
+// rawOffset offsets every edge of a ring with a positive area and joins
+// the offset edges without removing the loops that form.
+func rawOffset(ring [][2]float64, delta float64, opts OffsetOptions) [][2]float64 {
+	n := len(ring)
+	// the outside of a ring with a positive area is to the right of its edges
+	normals := make([][2]float64, n)
+	for i := range ring {
+		d := normalize(sub(ring[(i+1)%n], ring[i]))
+		normals[i] = [2]float64{d[1], -d[0]}
+	}
+
+	var out [][2]float64
+	for i, p := range ring {
+		n0 := normals[(i+n-1)%n] // normal of the edge ending at p
+		n1 := normals[i]         // normal of the edge starting at p
+		a := add(p, mul(n0, delta))
+		b := add(p, mul(n1, delta))
+
+		turn := cross(n0, n1)
+		if math.Abs(turn) < 1e-12 && dot(n0, n1) > 0 {
+			// straight through
+			out = append(out, a)
+			continue
+		}
+		if turn*delta <= 0 {
+			// the offset edges overlap at this corner, go through the
+			// original corner so the loop that forms has no area outside
+			// the final contour
+			out = append(out, a, p, b)
+			continue
+		}
+
+		switch opts.Join {
+		case JoinMiter:
+			cosTheta := dot(n0, n1)
+			miterLength := math.Sqrt(2 / (1 + cosTheta))
+			if cosTheta <= -1+1e-12 || miterLength > opts.MiterLimit {
+				// square off the corner at the miter limit
+				limit := math.Max(opts.MiterLimit, 1)
+				mid := normalize(add(n0, n1))
+				if mid == ([2]float64{}) {
+					mid = normalize(sub(n1, n0))
+				}
+				tip := add(p, mul(mid, delta*limit))
+				along := [2]float64{-mid[1], mid[0]}
+				// where the square cut meets the two offset edges
+				ca := lineIntersection(tip, along, a, [2]float64{-n0[1], n0[0]})
+				cb := lineIntersection(tip, along, b, [2]float64{-n1[1], n1[0]})
+				out = append(out, a, ca, cb, b)
+				continue
+			}
+			out = append(out, add(p, mul(add(n0, n1), delta/(1+cosTheta))))
+		default:
+			out = append(out, arcPoints(p, a, b, math.Abs(delta), delta < 0, opts.Tolerance)...)
+		}
+	}
+	return out
+}
+
+// lineIntersection returns where the line through p with direction d
+// meets the line through q with direction e, or p if they are parallel
+func lineIntersection(p, d, q, e [2]float64) [2]float64 {
+	denom := cross(d, e)
+	if math.Abs(denom) < 1e-12 {
+		return p
+	}
+	t := cross(sub(q, p), e) / denom
+	return add(p, mul(d, t))
+}
+
+// arcPoints approximates the arc around center from a to b, both of which
+// are radius away from center. The arc turns right (clockwise with the y
+// axis up) when clockwise is set. The points include a and b.
+func arcPoints(center, a, b [2]float64, radius float64, clockwise bool, tolerance float64) [][2]float64 {
+	start := math.Atan2(a[1]-center[1], a[0]-center[0])
+	end := math.Atan2(b[1]-center[1], b[0]-center[0])
+	sweep := end - start
+	if clockwise {
+		for sweep > 0 {
+			sweep -= 2 * math.Pi
+		}
+	} else {
+		for sweep < 0 {
+			sweep += 2 * math.Pi
+		}
+	}
+	steps := arcSteps(radius, math.Abs(sweep), tolerance)
+	points := make([][2]float64, 0, steps+1)
+	points = append(points, a)
+	for i := 1; i < steps; i++ {
+		angle := start + sweep*float64(i)/float64(steps)
+		points = append(points, [2]float64{center[0] + radius*math.Cos(angle), center[1] + radius*math.Sin(angle)})
+	}
+	return append(points, b)
+}
+
+// arcSteps is how many straight lines are needed so that an arc of the
+// given radius and sweep stays within tolerance of the true arc
+func arcSteps(radius, sweep, tolerance float64) int {
+	if radius <= tolerance || tolerance <= 0 {
+		return int(math.Max(1, math.Ceil(sweep/(math.Pi/4))))
+	}
+	step := 2 * math.Acos(1-tolerance/radius)
+	return int(math.Max(1, math.Ceil(sweep/step)))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// OperationKind is what the laser does along the segments of an operation
+type OperationKind int
+
+const (
+	// Cut goes all the way through the material
+	Cut OperationKind = iota
+	// Score marks the surface with a light vector pass
+	Score
+	// Engrave is a fast, low power vector pass over hatch lines that
+	// shades the surface of a filled area
+	Engrave
+)
+
+func (k OperationKind) String() string {
+	switch k {
+	case Cut:
+		return "cut"
+	case Score:
+		return "score"
+	case Engrave:
+		return "engrave"
+	}
+	return fmt.Sprintf("OperationKind(%d)", int(k))
+}
+
+// Operation is a set of segments processed with the same settings.
+// Segments belong to the operation whose colour matches their stroke.
+type Operation struct {
+	Name  string
+	Color string // #rrggbb
+	Kind  OperationKind
+	Lead  LeadOptions
+}
+
+// defaultOperations follow the colours most teams already use: black is
+// cut and blue is scored. Strokes of any other colour are cut. Hatch lines
+// are engraved, they get an orange of their own that drawings do not use
+// so no colour of a drawing changes what it means.
+var defaultOperations = []Operation{
+	{Name: "cut", Color: "#000000", Kind: Cut},
+	{Name: "score", Color: "#0000ff", Kind: Score},
+	{Name: "hatch", Color: "#ff8000", Kind: Engrave},
+}
+
+// operationFor returns the operation a segment belongs to, or nil for
+// segments without a stroke as those are not lines the laser follows.
+func (j *Job) operationFor(s svg.Segment) *Operation {
+	color := normalizeColor(s.Stroke)
+	if color == "" || color == "none" {
+		return nil
+	}
+	for i := range j.Operations {
+		if j.Operations[i].Color == color {
+			return &j.Operations[i]
+		}
+	}
+	if len(j.Operations) == 0 {
+		return &defaultOperations[0]
+	}
+	return &j.Operations[0]
+}
+
+// cutContours builds the containment tree of the closed contours that are
+// cut through. A scored outline inside a part is not a hole, so segments
+// of other operations are left out. The nodes are indexed like j.Segments.
+func (j *Job) cutContours() []*contourNode {
+	_, nodes := containmentTree(j.cutSegments())
+	return nodes
+}
+
+// cutSegments copies the segments of the job with only the contours that
+// are cut still closed
+func (j *Job) cutSegments() []svg.Segment {
+	masked := make([]svg.Segment, len(j.Segments))
+	for i, s := range j.Segments {
+		masked[i] = s
+		if op := j.operationFor(s); op == nil || op.Kind != Cut {
+			masked[i].Closed = false
+		}
+	}
+	return masked
+}
+
+var namedColors = map[string]string{
+	"black":   "#000000",
+	"white":   "#ffffff",
+	"red":     "#ff0000",
+	"lime":    "#00ff00",
+	"green":   "#008000",
+	"blue":    "#0000ff",
+	"yellow":  "#ffff00",
+	"cyan":    "#00ffff",
+	"aqua":    "#00ffff",
+	"magenta": "#ff00ff",
+	"fuchsia": "#ff00ff",
+	"gray":    "#808080",
+	"grey":    "#808080",
+	"orange":  "#ffa500",
+}
+
+// normalizeColor turns an svg colour into #rrggbb, so colours written
+// differently can be compared. Values that are not a colour, like none,
+// are returned lower cased.
+func normalizeColor(color string) string {
+	c := strings.ToLower(strings.TrimSpace(color))
+	if named, ok := namedColors[c]; ok {
+		return named
+	}
+	if strings.HasPrefix(c, "#") && len(c) == 4 {
+		return "#" + strings.Repeat(c[1:2], 2) + strings.Repeat(c[2:3], 2) + strings.Repeat(c[3:4], 2)
+	}
+	if strings.HasPrefix(c, "rgb(") && strings.HasSuffix(c, ")") {
+		parts := strings.Split(c[4:len(c)-1], ",")
+		if len(parts) == 3 {
+			var rgb [3]int
+			for i, p := range parts {
+				p = strings.TrimSpace(p)
+				var v float64
+				var err error
+				if strings.HasSuffix(p, "%") {
+					v, err = strconv.ParseFloat(strings.TrimSuffix(p, "%"), 64)
+					v = v * 255 / 100
+				} else {
+					v, err = strconv.ParseFloat(p, 64)
+				}
+				if err != nil {
+					return c
+				}
+				rgb[i] = int(v + .5)
+				if rgb[i] > 255 {
+					rgb[i] = 255
+				}
+			}
+			return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+		}
+	}
+	return c
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestNormalizeColor(t *testing.T) {
+	tests := []struct {
+		color string
+		want  string
+	}{
+		{"black", "#000000"},
+		{" Blue ", "#0000ff"},
+		{"#F00", "#ff0000"},
+		{"#00ff00", "#00ff00"},
+		{"rgb(0, 0, 255)", "#0000ff"},
+		{"rgb(100%,0%,0%)", "#ff0000"},
+		{"none", "none"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(normalizeColor(tt.color), tt.want)
+		})
+	}
+}
+
+func TestOperationFor(t *testing.T) {
+	is := is.New(t)
+	job := &Job{Operations: append([]Operation{}, defaultOperations...)}
+	is.Equal(job.operationFor(svg.Segment{Stroke: "black"}).Name, "cut")
+	is.Equal(job.operationFor(svg.Segment{Stroke: "#00f"}).Name, "score")
+	is.Equal(job.operationFor(svg.Segment{Stroke: "red"}).Name, "cut")
+	is.Equal(job.operationFor(svg.Segment{Stroke: "#ff8000"}).Name, "hatch")
+	is.True(job.operationFor(svg.Segment{Stroke: "none"}) == nil)
+	is.True(job.operationFor(svg.Segment{}) == nil)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// kindOrder is the order operations are run in. Marking the surface goes
+// first while the sheet is still whole and every part is where it was
+// drawn.
+var kindOrder = map[OperationKind]int{Engrave: 0, Score: 1, Cut: 2}
+
+// applyOrder puts the segments of the job in the order they are cut.
+// Engraving and scoring come before cutting. Cuts go from the inside out,
+// a part drops out of the sheet once its outer profile is cut, so its
+// holes and any parts inside them are cut before it. Within each of those
+// groups the next segment is the one closest to where the last one ended,
+// open segments may be cut backwards and closed contours are started at
+// the point closest to the head. Segments that belong to no operation keep
+// their order at the end.
+func (j *Job) applyOrder() {
+	nodes := j.cutContours()
+
+	type group struct {
+		kind, depth int
+	}
+	groups := map[group][]int{}
+	var keys []group
+	var unassigned []svg.Segment
+	for i, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || len(s.Points) == 0 {
+			unassigned = append(unassigned, s)
+			continue
+		}
+		g := group{kind: kindOrder[op.Kind]}
+		if op.Kind == Cut {
+			g.depth = cutDepth(i, j.Segments, nodes)
+		}
+		if _, ok := groups[g]; !ok {
+			keys = append(keys, g)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].kind != keys[b].kind {
+			return keys[a].kind < keys[b].kind
+		}
+		return keys[a].depth > keys[b].depth
+	})
+
+	var ordered []svg.Segment
+	head := [2]float64{0, 0}
+	for _, key := range keys {
+		var next []svg.Segment
+		next, head = nearestOrder(j.Segments, groups[key], head)
+		ordered = append(ordered, next...)
+	}
+	j.Segments = append(ordered, unassigned...)
+}
+
+// cutDepth is how many closed cut contours segment i is inside. A closed
+// contour has it from the containment tree, an open segment is inside the
+// contours around its first point.
+func cutDepth(i int, segments []svg.Segment, nodes []*contourNode) int {
+	if nodes[i] != nil {
+		return nodes[i].Depth
+	}
+	p := segments[i].Points[0]
+	depth := 0
+	for k, n := range nodes {
+		if n != nil && k != i && near(n.Bounds, p, 0) && pointInRing(p, n.Ring) {
+			depth++
+		}
+	}
+	return depth
+}
+
+// nearestOrder orders the segments at indexes, each one starting as close
+// as it can to where the one before ended, beginning at head. It returns
+// the segments and where the last one ends.
+func nearestOrder(segments []svg.Segment, indexes []int, head [2]float64) ([]svg.Segment, [2]float64) {
+	left := append([]int{}, indexes...)
+	var ordered []svg.Segment
+	for len(left) > 0 {
+		best, bestDist, bestStart := 0, math.Inf(1), 0
+		for k, i := range left {
+			start, dist := closestStart(segments[i], head)
+			if dist < bestDist {
+				best, bestDist, bestStart = k, dist, start
+			}
+		}
+		s := startAt(segments[left[best]], bestStart)
+		ordered = append(ordered, s)
+		head = s.Points[len(s.Points)-1]
+		left = append(left[:best], left[best+1:]...)
+	}
+	return ordered, head
+}
+
+// closestStart is the point s can start at closest to p and how far it
+// is. An open segment starts at either end, a closed contour at any of
+// its points. The start is an index of s.Points, -1 for the far end of an
+// open segment.
+func closestStart(s svg.Segment, p [2]float64) (int, float64) {
+	if !s.Closed {
+		first, last := distance(s.Points[0], p), distance(s.Points[len(s.Points)-1], p)
+		if last < first {
+			return -1, last
+		}
+		return 0, first
+	}
+	best, bestDist := 0, math.Inf(1)
+	for i, q := range openRing(s.Points) {
+		if d := distance(q, p); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best, bestDist
+}
+
+// startAt returns a copy of s starting at start, as returned by
+// closestStart
+func startAt(s svg.Segment, start int) svg.Segment {
+	started := s
+	switch {
+	case start == -1:
+		started.Points = make([][2]float64, len(s.Points))
+		for i, p := range s.Points {
+			started.Points[len(s.Points)-1-i] = p
+		}
+	case start > 0 && s.Closed:
+		ring := openRing(s.Points)
+		started.Points = closeRing(append(append([][2]float64{}, ring[start:]...), ring[:start]...))
+	}
+	return started
+}
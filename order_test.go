@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestApplyOrder(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Operations: defaultOperations,
+		Segments: []svg.Segment{
+			{Closed: true, Stroke: "#000000", Layer: "outer", Points: closeRing(square(0, 0, 100))},
+			{Closed: true, Stroke: "#000000", Layer: "hole", Points: closeRing(square(60, 60, 20))},
+			{Closed: true, Stroke: "#000000", Layer: "part in hole", Points: closeRing(square(65, 65, 5))},
+			{Stroke: "#0000ff", Layer: "score", Points: [][2]float64{{50, 10}, {10, 10}}},
+			{Stroke: "none", Layer: "unassigned", Points: [][2]float64{{0, 0}, {1, 1}}},
+			{Closed: true, Stroke: "#ff8000", Layer: "engrave", Points: closeRing(square(20, 20, 10))},
+			{Closed: true, Stroke: "#000000", Layer: "other hole", Points: closeRing(square(10, 60, 20))},
+		},
+	}
+	job.applyOrder()
+
+	var layers []string
+	for _, s := range job.Segments {
+		layers = append(layers, s.Layer)
+	}
+	is.Equal(layers, []string{"engrave", "score", "part in hole", "hole", "other hole", "outer", "unassigned"})
+
+	// the score line is cut backwards from the end nearest the engraving,
+	// the engraving starts at its corner closest to the origin
+	is.Equal(job.Segments[0].Points[0], [2]float64{20, 20})
+	is.Equal(job.Segments[1].Points[0], [2]float64{10, 10})
+	// closed contours stay closed when started somewhere else
+	hole := job.Segments[3].Points
+	is.Equal(hole[0], hole[len(hole)-1])
+	is.Equal(len(hole), 5)
+}
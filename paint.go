@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// graphicsState is the part of the graphics state of pdf and postscript
+// that changes what gets cut. The transformation matrix maps user space
+// to millimetres from the top left corner of the job, widths are in user
+// space units.
+type graphicsState struct {
+	ctm    matrix
+	stroke string
+	fill   string
+	width  float64
+}
+
+// subpath is a part of the current path, its points are in millimetres
+type subpath struct {
+	points [][2]float64
+	closed bool
+}
+
+// painter turns the path construction and painting operators pdf and
+// postscript share into segments. Points are transformed by the matrix as
+// the path is built, like both of them do, so the matrix can change in
+// the middle of a path.
+type painter struct {
+	graphicsState
+	saved     []graphicsState
+	tolerance float64
+	// layer is put on every segment painted and nothing is painted while
+	// hidden is set
+	layer    string
+	hidden   bool
+	path     []subpath
+	segments []svg.Segment
+	element  int
+}
+
+// newGraphicsState is the state a page starts with, black hairlines
+// drawn with the page matrix
+func newGraphicsState(page matrix) graphicsState {
+	return graphicsState{ctm: page, stroke: "#000000", fill: "#000000", width: 1}
+}
+
+func (p *painter) save() {
+	p.saved = append(p.saved, p.graphicsState)
+}
+
+// restore goes back to the last saved state. Unbalanced restores are
+// ignored, the page state is never thrown away.
+func (p *painter) restore() {
+	if n := len(p.saved); n > 0 {
+		p.graphicsState = p.saved[n-1]
+		p.saved = p.saved[:n-1]
+	}
+}
+
+// concat puts m in front of the matrix, so it applies to user space
+// before the transformations already there
+func (p *painter) concat(m matrix) {
+	p.ctm = m.then(p.ctm)
+}
+
+// current is the current point in millimetres and if there is one
+func (p *painter) current() ([2]float64, bool) {
+	if len(p.path) == 0 {
+		return [2]float64{}, false
+	}
+	sp := p.path[len(p.path)-1]
+	if sp.closed {
+		return sp.points[0], true
+	}
+	return sp.points[len(sp.points)-1], true
+}
+
+func (p *painter) moveTo(pt [2]float64) {
+	p.moveToDevice(p.ctm.apply(pt))
+}
+
+func (p *painter) moveToDevice(pt [2]float64) {
+	if n := len(p.path); n > 0 && len(p.path[n-1].points) == 1 {
+		// a move straight after another one replaces it
+		p.path[n-1].points[0] = pt
+		return
+	}
+	p.path = append(p.path, subpath{points: [][2]float64{pt}})
+}
+
+func (p *painter) lineTo(pt [2]float64) {
+	p.lineToDevice(p.ctm.apply(pt))
+}
+
+// lineToDevice adds a line from the current point. Drawing on from a
+// closed subpath starts a new one where it started, a line without a
+// current point starts the path.
+func (p *painter) lineToDevice(pt [2]float64) {
+	start, ok := p.current()
+	if !ok {
+		p.moveToDevice(pt)
+		return
+	}
+	if p.path[len(p.path)-1].closed {
+		p.path = append(p.path, subpath{points: [][2]float64{start}})
+	}
+	sp := &p.path[len(p.path)-1]
+	sp.points = append(sp.points, pt)
+}
+
+func (p *painter) curveTo(c1, c2, end [2]float64) {
+	p.curveToDevice(p.ctm.apply(c1), p.ctm.apply(c2), p.ctm.apply(end))
+}
+
+// curveToDevice adds a cubic bezier from the current point, flattened
+// into lines no further than the tolerance from the curve. The distance
+// is at most 3/4 of how far the control points are from being evenly
+// spaced on a line, over the square of the number of lines.
+func (p *painter) curveToDevice(c1, c2, end [2]float64) {
+	start, ok := p.current()
+	if !ok {
+		p.moveToDevice(c1)
+		start = c1
+	}
+	d := math.Max(
+		math.Hypot(start[0]-2*c1[0]+c2[0], start[1]-2*c1[1]+c2[1]),
+		math.Hypot(c1[0]-2*c2[0]+end[0], c1[1]-2*c2[1]+end[1]),
+	)
+	n := 1
+	if p.tolerance > 0 {
+		n = int(math.Max(1, math.Ceil(math.Sqrt(.75*d/p.tolerance))))
+	}
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		u := 1 - t
+		a, b, c, e := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+		p.lineToDevice([2]float64{
+			a*start[0] + b*c1[0] + c*c2[0] + e*end[0],
+			a*start[1] + b*c1[1] + c*c2[1] + e*end[1],
+		})
+	}
+}
+
+// closePath closes the last subpath with a line back to where it started
+func (p *painter) closePath() {
+	if n := len(p.path); n > 0 && len(p.path[n-1].points) > 1 {
+		p.path[n-1].closed = true
+	}
+}
+
+func (p *painter) newPath() {
+	p.path = nil
+}
+
+// paint turns the current path into segments and starts a new one. A
+// filled subpath is closed whether it was closed or not, it is filled as
+// if it was. Lines are as wide as the line width in user space is on the
+// page.
+func (p *painter) paint(stroke, fill, evenOdd bool) {
+	path := p.path
+	p.path = nil
+	if p.hidden || !stroke && !fill {
+		return
+	}
+	segment := svg.Segment{
+		Width:   p.width * math.Sqrt(math.Abs(p.ctm[0]*p.ctm[3]-p.ctm[1]*p.ctm[2])),
+		Stroke:  "none",
+		Fill:    "none",
+		Layer:   p.layer,
+		Element: p.element,
+	}
+	if stroke {
+		segment.Stroke = p.stroke
+	}
+	if fill {
+		segment.Fill = p.fill
+		segment.FillRule = "nonzero"
+		if evenOdd {
+			segment.FillRule = "evenodd"
+		}
+	}
+	painted := false
+	for _, sp := range path {
+		if len(sp.points) < 2 {
+			continue
+		}
+		s := segment
+		s.Points = sp.points
+		if ring := openRing(sp.points); (sp.closed || fill && !stroke) && len(ring) > 2 {
+			s.Closed = true
+			s.Points = closeRing(ring)
+		}
+		p.segments = append(p.segments, s)
+		painted = true
+	}
+	if painted {
+		p.element++
+	}
+}
+
+// deviceColor is the colour of gray, rgb or cmyk components from 0 to 1,
+// told apart by how many there are
+func deviceColor(components []float64) (string, bool) {
+	c := make([]float64, len(components))
+	for i, v := range components {
+		c[i] = math.Min(1, math.Max(0, v))
+	}
+	var rgb [3]float64
+	switch len(c) {
+	case 1:
+		rgb = [3]float64{c[0], c[0], c[0]}
+	case 3:
+		rgb = [3]float64{c[0], c[1], c[2]}
+	case 4:
+		for i := range rgb {
+			rgb[i] = (1 - c[i]) * (1 - c[3])
+		}
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("#%02x%02x%02x", int(rgb[0]*255+.5), int(rgb[1]*255+.5), int(rgb[2]*255+.5)), true
+}
@@ -0,0 +1,1074 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfMaxDepth limits how far references, the page tree and form xobjects
+// are followed, a broken file could make them go round in circles
+const pdfMaxDepth = 32
+
+// pdfPointsPerIn is the size of the default user space unit of pdf and
+// postscript, a point
+const pdfPointsPerIn = 72
+
+// pdfName is a name object, without the slash
+type pdfName string
+
+// pdfKeyword is an operator in a content stream or a bare word like obj
+// or R in the file, the delimiters of arrays and dictionaries too
+type pdfKeyword string
+
+// pdfRef is an indirect reference to an object
+type pdfRef struct {
+	num, gen int
+}
+
+type pdfDict map[pdfName]interface{}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// pdfLexer reads the objects of pdf syntax. Numbers are float64, strings
+// are string and booleans bool, null is nil.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// skipSpace skips white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// token reads the next token. It returns io.EOF at the end of the data.
+func (l *pdfLexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	start := l.pos
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		var name []byte
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			if l.data[l.pos] == '#' && l.pos+2 < len(l.data) {
+				if b, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+					name = append(name, b[0])
+					l.pos += 3
+					continue
+				}
+			}
+			name = append(name, l.data[l.pos])
+			l.pos++
+		}
+		return pdfName(name), nil
+	case c == '(':
+		return l.literalString()
+	case bytes.HasPrefix(l.data[l.pos:], []byte("<<")), bytes.HasPrefix(l.data[l.pos:], []byte(">>")):
+		l.pos += 2
+		return pdfKeyword(l.data[start:l.pos]), nil
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated hex string at offset %d", start)
+		}
+		l.pos += end + 1
+		return hexString(l.data[start+1 : l.pos-1]), nil
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(l.data[start:l.pos]), nil
+	case c == ')' || c == '>':
+		return nil, fmt.Errorf("unexpected '%c' at offset %d", c, start)
+	}
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if strings.IndexByte("+-.0123456789", word[0]) >= 0 {
+		if v, err := strconv.ParseFloat(word, 64); err == nil {
+			return v, nil
+		}
+	}
+	return pdfKeyword(word), nil
+}
+
+// literalString reads a string in parentheses, which may hold balanced
+// parentheses and backslash escapes
+func (l *pdfLexer) literalString() (string, error) {
+	start := l.pos
+	l.pos++
+	var s []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(s), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// a backslash at the end of a line continues the string
+				if c == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// hexString decodes the digits of a hex string, a missing last digit is 0
+func hexString(digits []byte) string {
+	var clean []byte
+	for _, c := range digits {
+		if !isPDFSpace(c) {
+			clean = append(clean, c)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	s, _ := hex.DecodeString(string(clean))
+	return string(s)
+}
+
+// object reads the next object, putting arrays, dictionaries and
+// references together. Any other keyword is returned as it is.
+func (l *pdfLexer) object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.objectFrom(tok, 0)
+}
+
+func (l *pdfLexer) objectFrom(tok interface{}, depth int) (interface{}, error) {
+	if depth > pdfMaxDepth {
+		return nil, fmt.Errorf("objects nested too deep at offset %d", l.pos)
+	}
+	switch t := tok.(type) {
+	case float64:
+		// a reference is two whole numbers followed by R
+		save := l.pos
+		if gen, err := l.token(); err == nil && isWhole(t) && isWhole(gen) {
+			if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+				return pdfRef{num: int(t), gen: int(gen.(float64))}, nil
+			}
+		}
+		l.pos = save
+	case pdfKeyword:
+		switch t {
+		case "true", "false":
+			return t == "true", nil
+		case "null":
+			return nil, nil
+		case "[":
+			array := []interface{}{}
+			for {
+				tok, err := l.token()
+				if err != nil {
+					return nil, fmt.Errorf("unterminated array - %w", err)
+				}
+				if tok == pdfKeyword("]") {
+					return array, nil
+				}
+				v, err := l.objectFrom(tok, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, v)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				tok, err := l.token()
+				if err != nil {
+					return nil, fmt.Errorf("unterminated dictionary - %w", err)
+				}
+				if tok == pdfKeyword(">>") {
+					return dict, nil
+				}
+				key, ok := tok.(pdfName)
+				if !ok {
+					return nil, fmt.Errorf("dictionary key %v is not a name at offset %d", tok, l.pos)
+				}
+				tok, err = l.token()
+				if err != nil {
+					return nil, fmt.Errorf("unterminated dictionary - %w", err)
+				}
+				v, err := l.objectFrom(tok, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = v
+			}
+		}
+	}
+	return tok, nil
+}
+
+func isWhole(v interface{}) bool {
+	f, ok := v.(float64)
+	return ok && f >= 0 && f == math.Trunc(f)
+}
+
+// skipInlineImage skips the data of an inline image after its BI
+// operator, up to the EI operator on its own after it
+func (l *pdfLexer) skipInlineImage() error {
+	for {
+		tok, err := l.object()
+		if err != nil {
+			return fmt.Errorf("unterminated inline image - %w", err)
+		}
+		if tok == pdfKeyword("ID") {
+			break
+		}
+	}
+	for i := l.pos + 1; i+2 <= len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && isPDFSpace(l.data[i-1]) &&
+			(i+2 == len(l.data) || isPDFSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return nil
+		}
+	}
+	return fmt.Errorf("unterminated inline image")
+}
+
+// pdfLocation is where an object is, at an offset in the file or at an
+// offset in the decoded data of an object stream
+type pdfLocation struct {
+	offset int
+	stream int
+}
+
+// pdfFile is a parsed pdf file. Objects are found by looking for their
+// headers instead of through the cross reference table, which is often
+// wrong in files that have been edited, and are read as they are needed.
+type pdfFile struct {
+	data      []byte
+	locations map[int]pdfLocation
+	objects   map[int]interface{}
+	streams   map[int][]byte
+	trailer   pdfDict
+}
+
+var pdfObjectRegex = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+var pdfTrailerRegex = regexp.MustCompile(`trailer\s*<<`)
+
+// openPDF finds the objects and the trailer of a pdf file. Objects that
+// are defined more than once take the last definition, like the updates
+// appended to an edited file do.
+func openPDF(data []byte) (*pdfFile, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a pdf file, it does not start with %%PDF-")
+	}
+	f := scanPDF(data)
+	if f.trailer["Root"] == nil {
+		// cross reference streams hold the trailer in their dictionary,
+		// failing that the catalog is found by its type
+		for _, num := range f.objectNumbers() {
+			d := f.dict(num)
+			if d["Type"] == pdfName("XRef") && d["Root"] != nil {
+				f.trailer["Root"] = d["Root"]
+			}
+			if d["Type"] == pdfName("Catalog") && f.trailer["Root"] == nil {
+				f.trailer["Root"] = pdfRef{num: num}
+			}
+		}
+	}
+	if f.trailer["Root"] == nil {
+		return nil, fmt.Errorf("the pdf has no document catalog")
+	}
+	return f, nil
+}
+
+// scanPDF finds the objects and trailers in data, which does not have to
+// be a whole pdf file
+func scanPDF(data []byte) *pdfFile {
+	f := &pdfFile{
+		data:      data,
+		locations: map[int]pdfLocation{},
+		objects:   map[int]interface{}{},
+		streams:   map[int][]byte{},
+		trailer:   pdfDict{},
+	}
+	for _, m := range pdfObjectRegex.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		f.locations[num] = pdfLocation{offset: m[1], stream: -1}
+		// objects in an object stream are defined where the stream is
+		if bytes.Contains(f.window(m[1]), []byte("/ObjStm")) {
+			f.loadObjectStream(num)
+		}
+	}
+
+	for _, m := range pdfTrailerRegex.FindAllIndex(data, -1) {
+		l := &pdfLexer{data: data, pos: m[1] - 2}
+		if trailer, err := l.object(); err == nil {
+			if d, ok := trailer.(pdfDict); ok {
+				for k, v := range d {
+					f.trailer[k] = v
+				}
+			}
+		}
+	}
+	return f
+}
+
+// window is the start of the object at offset, enough to see its type
+func (f *pdfFile) window(offset int) []byte {
+	end := offset + 256
+	if end > len(f.data) {
+		end = len(f.data)
+	}
+	return f.data[offset:end]
+}
+
+func (f *pdfFile) objectNumbers() []int {
+	var nums []int
+	for num := range f.locations {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// loadObjectStream adds the objects in object stream num. Its data starts
+// with pairs of object numbers and offsets from the first object.
+func (f *pdfFile) loadObjectStream(num int) {
+	s, ok := f.object(num).(*pdfStream)
+	if !ok {
+		return
+	}
+	data, err := f.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := f.resolve(s.dict["N"]).(float64)
+	first, _ := f.resolve(s.dict["First"]).(float64)
+	f.streams[num] = data
+	l := &pdfLexer{data: data}
+	for i := 0; i < int(n); i++ {
+		objNum, err1 := l.token()
+		offset, err2 := l.token()
+		if err1 != nil || err2 != nil || !isWhole(objNum) || !isWhole(offset) {
+			return
+		}
+		f.locations[int(objNum.(float64))] = pdfLocation{offset: int(first + offset.(float64)), stream: num}
+		delete(f.objects, int(objNum.(float64)))
+	}
+}
+
+// object reads object num, nil when it is missing or broken
+func (f *pdfFile) object(num int) interface{} {
+	if v, ok := f.objects[num]; ok {
+		return v
+	}
+	// a reference back to the object while it is read finds nothing
+	f.objects[num] = nil
+	loc, ok := f.locations[num]
+	if !ok {
+		return nil
+	}
+	data := f.data
+	if loc.stream >= 0 {
+		data = f.streams[loc.stream]
+	}
+	if loc.offset > len(data) {
+		return nil
+	}
+	l := &pdfLexer{data: data, pos: loc.offset}
+	v, err := l.object()
+	if err != nil {
+		return nil
+	}
+	if d, ok := v.(pdfDict); ok && loc.stream < 0 {
+		save := l.pos
+		if tok, err := l.token(); err == nil && tok == pdfKeyword("stream") {
+			v = &pdfStream{dict: d, data: f.streamData(d, l.pos)}
+		} else {
+			l.pos = save
+		}
+	}
+	f.objects[num] = v
+	return v
+}
+
+// streamData is the data of a stream whose stream keyword ends at start.
+// The length is checked against where endstream is, it is often wrong.
+func (f *pdfFile) streamData(d pdfDict, start int) []byte {
+	if bytes.HasPrefix(f.data[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(f.data) && (f.data[start] == '\n' || f.data[start] == '\r') {
+		start++
+	}
+	if length, ok := f.resolve(d["Length"]).(float64); ok && length >= 0 && start+int(length) <= len(f.data) {
+		end := start + int(length)
+		if bytes.HasPrefix(bytes.TrimLeft(f.data[end:], "\x00\t\n\f\r "), []byte("endstream")) {
+			return f.data[start:end]
+		}
+	}
+	end := bytes.Index(f.data[start:], []byte("endstream"))
+	if end < 0 {
+		return f.data[start:]
+	}
+	return bytes.TrimRight(f.data[start:start+end], "\r\n")
+}
+
+// resolve follows references to the object they point to
+func (f *pdfFile) resolve(v interface{}) interface{} {
+	for depth := 0; depth < pdfMaxDepth; depth++ {
+		r, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.object(r.num)
+	}
+	return nil
+}
+
+// dict is object num as a dictionary, the dictionary of a stream too
+func (f *pdfFile) dict(num int) pdfDict {
+	return f.dictOf(pdfRef{num: num})
+}
+
+func (f *pdfFile) dictOf(v interface{}) pdfDict {
+	switch o := f.resolve(v).(type) {
+	case pdfDict:
+		return o
+	case *pdfStream:
+		return o.dict
+	}
+	return nil
+}
+
+// array is v as an array, a single object is an array of one
+func (f *pdfFile) array(v interface{}) []interface{} {
+	switch o := f.resolve(v).(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return o
+	default:
+		return []interface{}{o}
+	}
+}
+
+// numbers is v as an array of n numbers
+func (f *pdfFile) numbers(v interface{}, n int) ([]float64, bool) {
+	array := f.array(v)
+	if len(array) != n {
+		return nil, false
+	}
+	numbers := make([]float64, n)
+	for i, item := range array {
+		var ok bool
+		if numbers[i], ok = f.resolve(item).(float64); !ok {
+			return nil, false
+		}
+	}
+	return numbers, true
+}
+
+// decode applies the filters of a stream to its data
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	data := s.data
+	params := f.array(s.dict["DecodeParms"])
+	for i, filter := range f.array(s.dict["Filter"]) {
+		name, _ := f.resolve(filter).(pdfName)
+		if i < len(params) {
+			if predictor, ok := f.dictOf(params[i])["Predictor"].(float64); ok && predictor > 1 {
+				return nil, fmt.Errorf("unsupported predictor %g", predictor)
+			}
+		}
+		switch name {
+		case "FlateDecode", "Fl":
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("unable to inflate stream - %w", err)
+			}
+			decoded, err := ioutil.ReadAll(r)
+			// keep what could be read of a truncated stream
+			if err != nil && len(decoded) == 0 {
+				return nil, fmt.Errorf("unable to inflate stream - %w", err)
+			}
+			data = decoded
+		case "ASCIIHexDecode", "AHx":
+			if end := bytes.IndexByte(data, '>'); end >= 0 {
+				data = data[:end]
+			}
+			data = []byte(hexString(data))
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end >= 0 {
+				data = data[:end]
+			}
+			decoded, err := ioutil.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode ascii85 stream - %w", err)
+			}
+			data = decoded
+		default:
+			return nil, fmt.Errorf("unsupported stream filter '%s'", name)
+		}
+	}
+	return data, nil
+}
+
+// pdfText decodes a text string, which is utf-16 when it starts with a
+// byte order mark and pdf doc encoding, close enough to latin-1,
+// otherwise
+func pdfText(s string) string {
+	if strings.HasPrefix(s, "\xfe\xff") {
+		var units []uint16
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// pdfPage is a page with the attributes it inherits from the page tree
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+	box       [4]float64
+	rotate    int
+	userUnit  float64
+}
+
+// pdfInherited are the page attributes a page takes from its parents
+var pdfInherited = []pdfName{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// pages are the pages of the document in order
+func (f *pdfFile) pages() ([]pdfPage, error) {
+	root := f.dictOf(f.trailer["Root"])
+	if root == nil {
+		return nil, fmt.Errorf("the pdf has no document catalog")
+	}
+	var pages []pdfPage
+	var walk func(node interface{}, inherited pdfDict, depth int) error
+	walk = func(node interface{}, inherited pdfDict, depth int) error {
+		if depth > pdfMaxDepth {
+			return fmt.Errorf("the page tree is too deep")
+		}
+		d := f.dictOf(node)
+		if d == nil {
+			return nil
+		}
+		attrs := pdfDict{}
+		for _, key := range pdfInherited {
+			if v, ok := d[key]; ok {
+				attrs[key] = v
+			} else if v, ok := inherited[key]; ok {
+				attrs[key] = v
+			}
+		}
+		if kids, ok := d["Kids"]; ok && d["Type"] != pdfName("Page") {
+			for _, kid := range f.array(kids) {
+				if err := walk(kid, attrs, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		pages = append(pages, f.page(d, attrs))
+		return nil
+	}
+	if err := walk(root["Pages"], nil, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// page reads the attributes of a page. The crop box is what is shown of
+// the page, a US letter page is assumed when there is no media box.
+func (f *pdfFile) page(d pdfDict, attrs pdfDict) pdfPage {
+	p := pdfPage{dict: d, resources: f.dictOf(attrs["Resources"]), box: [4]float64{0, 0, 612, 792}, userUnit: 1}
+	box, ok := f.numbers(attrs["CropBox"], 4)
+	if !ok {
+		box, ok = f.numbers(attrs["MediaBox"], 4)
+	}
+	if ok {
+		p.box = [4]float64{
+			math.Min(box[0], box[2]), math.Min(box[1], box[3]),
+			math.Max(box[0], box[2]), math.Max(box[1], box[3]),
+		}
+	}
+	if rotate, ok := f.resolve(attrs["Rotate"]).(float64); ok {
+		p.rotate = (int(rotate)%360 + 360) % 360
+	}
+	if unit, ok := f.resolve(d["UserUnit"]).(float64); ok && unit > 0 {
+		p.userUnit = unit
+	}
+	return p
+}
+
+// transform maps the default user space of the page to millimetres on
+// the job, with the top of the page at top. It returns the size of the
+// page as it is shown, turned by its rotation.
+func (p pdfPage) transform(top float64) (matrix, float64, float64) {
+	w, h := p.box[2]-p.box[0], p.box[3]-p.box[1]
+	// from points on the page to points on the turned page, with y down
+	var turn matrix
+	switch p.rotate {
+	case 90:
+		turn = matrix{0, 1, 1, 0, 0, 0}
+	case 180:
+		turn = matrix{-1, 0, 0, 1, w, 0}
+	case 270:
+		turn = matrix{0, -1, -1, 0, h, w}
+	default:
+		turn = matrix{1, 0, 0, -1, 0, h}
+	}
+	if p.rotate == 90 || p.rotate == 270 {
+		w, h = h, w
+	}
+	k := p.userUnit * MILIMETERS_PER_INCH / pdfPointsPerIn
+	m := matrix{1, 0, 0, 1, -p.box[0], -p.box[1]}.then(turn).then(matrix{k, 0, 0, k, 0, top})
+	return m, w * k, h * k
+}
+
+// contents is the content of a page, which may be split over several
+// streams
+func (f *pdfFile) contents(p pdfPage) ([]byte, error) {
+	var data []byte
+	for _, c := range f.array(p.dict["Contents"]) {
+		s, ok := f.resolve(c).(*pdfStream)
+		if !ok {
+			continue
+		}
+		decoded, err := f.decode(s)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, decoded...), '\n')
+	}
+	return data, nil
+}
+
+// pdfContent runs content streams on a painter
+type pdfContent struct {
+	file *pdfFile
+	*painter
+	// marked is the stack of marked content sequences, the layer each
+	// one is on and if it is hidden
+	marked []pdfMarked
+	// hidden are the layers left out by name and optional content groups
+	// that are off by object number
+	hiddenLayers map[string]bool
+	hiddenOCG    map[int]bool
+}
+
+type pdfMarked struct {
+	layer  string
+	hidden bool
+}
+
+// run interprets a content stream with its resources. Operators that
+// only change how things look, text and images are skipped.
+func (c *pdfContent) run(data []byte, resources pdfDict, depth int) error {
+	if depth > pdfMaxDepth {
+		return fmt.Errorf("form xobjects nested too deep")
+	}
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		obj, err := l.object()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		if op == "BI" {
+			if err := l.skipInlineImage(); err != nil {
+				return err
+			}
+		} else if err := c.operator(string(op), operands, resources, depth); err != nil {
+			return err
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfOperands are the last n operands as numbers, if they are
+func pdfOperands(operands []interface{}, n int) ([]float64, bool) {
+	if len(operands) < n {
+		return nil, false
+	}
+	numbers := make([]float64, n)
+	for i, o := range operands[len(operands)-n:] {
+		var ok bool
+		if numbers[i], ok = o.(float64); !ok {
+			return nil, false
+		}
+	}
+	return numbers, true
+}
+
+func (c *pdfContent) operator(op string, operands []interface{}, resources pdfDict, depth int) error {
+	switch op {
+	case "q":
+		c.save()
+	case "Q":
+		c.restore()
+	case "cm":
+		if v, ok := pdfOperands(operands, 6); ok {
+			c.concat(matrix{v[0], v[1], v[2], v[3], v[4], v[5]})
+		}
+	case "w":
+		if v, ok := pdfOperands(operands, 1); ok {
+			c.width = v[0]
+		}
+	case "gs":
+		if name, ok := lastName(operands); ok {
+			state := c.file.dictOf(c.file.dictOf(resources["ExtGState"])[name])
+			if width, ok := c.file.resolve(state["LW"]).(float64); ok {
+				c.width = width
+			}
+		}
+	case "m":
+		if v, ok := pdfOperands(operands, 2); ok {
+			c.moveTo([2]float64{v[0], v[1]})
+		}
+	case "l":
+		if v, ok := pdfOperands(operands, 2); ok {
+			c.lineTo([2]float64{v[0], v[1]})
+		}
+	case "c":
+		if v, ok := pdfOperands(operands, 6); ok {
+			c.curveTo([2]float64{v[0], v[1]}, [2]float64{v[2], v[3]}, [2]float64{v[4], v[5]})
+		}
+	case "v":
+		// the first control point is the current point
+		if v, ok := pdfOperands(operands, 4); ok {
+			if start, ok := c.current(); ok {
+				c.curveToDevice(start, c.ctm.apply([2]float64{v[0], v[1]}), c.ctm.apply([2]float64{v[2], v[3]}))
+			}
+		}
+	case "y":
+		// the second control point is the end point
+		if v, ok := pdfOperands(operands, 4); ok {
+			end := c.ctm.apply([2]float64{v[2], v[3]})
+			c.curveToDevice(c.ctm.apply([2]float64{v[0], v[1]}), end, end)
+		}
+	case "h":
+		c.closePath()
+	case "re":
+		if v, ok := pdfOperands(operands, 4); ok {
+			c.moveTo([2]float64{v[0], v[1]})
+			c.lineTo([2]float64{v[0] + v[2], v[1]})
+			c.lineTo([2]float64{v[0] + v[2], v[1] + v[3]})
+			c.lineTo([2]float64{v[0], v[1] + v[3]})
+			c.closePath()
+		}
+	case "S":
+		c.paint(true, false, false)
+	case "s":
+		c.closePath()
+		c.paint(true, false, false)
+	case "f", "F":
+		c.paint(false, true, false)
+	case "f*":
+		c.paint(false, true, true)
+	case "B":
+		c.paint(true, true, false)
+	case "B*":
+		c.paint(true, true, true)
+	case "b":
+		c.closePath()
+		c.paint(true, true, false)
+	case "b*":
+		c.closePath()
+		c.paint(true, true, true)
+	case "n":
+		c.newPath()
+	case "G", "RG", "K":
+		if color, ok := operandColor(operands); ok {
+			c.stroke = color
+		}
+	case "g", "rg", "k":
+		if color, ok := operandColor(operands); ok {
+			c.fill = color
+		}
+	case "SC", "SCN":
+		// patterns have a name and keep the colour they had
+		if color, ok := operandColor(operands); ok {
+			c.stroke = color
+		}
+	case "sc", "scn":
+		if color, ok := operandColor(operands); ok {
+			c.fill = color
+		}
+	case "CS":
+		c.stroke = "#000000"
+	case "cs":
+		c.fill = "#000000"
+	case "BMC":
+		c.beginMarked(pdfMarked{})
+	case "BDC":
+		marked := pdfMarked{}
+		if len(operands) == 2 && operands[0] == pdfName("OC") {
+			props := operands[1]
+			if name, ok := props.(pdfName); ok {
+				props = c.file.dictOf(resources["Properties"])[name]
+			}
+			marked = c.optionalContent(props)
+		}
+		c.beginMarked(marked)
+	case "EMC":
+		if n := len(c.marked); n > 0 {
+			c.marked = c.marked[:n-1]
+			c.updateLayer()
+		}
+	case "Do":
+		if name, ok := lastName(operands); ok {
+			return c.drawXObject(c.file.dictOf(resources["XObject"])[name], resources, depth)
+		}
+	}
+	return nil
+}
+
+// lastName is the last operand as a name, if it is one
+func lastName(operands []interface{}) (pdfName, bool) {
+	if len(operands) == 0 {
+		return "", false
+	}
+	name, ok := operands[len(operands)-1].(pdfName)
+	return name, ok
+}
+
+// operandColor is the colour of numeric colour operands, gray, rgb or
+// cmyk by how many there are
+func operandColor(operands []interface{}) (string, bool) {
+	v, ok := pdfOperands(operands, len(operands))
+	if !ok {
+		return "", false
+	}
+	return deviceColor(v)
+}
+
+// optionalContent is the layer of an optional content group, or of the
+// first group of a membership dictionary
+func (c *pdfContent) optionalContent(props interface{}) pdfMarked {
+	d := c.file.dictOf(props)
+	if d["Type"] == pdfName("OCMD") {
+		groups := c.file.array(d["OCGs"])
+		if len(groups) == 0 {
+			return pdfMarked{}
+		}
+		props = groups[0]
+		d = c.file.dictOf(props)
+	}
+	name, _ := c.file.resolve(d["Name"]).(string)
+	marked := pdfMarked{layer: pdfText(name)}
+	if r, ok := props.(pdfRef); ok && c.hiddenOCG[r.num] {
+		marked.hidden = true
+	}
+	marked.hidden = marked.hidden || c.hiddenLayers[marked.layer]
+	return marked
+}
+
+// beginMarked starts a marked content sequence. One that is not on a
+// layer stays on the layer around it.
+func (c *pdfContent) beginMarked(marked pdfMarked) {
+	if n := len(c.marked); n > 0 {
+		if marked.layer == "" {
+			marked.layer = c.marked[n-1].layer
+		}
+		marked.hidden = marked.hidden || c.marked[n-1].hidden
+	}
+	c.marked = append(c.marked, marked)
+	c.updateLayer()
+}
+
+func (c *pdfContent) updateLayer() {
+	c.layer, c.hidden = "", false
+	if n := len(c.marked); n > 0 {
+		c.layer, c.hidden = c.marked[n-1].layer, c.marked[n-1].hidden
+	}
+}
+
+// drawXObject draws a form xobject, a content stream of its own with its
+// own matrix and resources. Images are skipped.
+func (c *pdfContent) drawXObject(ref interface{}, resources pdfDict, depth int) error {
+	s, ok := c.file.resolve(ref).(*pdfStream)
+	if !ok || s.dict["Subtype"] != pdfName("Form") {
+		return nil
+	}
+	data, err := c.file.decode(s)
+	if err != nil {
+		return err
+	}
+	if own := c.file.dictOf(s.dict["Resources"]); own != nil {
+		resources = own
+	}
+	c.save()
+	defer c.restore()
+	if m, ok := c.file.numbers(s.dict["Matrix"], 6); ok {
+		c.concat(matrix{m[0], m[1], m[2], m[3], m[4], m[5]})
+	}
+	if oc, ok := s.dict["OC"]; ok {
+		c.beginMarked(c.optionalContent(oc))
+		defer func(n int) {
+			c.marked = c.marked[:n]
+			c.updateLayer()
+		}(len(c.marked) - 1)
+	}
+	return c.run(data, resources, depth+1)
+}
+
+// loadPDFJob reads the vector drawing of a pdf into a job. Pages are put
+// one under the other, in points of 1/72in unless the page has a user
+// unit. Optional content groups become layers, the ones that are off and
+// the layers in clean.Drop are left out. Text is left out like the text
+// of a dxf, Onshape draws the parts with lines.
+func loadPDFJob(name string, file []byte, material Material, clean CleanOptions) (*Job, error) {
+	f, err := openPDF(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse pdf - %w", err)
+	}
+	pages, err := f.pages()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse pdf - %w", err)
+	}
+	return f.job(name, pages, material, clean)
+}
+
+// job draws pages into a job, one under the other
+func (f *pdfFile) job(name string, pages []pdfPage, material Material, clean CleanOptions) (*Job, error) {
+	content := &pdfContent{
+		file:         f,
+		painter:      &painter{tolerance: defaultOffsetOptions.Tolerance},
+		hiddenLayers: map[string]bool{},
+		hiddenOCG:    map[int]bool{},
+	}
+	for _, layer := range clean.Drop {
+		content.hiddenLayers[layer] = true
+	}
+	config := f.dictOf(f.dictOf(f.dictOf(f.trailer["Root"])["OCProperties"])["D"])
+	for _, off := range f.array(config["OFF"]) {
+		if r, ok := off.(pdfRef); ok {
+			content.hiddenOCG[r.num] = true
+		}
+	}
+
+	width, height := 0.0, 0.0
+	for i, page := range pages {
+		m, w, h := page.transform(height)
+		content.graphicsState = newGraphicsState(m)
+		content.saved, content.marked = nil, nil
+		content.updateLayer()
+		content.newPath()
+		data, err := f.contents(page)
+		if err == nil {
+			err = content.run(data, page.resources, 0)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read page %d of %s - %w", i+1, name, err)
+		}
+		width, height = math.Max(width, w), height+h
+	}
+	if len(content.segments) == 0 {
+		return nil, fmt.Errorf("%s has no geometry to cut", name)
+	}
+
+	return &Job{
+		Name:       name,
+		WidthMm:    width,
+		HeightMm:   height,
+		Material:   material,
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments:   joinSegments(content.segments, joinTolerance),
+	}, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+// pdfDocument writes numbered objects and a trailer pointing at object 1
+// as a pdf file. There is no cross reference table, it is not needed to
+// read the file.
+func pdfDocument(objects ...string) []byte {
+	out := bytes.Buffer{}
+	out.WriteString("%PDF-1.5\n")
+	for i, o := range objects {
+		if o != "" {
+			fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, o)
+		}
+	}
+	out.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return out.Bytes()
+}
+
+// pdfFlateStream is a stream object holding data compressed with flate
+func pdfFlateStream(dict, data string) string {
+	compressed := bytes.Buffer{}
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte(data))
+	w.Close()
+	return fmt.Sprintf("<< %s /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", dict, compressed.Len(), compressed.String())
+}
+
+func TestLoadPDFJob(t *testing.T) {
+	is := is.New(t)
+	page1 := strings.Join([]string{
+		"q 0.5 0 0 0.5 0 0 cm 1 0 0 RG 2 w 0 0 m 288 0 l S Q",
+		"0 0 1 rg 10 10 20 20 re f",
+		"BI /W 1 /H 1 /BPC 8 /CS /G ID \xff EI",
+		"/OC /Off BDC 0 0 m 10 10 l S EMC",
+		"/OC /Parts BDC 0 36 m 36 72 108 72 144 36 c S EMC",
+		"BT /F1 12 Tf (not cut) Tj ET",
+		"q 1 0 0 1 100 0 cm /Fm1 Do Q",
+	}, "\n")
+	// the pages are in an object stream
+	pages := "<< /Type /Pages /Kids [4 0 R 5 0 R] /Count 2 /MediaBox [0 0 144 72] >>"
+	file := pdfDocument(
+		"<< /Type /Catalog /Pages 3 0 R /OCProperties << /OCGs [8 0 R 9 0 R] /D << /OFF [8 0 R] >> >> >>",
+		fmt.Sprintf("<< /Type /ObjStm /N 1 /First 4 /Length %d >>\nstream\n3 0 %s\nendstream", len(pages)+4, pages),
+		"",
+		"<< /Type /Page /Parent 3 0 R /Contents 6 0 R /Resources << /Properties << /Off 8 0 R /Parts 9 0 R >> /XObject << /Fm1 10 0 R >> >> >>",
+		"<< /Type /Page /Parent 3 0 R /MediaBox [0 0 72 72] /Contents [7 0 R] >>",
+		pdfFlateStream("", page1),
+		pdfFlateStream("", "0 G 0 0 m 72 72 l S"),
+		"<< /Type /OCG /Name (hidden) >>",
+		"<< /Type /OCG /Name <FEFF00700061007200740073> >>",
+		pdfFlateStream("/Type /XObject /Subtype /Form /BBox [0 0 20 20] /Matrix [2 0 0 2 0 0]", "0 5 m 10 5 l S"),
+	)
+
+	job, err := loadJob(context.Background(), "drawing.pdf", file, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	k := MILIMETERS_PER_INCH / 72
+	// the second page goes under the first one
+	is.True(math.Abs(job.WidthMm-144*k) < 1e-9)
+	is.True(math.Abs(job.HeightMm-144*k) < 1e-9)
+	is.Equal(len(job.Segments), 5) // not the hidden layer, the image or the text
+
+	find := func(match func(s svg.Segment) bool) svg.Segment {
+		for _, s := range job.Segments {
+			if match(s) {
+				return s
+			}
+		}
+		t.Fatal("segment not found")
+		return svg.Segment{}
+	}
+	nearPoint := func(p [2]float64, x, y float64) bool {
+		return math.Abs(p[0]-x) < 1e-6 && math.Abs(p[1]-y) < 1e-6
+	}
+
+	// a point is 1/72in and y is flipped
+	line := find(func(s svg.Segment) bool { return s.Stroke == "#ff0000" })
+	is.True(nearPoint(line.Points[0], 0, 72*k) && nearPoint(line.Points[1], 144*k, 72*k))
+	is.True(math.Abs(line.Width-k) < 1e-9) // 2 units wide at half size
+
+	square := find(func(s svg.Segment) bool { return s.Fill == "#0000ff" })
+	is.True(square.Closed)
+	is.Equal(square.Stroke, "none")
+	is.Equal(square.FillRule, "nonzero")
+	b := pointsBounds(square.Points)
+	is.True(math.Abs(b.MinX-10*k) < 1e-9 && math.Abs(b.MinY-42*k) < 1e-9 && math.Abs(b.width()-20*k) < 1e-9)
+
+	curve := find(func(s svg.Segment) bool { return s.Layer == "parts" })
+	is.True(len(curve.Points) > 2)
+	is.True(math.Abs(pointsBounds(curve.Points).MinY-9*k) < defaultOffsetOptions.Tolerance)
+
+	form := find(func(s svg.Segment) bool { return nearPoint(s.Points[0], 100*k, 62*k) })
+	is.True(nearPoint(form.Points[1], 120*k, 62*k))
+
+	page2 := find(func(s svg.Segment) bool { return pointsBounds(s.Points).MaxY > 72*k+1 })
+	is.True(nearPoint(page2.Points[0], 0, 144*k) && nearPoint(page2.Points[1], 72*k, 72*k))
+
+	// the layers in clean.Drop are left out too
+	job, err = loadJob(context.Background(), "drawing.pdf", file, materialPresets["none"], CleanOptions{Drop: []string{"parts"}})
+	is.NoErr(err)
+	is.Equal(len(job.Segments), 4)
+}
+
+func TestPDFLexer(t *testing.T) {
+	is := is.New(t)
+	l := &pdfLexer{data: []byte(`<< /A#20B (a\(b\)\101\
+c) /Hex <41 4>  /Ref 12 0 R /Arr [1 -.5 true null /N] >> % comment`)}
+	v, err := l.object()
+	is.NoErr(err)
+	d := v.(pdfDict)
+	is.Equal(d["A B"], "a(b)Ac")
+	is.Equal(d["Hex"], "A@")
+	is.Equal(d["Ref"], pdfRef{num: 12})
+	is.Equal(d["Arr"], []interface{}{1.0, -.5, true, nil, pdfName("N")})
+	_, err = l.object()
+	is.True(err != nil) // the end of the data
+	is.Equal(pdfText("\xfe\xff\x00h\x00i"), "hi")
+
+	_, err = openPDF([]byte("not a pdf"))
+	is.True(err != nil)
+}
+
+func TestLoadPDFJobOnshape(t *testing.T) {
+	is := is.New(t)
+	pdf, err := ioutil.ReadFile("./samples/pdf/Top Drawer Drawing 1.pdf")
+	is.NoErr(err)
+	dxf, err := ioutil.ReadFile("./samples/Top Drawer Drawing 1.dxf")
+	is.NoErr(err)
+
+	fromPDF, err := loadJob(context.Background(), "Top Drawer Drawing 1.pdf", pdf, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	fromDXF, err := loadJob(context.Background(), "Top Drawer Drawing 1.dxf", dxf, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+
+	// the 24x18in sheet has the same contours on the same layer as the dxf
+	is.True(math.Abs(fromPDF.WidthMm-24*MILIMETERS_PER_INCH) < 1e-9)
+	is.True(math.Abs(fromPDF.HeightMm-18*MILIMETERS_PER_INCH) < 1e-9)
+	is.Equal(len(fromPDF.Segments), len(fromDXF.Segments))
+	for _, s := range fromPDF.Segments {
+		is.True(s.Closed)
+		is.Equal(s.Layer, "Visible")
+	}
+	a, b := segmentsBounds(fromPDF.Segments), segmentsBounds(fromDXF.Segments)
+	is.True(math.Abs(a.width()-b.width()) < 1e-3 && math.Abs(a.height()-b.height()) < 1e-3)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// PDFOptions is how writePDF draws a job for the laser driver
+type PDFOptions struct {
+	Strokes StrokeOptions
+	// Images draws the raster images of the job, which the driver engraves
+	Images bool
+}
+
+var defaultPDFOptions = PDFOptions{
+	Strokes: defaultStrokeOptions,
+	Images:  true,
+}
+
+// writePDF writes the job as a one page pdf the size of the job. Strokes
+// are drawn as hairlines in the colour of their operation, like fixStoke
+// draws them, fills in their own colour. Images go under the paths.
+func (j *Job) writePDF(w io.Writer, opts PDFOptions) error {
+	k := pdfPointsPerIn / MILIMETERS_PER_INCH
+	// the catalog, the page tree, the page and its contents come first,
+	// the images after them
+	objects := make([]string, 4)
+
+	content := bytes.Buffer{}
+	// millimetres from the top left corner
+	fmt.Fprintf(&content, "%s 0 0 %s 0 %s cm\n", formatPDF(k), formatPDF(-k), formatPDF(j.HeightMm*k))
+
+	var xobjects []string
+	if opts.Images {
+		for i, img := range j.Images {
+			obj, err := pdfImage(img.Data, len(objects)+1)
+			if err != nil {
+				log.Printf("%s - image %d left out - %s", j.Name, i+1, err)
+				continue
+			}
+			name := fmt.Sprintf("Im%d", i+1)
+			xobjects = append(xobjects, fmt.Sprintf("/%s %d 0 R", name, len(objects)+1))
+			objects = append(objects, obj...)
+			fmt.Fprintf(&content, "q %s cm /%s Do Q\n", pdfMatrix(img.Matrix), name)
+		}
+	}
+
+	fmt.Fprintf(&content, "%s w 1 J 1 j\n", formatPDF(opts.Strokes.WidthIn*MILIMETERS_PER_INCH))
+	for _, s := range j.Segments {
+		writePDFSegment(&content, s, j.Operations, opts.Strokes)
+	}
+
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"
+	resources := ""
+	if len(xobjects) > 0 {
+		resources = "/XObject << " + strings.Join(xobjects, " ") + " >>"
+	}
+	objects[2] = fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << %s >> /Contents 4 0 R >>",
+		formatPDF(j.WidthMm*k), formatPDF(j.HeightMm*k), resources)
+	objects[3] = pdfStreamObject("", content.Bytes())
+
+	out := bytes.Buffer{}
+	// the comment of high bytes tells programs the file is binary
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writePDFSegment writes the path of s and the operator painting it, in the
+// colour of the one of operations it belongs to
+func writePDFSegment(out *bytes.Buffer, s svg.Segment, operations []Operation, strokes StrokeOptions) {
+	stroked := s.Stroke != "" && normalizeColor(s.Stroke) != "none"
+	filled := s.Fill != "" && normalizeColor(s.Fill) != "none"
+	if len(s.Points) < 2 || !stroked && !filled {
+		return
+	}
+	if stroked {
+		fmt.Fprintf(out, "%s RG\n", pdfColor(vectorColor(s.Stroke, operations, strokes.Color)))
+	}
+	if filled {
+		fmt.Fprintf(out, "%s rg\n", pdfColor(s.Fill))
+	}
+
+	points := s.Points
+	if s.Closed {
+		points = openRing(points)
+	}
+	for i, p := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(out, "%s %s %s\n", formatMm(p[0]), formatMm(p[1]), op)
+	}
+
+	op := "S"
+	switch {
+	case filled && stroked:
+		op = "B"
+	case filled:
+		op = "f"
+	}
+	if filled && s.FillRule == "evenodd" {
+		op += "*"
+	}
+	if s.Closed {
+		op = "h " + op
+	}
+	fmt.Fprintln(out, op)
+}
+
+// pdfColor is the three rgb components of a colour, black when it is not
+// one normalizeColor knows
+func pdfColor(c string) string {
+	rgb, _ := parseHexColor(normalizeColor(c))
+	return fmt.Sprintf("%s %s %s", formatPDF(rgb[0]/255), formatPDF(rgb[1]/255), formatPDF(rgb[2]/255))
+}
+
+func pdfMatrix(m matrix) string {
+	parts := make([]string, len(m))
+	for i, v := range m {
+		parts[i] = formatPDF(v)
+	}
+	return strings.Join(parts, " ")
+}
+
+// pdfImage is the image xobject of a png or jpeg file and the soft mask
+// of its transparency, if it has any. first is the number of the image
+// object, the mask comes after it. Jpeg files are put in as they are.
+func pdfImage(data []byte, first int) ([]string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8", b.Dx(), b.Dy())
+	if format == "jpeg" {
+		switch img.(type) {
+		case *image.YCbCr:
+			return []string{pdfStreamData(dict+" /ColorSpace /DeviceRGB /Filter /DCTDecode", data)}, nil
+		case *image.Gray:
+			return []string{pdfStreamData(dict+" /ColorSpace /DeviceGray /Filter /DCTDecode", data)}, nil
+		}
+	}
+
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 255
+		}
+	}
+	if opaque {
+		return []string{pdfStreamObject(dict+" /ColorSpace /DeviceRGB", rgb)}, nil
+	}
+	return []string{
+		pdfStreamObject(dict+fmt.Sprintf(" /ColorSpace /DeviceRGB /SMask %d 0 R", first+1), rgb),
+		pdfStreamObject(dict+" /ColorSpace /DeviceGray", alpha),
+	}, nil
+}
+
+// pdfStreamObject is a stream object of data compressed with flate, dict
+// is the rest of its dictionary
+func pdfStreamObject(dict string, data []byte) string {
+	compressed := bytes.Buffer{}
+	z := zlib.NewWriter(&compressed)
+	z.Write(data)
+	z.Close()
+	return pdfStreamData(strings.TrimSpace(dict+" /Filter /FlateDecode"), compressed.Bytes())
+}
+
+// pdfStreamData is a stream object of data as it is
+func pdfStreamData(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// formatPDF prints a number with six decimals, without trailing zeros, the
+// scale from millimetres to points needs them to keep a micron
+func formatPDF(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 6, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+// testPNG is a png file of a 2x1 image, the right pixel see through
+func testPNG() []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	img.Set(1, 0, color.NRGBA{B: 255, A: 0})
+	out := bytes.Buffer{}
+	png.Encode(&out, img)
+	return out.Bytes()
+}
+
+func TestWritePDF(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:     "test",
+		WidthMm:  100,
+		HeightMm: 50,
+		// red is the colour of an operation of this job
+		Operations: []Operation{{Name: "cut", Color: "#000000", Kind: Cut}, {Name: "mark", Color: "#ff0000", Kind: Score}},
+		Segments: []svg.Segment{
+			{Points: [][2]float64{{10, 10}, {90, 10}}, Stroke: "red", Fill: "none", Width: 2},
+			{Points: closeRing(square(20, 20, 10)), Closed: true, Stroke: "none", Fill: "#0000ff", FillRule: "evenodd"},
+			{Points: [][2]float64{{0, 0}, {1, 1}}, Stroke: "none", Fill: "none"}, // not painted
+		},
+		Images: []JobImage{{Matrix: matrix{20, 0, 0, -10, 50, 30}, Data: testPNG()}},
+	}
+	out := bytes.Buffer{}
+	is.NoErr(job.writePDF(&out, defaultPDFOptions))
+	is.True(strings.Contains(out.String(), "/SMask"))
+
+	// the pdf reader gets the same drawing back
+	read, err := loadPDFJob("test.pdf", out.Bytes(), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.True(math.Abs(read.WidthMm-100) < 1e-3 && math.Abs(read.HeightMm-50) < 1e-3)
+	is.Equal(len(read.Segments), 2)
+
+	find := func(match func(s svg.Segment) bool) svg.Segment {
+		for _, s := range read.Segments {
+			if match(s) {
+				return s
+			}
+		}
+		t.Fatal("segment not found")
+		return svg.Segment{}
+	}
+
+	line := find(func(s svg.Segment) bool { return !s.Closed })
+	is.Equal(line.Stroke, "#ff0000")
+	is.True(math.Abs(line.Width-defaultStrokeOptions.WidthIn*MILIMETERS_PER_INCH) < 1e-3) // a hairline
+	b := pointsBounds(line.Points)
+	is.True(math.Abs(b.MinX-10) < 1e-3 && math.Abs(b.MaxX-90) < 1e-3 && math.Abs(b.MinY-10) < 1e-3 && b.height() < 1e-3)
+
+	filled := find(func(s svg.Segment) bool { return s.Closed })
+	is.True(filled.Closed)
+	is.Equal(filled.Fill, "#0000ff")
+	is.Equal(filled.FillRule, "evenodd")
+	b = pointsBounds(filled.Points)
+	is.True(math.Abs(b.MinX-20) < 1e-3 && math.Abs(b.MinY-20) < 1e-3 && math.Abs(b.width()-10) < 1e-3)
+
+	// images are optional
+	out.Reset()
+	is.NoErr(job.writePDF(&out, PDFOptions{Strokes: defaultStrokeOptions}))
+	is.True(!strings.Contains(out.String(), "/Image"))
+}
+
+func TestSVGImages(t *testing.T) {
+	is := is.New(t)
+	href := "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG())
+	root, err := xmltree.Parse([]byte(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+		<g transform="translate(10 20)">
+			<image x="0" y="0" width="40" height="40" xlink:href="` + href + `"/>
+			<image x="0" y="0" width="40" height="40" preserveAspectRatio="none" href="` + href + `"/>
+			<image href="linked.png" width="10" height="10"/>
+		</g>
+		<defs><image width="10" height="10" href="` + href + `"/></defs>
+	</svg>`))
+	is.NoErr(err)
+	images := svgImages(root, matrix{2, 0, 0, 2, 0, 0})
+	is.Equal(len(images), 2)
+
+	// the 2x1 image meets the middle of the square box
+	is.Equal(images[0].Matrix, matrix{80, 0, 0, -40, 20, 100})
+	is.Equal(images[1].Matrix, matrix{80, 0, 0, -80, 20, 120})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// resolveRings rebuilds a set of possibly self intersecting and
+// overlapping rings into simple rings. Every edge is split where it
+// crosses another edge, then the pieces that separate an area where keep
+// is true from an area where it is false are linked back together. keep
+// is given the winding number of the area. The resulting rings have the
+// kept area on their left, so outer boundaries have a positive area and
+// holes a negative one.
+func resolveRings(rings [][][2]float64, keep func(winding int) bool) [][][2]float64 {
+	return resolveOperands([][][][2]float64{rings}, func(windings []int) bool { return keep(windings[0]) })
+}
+
+// resolveOperands is resolveRings for several sets of rings at once. keep
+// is given the winding number of the area in every set, which is what
+// boolean operations between the sets decide on.
+func resolveOperands(operands [][][][2]float64, keep func(windings []int) bool) [][][2]float64 {
+	var rings [][][2]float64
+	for _, o := range operands {
+		rings = append(rings, o...)
+	}
+	edges := splitEdges(rings)
+	if len(edges) == 0 {
+		return nil
+	}
+
+	b := emptyBounds()
+	for _, r := range rings {
+		b = b.union(pointsBounds(r))
+	}
+	eps := math.Max(math.Hypot(b.width(), b.height())*1e-9, 1e-12)
+
+	windings := make([]int, len(operands))
+	keepAt := func(p [2]float64) bool {
+		for i, o := range operands {
+			windings[i] = windingAll(p, o)
+		}
+		return keep(windings)
+	}
+
+	// classify every piece by the winding just to its left and right
+	var kept []polygonEdge
+	for _, e := range edges {
+		d := sub(e.b, e.a)
+		l := length(d)
+		offset := math.Min(eps*1000, l/4)
+		n := mul([2]float64{-d[1] / l, d[0] / l}, offset) // left normal
+		mid := lerp(e.a, e.b, 0.5)
+		left := keepAt(add(mid, n))
+		right := keepAt(sub(mid, n))
+		if left == right {
+			continue
+		}
+		if left {
+			kept = append(kept, e)
+		} else {
+			kept = append(kept, polygonEdge{a: e.b, b: e.a})
+		}
+	}
+	return linkEdges(kept)
+}
+
+// windingAll is the winding number of p summed over all rings
+func windingAll(p [2]float64, rings [][][2]float64) int {
+	w := 0
+	for _, r := range rings {
+		w += windingNumber(p, r)
+	}
+	return w
+}
+
+type polygonEdge struct {
+	a, b [2]float64
+}
+
+// snapGrid is the grid intersection points are rounded to so that the
+// pieces of different edges meet in exactly the same point
+const snapGrid = 1e-7
+
+func snap(p [2]float64) [2]float64 {
+	return [2]float64{math.Round(p[0]/snapGrid) * snapGrid, math.Round(p[1]/snapGrid) * snapGrid}
+}
+
+// splitEdges cuts the edges of all rings at every point where they touch
+// or cross another edge. Pieces that lie on top of each other are only
+// returned once.
+func splitEdges(rings [][][2]float64) []polygonEdge {
+	type edgeInfo struct {
+		a, b   [2]float64
+		bounds bounds
+		cuts   []float64
+	}
+	var edges []*edgeInfo
+	for _, r := range rings {
+		for i := range r {
+			a, b := snap(r[i]), snap(r[(i+1)%len(r)])
+			if a == b {
+				continue
+			}
+			edges = append(edges, &edgeInfo{a: a, b: b, bounds: pointsBounds([][2]float64{a, b}), cuts: []float64{0, 1}})
+		}
+	}
+
+	// sweep along x so only edges with overlapping x ranges are compared
+	sort.Slice(edges, func(i, j int) bool { return edges[i].bounds.MinX < edges[j].bounds.MinX })
+	for i, e := range edges {
+		for _, f := range edges[i+1:] {
+			if f.bounds.MinX > e.bounds.MaxX {
+				break
+			}
+			if !e.bounds.overlaps(f.bounds) {
+				continue
+			}
+			for _, t := range edgeIntersections(e.a, e.b, f.a, f.b) {
+				e.cuts = append(e.cuts, t[0])
+				f.cuts = append(f.cuts, t[1])
+			}
+		}
+	}
+
+	seen := map[polygonEdge]bool{}
+	var pieces []polygonEdge
+	for _, e := range edges {
+		sort.Float64s(e.cuts)
+		prev := e.a
+		for _, t := range e.cuts[1:] {
+			p := e.b
+			if t < 1 {
+				p = snap(lerp(e.a, e.b, t))
+			}
+			if p == prev {
+				continue
+			}
+			piece := polygonEdge{a: prev, b: p}
+			if !seen[piece] && !seen[polygonEdge{a: p, b: prev}] {
+				seen[piece] = true
+				pieces = append(pieces, piece)
+			}
+			prev = p
+		}
+	}
+	return pieces
+}
+
+// edgeIntersections returns the parameters along a1-a2 and b1-b2 of the
+// points the two edges have in common. Collinear overlapping edges return
+// the end points of the overlap.
+func edgeIntersections(a1, a2, b1, b2 [2]float64) [][2]float64 {
+	da, db := sub(a2, a1), sub(b2, b1)
+	denom := cross(da, db)
+	la, lb := dot(da, da), dot(db, db)
+	const tol = 1e-12
+
+	if math.Abs(denom) <= tol*math.Sqrt(la*lb) {
+		// parallel, only collinear edges can share points
+		if math.Abs(cross(da, sub(b1, a1))) > tol*la+snapGrid*math.Sqrt(la) {
+			return nil
+		}
+		var hits [][2]float64
+		// project the end points of each edge onto the other
+		for _, p := range [][2]float64{b1, b2} {
+			t := dot(sub(p, a1), da) / la
+			if t > 0 && t < 1 {
+				hits = append(hits, [2]float64{t, dot(sub(p, b1), db) / lb})
+			}
+		}
+		for _, p := range [][2]float64{a1, a2} {
+			u := dot(sub(p, b1), db) / lb
+			if u > 0 && u < 1 {
+				hits = append(hits, [2]float64{dot(sub(p, a1), da) / la, u})
+			}
+		}
+		return hits
+	}
+
+	t := cross(sub(b1, a1), db) / denom
+	u := cross(sub(b1, a1), da) / denom
+	if t < -tol || t > 1+tol || u < -tol || u > 1+tol {
+		return nil
+	}
+	return [][2]float64{{math.Min(math.Max(t, 0), 1), math.Min(math.Max(u, 0), 1)}}
+}
+
+// linkEdges joins directed edges into rings. Where several edges leave a
+// point the one turning furthest left is taken, which keeps rings that
+// only touch in a point apart.
+func linkEdges(edges []polygonEdge) [][][2]float64 {
+	outgoing := map[[2]float64][]int{}
+	for i, e := range edges {
+		outgoing[e.a] = append(outgoing[e.a], i)
+	}
+	used := make([]bool, len(edges))
+
+	var rings [][][2]float64
+	for start := range edges {
+		if used[start] {
+			continue
+		}
+		used[start] = true
+		ring := [][2]float64{edges[start].a}
+		current := edges[start]
+		for current.b != edges[start].a {
+			back := math.Atan2(current.a[1]-current.b[1], current.a[0]-current.b[0])
+			best, bestAngle := -1, math.Inf(-1)
+			for _, i := range outgoing[current.b] {
+				if used[i] {
+					continue
+				}
+				d := sub(edges[i].b, edges[i].a)
+				angle := math.Atan2(d[1], d[0]) - back
+				for angle <= 0 {
+					angle += 2 * math.Pi
+				}
+				if angle > bestAngle {
+					best, bestAngle = i, angle
+				}
+			}
+			if best < 0 {
+				break // dangling edge, the ring can not be closed
+			}
+			used[best] = true
+			ring = append(ring, current.b)
+			current = edges[best]
+		}
+		if current.b != edges[start].a {
+			continue
+		}
+		ring = simplifyRing(ring, 0)
+		if len(ring) >= 3 && math.Abs(ringArea(ring)) > snapGrid*snapGrid {
+			rings = append(rings, ring)
+		}
+	}
+	return rings
+}
+
+// simplifyRing removes repeated points and points that are within tol of
+// the line through their neighbours.
+func simplifyRing(ring [][2]float64, tol float64) [][2]float64 {
+	changed := true
+	for changed && len(ring) >= 3 {
+		changed = false
+		var out [][2]float64
+		for i, p := range ring {
+			prev := ring[(i+len(ring)-1)%len(ring)]
+			if len(out) > 0 {
+				prev = out[len(out)-1]
+			}
+			next := ring[(i+1)%len(ring)]
+			d := sub(next, prev)
+			l := length(d)
+			if p == prev || (l > 0 && math.Abs(cross(d, sub(p, prev)))/l <= tol && dot(sub(p, prev), d) >= 0 && dot(sub(next, p), d) >= 0) {
+				changed = true
+				continue
+			}
+			out = append(out, p)
+		}
+		ring = out
+	}
+	return ring
+}
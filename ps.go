@@ -0,0 +1,1875 @@
+package main
+
+import (
+	"bytes"
+	"encoding/ascii85"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// psMaxOps limits how many operators a file may run, a loop that never
+// exits would otherwise never finish
+const psMaxOps = 20000000
+
+// psMaxDepth limits how deep procedures may call each other
+const psMaxDepth = 200
+
+// psProc is an executable array, a procedure
+type psProc []interface{}
+
+// psMark is what mark, [ and << push
+type psMark struct{}
+
+// psDict is a dictionary, keyed by the text of names
+type psDict map[string]interface{}
+
+// psOperator is a built in operator
+type psOperator func(in *psInterp) error
+
+// psSave is what save pushes for restore
+type psSave struct{}
+
+// psFile is the file being read, or a filter reading from it, the data of
+// inline images comes from one
+type psFile struct {
+	ascii85 bool
+}
+
+// psError is an error of one operator, like too few operands or operands
+// of the wrong type. The operator is skipped and the program goes on.
+type psError string
+
+func (e psError) Error() string {
+	return string(e)
+}
+
+var errPSExit = errors.New("exit outside of a loop")
+var errPSStop = errors.New("stop outside of stopped")
+var errPSQuit = errors.New("quit")
+
+// psScanner reads postscript tokens. The syntax is that of pdf with
+// procedures, immediate names, radix numbers and ascii85 strings added.
+type psScanner struct {
+	pdfLexer
+}
+
+var psRadixRegex = regexp.MustCompile(`^(\d+)#([0-9A-Za-z]+)$`)
+
+// next reads the next token, a whole procedure for {. Names to execute are
+// pdfKeyword, immediate names are executed like them when they are run.
+func (s *psScanner) next() (interface{}, error) {
+	s.skipSpace()
+	switch {
+	case bytes.HasPrefix(s.data[s.pos:], []byte("//")):
+		s.pos++
+		tok, err := s.token()
+		if name, ok := tok.(pdfName); ok {
+			return pdfKeyword(name), nil
+		}
+		return tok, err
+	case bytes.HasPrefix(s.data[s.pos:], []byte("<~")):
+		end := bytes.Index(s.data[s.pos:], []byte("~>"))
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated ascii85 string at offset %d", s.pos)
+		}
+		data := s.data[s.pos+2 : s.pos+end]
+		s.pos += end + 2
+		decoded, err := ioutil.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ascii85 string - %w", err)
+		}
+		return string(decoded), nil
+	}
+
+	tok, err := s.token()
+	if err != nil {
+		return nil, err
+	}
+	if word, ok := tok.(pdfKeyword); ok {
+		switch {
+		case word == "{":
+			proc := psProc{}
+			for {
+				tok, err := s.next()
+				if err != nil {
+					return nil, fmt.Errorf("unterminated procedure - %w", err)
+				}
+				if tok == pdfKeyword("}") {
+					return proc, nil
+				}
+				proc = append(proc, tok)
+			}
+		case psRadixRegex.MatchString(string(word)):
+			m := psRadixRegex.FindStringSubmatch(string(word))
+			base, _ := strconv.Atoi(m[1])
+			if base >= 2 && base <= 36 {
+				if v, err := strconv.ParseInt(m[2], base, 64); err == nil {
+					return float64(v), nil
+				}
+			}
+		}
+	}
+	return tok, nil
+}
+
+// skipHex skips the hex digits of image data read from the file
+func (s *psScanner) skipHex() {
+	for s.pos < len(s.data) && (isPDFSpace(s.data[s.pos]) || strings.IndexByte("0123456789abcdefABCDEF", s.data[s.pos]) >= 0) {
+		s.pos++
+	}
+	if s.pos < len(s.data) && s.data[s.pos] == '>' {
+		s.pos++
+	}
+}
+
+// psInterp runs the part of postscript that draws paths. Everything else
+// is left out: operators it does not know are skipped, text is not
+// drawn and images are skipped over.
+type psInterp struct {
+	*painter
+	scanner *psScanner
+	stack   []interface{}
+	dicts   []psDict
+	ops     int
+	depth   int
+	// colorComponents is how many numbers setcolor takes
+	colorComponents int
+	// page is the area of the page that is kept, pages counts the pages
+	// shown and pageStart is where the segments of the page being drawn
+	// start
+	page      pdfPage
+	pages     int
+	pageStart int
+}
+
+func newPSInterp(data []byte, page pdfPage, tolerance float64) *psInterp {
+	system := psDict{}
+	for name, op := range psOperators {
+		system[name] = op
+	}
+	in := &psInterp{
+		painter:         &painter{tolerance: tolerance},
+		scanner:         &psScanner{pdfLexer{data: data}},
+		dicts:           []psDict{system, {}},
+		colorComponents: 1,
+		page:            page,
+	}
+	in.graphicsState = newGraphicsState(in.pageMatrix())
+	return in
+}
+
+// pageMatrix maps the default user space to the page being drawn, under
+// the pages already shown
+func (in *psInterp) pageMatrix() matrix {
+	_, _, h := in.page.transform(0)
+	m, _, _ := in.page.transform(float64(in.pages) * h)
+	return m
+}
+
+// run runs the program to the end
+func (in *psInterp) run() error {
+	for {
+		tok, err := in.scanner.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if tok == pdfKeyword("}") {
+			return fmt.Errorf("unexpected } at offset %d", in.scanner.pos)
+		}
+		switch err := in.execute(tok); err {
+		case nil, errPSExit, errPSStop:
+		case errPSQuit:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// execute runs an executable name and pushes anything else
+func (in *psInterp) execute(obj interface{}) error {
+	name, ok := obj.(pdfKeyword)
+	if !ok {
+		in.push(obj)
+		return nil
+	}
+	if err := in.count(); err != nil {
+		return err
+	}
+	v, ok := in.lookup(string(name))
+	if !ok {
+		return nil
+	}
+	return in.call(v)
+}
+
+// call runs the value of a name, a procedure or an operator. Other values
+// are pushed.
+func (in *psInterp) call(v interface{}) error {
+	switch f := v.(type) {
+	case psOperator:
+		err := f(in)
+		if _, ok := err.(psError); ok {
+			return nil
+		}
+		return err
+	case psProc:
+		return in.runProc(f)
+	}
+	in.push(v)
+	return nil
+}
+
+// count counts an operator or procedure run against psMaxOps
+func (in *psInterp) count() error {
+	in.ops++
+	if in.ops > psMaxOps {
+		return fmt.Errorf("the program runs more than %d operators", psMaxOps)
+	}
+	return nil
+}
+
+func (in *psInterp) runProc(p psProc) error {
+	if err := in.count(); err != nil {
+		return err
+	}
+	if in.depth >= psMaxDepth {
+		return fmt.Errorf("procedures nested more than %d deep", psMaxDepth)
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+	for _, obj := range p {
+		if err := in.execute(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds the value of a name in the dictionary stack
+func (in *psInterp) lookup(name string) (interface{}, bool) {
+	for i := len(in.dicts) - 1; i >= 0; i-- {
+		if v, ok := in.dicts[i][name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (in *psInterp) push(v ...interface{}) {
+	in.stack = append(in.stack, v...)
+}
+
+func (in *psInterp) pop() (interface{}, error) {
+	n := len(in.stack)
+	if n == 0 {
+		return nil, psError("stackunderflow")
+	}
+	v := in.stack[n-1]
+	in.stack = in.stack[:n-1]
+	return v, nil
+}
+
+// popNumbers pops n numbers, in the order they were pushed. Nothing is
+// popped when they are not all numbers.
+func (in *psInterp) popNumbers(n int) ([]float64, error) {
+	if len(in.stack) < n {
+		return nil, psError("stackunderflow")
+	}
+	v := make([]float64, n)
+	for i, o := range in.stack[len(in.stack)-n:] {
+		var ok bool
+		if v[i], ok = o.(float64); !ok {
+			return nil, psError("typecheck")
+		}
+	}
+	in.stack = in.stack[:len(in.stack)-n]
+	return v, nil
+}
+
+func (in *psInterp) popInt() (int, error) {
+	v, err := in.popNumbers(1)
+	if err != nil {
+		return 0, err
+	}
+	return int(v[0]), nil
+}
+
+// popProc pops a procedure, any executable value can be run like one
+func (in *psInterp) popProc() (psProc, error) {
+	v, err := in.pop()
+	if err != nil {
+		return nil, err
+	}
+	switch p := v.(type) {
+	case psProc:
+		return p, nil
+	case pdfKeyword, psOperator:
+		return psProc{p}, nil
+	}
+	in.push(v)
+	return nil, psError("typecheck")
+}
+
+func (in *psInterp) popBool() (bool, error) {
+	v, err := in.pop()
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		in.push(v)
+		return false, psError("typecheck")
+	}
+	return b, nil
+}
+
+// popMatrix pops a matrix, an array of six numbers
+func (in *psInterp) popMatrix() (matrix, error) {
+	v, err := in.pop()
+	if err != nil {
+		return matrix{}, err
+	}
+	m, ok := psMatrix(v)
+	if !ok {
+		in.push(v)
+		return matrix{}, psError("typecheck")
+	}
+	return m, nil
+}
+
+func psMatrix(v interface{}) (matrix, bool) {
+	array, ok := v.([]interface{})
+	if !ok || len(array) != 6 {
+		return matrix{}, false
+	}
+	var m matrix
+	for i, item := range array {
+		if m[i], ok = item.(float64); !ok {
+			return matrix{}, false
+		}
+	}
+	return m, true
+}
+
+func psArray(m matrix) []interface{} {
+	return []interface{}{m[0], m[1], m[2], m[3], m[4], m[5]}
+}
+
+// psKey is the text of a name or string used as a dictionary key
+func psKey(v interface{}) (string, bool) {
+	switch k := v.(type) {
+	case pdfName:
+		return string(k), true
+	case pdfKeyword:
+		return string(k), true
+	case string:
+		return k, true
+	case float64:
+		return strconv.FormatFloat(k, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// psEqual compares like eq, names and strings are equal when their text
+// is, composite objects only when they are the same object
+func psEqual(a, b interface{}) bool {
+	if ka, ok := psKey(a); ok {
+		kb, ok := psKey(b)
+		_, na := a.(float64)
+		_, nb := b.(float64)
+		return ok && na == nb && ka == kb
+	}
+	switch a.(type) {
+	case bool, nil, psMark:
+		return a == b
+	}
+	return fmt.Sprintf("%p", a) == fmt.Sprintf("%p", b)
+}
+
+// psText is the text cvs gives a value
+func psText(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	if k, ok := psKey(v); ok {
+		return k
+	}
+	return "--nostringval--"
+}
+
+// userCurrent is the current point in user space
+func (in *psInterp) userCurrent() ([2]float64, error) {
+	p, ok := in.current()
+	inverse, invertible := in.ctm.invert()
+	if !ok || !invertible {
+		return [2]float64{}, psError("nocurrentpoint")
+	}
+	return inverse.apply(p), nil
+}
+
+// arc adds an arc of a circle in user space around x y, from angle a1 to
+// a2 in degrees, as curves of at most a quarter turn. It starts with a
+// line from the current point.
+func (in *psInterp) arc(clockwise bool) error {
+	v, err := in.popNumbers(5)
+	if err != nil {
+		return err
+	}
+	x, y, r, a1, a2 := v[0], v[1], v[2], v[3], v[4]
+	if clockwise && a2 > a1 {
+		a2 -= 360 * math.Ceil((a2-a1)/360)
+	}
+	if !clockwise && a2 < a1 {
+		a2 += 360 * math.Ceil((a1-a2)/360)
+	}
+	at := func(a float64) [2]float64 {
+		return [2]float64{x + r*math.Cos(a), y + r*math.Sin(a)}
+	}
+	start, sweep := a1*math.Pi/180, (a2-a1)*math.Pi/180
+	if _, ok := in.current(); ok {
+		in.lineTo(at(start))
+	} else {
+		in.moveTo(at(start))
+	}
+	n := int(math.Ceil(math.Abs(sweep) / (math.Pi / 2)))
+	for i := 0; i < n; i++ {
+		t0 := start + sweep*float64(i)/float64(n)
+		t1 := t0 + sweep/float64(n)
+		k := 4.0 / 3 * math.Tan((t1-t0)/4) * r
+		p0, p1 := at(t0), at(t1)
+		in.curveTo(
+			[2]float64{p0[0] - k*math.Sin(t0), p0[1] + k*math.Cos(t0)},
+			[2]float64{p1[0] + k*math.Sin(t1), p1[1] - k*math.Cos(t1)},
+			p1,
+		)
+	}
+	return nil
+}
+
+// rect paints a rectangle without touching the current path
+func (in *psInterp) rect(stroke, fill bool) error {
+	v, err := in.popNumbers(4)
+	if err != nil {
+		return err
+	}
+	path := in.path
+	in.path = nil
+	in.moveTo([2]float64{v[0], v[1]})
+	in.lineTo([2]float64{v[0] + v[2], v[1]})
+	in.lineTo([2]float64{v[0] + v[2], v[1] + v[3]})
+	in.lineTo([2]float64{v[0], v[1] + v[3]})
+	in.closePath()
+	in.paint(stroke, fill, false)
+	in.path = path
+	return nil
+}
+
+// setColor sets the colour, which postscript uses to stroke and fill
+func (in *psInterp) setColor(n int) error {
+	v, err := in.popNumbers(n)
+	if err != nil {
+		return err
+	}
+	if color, ok := deviceColor(v); ok {
+		in.stroke, in.fill = color, color
+	}
+	return nil
+}
+
+// transformOp is translate, scale or rotate. With a matrix on the stack
+// the transformation is put in the matrix instead of the current one.
+func transformOp(operands int, m func(v []float64) matrix) psOperator {
+	return func(in *psInterp) error {
+		if n := len(in.stack); n > 0 {
+			if _, ok := psMatrix(in.stack[n-1]); ok {
+				in.pop()
+				v, err := in.popNumbers(operands)
+				if err != nil {
+					return err
+				}
+				in.push(psArray(m(v)))
+				return nil
+			}
+		}
+		v, err := in.popNumbers(operands)
+		if err != nil {
+			return err
+		}
+		in.concat(m(v))
+		return nil
+	}
+}
+
+// popOnly pops the operands of an operator that changes nothing that is
+// cut, like setlinecap or show
+func popOnly(n int) psOperator {
+	return func(in *psInterp) error {
+		if len(in.stack) < n {
+			return psError("stackunderflow")
+		}
+		in.stack = in.stack[:len(in.stack)-n]
+		return nil
+	}
+}
+
+// math1 is an operator on one number
+func math1(f func(float64) float64) psOperator {
+	return func(in *psInterp) error {
+		v, err := in.popNumbers(1)
+		if err != nil {
+			return err
+		}
+		in.push(f(v[0]))
+		return nil
+	}
+}
+
+// math2 is an operator on two numbers
+func math2(f func(a, b float64) (interface{}, error)) psOperator {
+	return func(in *psInterp) error {
+		v, err := in.popNumbers(2)
+		if err != nil {
+			return err
+		}
+		r, err := f(v[0], v[1])
+		if err != nil {
+			in.push(v[0], v[1])
+			return err
+		}
+		in.push(r)
+		return nil
+	}
+}
+
+// logic is and, or or xor on booleans or integers
+func logic(b func(x, y bool) bool, i func(x, y int64) int64) psOperator {
+	return func(in *psInterp) error {
+		if v, err := in.popNumbers(2); err == nil {
+			in.push(float64(i(int64(v[0]), int64(v[1]))))
+			return nil
+		}
+		y, err := in.popBool()
+		if err != nil {
+			return err
+		}
+		x, err := in.popBool()
+		if err != nil {
+			in.push(y)
+			return err
+		}
+		in.push(b(x, y))
+		return nil
+	}
+}
+
+// skipImage pops the operands of an image operator and skips its data
+// when it is read from the file right after the operator
+func skipImage(operands int) psOperator {
+	return func(in *psInterp) error {
+		if len(in.stack) == 0 {
+			return psError("stackunderflow")
+		}
+		var sources []interface{}
+		if d, ok := in.stack[len(in.stack)-1].(psDict); ok {
+			in.pop()
+			sources = append(sources, d["DataSource"])
+		} else {
+			if operands < 0 {
+				// colorimage has a number of sources, then multi and ncomp
+				v, err := in.popNumbers(1)
+				if err != nil {
+					return err
+				}
+				multi, _ := in.popBool()
+				operands = 5
+				if multi {
+					operands = 4 + int(v[0])
+				}
+			}
+			if len(in.stack) < operands {
+				return psError("stackunderflow")
+			}
+			sources = append(sources, in.stack[len(in.stack)-operands+4:]...)
+			in.stack = in.stack[:len(in.stack)-operands]
+		}
+		for _, source := range sources {
+			switch s := source.(type) {
+			case psFile:
+				if s.ascii85 {
+					if end := bytes.Index(in.scanner.data[in.scanner.pos:], []byte("~>")); end >= 0 {
+						in.scanner.pos += end + 2
+					}
+				} else {
+					in.scanner.skipHex()
+				}
+				return nil
+			case psProc:
+				for _, name := range s {
+					if name == pdfKeyword("currentfile") {
+						in.scanner.skipHex()
+						return nil
+					}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+var psOperators map[string]psOperator
+
+func init() {
+	psOperators = map[string]psOperator{
+		// the operand stack
+		"pop": func(in *psInterp) error {
+			_, err := in.pop()
+			return err
+		},
+		"exch": func(in *psInterp) error {
+			n := len(in.stack)
+			if n < 2 {
+				return psError("stackunderflow")
+			}
+			in.stack[n-1], in.stack[n-2] = in.stack[n-2], in.stack[n-1]
+			return nil
+		},
+		"dup": func(in *psInterp) error {
+			if len(in.stack) == 0 {
+				return psError("stackunderflow")
+			}
+			in.push(in.stack[len(in.stack)-1])
+			return nil
+		},
+		"copy": func(in *psInterp) error {
+			n, err := in.popInt()
+			if err != nil {
+				return err
+			}
+			if n < 0 || n > len(in.stack) {
+				in.push(float64(n))
+				return psError("rangecheck")
+			}
+			in.push(in.stack[len(in.stack)-n:]...)
+			return nil
+		},
+		"index": func(in *psInterp) error {
+			n, err := in.popInt()
+			if err != nil {
+				return err
+			}
+			if n < 0 || n >= len(in.stack) {
+				in.push(float64(n))
+				return psError("rangecheck")
+			}
+			in.push(in.stack[len(in.stack)-1-n])
+			return nil
+		},
+		"roll": func(in *psInterp) error {
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			n, j := int(v[0]), int(v[1])
+			if n < 0 || n > len(in.stack) {
+				in.push(v[0], v[1])
+				return psError("rangecheck")
+			}
+			if n == 0 {
+				return nil
+			}
+			top := in.stack[len(in.stack)-n:]
+			rolled := make([]interface{}, n)
+			for i, o := range top {
+				rolled[((i+j)%n+n)%n] = o
+			}
+			copy(top, rolled)
+			return nil
+		},
+		"clear": func(in *psInterp) error {
+			in.stack = nil
+			return nil
+		},
+		"count": func(in *psInterp) error {
+			in.push(float64(len(in.stack)))
+			return nil
+		},
+		"mark": func(in *psInterp) error {
+			in.push(psMark{})
+			return nil
+		},
+		"cleartomark": func(in *psInterp) error {
+			n := in.countToMark()
+			if n < 0 {
+				return psError("unmatchedmark")
+			}
+			in.stack = in.stack[:len(in.stack)-n-1]
+			return nil
+		},
+		"counttomark": func(in *psInterp) error {
+			n := in.countToMark()
+			if n < 0 {
+				return psError("unmatchedmark")
+			}
+			in.push(float64(n))
+			return nil
+		},
+		"]": func(in *psInterp) error {
+			n := in.countToMark()
+			if n < 0 {
+				return psError("unmatchedmark")
+			}
+			array := append([]interface{}{}, in.stack[len(in.stack)-n:]...)
+			in.stack = in.stack[:len(in.stack)-n-1]
+			in.push(array)
+			return nil
+		},
+		">>": func(in *psInterp) error {
+			n := in.countToMark()
+			if n < 0 || n%2 == 1 {
+				return psError("rangecheck")
+			}
+			d := psDict{}
+			for i := len(in.stack) - n; i < len(in.stack); i += 2 {
+				if key, ok := psKey(in.stack[i]); ok {
+					d[key] = in.stack[i+1]
+				}
+			}
+			in.stack = in.stack[:len(in.stack)-n-1]
+			in.push(d)
+			return nil
+		},
+
+		// arithmetic and logic
+		"add": math2(func(a, b float64) (interface{}, error) { return a + b, nil }),
+		"sub": math2(func(a, b float64) (interface{}, error) { return a - b, nil }),
+		"mul": math2(func(a, b float64) (interface{}, error) { return a * b, nil }),
+		"div": math2(func(a, b float64) (interface{}, error) {
+			if b == 0 {
+				return nil, psError("undefinedresult")
+			}
+			return a / b, nil
+		}),
+		"idiv": math2(func(a, b float64) (interface{}, error) {
+			if int64(b) == 0 {
+				return nil, psError("undefinedresult")
+			}
+			return float64(int64(a) / int64(b)), nil
+		}),
+		"mod": math2(func(a, b float64) (interface{}, error) {
+			if int64(b) == 0 {
+				return nil, psError("undefinedresult")
+			}
+			return float64(int64(a) % int64(b)), nil
+		}),
+		"atan": math2(func(a, b float64) (interface{}, error) {
+			d := math.Atan2(a, b) * 180 / math.Pi
+			if d < 0 {
+				d += 360
+			}
+			return d, nil
+		}),
+		"exp": math2(func(a, b float64) (interface{}, error) { return math.Pow(a, b), nil }),
+		"gt":  math2(func(a, b float64) (interface{}, error) { return a > b, nil }),
+		"ge":  math2(func(a, b float64) (interface{}, error) { return a >= b, nil }),
+		"lt":  math2(func(a, b float64) (interface{}, error) { return a < b, nil }),
+		"le":  math2(func(a, b float64) (interface{}, error) { return a <= b, nil }),
+
+		"neg":      math1(func(a float64) float64 { return -a }),
+		"abs":      math1(math.Abs),
+		"sqrt":     math1(math.Sqrt),
+		"sin":      math1(func(a float64) float64 { return math.Sin(a * math.Pi / 180) }),
+		"cos":      math1(func(a float64) float64 { return math.Cos(a * math.Pi / 180) }),
+		"ln":       math1(math.Log),
+		"log":      math1(math.Log10),
+		"round":    math1(func(a float64) float64 { return math.Floor(a + .5) }),
+		"truncate": math1(math.Trunc),
+		"floor":    math1(math.Floor),
+		"ceiling":  math1(math.Ceil),
+		"cvi":      math1(math.Trunc),
+		"cvr":      math1(func(a float64) float64 { return a }),
+
+		"eq": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			b, _ := in.pop()
+			a, _ := in.pop()
+			in.push(psEqual(a, b))
+			return nil
+		},
+		"ne": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			b, _ := in.pop()
+			a, _ := in.pop()
+			in.push(!psEqual(a, b))
+			return nil
+		},
+		"and": logic(func(x, y bool) bool { return x && y }, func(x, y int64) int64 { return x & y }),
+		"or":  logic(func(x, y bool) bool { return x || y }, func(x, y int64) int64 { return x | y }),
+		"xor": logic(func(x, y bool) bool { return x != y }, func(x, y int64) int64 { return x ^ y }),
+		"not": func(in *psInterp) error {
+			if v, err := in.popNumbers(1); err == nil {
+				in.push(float64(^int64(v[0])))
+				return nil
+			}
+			b, err := in.popBool()
+			if err != nil {
+				return err
+			}
+			in.push(!b)
+			return nil
+		},
+		"true": func(in *psInterp) error {
+			in.push(true)
+			return nil
+		},
+		"false": func(in *psInterp) error {
+			in.push(false)
+			return nil
+		},
+		"null": func(in *psInterp) error {
+			in.push(nil)
+			return nil
+		},
+
+		// control
+		"exec": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			if name, ok := v.(pdfKeyword); ok {
+				return in.execute(name)
+			}
+			return in.call(v)
+		},
+		"if": func(in *psInterp) error {
+			proc, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			cond, err := in.popBool()
+			if err != nil {
+				in.push(proc)
+				return err
+			}
+			if cond {
+				return in.runProc(proc)
+			}
+			return nil
+		},
+		"ifelse": func(in *psInterp) error {
+			otherwise, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			then, err := in.popProc()
+			if err != nil {
+				in.push(otherwise)
+				return err
+			}
+			cond, err := in.popBool()
+			if err != nil {
+				in.push(then, otherwise)
+				return err
+			}
+			if cond {
+				return in.runProc(then)
+			}
+			return in.runProc(otherwise)
+		},
+		"repeat": func(in *psInterp) error {
+			proc, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			n, err := in.popInt()
+			if err != nil {
+				in.push(proc)
+				return err
+			}
+			for i := 0; i < n; i++ {
+				if err := in.runProc(proc); err == errPSExit {
+					break
+				} else if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"for": func(in *psInterp) error {
+			proc, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			v, err := in.popNumbers(3)
+			if err != nil {
+				in.push(proc)
+				return err
+			}
+			if v[1] == 0 {
+				return nil
+			}
+			for i := v[0]; v[1] > 0 && i <= v[2] || v[1] < 0 && i >= v[2]; i += v[1] {
+				in.push(i)
+				if err := in.runProc(proc); err == errPSExit {
+					break
+				} else if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"loop": func(in *psInterp) error {
+			proc, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			for {
+				if err := in.runProc(proc); err == errPSExit {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+		},
+		"forall": func(in *psInterp) error {
+			proc, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			v, err := in.pop()
+			if err != nil {
+				in.push(proc)
+				return err
+			}
+			var items [][]interface{}
+			switch c := v.(type) {
+			case []interface{}:
+				for _, item := range c {
+					items = append(items, []interface{}{item})
+				}
+			case psProc:
+				for _, item := range c {
+					items = append(items, []interface{}{item})
+				}
+			case string:
+				for i := 0; i < len(c); i++ {
+					items = append(items, []interface{}{float64(c[i])})
+				}
+			case psDict:
+				var keys []string
+				for k := range c {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					items = append(items, []interface{}{pdfName(k), c[k]})
+				}
+			default:
+				in.push(v, proc)
+				return psError("typecheck")
+			}
+			for _, item := range items {
+				in.push(item...)
+				if err := in.runProc(proc); err == errPSExit {
+					break
+				} else if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"exit": func(in *psInterp) error {
+			return errPSExit
+		},
+		"stop": func(in *psInterp) error {
+			return errPSStop
+		},
+		"stopped": func(in *psInterp) error {
+			proc, err := in.popProc()
+			if err != nil {
+				return err
+			}
+			switch err := in.runProc(proc); err {
+			case nil:
+				in.push(false)
+			case errPSStop:
+				in.push(true)
+			default:
+				return err
+			}
+			return nil
+		},
+		"quit": func(in *psInterp) error {
+			return errPSQuit
+		},
+
+		// dictionaries
+		"dict": func(in *psInterp) error {
+			if _, err := in.popNumbers(1); err != nil {
+				return err
+			}
+			in.push(psDict{})
+			return nil
+		},
+		"begin": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			d, ok := v.(psDict)
+			if !ok {
+				in.push(v)
+				return psError("typecheck")
+			}
+			in.dicts = append(in.dicts, d)
+			return nil
+		},
+		"end": func(in *psInterp) error {
+			// systemdict and userdict stay
+			if len(in.dicts) <= 2 {
+				return psError("dictstackunderflow")
+			}
+			in.dicts = in.dicts[:len(in.dicts)-1]
+			return nil
+		},
+		"def": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			key, ok := psKey(in.stack[len(in.stack)-2])
+			if !ok {
+				return psError("typecheck")
+			}
+			value, _ := in.pop()
+			in.pop()
+			in.dicts[len(in.dicts)-1][key] = value
+			return nil
+		},
+		"store": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			key, ok := psKey(in.stack[len(in.stack)-2])
+			if !ok {
+				return psError("typecheck")
+			}
+			value, _ := in.pop()
+			in.pop()
+			for i := len(in.dicts) - 1; i >= 0; i-- {
+				if _, ok := in.dicts[i][key]; ok {
+					in.dicts[i][key] = value
+					return nil
+				}
+			}
+			in.dicts[len(in.dicts)-1][key] = value
+			return nil
+		},
+		"load": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			key, _ := psKey(v)
+			value, ok := in.lookup(key)
+			if !ok {
+				in.push(v)
+				return psError("undefined")
+			}
+			in.push(value)
+			return nil
+		},
+		"where": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			key, _ := psKey(v)
+			for i := len(in.dicts) - 1; i >= 0; i-- {
+				if _, ok := in.dicts[i][key]; ok {
+					in.push(in.dicts[i], true)
+					return nil
+				}
+			}
+			in.push(false)
+			return nil
+		},
+		"known": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			d, ok := in.stack[len(in.stack)-2].(psDict)
+			key, _ := psKey(in.stack[len(in.stack)-1])
+			if !ok {
+				return psError("typecheck")
+			}
+			in.stack = in.stack[:len(in.stack)-2]
+			_, known := d[key]
+			in.push(known)
+			return nil
+		},
+		"undef": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			d, ok := in.stack[len(in.stack)-2].(psDict)
+			key, _ := psKey(in.stack[len(in.stack)-1])
+			if !ok {
+				return psError("typecheck")
+			}
+			in.stack = in.stack[:len(in.stack)-2]
+			delete(d, key)
+			return nil
+		},
+		"currentdict": func(in *psInterp) error {
+			in.push(in.dicts[len(in.dicts)-1])
+			return nil
+		},
+		"systemdict": func(in *psInterp) error {
+			in.push(in.dicts[0])
+			return nil
+		},
+		"userdict": func(in *psInterp) error {
+			in.push(in.dicts[1])
+			return nil
+		},
+		"bind":     popOnly(0),
+		"readonly": popOnly(0),
+		"cvx": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			switch c := v.(type) {
+			case []interface{}:
+				v = psProc(c)
+			case pdfName:
+				v = pdfKeyword(c)
+			}
+			in.push(v)
+			return nil
+		},
+		"cvlit": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			switch c := v.(type) {
+			case psProc:
+				v = []interface{}(c)
+			case pdfKeyword:
+				v = pdfName(c)
+			}
+			in.push(v)
+			return nil
+		},
+		"cvn": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			s, ok := v.(string)
+			if !ok {
+				in.push(v)
+				return psError("typecheck")
+			}
+			in.push(pdfName(s))
+			return nil
+		},
+		"cvs": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			in.pop()
+			v, _ := in.pop()
+			in.push(psText(v))
+			return nil
+		},
+
+		// arrays and strings
+		"array": func(in *psInterp) error {
+			n, err := in.popInt()
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return psError("rangecheck")
+			}
+			in.push(make([]interface{}, n))
+			return nil
+		},
+		"string": func(in *psInterp) error {
+			n, err := in.popInt()
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return psError("rangecheck")
+			}
+			in.push(strings.Repeat("\x00", n))
+			return nil
+		},
+		"length": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			switch c := v.(type) {
+			case []interface{}:
+				in.push(float64(len(c)))
+			case psProc:
+				in.push(float64(len(c)))
+			case psDict:
+				in.push(float64(len(c)))
+			case string:
+				in.push(float64(len(c)))
+			case pdfName:
+				in.push(float64(len(c)))
+			default:
+				in.push(v)
+				return psError("typecheck")
+			}
+			return nil
+		},
+		"get": func(in *psInterp) error {
+			if len(in.stack) < 2 {
+				return psError("stackunderflow")
+			}
+			container, key := in.stack[len(in.stack)-2], in.stack[len(in.stack)-1]
+			var v interface{}
+			i, isIndex := key.(float64)
+			switch c := container.(type) {
+			case psDict:
+				k, _ := psKey(key)
+				var ok bool
+				if v, ok = c[k]; !ok {
+					return psError("undefined")
+				}
+			case []interface{}:
+				if !isIndex || int(i) < 0 || int(i) >= len(c) {
+					return psError("rangecheck")
+				}
+				v = c[int(i)]
+			case psProc:
+				if !isIndex || int(i) < 0 || int(i) >= len(c) {
+					return psError("rangecheck")
+				}
+				v = c[int(i)]
+			case string:
+				if !isIndex || int(i) < 0 || int(i) >= len(c) {
+					return psError("rangecheck")
+				}
+				v = float64(c[int(i)])
+			default:
+				return psError("typecheck")
+			}
+			in.stack = in.stack[:len(in.stack)-2]
+			in.push(v)
+			return nil
+		},
+		"put": func(in *psInterp) error {
+			if len(in.stack) < 3 {
+				return psError("stackunderflow")
+			}
+			container, key, value := in.stack[len(in.stack)-3], in.stack[len(in.stack)-2], in.stack[len(in.stack)-1]
+			i, isIndex := key.(float64)
+			switch c := container.(type) {
+			case psDict:
+				k, ok := psKey(key)
+				if !ok {
+					return psError("typecheck")
+				}
+				c[k] = value
+			case []interface{}:
+				if !isIndex || int(i) < 0 || int(i) >= len(c) {
+					return psError("rangecheck")
+				}
+				c[int(i)] = value
+			case psProc:
+				if !isIndex || int(i) < 0 || int(i) >= len(c) {
+					return psError("rangecheck")
+				}
+				c[int(i)] = value
+			}
+			in.stack = in.stack[:len(in.stack)-3]
+			return nil
+		},
+		"getinterval": func(in *psInterp) error {
+			if len(in.stack) < 3 {
+				return psError("stackunderflow")
+			}
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			start, n := int(v[0]), int(v[1])
+			container, _ := in.pop()
+			size := -1
+			switch c := container.(type) {
+			case []interface{}:
+				size = len(c)
+			case string:
+				size = len(c)
+			}
+			if start < 0 || n < 0 || start+n > size {
+				in.push(container, v[0], v[1])
+				return psError("rangecheck")
+			}
+			switch c := container.(type) {
+			case []interface{}:
+				in.push(c[start : start+n])
+			case string:
+				in.push(c[start : start+n])
+			}
+			return nil
+		},
+		"aload": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			switch c := v.(type) {
+			case []interface{}:
+				in.push(c...)
+			case psProc:
+				in.push(c...)
+			default:
+				in.push(v)
+				return psError("typecheck")
+			}
+			in.push(v)
+			return nil
+		},
+		"astore": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			array, ok := v.([]interface{})
+			if !ok || len(in.stack) < len(array) {
+				in.push(v)
+				return psError("typecheck")
+			}
+			copy(array, in.stack[len(in.stack)-len(array):])
+			in.stack = in.stack[:len(in.stack)-len(array)]
+			in.push(array)
+			return nil
+		},
+
+		// the graphics state
+		"gsave": func(in *psInterp) error {
+			in.save()
+			return nil
+		},
+		"grestore": func(in *psInterp) error {
+			in.restore()
+			return nil
+		},
+		"grestoreall": func(in *psInterp) error {
+			for len(in.saved) > 0 {
+				in.restore()
+			}
+			return nil
+		},
+		"save": func(in *psInterp) error {
+			in.save()
+			in.push(psSave{})
+			return nil
+		},
+		"restore": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			if _, ok := v.(psSave); !ok {
+				in.push(v)
+				return psError("typecheck")
+			}
+			in.restore()
+			return nil
+		},
+		"initgraphics": func(in *psInterp) error {
+			in.graphicsState = newGraphicsState(in.pageMatrix())
+			return nil
+		},
+		"setlinewidth": func(in *psInterp) error {
+			v, err := in.popNumbers(1)
+			if err != nil {
+				return err
+			}
+			in.width = v[0]
+			return nil
+		},
+		"currentlinewidth": func(in *psInterp) error {
+			in.push(in.width)
+			return nil
+		},
+		"setgray": func(in *psInterp) error {
+			return in.setColor(1)
+		},
+		"setrgbcolor": func(in *psInterp) error {
+			return in.setColor(3)
+		},
+		"setcmykcolor": func(in *psInterp) error {
+			return in.setColor(4)
+		},
+		"sethsbcolor": func(in *psInterp) error {
+			v, err := in.popNumbers(3)
+			if err != nil {
+				return err
+			}
+			h, s, b := v[0]*6, v[1], v[2]
+			i := math.Floor(h)
+			f := h - i
+			p, q, t := b*(1-s), b*(1-s*f), b*(1-s*(1-f))
+			rgb := map[int][]float64{0: {b, t, p}, 1: {q, b, p}, 2: {p, b, t}, 3: {p, q, b}, 4: {t, p, b}, 5: {b, p, q}}[int(i)%6]
+			if rgb == nil {
+				rgb = []float64{b, t, p}
+			}
+			in.push(rgb[0], rgb[1], rgb[2])
+			return in.setColor(3)
+		},
+		"setcolorspace": func(in *psInterp) error {
+			v, err := in.pop()
+			if err != nil {
+				return err
+			}
+			if array, ok := v.([]interface{}); ok && len(array) > 0 {
+				v = array[0]
+			}
+			name, _ := psKey(v)
+			in.colorComponents = map[string]int{"DeviceRGB": 3, "DeviceCMYK": 4}[name]
+			if in.colorComponents == 0 {
+				in.colorComponents = 1
+			}
+			in.stroke, in.fill = "#000000", "#000000"
+			return nil
+		},
+		"setcolor": func(in *psInterp) error {
+			return in.setColor(in.colorComponents)
+		},
+
+		// matrices
+		"matrix": func(in *psInterp) error {
+			in.push(psArray(identityMatrix))
+			return nil
+		},
+		"identmatrix": func(in *psInterp) error {
+			if _, err := in.popMatrix(); err != nil {
+				return err
+			}
+			in.push(psArray(identityMatrix))
+			return nil
+		},
+		"defaultmatrix": func(in *psInterp) error {
+			if _, err := in.popMatrix(); err != nil {
+				return err
+			}
+			in.push(psArray(identityMatrix))
+			return nil
+		},
+		"currentmatrix": func(in *psInterp) error {
+			if _, err := in.popMatrix(); err != nil {
+				return err
+			}
+			// the default user space is taken to be the device space
+			page, _ := in.pageMatrix().invert()
+			in.push(psArray(in.ctm.then(page)))
+			return nil
+		},
+		"setmatrix": func(in *psInterp) error {
+			m, err := in.popMatrix()
+			if err != nil {
+				return err
+			}
+			in.ctm = m.then(in.pageMatrix())
+			return nil
+		},
+		"initmatrix": func(in *psInterp) error {
+			in.ctm = in.pageMatrix()
+			return nil
+		},
+		"concat": func(in *psInterp) error {
+			m, err := in.popMatrix()
+			if err != nil {
+				return err
+			}
+			in.concat(m)
+			return nil
+		},
+		"concatmatrix": func(in *psInterp) error {
+			if _, err := in.popMatrix(); err != nil {
+				return err
+			}
+			b, err := in.popMatrix()
+			if err != nil {
+				return err
+			}
+			a, err := in.popMatrix()
+			if err != nil {
+				return err
+			}
+			in.push(psArray(a.then(b)))
+			return nil
+		},
+		"translate": transformOp(2, func(v []float64) matrix {
+			return matrix{1, 0, 0, 1, v[0], v[1]}
+		}),
+		"scale": transformOp(2, func(v []float64) matrix {
+			return matrix{v[0], 0, 0, v[1], 0, 0}
+		}),
+		"rotate": transformOp(1, func(v []float64) matrix {
+			s, c := math.Sincos(v[0] * math.Pi / 180)
+			return matrix{c, s, -s, c, 0, 0}
+		}),
+		"transform": func(in *psInterp) error {
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			page, _ := in.pageMatrix().invert()
+			p := in.ctm.then(page).apply([2]float64{v[0], v[1]})
+			in.push(p[0], p[1])
+			return nil
+		},
+		"itransform": func(in *psInterp) error {
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			page, _ := in.pageMatrix().invert()
+			inverse, ok := in.ctm.then(page).invert()
+			if !ok {
+				in.push(v[0], v[1])
+				return psError("undefinedresult")
+			}
+			p := inverse.apply([2]float64{v[0], v[1]})
+			in.push(p[0], p[1])
+			return nil
+		},
+
+		// paths
+		"newpath": func(in *psInterp) error {
+			in.newPath()
+			return nil
+		},
+		"moveto": func(in *psInterp) error {
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			in.moveTo([2]float64{v[0], v[1]})
+			return nil
+		},
+		"rmoveto": func(in *psInterp) error {
+			p, err := in.userCurrent()
+			if err != nil {
+				return err
+			}
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			in.moveTo([2]float64{p[0] + v[0], p[1] + v[1]})
+			return nil
+		},
+		"lineto": func(in *psInterp) error {
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			in.lineTo([2]float64{v[0], v[1]})
+			return nil
+		},
+		"rlineto": func(in *psInterp) error {
+			p, err := in.userCurrent()
+			if err != nil {
+				return err
+			}
+			v, err := in.popNumbers(2)
+			if err != nil {
+				return err
+			}
+			in.lineTo([2]float64{p[0] + v[0], p[1] + v[1]})
+			return nil
+		},
+		"curveto": func(in *psInterp) error {
+			v, err := in.popNumbers(6)
+			if err != nil {
+				return err
+			}
+			in.curveTo([2]float64{v[0], v[1]}, [2]float64{v[2], v[3]}, [2]float64{v[4], v[5]})
+			return nil
+		},
+		"rcurveto": func(in *psInterp) error {
+			p, err := in.userCurrent()
+			if err != nil {
+				return err
+			}
+			v, err := in.popNumbers(6)
+			if err != nil {
+				return err
+			}
+			in.curveTo(
+				[2]float64{p[0] + v[0], p[1] + v[1]},
+				[2]float64{p[0] + v[2], p[1] + v[3]},
+				[2]float64{p[0] + v[4], p[1] + v[5]},
+			)
+			return nil
+		},
+		"arc": func(in *psInterp) error {
+			return in.arc(false)
+		},
+		"arcn": func(in *psInterp) error {
+			return in.arc(true)
+		},
+		"closepath": func(in *psInterp) error {
+			in.closePath()
+			return nil
+		},
+		"currentpoint": func(in *psInterp) error {
+			p, err := in.userCurrent()
+			if err != nil {
+				return err
+			}
+			in.push(p[0], p[1])
+			return nil
+		},
+		"stroke": func(in *psInterp) error {
+			in.paint(true, false, false)
+			return nil
+		},
+		"fill": func(in *psInterp) error {
+			in.paint(false, true, false)
+			return nil
+		},
+		"eofill": func(in *psInterp) error {
+			in.paint(false, true, true)
+			return nil
+		},
+		"rectstroke": func(in *psInterp) error {
+			return in.rect(true, false)
+		},
+		"rectfill": func(in *psInterp) error {
+			return in.rect(false, true)
+		},
+		"showpage": func(in *psInterp) error {
+			in.pages++
+			in.pageStart = len(in.segments)
+			in.graphicsState = newGraphicsState(in.pageMatrix())
+			in.saved = nil
+			in.newPath()
+			return nil
+		},
+
+		// files, only as the source of image data
+		"currentfile": func(in *psInterp) error {
+			in.push(psFile{})
+			return nil
+		},
+		"filter": func(in *psInterp) error {
+			name, err := in.pop()
+			if err != nil {
+				return err
+			}
+			source, err := in.pop()
+			if err != nil {
+				in.push(name)
+				return err
+			}
+			if _, ok := source.(psDict); ok {
+				// parameters come before the name, the source before them
+				source, _ = in.pop()
+			}
+			filter, _ := psKey(name)
+			if _, ok := source.(psFile); ok {
+				source = psFile{ascii85: filter == "ASCII85Decode"}
+			}
+			in.push(source)
+			return nil
+		},
+		"image":      skipImage(5),
+		"imagemask":  skipImage(5),
+		"colorimage": skipImage(-1),
+
+		// fonts and text, which are not cut
+		"findfont": func(in *psInterp) error {
+			if _, err := in.pop(); err != nil {
+				return err
+			}
+			in.push(psDict{})
+			return nil
+		},
+		"currentfont": func(in *psInterp) error {
+			in.push(psDict{})
+			return nil
+		},
+		"stringwidth": func(in *psInterp) error {
+			if _, err := in.pop(); err != nil {
+				return err
+			}
+			in.push(0.0, 0.0)
+			return nil
+		},
+		"definefont": popOnly(1),
+		"scalefont":  popOnly(1),
+		"makefont":   popOnly(1),
+		"setfont":    popOnly(1),
+		"selectfont": popOnly(2),
+		"show":       popOnly(1),
+		"ashow":      popOnly(3),
+		"widthshow":  popOnly(4),
+		"awidthshow": popOnly(6),
+		"kshow":      popOnly(2),
+		"xshow":      popOnly(2),
+		"yshow":      popOnly(2),
+		"xyshow":     popOnly(2),
+		"glyphshow":  popOnly(1),
+		"charpath":   popOnly(2),
+
+		// the rest of the graphics state and device
+		"setlinecap":      popOnly(1),
+		"setlinejoin":     popOnly(1),
+		"setmiterlimit":   popOnly(1),
+		"setdash":         popOnly(2),
+		"setflat":         popOnly(1),
+		"setstrokeadjust": popOnly(1),
+		"setoverprint":    popOnly(1),
+		"setpagedevice":   popOnly(1),
+		"setcachedevice":  popOnly(6),
+		"setcharwidth":    popOnly(2),
+		"rectclip":        popOnly(4),
+		"clip":            popOnly(0),
+		"eoclip":          popOnly(0),
+		"print":           popOnly(1),
+		"=":               popOnly(1),
+		"==":              popOnly(1),
+		"pdfmark": func(in *psInterp) error {
+			return psOperators["cleartomark"](in)
+		},
+	}
+	psOperators["["] = psOperators["mark"]
+	psOperators["<<"] = psOperators["mark"]
+}
+
+// countToMark is how many objects are above the topmost mark, -1 when
+// there is none
+func (in *psInterp) countToMark() int {
+	for i := len(in.stack) - 1; i >= 0; i-- {
+		if _, ok := in.stack[i].(psMark); ok {
+			return len(in.stack) - 1 - i
+		}
+	}
+	return -1
+}
+
+// epsMagic starts an eps file with a binary header, which says where the
+// postscript is amongst the preview images
+var epsMagic = []byte{0xc5, 0xd0, 0xd3, 0xc6}
+
+// psProgram is the postscript in file, without the binary header of an
+// eps file with a preview
+func psProgram(file []byte) []byte {
+	if bytes.HasPrefix(file, epsMagic) && len(file) >= 12 {
+		start := int(binary.LittleEndian.Uint32(file[4:]))
+		length := int(binary.LittleEndian.Uint32(file[8:]))
+		if start >= 0 && length >= 0 && start+length <= len(file) {
+			return file[start : start+length]
+		}
+	}
+	return file
+}
+
+var psBoundingBoxRegex = regexp.MustCompile(`%%(HiRes)?BoundingBox:[ \t]*(` + numberPattern + `)[ \t]+(` + numberPattern + `)[ \t]+(` + numberPattern + `)[ \t]+(` + numberPattern + `)`)
+
+// psPage is the area of the page given by the bounding box comment, the
+// high resolution one when there is one. Without one it is a US letter
+// page.
+func psPage(program []byte) pdfPage {
+	page := pdfPage{box: [4]float64{0, 0, 612, 792}, userUnit: 1}
+	found := false
+	for _, m := range psBoundingBoxRegex.FindAllSubmatch(program, -1) {
+		hiRes := len(m[1]) > 0
+		if found && !hiRes {
+			continue
+		}
+		var box [4]float64
+		for i := range box {
+			box[i], _ = strconv.ParseFloat(string(m[i+2]), 64)
+		}
+		if box[2] > box[0] && box[3] > box[1] {
+			page.box = box
+			found = true
+			if hiRes {
+				break
+			}
+		}
+	}
+	return page
+}
+
+// ps2writePageRegex finds the pages of a file written by ghostscript's
+// ps2write device. Its prolog is a pdf interpreter written in postscript
+// and the pages are pdf objects, so they are read as pdf instead.
+var ps2writePageRegex = regexp.MustCompile(`\d+\s+\d+\s+obj\s*<<\s*/Type\s*/Page\b`)
+
+// loadPSJob reads the paths a postscript or eps file draws into a job.
+// The bounding box is the page, pages are put one under the other.
+func loadPSJob(name string, file []byte, material Material, clean CleanOptions) (*Job, error) {
+	program := psProgram(file)
+	if !bytes.HasPrefix(program, []byte("%!")) {
+		return nil, fmt.Errorf("not a postscript file, it does not start with %%!")
+	}
+
+	if ps2writePageRegex.Match(program) {
+		f := scanPDF(program)
+		var pages []pdfPage
+		for _, num := range f.objectNumbers() {
+			if d := f.dict(num); d["Type"] == pdfName("Page") {
+				pages = append(pages, f.page(d, d))
+			}
+		}
+		return f.job(name, pages, material, clean)
+	}
+
+	page := psPage(program)
+	in := newPSInterp(program, page, defaultOffsetOptions.Tolerance)
+	if err := in.run(); err != nil {
+		return nil, fmt.Errorf("unable to read %s - %w", name, err)
+	}
+	if len(in.segments) == 0 {
+		return nil, fmt.Errorf("%s has no geometry to cut", name)
+	}
+	pages := in.pages
+	if len(in.segments) > in.pageStart || pages == 0 {
+		pages++
+	}
+	_, width, height := page.transform(0)
+
+	return &Job{
+		Name:       name,
+		WidthMm:    width,
+		HeightMm:   height * float64(pages),
+		Material:   material,
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments:   joinSegments(in.segments, joinTolerance),
+	}, nil
+}
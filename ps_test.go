@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestLoadPSJob(t *testing.T) {
+	is := is.New(t)
+	// a prolog like the ones cairo and inkscape write
+	file := []byte(`%!PS-Adobe-3.0 EPSF-3.0
+%%BoundingBox: 0 0 144 72
+%%HiResBoundingBox: 0 0 144 72
+%%EndComments
+/cairo_dict 20 dict def
+cairo_dict begin
+/q { gsave } bind def
+/Q { grestore } bind def
+/m { moveto } bind def
+/l { lineto } bind def
+/h { closepath } bind def
+/S { stroke } bind def
+/f { fill } bind def
+/rg { setrgbcolor } bind def
+/w { setlinewidth } bind def
+/Times-Roman findfont 12 scalefont setfont
+q 0.5 0.5 scale 1 0 0 rg 2 w 0 0 m 288 0 l S Q
+0 0 1 rg 10 10 m 30 10 l 30 30 l 10 30 l h f
+newpath 100 36 10 0 360 arc closepath stroke
+0 1 2 { 10 mul 50 add 0 moveto 0 5 rlineto } for stroke
+72 72 moveto (not cut) show
+/DeviceRGB setcolorspace 0 1 0 setcolor 200 200 moveto 210 210 lineto stroke
+8 8 1 [8 0 0 8 0 0] currentfile /ASCII85Decode filter image
+zz{}~>
+unknownoperator
+end
+showpage
+%%EOF
+`)
+	job, err := loadJob(context.Background(), "drawing.eps", file, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	k := MILIMETERS_PER_INCH / 72
+	is.True(math.Abs(job.WidthMm-144*k) < 1e-9)
+	is.True(math.Abs(job.HeightMm-72*k) < 1e-9) // the page shown is the only one
+	is.Equal(len(job.Segments), 7)
+
+	find := func(match func(s svg.Segment) bool) svg.Segment {
+		for _, s := range job.Segments {
+			if match(s) {
+				return s
+			}
+		}
+		t.Fatal("segment not found")
+		return svg.Segment{}
+	}
+	nearPoint := func(p [2]float64, x, y float64) bool {
+		return math.Abs(p[0]-x) < 1e-6 && math.Abs(p[1]-y) < 1e-6
+	}
+
+	// a point is 1/72in and y is flipped
+	line := find(func(s svg.Segment) bool { return s.Stroke == "#ff0000" })
+	is.True(nearPoint(line.Points[0], 0, 72*k) && nearPoint(line.Points[1], 144*k, 72*k))
+	is.True(math.Abs(line.Width-k) < 1e-9) // 2 units wide at half size
+
+	square := find(func(s svg.Segment) bool { return s.Fill == "#0000ff" })
+	is.True(square.Closed)
+	is.Equal(square.Stroke, "none")
+	b := pointsBounds(square.Points)
+	is.True(math.Abs(b.MinX-10*k) < 1e-9 && math.Abs(b.MinY-42*k) < 1e-9 && math.Abs(b.width()-20*k) < 1e-9)
+
+	circle := find(func(s svg.Segment) bool { return s.Closed && s.Fill == "none" })
+	is.Equal(circle.Stroke, "#0000ff") // postscript has one colour for both
+	b = pointsBounds(circle.Points)
+	is.True(math.Abs(b.width()-20*k) < defaultOffsetOptions.Tolerance)
+	is.True(math.Abs(b.center()[0]-100*k) < defaultOffsetOptions.Tolerance)
+
+	// the for loop drew three ticks
+	ticks := 0
+	for _, s := range job.Segments {
+		if len(s.Points) == 2 && math.Abs(s.Points[0][1]-72*k) < 1e-9 && s.Points[0][0] > 40*k {
+			ticks++
+		}
+	}
+	is.Equal(ticks, 3)
+
+	green := find(func(s svg.Segment) bool { return s.Stroke == "#00ff00" })
+	is.True(nearPoint(green.Points[0], 200*k, -128*k))
+
+	_, err = loadJob(context.Background(), "drawing.ps", []byte("not postscript"), materialPresets["none"], defaultCleanOptions)
+	is.True(err != nil)
+}
+
+func TestPSInterp(t *testing.T) {
+	is := is.New(t)
+	in := newPSInterp([]byte(`
+		1 2 3 3 1 roll
+		[ 1 2 ] aload pop add
+		<< /a 16#ff >> /a get
+		{ 1 } stopped
+		/x 10 def x x mul
+		1 { exit } loop
+		0 1 1 4 { add } for
+		2 copy gt
+		mark 1 2 cleartomark
+		(abc) length
+		pop`), pdfPage{box: [4]float64{0, 0, 72, 72}, userUnit: 1}, .01)
+	is.NoErr(in.run())
+	is.Equal(in.stack, []interface{}{3.0, 1.0, 2.0, 3.0, 255.0, 1.0, false, 100.0, 1.0, 10.0, false})
+
+	// a loop that never ends is stopped
+	in = newPSInterp([]byte(`{ } loop`), pdfPage{box: [4]float64{0, 0, 72, 72}, userUnit: 1}, .01)
+	is.True(in.run() != nil)
+}
+
+func TestLoadPSJobGhostscript(t *testing.T) {
+	is := is.New(t)
+	ps, err := ioutil.ReadFile("./samples/ps/Top Drawer Drawing 1.ps")
+	is.NoErr(err)
+	dxf, err := ioutil.ReadFile("./samples/Top Drawer Drawing 1.dxf")
+	is.NoErr(err)
+
+	fromPS, err := loadJob(context.Background(), "Top Drawer Drawing 1.ps", ps, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	fromDXF, err := loadJob(context.Background(), "Top Drawer Drawing 1.dxf", dxf, materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+
+	// ps2write puts the pages in as pdf, they have the contours of the dxf
+	is.True(math.Abs(fromPS.WidthMm-24*MILIMETERS_PER_INCH) < 1e-9)
+	is.True(math.Abs(fromPS.HeightMm-18*MILIMETERS_PER_INCH) < 1e-9)
+	is.Equal(len(fromPS.Segments), len(fromDXF.Segments))
+	for _, s := range fromPS.Segments {
+		is.True(s.Closed)
+	}
+	// ps2write rounds the coordinates a little more than the pdf export
+	a, b := segmentsBounds(fromPS.Segments), segmentsBounds(fromDXF.Segments)
+	is.True(math.Abs(a.width()-b.width()) < 1e-2 && math.Abs(a.height()-b.height()) < 1e-2)
+}
@@ -0,0 +1,16 @@
+package main
+
+// newRSVGConverter converts with rsvg-convert from librsvg, a much
+// smaller install than inkscape. Versions before 2 are long gone.
+// see: https://gitlab.gnome.org/GNOME/librsvg/-/blob/main/rsvg-convert.rst
+func newRSVGConverter(bin string) *programConverter {
+	return &programConverter{
+		name:     "rsvg",
+		bin:      bin,
+		formats:  []string{"pdf", "ps", "eps", "png", "svg"},
+		minMajor: 2,
+		args: func(to string) []string {
+			return []string{"--format=" + to}
+		},
+	}
+}
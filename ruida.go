@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// rdMagic is the key .rd files are scrambled with by RDWorks and LightBurn
+const rdMagic = 0x88
+
+// Ruida commands, the first byte of a command has its top bit set and
+// every other byte has it clear. Coordinates are micrometres from the top
+// left corner with y down, powers are a share of full power and speeds
+// micrometres a second.
+// see: https://edutechwiki.unige.ch/en/Ruida
+const (
+	rdMoveAbs   = 0x88 // X Y, travel with the laser off
+	rdCutAbs    = 0xa8 // X Y, move with the laser on
+	rdPower     = 0xc6 // 01 min power, 02 max power of laser 1; 31 and 32 per layer
+	rdSpeed     = 0xc9 // 02 speed, 04 per layer
+	rdLayer     = 0xca // 02 the layer that follows, 06 layer colour, 22 last layer
+	rdBounds    = 0xe7 // 03 top left, 07 bottom right, 50 and 51 document, 52 and 53 per layer; 00 block end
+	rdStart     = 0xf1 // 02 00 start of the job
+	rdFinish    = 0xeb
+	rdEndOfFile = 0xd7
+)
+
+// rdCommand is a decoded Ruida command, its op code and the bytes after
+// it. For the commands with a sub command that is the first of Data.
+type rdCommand struct {
+	Op   byte
+	Data []byte
+}
+
+// rdWriter collects Ruida commands
+type rdWriter struct {
+	bytes.Buffer
+}
+
+func (w *rdWriter) command(op byte, data ...byte) {
+	w.WriteByte(op)
+	w.Write(data)
+}
+
+// rdCoord encodes a length in millimetres as the 5 bytes of 7 bits of an
+// absolute Ruida number in micrometres
+func rdCoord(mm float64) []byte {
+	return rdNumber(int64(math.Round(mm * 1000)))
+}
+
+// rdNumber encodes v in 5 bytes of 7 bits, most significant first.
+// Negative numbers wrap around in 35 bits.
+func rdNumber(v int64) []byte {
+	b := make([]byte, 5)
+	for i := range b {
+		b[i] = byte(v>>(7*uint(4-i))) & 0x7f
+	}
+	return b
+}
+
+// rdPowerValue encodes a percentage of full power in 2 bytes of 7 bits
+func rdPowerValue(percent float64) []byte {
+	v := int(math.Round(math.Max(0, math.Min(100, percent)) * 0x3fff / 100))
+	return []byte{byte(v>>7) & 0x7f, byte(v) & 0x7f}
+}
+
+// rdColor encodes #rrggbb as the 0x00bbggrr the controllers keep
+func rdColor(color string) []byte {
+	rgb, _ := parseHexColor(normalizeColor(color))
+	return rdNumber(int64(rgb[2])<<16 | int64(rgb[1])<<8 | int64(rgb[0]))
+}
+
+func rdPoint(p [2]float64) []byte {
+	return append(rdCoord(p[0]), rdCoord(p[1])...)
+}
+
+// rdScramble scrambles a byte the way .rd files are: the top and bottom
+// bits swapped, xor the magic and plus one
+func rdScramble(b byte) byte {
+	b = b&0x7e | b>>7 | b<<7
+	return (b ^ rdMagic) + 1
+}
+
+func rdUnscramble(b byte) byte {
+	b = (b - 1) ^ rdMagic
+	return b&0x7e | b>>7 | b<<7
+}
+
+// rdJobLayer is the layer of an operation in an .rd file, with the
+// settings it is run with and the bounds of its segments
+type rdJobLayer struct {
+	index    byte
+	op       *Operation
+	settings LaserSettings
+	min, max [2]float64
+}
+
+// writeRD writes the job as an .rd file for a laser with a Ruida
+// controller. Every operation is a layer with the colour, speed and power
+// of its operation and the material. The job should be processed so its
+// segments are in the order they are cut, the layer is switched whenever
+// the operation changes. Each segment is cut as many times as its
+// operation has passes before the next one, like writeGCode.
+func (j *Job) writeRD(w io.Writer) error {
+	var layers []*rdJobLayer
+	layerOf := map[*Operation]*rdJobLayer{}
+	var segments []svg.Segment
+	var segmentLayers []*rdJobLayer
+	min, max := [2]float64{math.Inf(1), math.Inf(1)}, [2]float64{math.Inf(-1), math.Inf(-1)}
+	for _, s := range j.Segments {
+		op := j.operationFor(s)
+		if op == nil || len(s.Points) < 2 {
+			continue
+		}
+		layer, ok := layerOf[op]
+		if !ok {
+			layer = &rdJobLayer{index: byte(len(layers)), op: op, settings: j.Material.settings(op.Kind), min: min, max: max}
+			layerOf[op] = layer
+			layers = append(layers, layer)
+		}
+		for _, p := range s.Points {
+			for i := range p {
+				layer.min[i], layer.max[i] = math.Min(layer.min[i], p[i]), math.Max(layer.max[i], p[i])
+				min[i], max[i] = math.Min(min[i], p[i]), math.Max(max[i], p[i])
+			}
+		}
+		segments = append(segments, s)
+		segmentLayers = append(segmentLayers, layer)
+	}
+	if len(segments) == 0 {
+		min, max = [2]float64{}, [2]float64{}
+	}
+
+	out := &rdWriter{}
+	out.command(rdStart, 0x02, 0x00)
+	out.command(rdBounds, append([]byte{0x03}, rdPoint(min)...)...)
+	out.command(rdBounds, append([]byte{0x07}, rdPoint(max)...)...)
+	out.command(rdBounds, append([]byte{0x50}, rdPoint(min)...)...)
+	out.command(rdBounds, append([]byte{0x51}, rdPoint(max)...)...)
+	for _, layer := range layers {
+		n := layer.index
+		out.command(rdSpeed, append([]byte{0x04, n}, rdNumber(rdSpeedValue(layer.settings))...)...)
+		out.command(rdPower, append([]byte{0x31, n}, rdPowerValue(layer.settings.PowerPercent)...)...)
+		out.command(rdPower, append([]byte{0x32, n}, rdPowerValue(layer.settings.PowerPercent)...)...)
+		out.command(rdLayer, append([]byte{0x06, n}, rdColor(layer.op.Color)...)...)
+		out.command(rdBounds, append([]byte{0x52, n}, rdPoint(layer.min)...)...)
+		out.command(rdBounds, append([]byte{0x53, n}, rdPoint(layer.max)...)...)
+	}
+	if len(layers) > 0 {
+		out.command(rdLayer, 0x22, byte(len(layers)-1))
+	}
+
+	var current *rdJobLayer
+	for i, s := range segments {
+		layer := segmentLayers[i]
+		if layer != current {
+			out.command(rdLayer, 0x02, layer.index)
+			out.command(rdSpeed, append([]byte{0x02}, rdNumber(rdSpeedValue(layer.settings))...)...)
+			out.command(rdPower, append([]byte{0x01}, rdPowerValue(layer.settings.PowerPercent)...)...)
+			out.command(rdPower, append([]byte{0x02}, rdPowerValue(layer.settings.PowerPercent)...)...)
+			current = layer
+		}
+		points := s.Points
+		if s.Closed && len(openRing(points)) > 2 {
+			points = closeRing(openRing(points))
+		}
+		passes := layer.settings.Passes
+		if passes < 1 {
+			passes = 1
+		}
+		for pass := 0; pass < passes; pass++ {
+			out.command(rdMoveAbs, rdPoint(points[0])...)
+			for _, p := range points[1:] {
+				out.command(rdCutAbs, rdPoint(p)...)
+			}
+		}
+	}
+	out.command(rdFinish)
+	out.command(rdBounds, 0x00)
+	out.command(rdEndOfFile)
+
+	scrambled := out.Bytes()
+	for i, b := range scrambled {
+		scrambled[i] = rdScramble(b)
+	}
+	_, err := w.Write(scrambled)
+	return err
+}
+
+// rdSpeedValue is the speed of the settings in micrometres a second
+func rdSpeedValue(settings LaserSettings) int64 {
+	return int64(math.Round(settings.SpeedMmPerMin * 1000 / 60))
+}
+
+// decodeRD unscrambles an .rd file and splits it into its commands
+func decodeRD(data []byte) ([]rdCommand, error) {
+	var commands []rdCommand
+	for _, b := range data {
+		b = rdUnscramble(b)
+		if b&0x80 != 0 {
+			commands = append(commands, rdCommand{Op: b})
+			continue
+		}
+		if len(commands) == 0 {
+			return nil, fmt.Errorf("rd file starts with data byte %#x", b)
+		}
+		last := &commands[len(commands)-1]
+		last.Data = append(last.Data, b)
+	}
+	return commands, nil
+}
+
+// rdDecodeNumber reads a number of 7 bit bytes, most significant first.
+// Five bytes are a signed 35 bit number.
+func rdDecodeNumber(data []byte) int64 {
+	v := int64(0)
+	for _, b := range data {
+		v = v<<7 | int64(b&0x7f)
+	}
+	if len(data) == 5 && v&(1<<34) != 0 {
+		v -= 1 << 35
+	}
+	return v
+}
+
+// rdDecodePoint reads a point in millimetres from two absolute numbers
+func rdDecodePoint(data []byte) [2]float64 {
+	return [2]float64{float64(rdDecodeNumber(data[:5])) / 1000, float64(rdDecodeNumber(data[5:10])) / 1000}
+}
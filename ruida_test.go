@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestRDScramble(t *testing.T) {
+	is := is.New(t)
+	seen := map[byte]bool{}
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		is.Equal(rdUnscramble(rdScramble(b)), b)
+		seen[rdScramble(b)] = true
+	}
+	is.Equal(len(seen), 256)
+	is.Equal(rdDecodeNumber(rdNumber(-75)), int64(-75))
+	is.Equal(rdDecodeNumber(rdNumber(123456789)), int64(123456789))
+	is.Equal(rdDecodeNumber(rdPowerValue(100)), int64(0x3fff))
+}
+
+func TestWriteRD(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "parts",
+		WidthMm:    100,
+		HeightMm:   100,
+		Material:   materialPresets["acrylic-6mm"],
+		Operations: defaultOperations,
+		Segments: []svg.Segment{
+			{Stroke: "#0000ff", Points: [][2]float64{{0, 90}, {20, 90}}},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(10, 10, 30))},
+			{Stroke: "none", Fill: "#000000", Points: closeRing(square(50, 50, 10))},
+		},
+	}
+	out := bytes.Buffer{}
+	is.NoErr(job.writeRD(&out))
+	commands, err := decodeRD(out.Bytes())
+	is.NoErr(err)
+	is.Equal(commands[len(commands)-1].Op, byte(rdEndOfFile))
+
+	type layer struct {
+		speed, power int64
+		color        int64
+	}
+	layers := map[byte]*layer{}
+	var current byte
+	var cuts [][][2]float64
+	var cutLayers []byte
+	for _, c := range commands {
+		switch {
+		case c.Op == rdBounds && c.Data[0] == 0x03:
+			is.Equal(rdDecodePoint(c.Data[1:]), [2]float64{0, 10})
+		case c.Op == rdBounds && c.Data[0] == 0x07:
+			is.Equal(rdDecodePoint(c.Data[1:]), [2]float64{40, 90})
+		case c.Op == rdSpeed && c.Data[0] == 0x04:
+			layers[c.Data[1]] = &layer{speed: rdDecodeNumber(c.Data[2:])}
+		case c.Op == rdPower && c.Data[0] == 0x32:
+			layers[c.Data[1]].power = rdDecodeNumber(c.Data[2:])
+		case c.Op == rdLayer && c.Data[0] == 0x06:
+			layers[c.Data[1]].color = rdDecodeNumber(c.Data[2:])
+		case c.Op == rdLayer && c.Data[0] == 0x22:
+			is.Equal(c.Data[1], byte(1))
+		case c.Op == rdLayer && c.Data[0] == 0x02:
+			current = c.Data[1]
+		case c.Op == rdMoveAbs:
+			cuts = append(cuts, [][2]float64{rdDecodePoint(c.Data)})
+			cutLayers = append(cutLayers, current)
+		case c.Op == rdCutAbs:
+			cuts[len(cuts)-1] = append(cuts[len(cuts)-1], rdDecodePoint(c.Data))
+		}
+	}
+
+	// score, then the cut twice, the fill is not cut
+	is.Equal(len(layers), 2)
+	is.Equal(*layers[0], layer{speed: 20000, power: 3277, color: 0xff0000})
+	is.Equal(*layers[1], layer{speed: 2000, power: 0x3fff, color: 0})
+	is.Equal(cutLayers, []byte{0, 1, 1})
+	is.Equal(cuts[0], [][2]float64{{0, 90}, {20, 90}})
+	is.Equal(cuts[1], closeRing(square(10, 10, 30)))
+	is.Equal(cuts[2], cuts[1])
+}
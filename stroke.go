@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+)
+
+// StrokeOptions is how the strokes of a document are drawn for the laser.
+// The driver only treats hairlines as vector lines, anything wider is
+// rastered.
+type StrokeOptions struct {
+	// WidthIn is the width every stroke is drawn on paper, in inches
+	WidthIn float64
+	// Color is the colour strokes not matching the colour of an operation
+	// are drawn in, so the driver sees them as vector lines
+	Color string
+	// Operations are the operations of the job a document is drawn for,
+	// strokes in their colours keep them. A job loaded from a document
+	// has defaultOperations, which are used when this is empty.
+	Operations []Operation
+}
+
+var defaultStrokeOptions = StrokeOptions{
+	WidthIn: .001,
+	Color:   defaultOperations[0].Color,
+}
+
+// strokeState is the state of the strokes inherited down the document
+// tree
+type strokeState struct {
+	m      matrix
+	stroke string
+	color  string
+}
+
+// normalizeStrokes draws every stroked element of the document with a
+// stroke opts.WidthIn wide on paper, whatever transforms it is under, and
+// in the colour of the operation it belongs to. Widths and colours are set
+// on the elements themselves, so inherited values, style attributes and
+// non scaling strokes can not change them. pxPerIn is the user units of
+// the document per inch. It returns the number of elements changed.
+func normalizeStrokes(root *xmltree.Element, pxPerIn float64, opts StrokeOptions) int {
+	return normalizeElementStrokes(root, strokeState{m: identityMatrix, stroke: "none", color: "black"}, pxPerIn, opts)
+}
+
+func normalizeElementStrokes(el *xmltree.Element, state strokeState, pxPerIn float64, opts StrokeOptions) int {
+	switch el.Name.Local {
+	case "defs", "clipPath", "mask", "symbol", "marker", "pattern":
+		return 0
+	}
+
+	state.m = parseTransformAttr(el.Attr("", "transform")).then(state.m)
+	if color := paintAttr(el, "color"); color != "" && color != "inherit" {
+		state.color = color
+	}
+	if stroke := paintAttr(el, "stroke"); stroke != "" && stroke != "inherit" {
+		state.stroke = stroke
+		if strings.EqualFold(stroke, "currentColor") {
+			state.stroke = state.color
+		}
+	}
+
+	changed := 0
+	if drawable[el.Name.Local] && normalizeColor(state.stroke) != "none" {
+		// the width is in the user units of the element, which the
+		// transforms scale on the way to the page
+		scale := math.Sqrt(math.Abs(state.m[0]*state.m[3] - state.m[1]*state.m[2]))
+		if scale == 0 {
+			scale = 1
+		}
+		setPaintAttr(el, "stroke-width", formatLength(opts.WidthIn*pxPerIn/scale))
+		operations := opts.Operations
+		if len(operations) == 0 {
+			operations = defaultOperations
+		}
+		setPaintAttr(el, "stroke", vectorColor(state.stroke, operations, opts.Color))
+		setPaintAttr(el, "vector-effect", "")
+		changed++
+	}
+
+	for i := range el.Children {
+		changed += normalizeElementStrokes(&el.Children[i], state, pxPerIn, opts)
+	}
+	return changed
+}
+
+// vectorColor is the colour a stroke is drawn in for the laser, the colour
+// of the one of operations it belongs to in the form the operation writes
+// it or color if it belongs to none
+func vectorColor(stroke string, operations []Operation, color string) string {
+	c := normalizeColor(stroke)
+	for _, op := range operations {
+		if op.Color == c {
+			return c
+		}
+	}
+	return normalizeColor(color)
+}
+
+// setPaintAttr sets a presentation attribute of el, removing it from the
+// style attribute where it would win over the attribute. An empty value
+// removes it.
+func setPaintAttr(el *xmltree.Element, name, value string) {
+	if style := el.Attr("", "style"); style != "" {
+		var kept []string
+		for _, decl := range strings.Split(style, ";") {
+			kv := strings.SplitN(decl, ":", 2)
+			if strings.TrimSpace(decl) == "" || len(kv) == 2 && strings.TrimSpace(kv[0]) == name {
+				continue
+			}
+			kept = append(kept, strings.TrimSpace(decl))
+		}
+		el.SetAttr("", "style", strings.Join(kept, ";"))
+		if len(kept) == 0 {
+			removeAttr(el, "style")
+		}
+	}
+	if value == "" {
+		removeAttr(el, name)
+		return
+	}
+	el.SetAttr("", name, value)
+}
+
+// removeAttr removes the attribute with the local name from el
+func removeAttr(el *xmltree.Element, local string) {
+	kept := el.StartElement.Attr[:0]
+	for _, a := range el.StartElement.Attr {
+		if a.Name.Local != local {
+			kept = append(kept, a)
+		}
+	}
+	el.StartElement.Attr = kept
+}
+
+// formatLength prints a length in user units with six significant digits,
+// hairlines in documents with large units need more than three decimals
+func formatLength(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+	"github.com/matryer/is"
+)
+
+func TestNormalizeStrokes(t *testing.T) {
+	tests := []struct {
+		name   string
+		svg    string
+		width  string
+		stroke string
+		style  string
+	}{
+		{"attribute", `<line stroke="black" stroke-width="5"/>`, "0.3", "#000000", ""},
+		{"style", `<line style="stroke:#00f;stroke-width:5;opacity:.5"/>`, "0.3", "#0000ff", "opacity:.5"},
+		{"inherited", `<g stroke="#ff8000" stroke-width="5"><line/></g>`, "0.3", "#ff8000", ""},
+		{"scaled", `<g transform="scale(3)"><line stroke="black"/></g>`, "0.1", "#000000", ""},
+		{"scaled by the element", `<line transform="matrix(2,0,0,2,10,10)" stroke="black"/>`, "0.15", "#000000", ""},
+		{"non scaling", `<g transform="scale(10)"><line stroke="black" vector-effect="non-scaling-stroke"/></g>`, "0.03", "#000000", ""},
+		{"other colour", `<line stroke="rgb(10,20,30)"/>`, "0.3", "#000000", ""},
+		{"current colour", `<g color="blue"><line stroke="currentColor"/></g>`, "0.3", "#0000ff", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			root, err := xmltree.Parse([]byte(`<svg>` + tt.svg + `</svg>`))
+			is.NoErr(err)
+			is.Equal(normalizeStrokes(root, 300, defaultStrokeOptions), 1)
+			line := root.Search("", "line")[0]
+			is.Equal(line.Attr("", "stroke-width"), tt.width)
+			is.Equal(line.Attr("", "stroke"), tt.stroke)
+			is.Equal(line.Attr("", "style"), tt.style)
+			is.Equal(line.Attr("", "vector-effect"), "")
+		})
+	}
+}
+
+func TestNormalizeStrokesUnstroked(t *testing.T) {
+	is := is.New(t)
+	root, err := xmltree.Parse([]byte(`<svg><rect fill="black" stroke-width="5"/><g stroke="none"><line/></g><defs><line stroke="black"/></defs></svg>`))
+	is.NoErr(err)
+	is.Equal(normalizeStrokes(root, 300, defaultStrokeOptions), 0)
+	// widths of elements that are not stroked are left alone
+	is.Equal(root.Search("", "rect")[0].Attr("", "stroke-width"), "5")
+}
+
+func TestNormalizeStrokesOperations(t *testing.T) {
+	is := is.New(t)
+	opts := defaultStrokeOptions
+	opts.Operations = []Operation{{Name: "cut", Color: "#000000", Kind: Cut}, {Name: "mark", Color: "#ff0000", Kind: Score}}
+	root, err := xmltree.Parse([]byte(`<svg><line id="mark" stroke="red"/><line id="score" stroke="blue"/></svg>`))
+	is.NoErr(err)
+	is.Equal(normalizeStrokes(root, 300, opts), 2)
+	// the colours of the operations of the job are kept, blue is not one
+	lines := root.Search("", "line")
+	is.Equal(lines[0].Attr("", "stroke"), "#ff0000")
+	is.Equal(lines[1].Attr("", "stroke"), "#000000")
+}
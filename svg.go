@@ -1,97 +1,179 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // SVGAttrs provides processing utilities for svgs
-// Where width and height have a unit of "em" | "ex" | "px" | "in" | "cm" | "mm" | "pt" | "pc" | "%"
+// Where width and height have a unit of "em" | "ex" | "px" | "in" | "cm" | "mm" | "pt" | "pc" | "Q" | "%"
 // per https://developer.mozilla.org/en-US/docs/Web/SVG/Content_type#length
 type SVGAttrs struct {
-	width   string //eg "457.2mm"
-	height  string //eg "457.2mm"
-	viewbox string //eg "0 0 5400 5400"
+	width               string //eg "457.2mm"
+	height              string //eg "457.2mm"
+	viewbox             string //eg "0 0 5400 5400"
+	preserveAspectRatio string //eg "xMidYMid meet"
 }
 
-var viewBoxRegex = regexp.MustCompile(`^(\d+) (\d+) (\d+) (\d+)$`)
-var widthHeightRegex = regexp.MustCompile(`^([\d.]+)(mm|in)$`)
+var numberPattern = `[+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?`
+var viewBoxRegex = regexp.MustCompile(`^\s*(` + numberPattern + `)(?:\s*,\s*|\s+)(` + numberPattern + `)(?:\s*,\s*|\s+)(` + numberPattern + `)(?:\s*,\s*|\s+)(` + numberPattern + `)\s*$`)
+var lengthRegex = regexp.MustCompile(`^\s*(` + numberPattern + `)\s*(em|ex|px|in|cm|mm|pt|pc|Q|%)?\s*$`)
 
-// should only be used when we are SURE the input string is a valid number.
-// eg. when already checked via regex
-func mustParseInt(input string) int {
-	i, err := strconv.ParseInt(input, 10, 0) //bitSize=0 means int
-	if err != nil {
-		panic(err) // this should not happen if function is used properly
+const MILIMETERS_PER_INCH = 25.4
+
+// defaultPxPerIn is the size of a user unit when nothing says otherwise, a
+// css pixel
+const defaultPxPerIn = 96
+
+// pxPerUnit is the size of the absolute length units in css pixels. em and
+// ex are relative to the font, they are taken at the 16px default.
+var pxPerUnit = map[string]float64{
+	"":   1,
+	"px": 1,
+	"in": defaultPxPerIn,
+	"cm": defaultPxPerIn / 2.54,
+	"mm": defaultPxPerIn / MILIMETERS_PER_INCH,
+	"Q":  defaultPxPerIn / MILIMETERS_PER_INCH / 4,
+	"pt": defaultPxPerIn / 72.0,
+	"pc": defaultPxPerIn / 6.0,
+	"em": 16,
+	"ex": 8,
+}
+
+// parseViewBox reads a viewBox. It returns nil without an error when there
+// is no viewBox.
+func parseViewBox(viewbox string) ([]float64, error) {
+	if strings.TrimSpace(viewbox) == "" {
+		return nil, nil
+	}
+	matches := viewBoxRegex.FindStringSubmatch(viewbox)
+	if matches == nil {
+		return nil, fmt.Errorf("invalid viewBox '%s', expected four numbers: min-x min-y width height", viewbox)
+	}
+	values := make([]float64, 4)
+	for i := range values {
+		values[i], _ = strconv.ParseFloat(matches[i+1], 64) // the regex only matches numbers
 	}
-	return int(i)
+	if values[2] <= 0 || values[3] <= 0 {
+		return nil, fmt.Errorf("invalid viewBox '%s', its width and height must be more than 0", viewbox)
+	}
+	return values, nil
 }
 
-func mustParseFloat(input string) float64 {
-	i, err := strconv.ParseFloat(input, 64) //bitSize=64 means float64
-	if err != nil {
-		panic(err) // this should not happen if function is used properly
+// parseLengthIn reads a width or height in inches. It returns false
+// without an error when the length is missing or a percentage, which has
+// nothing to be a percentage of in a file.
+func parseLengthIn(name, length string) (float64, bool, error) {
+	if strings.TrimSpace(length) == "" {
+		return 0, false, nil
+	}
+	matches := lengthRegex.FindStringSubmatch(length)
+	if matches == nil {
+		return 0, false, fmt.Errorf("invalid %s '%s', expected a number with an optional unit like 210mm or 8.5in", name, length)
+	}
+	if matches[2] == "%" {
+		return 0, false, nil
 	}
-	return i
+	v, _ := strconv.ParseFloat(matches[1], 64) // the regex only matches numbers
+	if v <= 0 {
+		return 0, false, fmt.Errorf("invalid %s '%s', it must be more than 0", name, length)
+	}
+	return v * pxPerUnit[matches[2]] / defaultPxPerIn, true, nil
 }
 
-const MILIMETERS_PER_INCH = 25.4
-const float64EqualityThreshold = 1e-3
+// errPageSize is returned by pageSizeIn when nothing in the svg says how
+// big the page is
+var errPageSize = errors.New("the size of the page is unknown, the svg needs a viewBox or both a width and a height")
 
-func (a SVGAttrs) getResolutionPxPerIn() (int, error) {
+// pageSizeIn is the size of the page in inches. A missing width or height
+// follows the aspect ratio of the viewBox from the other one, and when
+// both are missing the viewBox is taken to be in css pixels.
+func (a SVGAttrs) pageSizeIn() (float64, float64, error) {
+	viewBox, err := parseViewBox(a.viewbox)
+	if err != nil {
+		return 0, 0, err
+	}
+	widthIn, hasWidth, err := parseLengthIn("width", a.width)
+	if err != nil {
+		return 0, 0, err
+	}
+	heightIn, hasHeight, err := parseLengthIn("height", a.height)
+	if err != nil {
+		return 0, 0, err
+	}
 
-	var widthPx int
-	var heightPx int
-	{
-		matches := viewBoxRegex.FindAllStringSubmatch(a.viewbox, -1) //-1 means all, no limit
+	switch {
+	case hasWidth && hasHeight:
+		return widthIn, heightIn, nil
+	case viewBox == nil:
+		return 0, 0, errPageSize
+	case hasWidth:
+		return widthIn, widthIn * viewBox[3] / viewBox[2], nil
+	case hasHeight:
+		return heightIn * viewBox[2] / viewBox[3], heightIn, nil
+	}
+	return viewBox[2] / defaultPxPerIn, viewBox[3] / defaultPxPerIn, nil
+}
 
-		if matches == nil || len(matches[0])-1 != 4 { //-1 because matches[0][0] is the full matched string
-			return 0, fmt.Errorf("invalid viewbox '%s'", a.viewbox)
-		}
-		parts := matches[0]
-		xMin, yMin, xMax, yMax := mustParseInt(parts[1]), mustParseInt(parts[2]), mustParseInt(parts[3]), mustParseInt(parts[4])
-		widthPx = xMax - xMin
-		heightPx = yMax - yMin
+// getResolutionPxPerIn returns how many user units make an inch on paper,
+// along x and along y. Without a viewBox a user unit is a css pixel. With
+// one the viewBox is scaled to fit the page as preserveAspectRatio says:
+// none stretches it to fill the page, so the scales can differ, meet, the
+// default, fits all of it and slice covers the whole page. Where the
+// viewBox is moved to by the alignment is not taken into account.
+func (a SVGAttrs) getResolutionPxPerIn() (float64, float64, error) {
+	viewBox, err := parseViewBox(a.viewbox)
+	if err != nil {
+		return 0, 0, err
+	}
+	if viewBox == nil {
+		return defaultPxPerIn, defaultPxPerIn, nil
 	}
+	widthIn, heightIn, err := a.pageSizeIn()
+	if err != nil {
+		return 0, 0, err
+	}
+	x, y := viewBox[2]/widthIn, viewBox[3]/heightIn
 
-	var widthIn float64
-	{
-		widthMatches := widthHeightRegex.FindAllStringSubmatch(a.width, -1) //-1 means all, no limit
-		if widthMatches == nil || len(widthMatches[0])-1 != 2 {             //-1 because matches[0][0] is the full matched string
-			return 0, fmt.Errorf("invalid width '%s'", a.width)
-		}
-		widthIn = mustParseFloat(widthMatches[0][1])
-		widthUnit := widthMatches[0][2]
-		if widthUnit != "in" && widthUnit != "mm" {
-			return 0, fmt.Errorf("invalid width unit '%s'", widthUnit)
-		}
-		if widthUnit == "mm" {
-			widthIn /= MILIMETERS_PER_INCH //convert to inches
-		}
+	fields := strings.Fields(a.preserveAspectRatio)
+	if len(fields) > 0 && fields[0] == "defer" {
+		fields = fields[1:]
+	}
+	align, meetOrSlice := "xMidYMid", "meet"
+	if len(fields) > 0 {
+		align = fields[0]
+	}
+	if len(fields) > 1 {
+		meetOrSlice = fields[1]
+	}
+	if len(fields) > 2 || !validAlign(align) || meetOrSlice != "meet" && meetOrSlice != "slice" {
+		return 0, 0, fmt.Errorf("invalid preserveAspectRatio '%s', expected an alignment like xMidYMid or none, optionally followed by meet or slice", a.preserveAspectRatio)
 	}
 
-	var heightIn float64
-	{
-		heightMatches := widthHeightRegex.FindAllStringSubmatch(a.height, -1) //-1 means all, no limit
-		if heightMatches == nil || len(heightMatches[0])-1 != 2 {             //-1 because matches[0][0] is the full matched string
-			return 0, fmt.Errorf("invalid height '%s'", a.height)
-		}
-		heightIn = mustParseFloat(heightMatches[0][1])
-		heightUnit := heightMatches[0][2]
-		if heightUnit != "in" && heightUnit != "mm" {
-			return 0, fmt.Errorf("invalid width unit '%s'", heightUnit)
-		}
-		if heightUnit == "mm" {
-			heightIn /= MILIMETERS_PER_INCH //convert to inches
-		}
-	}
-	widthPxPerInch := float64(widthPx) / widthIn
-	heightPxPerInch := float64(heightPx) / heightIn
-	if math.Abs(widthPxPerInch-heightPxPerInch) > float64EqualityThreshold {
-		return 0, fmt.Errorf("width and height pixels per inch do not match. width: %f height %f, %.15f", widthPxPerInch, heightPxPerInch, math.Abs(widthPxPerInch-heightPxPerInch))
+	switch {
+	case align == "none":
+		return x, y, nil
+	case meetOrSlice == "slice":
+		// the scale is user units per inch, the smaller one draws bigger
+		s := math.Min(x, y)
+		return s, s, nil
 	}
+	s := math.Max(x, y)
+	return s, s, nil
+}
 
-	return int(widthPxPerInch), nil
+// validAlign reports if align is an alignment value of preserveAspectRatio
+func validAlign(align string) bool {
+	if align == "none" {
+		return true
+	}
+	if len(align) != 8 || align[0] != 'x' || align[4] != 'Y' {
+		return false
+	}
+	ok := func(s string) bool { return s == "Min" || s == "Mid" || s == "Max" }
+	return ok(align[1:4]) && ok(align[5:8])
 }
@@ -4,13 +4,15 @@ import mt "github.com/rustyoz/Mtransform"
 
 // Circle is an SVG circle element
 type Circle struct {
-	ID        string  `xml:"id,attr"`
-	Transform string  `xml:"transform,attr"`
-	Style     string  `xml:"style,attr"`
-	Cx        float64 `xml:"cx,attr"`
-	Cy        float64 `xml:"cy,attr"`
-	Radius    float64 `xml:"r,attr"`
-	Fill      string  `xml:"fill,attr"`
+	ID          string  `xml:"id,attr"`
+	Transform   string  `xml:"transform,attr"`
+	Style       string  `xml:"style,attr"`
+	Cx          float64 `xml:"cx,attr"`
+	Cy          float64 `xml:"cy,attr"`
+	Radius      float64 `xml:"r,attr"`
+	Fill        string  `xml:"fill,attr"`
+	Stroke      string  `xml:"stroke,attr"`
+	StrokeWidth string  `xml:"stroke-width,attr"`
 
 	transform mt.Transform
 	group     *Group
@@ -26,13 +28,17 @@ func (c *Circle) ParseDrawingInstructions() (chan *DrawingInstruction, chan erro
 		defer close(draw)
 		defer close(errs)
 
+		t := shapeTransform(c.group, c.Transform)
+		x, y := t.Apply(c.Cx, c.Cy)
+		radius := c.Radius * scaleFactor(t)
+
 		draw <- &DrawingInstruction{
 			Kind:   CircleInstruction,
-			M:      &Tuple{c.Cx, c.Cy},
-			Radius: &c.Radius,
+			M:      &Tuple{x, y},
+			Radius: &radius,
 		}
 
-		draw <- &DrawingInstruction{Kind: PaintInstruction, Fill: &c.Fill}
+		draw <- shapePaint(c.group, c.Style, c.Stroke, c.Fill, c.StrokeWidth)
 	}()
 
 	return draw, errs
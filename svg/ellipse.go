@@ -4,14 +4,38 @@ import mt "github.com/rustyoz/Mtransform"
 
 // Ellipse is an SVG ellipse XML element
 type Ellipse struct {
-	ID        string `xml:"id,attr"`
-	Transform string `xml:"transform,attr"`
-	Style     string `xml:"style,attr"`
-	Cx        string `xml:"cx,attr"`
-	Cy        string `xml:"cy,attr"`
-	Rx        string `xml:"rx,attr"`
-	Ry        string `xml:"ry,attr"`
+	ID          string `xml:"id,attr"`
+	Transform   string `xml:"transform,attr"`
+	Style       string `xml:"style,attr"`
+	Cx          string `xml:"cx,attr"`
+	Cy          string `xml:"cy,attr"`
+	Rx          string `xml:"rx,attr"`
+	Ry          string `xml:"ry,attr"`
+	Fill        string `xml:"fill,attr"`
+	Stroke      string `xml:"stroke,attr"`
+	StrokeWidth string `xml:"stroke-width,attr"`
 
 	transform mt.Transform
 	group     *Group
 }
+
+// ParseDrawingInstructions implements the DrawingInstructionParser
+// interface
+func (e *Ellipse) ParseDrawingInstructions() (chan *DrawingInstruction, chan error) {
+	si := &shapeInstructions{transform: shapeTransform(e.group, e.Transform)}
+	var v [4]float64
+	for i, s := range []string{e.Cx, e.Cy, e.Rx, e.Ry} {
+		f, err := parseLength(s)
+		if err != nil {
+			si.err = err
+			return si.channels()
+		}
+		v[i] = f
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return si.channels()
+	}
+	si.ellipse(v[0], v[1], v[2], v[3])
+	si.paint(shapePaint(e.group, e.Style, e.Stroke, e.Fill, e.StrokeWidth))
+	return si.channels()
+}
@@ -4,14 +4,35 @@ import mt "github.com/rustyoz/Mtransform"
 
 // Line is an SVG XML line element
 type Line struct {
-	ID        string `xml:"id,attr"`
-	Transform string `xml:"transform,attr"`
-	Style     string `xml:"style,attr"`
-	X1        string `xml:"x1,attr"`
-	X2        string `xml:"x2,attr"`
-	Y1        string `xml:"y1,attr"`
-	Y2        string `xml:"y2,attr"`
+	ID          string `xml:"id,attr"`
+	Transform   string `xml:"transform,attr"`
+	Style       string `xml:"style,attr"`
+	X1          string `xml:"x1,attr"`
+	X2          string `xml:"x2,attr"`
+	Y1          string `xml:"y1,attr"`
+	Y2          string `xml:"y2,attr"`
+	Stroke      string `xml:"stroke,attr"`
+	StrokeWidth string `xml:"stroke-width,attr"`
 
 	transform mt.Transform
 	group     *Group
 }
+
+// ParseDrawingInstructions implements the DrawingInstructionParser
+// interface
+func (l *Line) ParseDrawingInstructions() (chan *DrawingInstruction, chan error) {
+	si := &shapeInstructions{transform: shapeTransform(l.group, l.Transform)}
+	var coords [4]float64
+	for i, s := range []string{l.X1, l.Y1, l.X2, l.Y2} {
+		v, err := parseLength(s)
+		if err != nil {
+			si.err = err
+			return si.channels()
+		}
+		coords[i] = v
+	}
+	si.moveTo(Tuple{coords[0], coords[1]})
+	si.lineTo(Tuple{coords[2], coords[3]})
+	si.paint(shapePaint(l.group, l.Style, l.Stroke, "none", l.StrokeWidth))
+	return si.channels()
+}
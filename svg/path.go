@@ -29,10 +29,20 @@ type Path struct {
 // A Segment of a path that contains a list of connected points, its
 // stroke Width and if the segment forms a closed loop.  Points are
 // defined in world space after any matrix transformation is applied.
+//
+// Stroke, Fill and FillRule are the effective presentation attributes of
+// the element the segment came from and Layer is the label (or id) of the
+// closest group that has one. Element numbers that element in document
+// order, so the sub paths of one path can be told apart from other paths.
 type Segment struct {
-	Width  float64
-	Closed bool
-	Points [][2]float64
+	Width    float64
+	Closed   bool
+	Points   [][2]float64
+	Stroke   string
+	Fill     string
+	FillRule string
+	Layer    string
+	Element  int
 }
 
 func (p Path) newSegment(start [2]float64) *Segment {
@@ -695,12 +705,11 @@ func (pdp *pathDescriptionParser) parseCurveToRelDI() error {
 		tuples = append(tuples, t)
 		pdp.lex.ConsumeWhiteSpace()
 	}
-	x, y := pdp.transform.Apply(pdp.x, pdp.y)
-
 	for j := 0; j < len(tuples)/3; j++ {
-		c1x, c1y := pdp.transform.Apply(x+tuples[j*3][0], y+tuples[j*3][1])
-		c2x, c2y := pdp.transform.Apply(x+tuples[j*3+1][0], y+tuples[j*3+1][1])
-		tx, ty := pdp.transform.Apply(x+tuples[j*3+2][0], y+tuples[j*3+2][1])
+		// control points are relative to the untransformed current point
+		c1x, c1y := pdp.transform.Apply(pdp.x+tuples[j*3][0], pdp.y+tuples[j*3][1])
+		c2x, c2y := pdp.transform.Apply(pdp.x+tuples[j*3+1][0], pdp.y+tuples[j*3+1][1])
+		tx, ty := pdp.transform.Apply(pdp.x+tuples[j*3+2][0], pdp.y+tuples[j*3+2][1])
 
 		pdp.p.instructions <- &DrawingInstruction{
 			Kind: CurveInstruction,
@@ -712,7 +721,6 @@ func (pdp *pathDescriptionParser) parseCurveToRelDI() error {
 
 		pdp.x += tuples[j*3+2][0]
 		pdp.y += tuples[j*3+2][1]
-		x, y = pdp.transform.Apply(pdp.x, pdp.y)
 	}
 
 	return nil
@@ -801,9 +809,9 @@ func (pdp *pathDescriptionParser) parseCurveToAbsDI() error {
 		pdp.p.instructions <- &DrawingInstruction{
 			Kind: CurveInstruction,
 			CurvePoints: &CurvePoints{
-				C1: &instrTuples[0],
-				C2: &instrTuples[1],
-				T:  &instrTuples[2],
+				C1: &instrTuples[j*3],
+				C2: &instrTuples[j*3+1],
+				T:  &instrTuples[j*3+2],
 			},
 		}
 	}
@@ -5,11 +5,34 @@ import mt "github.com/rustyoz/Mtransform"
 // PolyLine is a set of connected line segments that typically form a
 // closed shape
 type PolyLine struct {
-	ID        string `xml:"id,attr"`
-	Transform string `xml:"transform,attr"`
-	Style     string `xml:"style,attr"`
-	Points    string `xml:"points,attr"`
+	ID          string `xml:"id,attr"`
+	Transform   string `xml:"transform,attr"`
+	Style       string `xml:"style,attr"`
+	Points      string `xml:"points,attr"`
+	Fill        string `xml:"fill,attr"`
+	Stroke      string `xml:"stroke,attr"`
+	StrokeWidth string `xml:"stroke-width,attr"`
 
 	transform mt.Transform
 	group     *Group
 }
+
+// ParseDrawingInstructions implements the DrawingInstructionParser
+// interface
+func (p *PolyLine) ParseDrawingInstructions() (chan *DrawingInstruction, chan error) {
+	si := &shapeInstructions{transform: shapeTransform(p.group, p.Transform)}
+	points, err := parsePoints(p.Points)
+	if err != nil {
+		si.err = err
+		return si.channels()
+	}
+	for i, pt := range points {
+		if i == 0 {
+			si.moveTo(pt)
+			continue
+		}
+		si.lineTo(pt)
+	}
+	si.paint(shapePaint(p.group, p.Style, p.Stroke, p.Fill, p.StrokeWidth))
+	return si.channels()
+}
@@ -4,13 +4,18 @@ import mt "github.com/rustyoz/Mtransform"
 
 // Rect is an SVG XML rect element
 type Rect struct {
-	ID        string `xml:"id,attr"`
-	Width     string `xml:"width,attr"`
-	Height    string `xml:"height,attr"`
-	Transform string `xml:"transform,attr"`
-	Style     string `xml:"style,attr"`
-	Rx        string `xml:"rx,attr"`
-	Ry        string `xml:"ry,attr"`
+	ID          string `xml:"id,attr"`
+	X           string `xml:"x,attr"`
+	Y           string `xml:"y,attr"`
+	Width       string `xml:"width,attr"`
+	Height      string `xml:"height,attr"`
+	Transform   string `xml:"transform,attr"`
+	Style       string `xml:"style,attr"`
+	Rx          string `xml:"rx,attr"`
+	Ry          string `xml:"ry,attr"`
+	Fill        string `xml:"fill,attr"`
+	Stroke      string `xml:"stroke,attr"`
+	StrokeWidth string `xml:"stroke-width,attr"`
 
 	transform mt.Transform
 	group     *Group
@@ -19,11 +24,52 @@ type Rect struct {
 // ParseDrawingInstructions implements the DrawingInstructionParser
 // interface
 func (r *Rect) ParseDrawingInstructions() (chan *DrawingInstruction, chan error) {
-	draw := make(chan *DrawingInstruction)
-	errs := make(chan error)
+	si := &shapeInstructions{transform: shapeTransform(r.group, r.Transform)}
+	var v [6]float64
+	for i, s := range []string{r.X, r.Y, r.Width, r.Height, r.Rx, r.Ry} {
+		f, err := parseLength(s)
+		if err != nil {
+			si.err = err
+			return si.channels()
+		}
+		v[i] = f
+	}
+	x, y, w, h, rx, ry := v[0], v[1], v[2], v[3], v[4], v[5]
+	if w <= 0 || h <= 0 {
+		return si.channels() // a rect without area is not rendered
+	}
+	// a missing rx or ry takes the value of the other one
+	if r.Rx == "" {
+		rx = ry
+	}
+	if r.Ry == "" {
+		ry = rx
+	}
+	if rx > w/2 {
+		rx = w / 2
+	}
+	if ry > h/2 {
+		ry = h / 2
+	}
 
-	defer close(draw)
-	defer close(errs)
-
-	return draw, errs
+	if rx <= 0 || ry <= 0 {
+		si.moveTo(Tuple{x, y})
+		si.lineTo(Tuple{x + w, y})
+		si.lineTo(Tuple{x + w, y + h})
+		si.lineTo(Tuple{x, y + h})
+	} else {
+		kx, ky := rx*kappa, ry*kappa
+		si.moveTo(Tuple{x + rx, y})
+		si.lineTo(Tuple{x + w - rx, y})
+		si.curveTo(Tuple{x + w - rx + kx, y}, Tuple{x + w, y + ry - ky}, Tuple{x + w, y + ry})
+		si.lineTo(Tuple{x + w, y + h - ry})
+		si.curveTo(Tuple{x + w, y + h - ry + ky}, Tuple{x + w - rx + kx, y + h}, Tuple{x + w - rx, y + h})
+		si.lineTo(Tuple{x + rx, y + h})
+		si.curveTo(Tuple{x + rx - kx, y + h}, Tuple{x, y + h - ry + ky}, Tuple{x, y + h - ry})
+		si.lineTo(Tuple{x, y + ry})
+		si.curveTo(Tuple{x, y + ry - ky}, Tuple{x + rx - kx, y}, Tuple{x + rx, y})
+	}
+	si.close()
+	si.paint(shapePaint(r.group, r.Style, r.Stroke, r.Fill, r.StrokeWidth))
+	return si.channels()
 }
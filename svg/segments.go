@@ -0,0 +1,177 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+)
+
+// circleSteps is the number of straight lines used to approximate a
+// circle instruction
+const circleSteps = 72
+
+// Segments flattens every element of the document into segments. Curves
+// are interpolated and circles are approximated with straight lines. The
+// transforms of the elements and their groups are applied, so points are
+// in the user units of the root svg element.
+func (s *Svg) Segments() ([]Segment, error) {
+	var segments []Segment
+	element := 0
+	for i, e := range s.Elements {
+		segs, err := elementSegments(e, nil, element)
+		if err != nil {
+			return nil, fmt.Errorf("error when flattening element nr. %d: %s", i+1, err)
+		}
+		element++
+		segments = append(segments, segs...)
+	}
+	for i := range s.Groups {
+		segs, err := s.Groups[i].flatten(&element)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segs...)
+	}
+	return segments, nil
+}
+
+// Segments flattens every element of the group and its sub groups
+func (g *Group) Segments() ([]Segment, error) {
+	element := 0
+	return g.flatten(&element)
+}
+
+// flatten flattens the group, numbering its elements from *element on
+func (g *Group) flatten(element *int) ([]Segment, error) {
+	var segments []Segment
+	for _, e := range g.Elements {
+		if child, ok := e.(*Group); ok {
+			segs, err := child.flatten(element)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segs...)
+			continue
+		}
+		segs, err := elementSegments(e, g, *element)
+		if err != nil {
+			return nil, fmt.Errorf("error when flattening element of group '%s': %s", g.ID, err)
+		}
+		*element++
+		segments = append(segments, segs...)
+	}
+	return segments, nil
+}
+
+// elementSegments collects the drawing instructions of a single element
+// into segments. The paint instruction at the end of the element sets the
+// presentation attributes of every segment before it.
+func elementSegments(e DrawingInstructionParser, g *Group, element int) ([]Segment, error) {
+	instrs, errs := e.ParseDrawingInstructions()
+
+	var (
+		segments []Segment
+		current  *Segment
+		cursor   [2]float64 // current point, in document coordinates
+		start    [2]float64 // start of the current sub path
+		painted  int
+	)
+	flush := func() {
+		if current != nil && len(current.Points) > 1 {
+			current.Element = element
+			segments = append(segments, *current)
+		}
+		current = nil
+	}
+	ensure := func() {
+		if current == nil {
+			current = &Segment{Points: [][2]float64{cursor}}
+			start = cursor
+		}
+	}
+
+	for di := range instrs {
+		switch di.Kind {
+		case MoveInstruction:
+			flush()
+			cursor = [2]float64(*di.M)
+			ensure()
+		case LineInstruction:
+			ensure()
+			cursor = [2]float64(*di.M)
+			current.addPoint(cursor)
+		case CurveInstruction:
+			ensure()
+			var cb cubicBezier
+			cb.controlpoints[0] = cursor
+			cb.controlpoints[1] = [2]float64(*di.CurvePoints.C1)
+			cb.controlpoints[2] = [2]float64(*di.CurvePoints.C2)
+			cb.controlpoints[3] = [2]float64(*di.CurvePoints.T)
+			for _, v := range cb.recursiveInterpolate(10, 0) {
+				if v != current.Points[len(current.Points)-1] {
+					current.addPoint(v)
+				}
+			}
+			cursor = cb.controlpoints[3]
+		case CircleInstruction:
+			flush()
+			cx, cy, r := di.M[0], di.M[1], *di.Radius
+			current = &Segment{Closed: true}
+			for i := 0; i <= circleSteps; i++ {
+				a := 2 * math.Pi * float64(i%circleSteps) / circleSteps
+				current.addPoint([2]float64{cx + r*math.Cos(a), cy + r*math.Sin(a)})
+			}
+			flush()
+		case CloseInstruction:
+			if current != nil {
+				if current.Points[len(current.Points)-1] != start {
+					current.addPoint(start)
+				}
+				current.Closed = true
+			}
+			flush()
+			cursor = start
+		case PaintInstruction:
+			flush()
+			for i := painted; i < len(segments); i++ {
+				paintSegment(&segments[i], di, g)
+			}
+			painted = len(segments)
+		}
+	}
+	flush()
+	for i := painted; i < len(segments); i++ {
+		paintSegment(&segments[i], &DrawingInstruction{}, g)
+	}
+
+	for err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// paintSegment sets the presentation attributes of a segment from a paint
+// instruction, falling back to the ones of the group.
+func paintSegment(s *Segment, di *DrawingInstruction, g *Group) {
+	if di.StrokeWidth != nil {
+		s.Width = *di.StrokeWidth
+	} else if g != nil {
+		s.Width = g.StrokeWidth
+	}
+	s.Stroke = g.inherited(func(g *Group) string { return g.Stroke })
+	if di.Stroke != nil && *di.Stroke != "" {
+		s.Stroke = *di.Stroke
+	}
+	s.Fill = g.inherited(func(g *Group) string { return g.Fill })
+	if di.Fill != nil && *di.Fill != "" {
+		s.Fill = *di.Fill
+	}
+	s.FillRule = g.inherited(func(g *Group) string { return g.FillRule })
+	s.Layer = g.inherited(func(g *Group) string {
+		if g.Label != "" {
+			return g.Label
+		}
+		return g.ID
+	})
+}
@@ -0,0 +1,74 @@
+package svg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegments(t *testing.T) {
+	doc := `<svg viewBox="0 0 100 100">
+<g fill="none" stroke="#000000" fill-rule="evenodd" transform="translate(10,20)">
+	<g id="inner" transform="scale(2)">
+		<polyline points="0,0 1,0 1,1"/>
+		<polygon points="0,0 5,0 5,5" stroke="#ff0000"/>
+	</g>
+	<rect x="0" y="0" width="10" height="5" fill="#ffffff"/>
+</g>
+<line x1="0" y1="0" x2="3" y2="4" stroke="blue"/>
+</svg>`
+	svg, err := ParseSvg(doc, "test", 0)
+	require.NoError(t, err)
+
+	segments, err := svg.Segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 4)
+
+	line := segments[0]
+	require.False(t, line.Closed)
+	require.Equal(t, [][2]float64{{0, 0}, {3, 4}}, line.Points)
+	require.Equal(t, "blue", line.Stroke)
+
+	polyline := segments[1]
+	require.False(t, polyline.Closed)
+	require.Equal(t, [][2]float64{{10, 20}, {12, 20}, {12, 22}}, polyline.Points)
+	require.Equal(t, "#000000", polyline.Stroke)
+	require.Equal(t, "none", polyline.Fill)
+	require.Equal(t, "evenodd", polyline.FillRule)
+	require.Equal(t, "inner", polyline.Layer)
+
+	polygon := segments[2]
+	require.True(t, polygon.Closed)
+	require.Equal(t, [][2]float64{{10, 20}, {20, 20}, {20, 30}, {10, 20}}, polygon.Points)
+	require.Equal(t, "#ff0000", polygon.Stroke)
+
+	rect := segments[3]
+	require.True(t, rect.Closed)
+	require.Equal(t, [][2]float64{{10, 20}, {20, 20}, {20, 25}, {10, 25}, {10, 20}}, rect.Points)
+	require.Equal(t, "#ffffff", rect.Fill)
+	require.Equal(t, "", rect.Layer)
+
+	// elements are numbered in the order they are flattened
+	require.Equal(t, []int{0, 1, 2, 3}, []int{line.Element, polyline.Element, polygon.Element, rect.Element})
+}
+
+func TestSegmentsCurves(t *testing.T) {
+	doc := `<svg viewBox="0 0 100 100"><path d="M0 0 C0 10 10 10 10 0 Z" stroke-width="2"/><circle cx="5" cy="5" r="2"/></svg>`
+	svg, err := ParseSvg(doc, "test", 0)
+	require.NoError(t, err)
+
+	segments, err := svg.Segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+
+	curve := segments[0]
+	require.True(t, curve.Closed)
+	require.Greater(t, len(curve.Points), 4)
+	require.Equal(t, [2]float64{0, 0}, curve.Points[0])
+	require.Equal(t, [2]float64{0, 0}, curve.Points[len(curve.Points)-1])
+
+	circle := segments[1]
+	require.True(t, circle.Closed)
+	require.Len(t, circle.Points, circleSteps+1)
+	require.InDelta(t, 7, circle.Points[0][0], 1e-9)
+}
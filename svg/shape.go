@@ -0,0 +1,157 @@
+package svg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	mt "github.com/rustyoz/Mtransform"
+)
+
+// kappa is the distance of the control points from the end points of a
+// cubic bezier approximating a quarter circle of radius 1
+const kappa = 0.5522847498307936
+
+// parseLength parses a length attribute of a basic shape. Lengths are
+// expected in user units, a trailing px is accepted.
+func parseLength(s string) (float64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "px"))
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid length '%s'", s)
+	}
+	return v, nil
+}
+
+// parsePoints parses the points attribute of a polyline or polygon
+func parsePoints(points string) ([]Tuple, error) {
+	fields := strings.FieldsFunc(points, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("odd number of coordinates in points '%s'", points)
+	}
+	var tuples []Tuple
+	for i := 0; i < len(fields); i += 2 {
+		x, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate '%s'", fields[i])
+		}
+		y, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate '%s'", fields[i+1])
+		}
+		tuples = append(tuples, Tuple{x, y})
+	}
+	return tuples, nil
+}
+
+// shapeTransform is the transform from the coordinates of a basic shape
+// to the coordinates of the document.
+func shapeTransform(g *Group, transform string) mt.Transform {
+	t := mt.Identity()
+	if g != nil && g.Transform != nil {
+		t = *g.Transform
+	}
+	if transform != "" {
+		if et, err := parseTransform(transform); err == nil {
+			t = mt.MultiplyTransforms(t, et)
+		}
+	}
+	return t
+}
+
+// shapePaint builds the paint instruction of a basic shape from its own
+// presentation attributes and the ones inherited from its groups.
+func shapePaint(g *Group, style, stroke, fill, strokeWidth string) *DrawingInstruction {
+	s := presentation(g, style, stroke, func(g *Group) string { return g.Stroke }, "stroke")
+	f := presentation(g, style, fill, func(g *Group) string { return g.Fill }, "fill")
+	swString := presentation(g, style, strokeWidth, func(g *Group) string {
+		if g.StrokeWidth == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(g.StrokeWidth, 'f', -1, 64)
+	}, "stroke-width")
+	sw, err := parseLength(swString)
+	if err != nil || swString == "" {
+		sw = 1
+	}
+	if g != nil && g.Owner != nil && g.Owner.scale > 0 {
+		sw *= g.Owner.scale
+	}
+	return &DrawingInstruction{Kind: PaintInstruction, Stroke: &s, Fill: &f, StrokeWidth: &sw}
+}
+
+// shapeInstructions turns the points of a basic shape into drawing
+// instructions that are sent on an already closed channel.
+type shapeInstructions struct {
+	transform mt.Transform
+	instrs    []*DrawingInstruction
+	err       error
+}
+
+func (si *shapeInstructions) apply(t Tuple) *Tuple {
+	x, y := si.transform.Apply(t[0], t[1])
+	return &Tuple{x, y}
+}
+
+func (si *shapeInstructions) moveTo(t Tuple) {
+	si.instrs = append(si.instrs, &DrawingInstruction{Kind: MoveInstruction, M: si.apply(t)})
+}
+
+func (si *shapeInstructions) lineTo(t Tuple) {
+	si.instrs = append(si.instrs, &DrawingInstruction{Kind: LineInstruction, M: si.apply(t)})
+}
+
+func (si *shapeInstructions) curveTo(c1, c2, t Tuple) {
+	si.instrs = append(si.instrs, &DrawingInstruction{
+		Kind: CurveInstruction,
+		CurvePoints: &CurvePoints{
+			C1: si.apply(c1),
+			C2: si.apply(c2),
+			T:  si.apply(t),
+		},
+	})
+}
+
+// ellipse adds a closed ellipse made of four cubic beziers
+func (si *shapeInstructions) ellipse(cx, cy, rx, ry float64) {
+	si.moveTo(Tuple{cx + rx, cy})
+	si.curveTo(Tuple{cx + rx, cy + ry*kappa}, Tuple{cx + rx*kappa, cy + ry}, Tuple{cx, cy + ry})
+	si.curveTo(Tuple{cx - rx*kappa, cy + ry}, Tuple{cx - rx, cy + ry*kappa}, Tuple{cx - rx, cy})
+	si.curveTo(Tuple{cx - rx, cy - ry*kappa}, Tuple{cx - rx*kappa, cy - ry}, Tuple{cx, cy - ry})
+	si.curveTo(Tuple{cx + rx*kappa, cy - ry}, Tuple{cx + rx, cy - ry*kappa}, Tuple{cx + rx, cy})
+	si.close()
+}
+
+func (si *shapeInstructions) close() {
+	si.instrs = append(si.instrs, &DrawingInstruction{Kind: CloseInstruction})
+}
+
+func (si *shapeInstructions) paint(di *DrawingInstruction) {
+	si.instrs = append(si.instrs, di)
+}
+
+func (si *shapeInstructions) channels() (chan *DrawingInstruction, chan error) {
+	draw := make(chan *DrawingInstruction, len(si.instrs))
+	errs := make(chan error, 1)
+	if si.err != nil {
+		errs <- si.err
+	} else {
+		for _, di := range si.instrs {
+			draw <- di
+		}
+	}
+	close(draw)
+	close(errs)
+	return draw, errs
+}
+
+// scaleFactor is how much a transform scales lengths on average
+func scaleFactor(t mt.Transform) float64 {
+	return math.Sqrt(math.Abs(t[0][0]*t[1][1] - t[0][1]*t[1][0]))
+}
@@ -1,6 +1,7 @@
 package svg
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -12,9 +13,52 @@ func splitStyle(style string) map[string]string {
 	for _, keyval := range props {
 		kv := strings.Split(keyval, ":")
 		if len(kv) >= 2 {
-			r[kv[0]] = kv[1]
+			r[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 		}
 	}
 
 	return r
 }
+
+// parseStyle copies the presentation properties of a group's style
+// attribute onto the group so they are inherited like the attributes.
+func (g *Group) parseStyle(style string) {
+	for key, val := range splitStyle(style) {
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(key) {
+		case "stroke":
+			g.Stroke = val
+		case "stroke-width":
+			if sw, err := strconv.ParseFloat(strings.TrimSuffix(val, "px"), 64); err == nil {
+				g.StrokeWidth = sw
+			}
+		case "fill":
+			g.Fill = val
+		case "fill-rule":
+			g.FillRule = val
+		}
+	}
+}
+
+// inherited walks up from g until get returns a non empty value.
+func (g *Group) inherited(get func(*Group) string) string {
+	for ; g != nil; g = g.Parent {
+		if v := get(g); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// presentation returns the value of a presentation property for an
+// element. The element's style wins over its attribute which wins over
+// the value inherited from its groups.
+func presentation(g *Group, style string, attr string, get func(*Group) string, key string) string {
+	if v, ok := splitStyle(style)[key]; ok {
+		return strings.TrimSpace(v)
+	}
+	if attr != "" {
+		return attr
+	}
+	return g.inherited(get)
+}
@@ -42,6 +42,7 @@ type Svg struct {
 // Group represents an SVG group (usually located in a 'g' XML element)
 type Group struct {
 	ID              string
+	Label           string
 	Stroke          string
 	StrokeWidth     float64
 	Fill            string
@@ -92,6 +93,10 @@ func (g *Group) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error
 		switch attr.Name.Local {
 		case "id":
 			g.ID = attr.Value
+		case "label":
+			g.Label = attr.Value
+		case "style":
+			g.parseStyle(attr.Value)
 		case "stroke":
 			g.Stroke = attr.Value
 		case "stroke-width":
@@ -110,6 +115,10 @@ func (g *Group) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error
 			if err != nil {
 				fmt.Println(err)
 			}
+			// g.Transform starts out as a copy of the parent's transform
+			if g.Transform != nil {
+				t = mt.MultiplyTransforms(*g.Transform, t)
+			}
 			g.Transform = &t
 		}
 	}
@@ -126,11 +135,23 @@ func (g *Group) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error
 
 			switch tok.Name.Local {
 			case "g":
-				elementStruct = &Group{Parent: g, Owner: g.Owner, Transform: mt.NewTransform()}
+				transform := mt.Identity()
+				if g.Transform != nil {
+					transform = *g.Transform
+				}
+				elementStruct = &Group{Parent: g, Owner: g.Owner, Transform: &transform}
 			case "rect":
 				elementStruct = &Rect{group: g}
 			case "circle":
 				elementStruct = &Circle{group: g}
+			case "ellipse":
+				elementStruct = &Ellipse{group: g}
+			case "line":
+				elementStruct = &Line{group: g}
+			case "polyline":
+				elementStruct = &PolyLine{group: g}
+			case "polygon":
+				elementStruct = &Polygon{group: g}
 			case "path":
 				elementStruct = &Path{group: g, StrokeWidth: float64(g.StrokeWidth), Stroke: &g.Stroke, Fill: &g.Fill}
 			default:
@@ -230,6 +251,14 @@ func (s *Svg) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
 				dip = &Rect{}
 			case "circle":
 				dip = &Circle{}
+			case "ellipse":
+				dip = &Ellipse{}
+			case "line":
+				dip = &Line{}
+			case "polyline":
+				dip = &PolyLine{}
+			case "polygon":
+				dip = &Polygon{}
 			case "path":
 				dip = &Path{}
 
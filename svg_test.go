@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"runtime"
 	"strings"
@@ -23,7 +24,8 @@ func TestSVGAttrs_getResolutionPxPerIn(t *testing.T) {
 	tests := []struct {
 		name    string
 		a       SVGAttrs
-		want    int
+		wantX   float64
+		wantY   float64
 		wantErr bool
 	}{
 		{
@@ -33,8 +35,8 @@ func TestSVGAttrs_getResolutionPxPerIn(t *testing.T) {
 				height:  "457.2mm",
 				viewbox: "0 0 5400 5400",
 			},
-			want:    300,
-			wantErr: false,
+			wantX: 300,
+			wantY: 300,
 		}, {
 			name: "happy path - in",
 			a: SVGAttrs{
@@ -42,16 +44,113 @@ func TestSVGAttrs_getResolutionPxPerIn(t *testing.T) {
 				height:  "2in",
 				viewbox: "0 0 600 600",
 			},
-			want:    300,
-			wantErr: false,
+			wantX: 300,
+			wantY: 300,
 		}, {
-			name: "mismatch dpi",
+			name: "fractional mm",
+			a: SVGAttrs{
+				width:   "304.8mm",
+				height:  "304.8mm",
+				viewbox: "0 0 3599.5 3599.5",
+			},
+			wantX: 299.958333,
+			wantY: 299.958333,
+		}, {
+			name: "commas and a negative origin",
+			a: SVGAttrs{
+				width:   "10cm",
+				height:  "5cm",
+				viewbox: "-50,-25, 100,50",
+			},
+			wantX: 25.4,
+			wantY: 25.4,
+		}, {
+			name: "points",
+			a: SVGAttrs{
+				width:   "72pt",
+				height:  "144pt",
+				viewbox: "0 0 72 144",
+			},
+			wantX: 72,
+			wantY: 72,
+		}, {
+			name: "unitless is px",
+			a: SVGAttrs{
+				width:   "192",
+				height:  "96",
+				viewbox: "0 0 400 200",
+			},
+			wantX: 200,
+			wantY: 200,
+		}, {
+			name: "no size",
+			a: SVGAttrs{
+				viewbox: "0 0 400 200",
+			},
+			wantX: 96,
+			wantY: 96,
+		}, {
+			name: "percentage size",
+			a: SVGAttrs{
+				width:   "100%",
+				height:  "100%",
+				viewbox: "0 0 400 200",
+			},
+			wantX: 96,
+			wantY: 96,
+		}, {
+			name: "width only",
+			a: SVGAttrs{
+				width:   "4in",
+				viewbox: "0 0 400 200",
+			},
+			wantX: 100,
+			wantY: 100,
+		}, {
+			name: "no viewBox",
+			a: SVGAttrs{
+				width:  "100mm",
+				height: "100mm",
+			},
+			wantX: 96,
+			wantY: 96,
+		}, {
+			name: "mismatched aspect meets",
 			a: SVGAttrs{
 				width:   "2in",
 				height:  "3in",
 				viewbox: "0 0 5400 5400",
 			},
-			want:    0,
+			wantX: 2700,
+			wantY: 2700,
+		}, {
+			name: "mismatched aspect slices",
+			a: SVGAttrs{
+				width:               "2in",
+				height:              "3in",
+				viewbox:             "0 0 5400 5400",
+				preserveAspectRatio: "xMinYMin slice",
+			},
+			wantX: 1800,
+			wantY: 1800,
+		}, {
+			name: "mismatched aspect stretched",
+			a: SVGAttrs{
+				width:               "2in",
+				height:              "3in",
+				viewbox:             "0 0 5400 5400",
+				preserveAspectRatio: "none",
+			},
+			wantX: 2700,
+			wantY: 1800,
+		}, {
+			name: "invalid preserveAspectRatio",
+			a: SVGAttrs{
+				width:               "2in",
+				height:              "2in",
+				viewbox:             "0 0 600 600",
+				preserveAspectRatio: "middle",
+			},
 			wantErr: true,
 		}, {
 			name: "invalid viewbox - string",
@@ -60,7 +159,6 @@ func TestSVGAttrs_getResolutionPxPerIn(t *testing.T) {
 				height:  "457.2mm",
 				viewbox: "0 0 5400 5400mm",
 			},
-			want:    0,
 			wantErr: true,
 		}, {
 			name: "invalid viewbox - missing number",
@@ -69,26 +167,41 @@ func TestSVGAttrs_getResolutionPxPerIn(t *testing.T) {
 				height:  "457.2mm",
 				viewbox: "0 0 5400",
 			},
-			want:    0,
+			wantErr: true,
+		}, {
+			name: "invalid viewbox - zero width",
+			a: SVGAttrs{
+				width:   "457.2mm",
+				height:  "457.2mm",
+				viewbox: "0 0 0 5400",
+			},
+			wantErr: true,
+		}, {
+			name: "invalid width",
+			a: SVGAttrs{
+				width:   "wide",
+				height:  "457.2mm",
+				viewbox: "0 0 5400 5400",
+			},
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			got, err := tt.a.getResolutionPxPerIn()
+			gotX, gotY, err := tt.a.getResolutionPxPerIn()
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getResolutionPxPerIn() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
-				t.Errorf("getResolutionPxPerIn() got = %v, want %v", got, tt.want)
+			if math.Abs(gotX-tt.wantX) > 1e-6 || math.Abs(gotY-tt.wantY) > 1e-6 {
+				t.Errorf("getResolutionPxPerIn() got = %v, %v, want %v, %v", gotX, gotY, tt.wantX, tt.wantY)
 			}
 		})
 	}
 }
 
-func Test_widthHeightRegex(t *testing.T) {
+func Test_lengthRegex(t *testing.T) {
 	tests := []struct {
 		name  string
 		input string
@@ -96,14 +209,16 @@ func Test_widthHeightRegex(t *testing.T) {
 	}{
 		{name: "happy path - in", input: "2in", want: []string{"2", "in"}},
 		{name: "happy path - mm", input: "50.8mm", want: []string{"50.8", "mm"}},
-		{name: "invalid - missing units", input: "2", want: nil},
+		{name: "happy path - unitless", input: "2", want: []string{"2", ""}},
+		{name: "happy path - exponent", input: "1e2pt", want: []string{"1e2", "pt"}},
+		{name: "invalid - unknown unit", input: "2ft", want: nil},
 		{name: "invalid - blank", input: "", want: nil},
 	}
 	funcName := getFuncName()
 	funcName = strings.TrimPrefix(funcName, "_")
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			matches := widthHeightRegex.FindAllStringSubmatch(tt.input, -1) //-1 means all matches
+			matches := lengthRegex.FindAllStringSubmatch(tt.input, -1) //-1 means all matches
 			if tt.want == nil && matches == nil {
 				return //success
 			}
@@ -129,6 +244,7 @@ func Test_viewBoxRegex(t *testing.T) {
 		want  []string
 	}{
 		{name: "happy path", input: "0 0 5400 5400", want: []string{"0", "0", "5400", "5400"}},
+		{name: "happy path - commas", input: "-10.5,0,.5,1e3", want: []string{"-10.5", "0", ".5", "1e3"}},
 		{name: "invalid - string", input: "0 0 5400 5400mm", want: nil},
 		{name: "invalid - missing number", input: "0 0 5400", want: nil},
 		{name: "invalid - blank", input: "", want: nil},
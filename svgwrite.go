@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// SVGOptions are the annotations writeSVG draws over the segments, to see
+// how a processed job will be cut. They are drawn in a group of their own
+// and are for looking at, a drawing with them that is loaded again would
+// have them cut too.
+type SVGOptions struct {
+	// OrderNumbers numbers the segments in the order they are cut
+	OrderNumbers bool
+	// StartMarkers circles the point every segment starts at
+	StartMarkers bool
+	// Travel draws the moves between segments dashed
+	Travel bool
+}
+
+// svgAnnotations are the names of the annotations of SVGOptions
+var svgAnnotations = []string{"order", "starts", "travel"}
+
+// parseAnnotations reads the names of annotations, like order,travel
+func parseAnnotations(names []string) (SVGOptions, error) {
+	var opts SVGOptions
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "order":
+			opts.OrderNumbers = true
+		case "starts":
+			opts.StartMarkers = true
+		case "travel":
+			opts.Travel = true
+		default:
+			return opts, fmt.Errorf("unknown annotation '%s', expected one of %s", name, strings.Join(svgAnnotations, ", "))
+		}
+	}
+	return opts, nil
+}
+
+// annotationColor is the colour annotations are drawn in, grey is not the
+// colour of an operation
+const annotationColor = "#808080"
+
+// writeSVG writes the job as an svg document in millimetres, one path per
+// segment, with a user unit of one millimetre. The segments of every
+// operation are in a group of their own, in the order the operations are
+// first cut, the ones of no operation come last. Within a group they keep
+// the order of the job.
+func (j *Job) writeSVG(w io.Writer, opts SVGOptions) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprint(out, xml.Header)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%smm" height="%smm" viewBox="0 0 %s %s">`+"\n",
+		formatMm(j.WidthMm), formatMm(j.HeightMm), formatMm(j.WidthMm), formatMm(j.HeightMm))
+
+	var ops []*Operation
+	groups := map[*Operation][]svg.Segment{}
+	for _, s := range j.Segments {
+		if len(s.Points) == 0 {
+			continue
+		}
+		op := j.operationFor(s)
+		if _, ok := groups[op]; !ok && op != nil {
+			ops = append(ops, op)
+		}
+		groups[op] = append(groups[op], s)
+	}
+	for _, op := range append(ops, nil) {
+		if len(groups[op]) == 0 {
+			continue
+		}
+		if op != nil {
+			fmt.Fprintf(out, `<g id="operation-%s">`+"\n", xmlAttr(op.Name))
+		}
+		for _, s := range groups[op] {
+			fmt.Fprintf(out, `<path d="%s" %s/>`+"\n", pathData(s), segmentPaint(s))
+		}
+		if op != nil {
+			fmt.Fprintln(out, `</g>`)
+		}
+	}
+
+	if opts.OrderNumbers || opts.StartMarkers || opts.Travel {
+		j.writeAnnotations(out, opts)
+	}
+	fmt.Fprintln(out, `</svg>`)
+	return out.Flush()
+}
+
+// writeAnnotations draws the annotations of opts for the segments that are
+// cut, in the order they are cut starting from the top left corner
+func (j *Job) writeAnnotations(out *bufio.Writer, opts SVGOptions) {
+	// sized to the page so they can be read at any size
+	size := math.Max(math.Min(j.WidthMm, j.HeightMm)/100, .5)
+	fmt.Fprintf(out, `<g id="annotations" fill="none" stroke="%s" stroke-width="%s">`+"\n", annotationColor, formatMm(size/10))
+	head := [2]float64{0, 0}
+	n := 0
+	for _, s := range j.Segments {
+		if j.operationFor(s) == nil || len(s.Points) == 0 {
+			continue
+		}
+		n++
+		start, end := s.Points[0], s.Points[len(s.Points)-1]
+		if opts.Travel && head != start {
+			fmt.Fprintf(out, `<path d="M%s,%s L%s,%s" stroke-dasharray="%s,%s"/>`+"\n",
+				formatMm(head[0]), formatMm(head[1]), formatMm(start[0]), formatMm(start[1]), formatMm(size/2), formatMm(size/2))
+		}
+		if opts.StartMarkers {
+			fmt.Fprintf(out, `<circle cx="%s" cy="%s" r="%s"/>`+"\n", formatMm(start[0]), formatMm(start[1]), formatMm(size/2))
+		}
+		if opts.OrderNumbers {
+			fmt.Fprintf(out, `<text x="%s" y="%s" font-size="%s" fill="%s" stroke="none">%d</text>`+"\n",
+				formatMm(start[0]+size/2), formatMm(start[1]-size/2), formatMm(size*2), annotationColor, n)
+		}
+		head = end
+	}
+	fmt.Fprintln(out, `</g>`)
+}
+
+// pathData is the d attribute of a path following the points of s
+func pathData(s svg.Segment) string {
+	var d strings.Builder
+	points := s.Points
+	if s.Closed {
+		points = openRing(points)
+	}
+	for i, p := range points {
+		if i == 0 {
+			d.WriteString("M")
+		} else {
+			d.WriteString(" L")
+		}
+		d.WriteString(formatMm(p[0]) + "," + formatMm(p[1]))
+	}
+	if s.Closed {
+		d.WriteString(" Z")
+	}
+	return d.String()
+}
+
+// segmentPaint is the presentation attributes of s
+func segmentPaint(s svg.Segment) string {
+	stroke, fill := s.Stroke, s.Fill
+	if stroke == "" {
+		stroke = "none"
+	}
+	if fill == "" {
+		fill = "none"
+	}
+	attrs := fmt.Sprintf(`fill="%s" stroke="%s"`, fill, stroke)
+	if stroke != "none" {
+		attrs += fmt.Sprintf(` stroke-width="%s"`, formatMm(s.Width))
+	}
+	if s.FillRule != "" {
+		attrs += fmt.Sprintf(` fill-rule="%s"`, s.FillRule)
+	}
+	return attrs
+}
+
+// formatMm prints a length to a thousandth of a millimetre, without
+// trailing zeros
+func formatMm(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+import (
+	"aqwari.net/xml/xmltree"
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestWriteSVGAnnotations(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "parts",
+		WidthMm:    100,
+		HeightMm:   100,
+		Operations: defaultOperations,
+		Segments: []svg.Segment{
+			{Stroke: "#0000ff", Points: [][2]float64{{0, 90}, {20, 90}}},
+			{Stroke: "#0000ff", Points: [][2]float64{{20, 90}, {20, 70}}},
+			{Closed: true, Stroke: "#000000", Points: closeRing(square(10, 10, 30))},
+			{Stroke: "none", Fill: "#000000", Points: closeRing(square(50, 50, 10))},
+		},
+	}
+
+	out := bytes.Buffer{}
+	is.NoErr(job.writeSVG(&out, SVGOptions{}))
+	root, err := xmltree.Parse(out.Bytes())
+	is.NoErr(err)
+	is.Equal(len(root.Children), 3)
+	is.Equal(root.Children[0].Attr("", "id"), "operation-score")
+	is.Equal(len(root.Children[0].Children), 2)
+	is.Equal(root.Children[1].Attr("", "id"), "operation-cut")
+	is.Equal(root.Children[2].Name.Local, "path")
+	is.Equal(root.Children[2].Attr("", "fill"), "#000000")
+
+	out.Reset()
+	is.NoErr(job.writeSVG(&out, SVGOptions{OrderNumbers: true, StartMarkers: true, Travel: true}))
+	root, err = xmltree.Parse(out.Bytes())
+	is.NoErr(err)
+	annotations := root.Children[len(root.Children)-1]
+	is.Equal(annotations.Attr("", "id"), "annotations")
+	count := map[string]int{}
+	var numbers []string
+	for _, el := range annotations.Children {
+		count[el.Name.Local]++
+		if el.Name.Local == "text" {
+			numbers = append(numbers, string(el.Content))
+		}
+	}
+	// the second score starts where the first ends, so it has no travel
+	is.Equal(count, map[string]int{"path": 2, "circle": 3, "text": 3})
+	is.Equal(numbers, []string{"1", "2", "3"})
+	is.Equal(annotations.Children[0].Attr("", "d"), "M0,0 L0,90")
+
+	opts, err := parseAnnotations([]string{"order", "Travel"})
+	is.NoErr(err)
+	is.Equal(opts, SVGOptions{OrderNumbers: true, Travel: true})
+	_, err = parseAnnotations([]string{"colour"})
+	is.True(err != nil)
+}
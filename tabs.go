@@ -0,0 +1,291 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+const (
+	// straightTolerance is how far, in millimetres, points may stray from a
+	// line and still count as a straight edge rather than a curve
+	straightTolerance = .05
+	// cornerAngle is the smallest change of direction, in radians, that
+	// counts as a corner
+	cornerAngle = 10 * math.Pi / 180
+)
+
+// TabOptions controls the tabs left on the outer contours of parts so they
+// stay attached to the sheet instead of falling through the honeycomb.
+type TabOptions struct {
+	// Count is the number of tabs on every outer contour, 0 disables
+	// automatic tabs
+	Count int
+	// WidthMm is the length of contour that is left uncut for each tab
+	WidthMm float64
+	// Layer is the name of the layer holding tab markers. A marker is any
+	// shape on that layer, a tab is placed on the closest outer contour
+	// to its centre. Contours with markers get no automatic tabs.
+	Layer string
+}
+
+var defaultTabOptions = TabOptions{
+	Count:   0,
+	WidthMm: 1,
+	Layer:   "tabs",
+}
+
+// tab is a stretch of a contour that is left uncut, as distances along it
+type tab struct {
+	start, end float64
+}
+
+// applyTabs leaves gaps in the outer contours of the job. Tabs are only
+// put on outer profiles, holes fall out anyway. Automatic tabs are spread
+// evenly around the contour but are moved onto straight edges, away from
+// corners, where possible. A contour with tabs is split into the open
+// segments between them. The markers are taken out of the job even when
+// tabs have no width and none are placed.
+func (j *Job) applyTabs(opts TabOptions) {
+	// pull the markers out of the drawing, they are not cut
+	var markers [][2]float64
+	var segments []svg.Segment
+	for _, s := range j.Segments {
+		if opts.Layer != "" && s.Layer == opts.Layer {
+			markers = append(markers, pointsBounds(s.Points).center())
+			continue
+		}
+		segments = append(segments, s)
+	}
+	j.Segments = segments
+	if opts.WidthMm <= 0 {
+		return
+	}
+
+	nodes := j.cutContours()
+	manual := assignMarkers(segments, nodes, markers)
+
+	var tabbed []svg.Segment
+	for i, s := range segments {
+		node := nodes[i]
+		if node == nil || node.isHole() {
+			tabbed = append(tabbed, s)
+			continue
+		}
+		lengths := pathLengths(s.Points)
+		total := lengths[len(lengths)-1]
+		if total <= opts.WidthMm*2 {
+			tabbed = append(tabbed, s)
+			continue
+		}
+
+		var tabs []tab
+		if centres, ok := manual[i]; ok {
+			for _, c := range centres {
+				tabs = append(tabs, tab{start: c - opts.WidthMm/2, end: c + opts.WidthMm/2})
+			}
+		} else if opts.Count > 0 {
+			tabs = autoTabs(s.Points, lengths, opts)
+		}
+		if len(tabs) == 0 {
+			tabbed = append(tabbed, s)
+			continue
+		}
+		tabbed = append(tabbed, splitAtTabs(s, lengths, tabs)...)
+	}
+	j.Segments = tabbed
+}
+
+// assignMarkers finds the closest outer contour for every marker and
+// returns the tab centres, as distances along the contour, by segment index.
+func assignMarkers(segments []svg.Segment, nodes []*contourNode, markers [][2]float64) map[int][]float64 {
+	manual := map[int][]float64{}
+	for _, m := range markers {
+		best, bestDist, bestAlong := -1, math.Inf(1), 0.0
+		for i, s := range segments {
+			if nodes[i] == nil || nodes[i].isHole() {
+				continue
+			}
+			along, dist := closestAlong(s.Points, pathLengths(s.Points), m)
+			if dist < bestDist {
+				best, bestDist, bestAlong = i, dist, along
+			}
+		}
+		if best >= 0 {
+			manual[best] = append(manual[best], bestAlong)
+		}
+	}
+	return manual
+}
+
+// straightRun is a stretch of contour without corners or curves, as
+// distances along the contour. end may be past the length of the contour
+// when the run wraps through its start.
+type straightRun struct {
+	start, end float64
+}
+
+// straightRuns finds the straight edges of a closed contour. Consecutive
+// short edges that stay within straightTolerance of a line are one run,
+// the many short edges of a flattened curve are not.
+func straightRuns(points [][2]float64, lengths []float64) []straightRun {
+	ring := openRing(points)
+	n := len(ring)
+	if n < 3 {
+		return nil
+	}
+	total := lengths[len(lengths)-1]
+	// start scanning at a corner so no run is cut in two by the start of
+	// the contour
+	first := 0
+	for i := range ring {
+		if turnAngle(ring, i) >= cornerAngle {
+			first = i
+			break
+		}
+	}
+
+	var runs []straightRun
+	i := 0
+	for i < n {
+		a := (first + i) % n
+		k := i + 1
+		// extend the run while every point stays near the line from its start
+		for k+1 <= n {
+			b := (first + k + 1) % n
+			ok := true
+			for m := i + 1; m <= k; m++ {
+				if lineDistance(ring[(first+m)%n], ring[a], ring[b]) > straightTolerance {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				break
+			}
+			k++
+		}
+		start := lengths[a]
+		runs = append(runs, straightRun{start: start, end: start + distanceAlongRing(lengths, total, a, (first+k)%n)})
+		i = k
+	}
+	return runs
+}
+
+// distanceAlongRing is the distance from point a to point b going forward
+// around a closed contour
+func distanceAlongRing(lengths []float64, total float64, a, b int) float64 {
+	d := lengths[b] - lengths[a]
+	if d <= 0 {
+		d += total
+	}
+	return d
+}
+
+// turnAngle is how much the direction of a ring changes at point i
+func turnAngle(ring [][2]float64, i int) float64 {
+	n := len(ring)
+	d0 := sub(ring[i], ring[(i+n-1)%n])
+	d1 := sub(ring[(i+1)%n], ring[i])
+	return math.Abs(math.Atan2(cross(d0, d1), dot(d0, d1)))
+}
+
+// lineDistance is the distance from p to the line through a and b
+func lineDistance(p, a, b [2]float64) float64 {
+	d := sub(b, a)
+	l := length(d)
+	if l == 0 {
+		return distance(p, a)
+	}
+	return math.Abs(cross(d, sub(p, a))) / l
+}
+
+// autoTabs spreads opts.Count tabs evenly around a contour. Each tab is
+// moved to the closest position on a straight run that keeps it clear of
+// the corners at the ends of the run. When there is no such position, a
+// circle for instance, the even spacing is kept.
+func autoTabs(points [][2]float64, lengths []float64, opts TabOptions) []tab {
+	total := lengths[len(lengths)-1]
+	half := opts.WidthMm / 2
+	clearance := math.Max(opts.WidthMm, 2)
+
+	// the ranges a tab centre can be in
+	var allowed []straightRun
+	for _, r := range straightRuns(points, lengths) {
+		if r.end-r.start >= 2*(half+clearance) {
+			allowed = append(allowed, straightRun{start: r.start + half + clearance, end: r.end - half - clearance})
+		}
+	}
+
+	var tabs []tab
+	spacing := total / float64(opts.Count)
+	for k := 0; k < opts.Count; k++ {
+		ideal := spacing * (float64(k) + .5)
+		centre := ideal
+		if len(allowed) > 0 {
+			best := math.Inf(1)
+			for _, r := range allowed {
+				// try the run where it is and one lap later or earlier
+				for _, shift := range []float64{-total, 0, total} {
+					c := math.Max(r.start+shift, math.Min(r.end+shift, ideal))
+					if d := math.Abs(c - ideal); d < best && !overlapsTabs(tabs, c, half, total) {
+						best, centre = d, c
+					}
+				}
+			}
+			if math.IsInf(best, 1) {
+				continue // no room left for another tab
+			}
+		}
+		tabs = append(tabs, tab{start: centre - half, end: centre + half})
+	}
+	return tabs
+}
+
+// overlapsTabs reports if a tab centred at c would be within a tab width
+// of one already placed
+func overlapsTabs(tabs []tab, c, half, total float64) bool {
+	for _, t := range tabs {
+		d := math.Mod(math.Abs(c-(t.start+t.end)/2), total)
+		if math.Min(d, total-d) < 4*half {
+			return true
+		}
+	}
+	return false
+}
+
+// splitAtTabs cuts a closed contour into the open segments that run from
+// the end of one tab to the start of the next.
+func splitAtTabs(s svg.Segment, lengths []float64, tabs []tab) []svg.Segment {
+	total := lengths[len(lengths)-1]
+	for i := range tabs {
+		for tabs[i].start < 0 {
+			tabs[i].start += total
+			tabs[i].end += total
+		}
+		for tabs[i].start >= total {
+			tabs[i].start -= total
+			tabs[i].end -= total
+		}
+	}
+	sort.Slice(tabs, func(a, b int) bool { return tabs[a].start < tabs[b].start })
+
+	var pieces []svg.Segment
+	for i, t := range tabs {
+		next := tabs[(i+1)%len(tabs)].start
+		if i == len(tabs)-1 {
+			next += total
+		}
+		if next-t.end <= 0 {
+			continue
+		}
+		piece := s
+		piece.Closed = false
+		piece.Points = sliceClosedPath(s.Points, lengths, t.end, next)
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func circleRing(cx, cy, r float64, steps int) [][2]float64 {
+	var ring [][2]float64
+	for i := 0; i < steps; i++ {
+		a := 2 * math.Pi * float64(i) / float64(steps)
+		ring = append(ring, [2]float64{cx + r*math.Cos(a), cy + r*math.Sin(a)})
+	}
+	return ring
+}
+
+func cutLength(segments []svg.Segment) float64 {
+	total := 0.0
+	for _, s := range segments {
+		l := pathLengths(s.Points)
+		total += l[len(l)-1]
+	}
+	return total
+}
+
+func TestApplyTabs(t *testing.T) {
+	tests := []struct {
+		name       string
+		segments   []svg.Segment
+		opts       TabOptions
+		wantPieces int
+		wantLength float64
+	}{
+		{
+			name: "square",
+			segments: []svg.Segment{
+				{Closed: true, Stroke: "black", Points: closeRing(square(0, 0, 50))},
+			},
+			opts:       TabOptions{Count: 4, WidthMm: 2},
+			wantPieces: 4,
+			wantLength: 200 - 4*2,
+		},
+		{
+			name: "holes get no tabs",
+			segments: []svg.Segment{
+				{Closed: true, Stroke: "black", Points: closeRing(square(0, 0, 50))},
+				{Closed: true, Stroke: "black", Points: closeRing(square(10, 10, 20))},
+			},
+			opts:       TabOptions{Count: 2, WidthMm: 1},
+			wantPieces: 3,
+			wantLength: 200 - 2 + 80,
+		},
+		{
+			name: "circle",
+			segments: []svg.Segment{
+				{Closed: true, Stroke: "black", Points: closeRing(circleRing(0, 0, 20, 90))},
+			},
+			opts:       TabOptions{Count: 3, WidthMm: 1},
+			wantPieces: 3,
+			wantLength: 0, // checked against the perimeter below
+		},
+		{
+			name: "manual marker",
+			segments: []svg.Segment{
+				{Closed: true, Stroke: "black", Points: closeRing(square(0, 0, 50))},
+				{Closed: true, Stroke: "black", Layer: "tabs", Points: closeRing(circleRing(25, 51, 1, 8))},
+			},
+			opts:       TabOptions{Count: 4, WidthMm: 2, Layer: "tabs"},
+			wantPieces: 1,
+			wantLength: 200 - 2,
+		},
+		{
+			name: "markers without tab width",
+			segments: []svg.Segment{
+				{Closed: true, Stroke: "black", Points: closeRing(square(0, 0, 50))},
+				{Closed: true, Stroke: "black", Layer: "tabs", Points: closeRing(square(24, 50, 2))},
+			},
+			opts:       TabOptions{WidthMm: 0, Layer: "tabs"},
+			wantPieces: 1,
+			wantLength: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			job := &Job{Segments: tt.segments}
+			before := cutLength(job.Segments)
+			job.applyTabs(tt.opts)
+
+			is.Equal(len(job.Segments), tt.wantPieces)
+			want := tt.wantLength
+			if want == 0 {
+				want = before - float64(tt.opts.Count)*tt.opts.WidthMm
+			}
+			if math.Abs(cutLength(job.Segments)-want) > 1e-6 {
+				t.Errorf("cut length %f, want %f", cutLength(job.Segments), want)
+			}
+		})
+	}
+}
+
+func TestAutoTabsAvoidCorners(t *testing.T) {
+	is := is.New(t)
+	// a long thin part, evenly spaced tabs would land near the short sides
+	ring := closeRing([][2]float64{{0, 0}, {100, 0}, {100, 6}, {0, 6}})
+	lengths := pathLengths(ring)
+	tabs := autoTabs(ring, lengths, TabOptions{Count: 4, WidthMm: 1})
+	is.Equal(len(tabs), 4)
+	for _, tb := range tabs {
+		c := pointAlong(ring, lengths, math.Mod((tb.start+tb.end)/2+212, 212))
+		// every tab is on a long side and at least 2mm from a corner
+		is.True(c[1] == 0 || c[1] == 6)
+		is.True(c[0] >= 2.5 && c[0] <= 97.5)
+	}
+}
+
+func TestConvertTabs(t *testing.T) {
+	is := is.New(t)
+	request := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("tabs=4&tab-width=2"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	jobOpts, err := formJobOptions(request, defaultJobOptions)
+	is.NoErr(err)
+	is.Equal(jobOpts.Tabs.Count, 4)
+	is.Equal(jobOpts.Tabs.WidthMm, 2.0)
+
+	// the pdf for the laser driver leaves the tabs uncut
+	out := bytes.Buffer{}
+	opts := ConvertOptions{Name: "part.svg", Strokes: defaultStrokeOptions, Material: materialPresets["none"], Job: jobOpts}
+	is.NoErr(convert(context.Background(), "native", []byte(kerfSVG), "pdf", opts, &out))
+	read, err := loadPDFJob("part.pdf", out.Bytes(), materialPresets["none"], defaultCleanOptions)
+	is.NoErr(err)
+	is.Equal(len(read.Segments), 4)
+	is.True(math.Abs(cutLength(read.Segments)-(200-4*2)) < 1e-3)
+
+	request = httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("tabs=some"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = formJobOptions(request, defaultJobOptions)
+	is.True(err != nil)
+}
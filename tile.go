@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+import (
+	"github.com/rustyoz/svg"
+)
+
+// TileOptions controls how a drawing too big for the bed is split up
+type TileOptions struct {
+	SheetWidthMm  float64
+	SheetHeightMm float64
+	// OverlapMm is how far neighbouring tiles overlap, geometry in the
+	// overlap is cut on both
+	OverlapMm float64
+	// MarkSizeMm is the size of the registration crosses scored where
+	// tiles meet, 0 leaves them out
+	MarkSizeMm float64
+	// NumberSizeMm is the height of the tile number scored in the top left
+	// corner of every tile, 0 leaves it out
+	NumberSizeMm float64
+	// Layer is the layer registration marks and numbers are put on
+	Layer string
+}
+
+var defaultTileOptions = TileOptions{
+	SheetWidthMm:  defaultNestOptions.SheetWidthMm,
+	SheetHeightMm: defaultNestOptions.SheetHeightMm,
+	OverlapMm:     10,
+	MarkSizeMm:    5,
+	NumberSizeMm:  5,
+	Layer:         "registration",
+}
+
+// tile splits the job into sheet sized tiles, numbered from the top left,
+// row by row. The geometry is clipped at the edges of every tile, so a
+// contour crossing into the next tile is cut as open segments on both.
+// Registration marks go in the overlaps, on both tiles sharing one, so the
+// pieces can be lined up again.
+func tile(j *Job, opts TileOptions) ([]*Job, error) {
+	stepX, stepY := opts.SheetWidthMm-opts.OverlapMm, opts.SheetHeightMm-opts.OverlapMm
+	if stepX <= 0 || stepY <= 0 {
+		return nil, fmt.Errorf("an overlap of %gmm does not fit on a %gx%gmm sheet",
+			opts.OverlapMm, opts.SheetWidthMm, opts.SheetHeightMm)
+	}
+	drawing := segmentsBounds(j.Segments)
+	if drawing.isEmpty() {
+		return nil, fmt.Errorf("%s has nothing to tile", j.Name)
+	}
+	cols := tileCount(drawing.width(), opts.SheetWidthMm, stepX)
+	rows := tileCount(drawing.height(), opts.SheetHeightMm, stepY)
+
+	mark := scoreColor(j)
+	var tiles []*Job
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			area := bounds{MinX: drawing.MinX + float64(c)*stepX, MinY: drawing.MinY + float64(r)*stepY}
+			area.MaxX, area.MaxY = area.MinX+opts.SheetWidthMm, area.MinY+opts.SheetHeightMm
+
+			var segments []svg.Segment
+			for _, s := range j.Segments {
+				segments = append(segments, clipSegment(s, area)...)
+			}
+
+			if opts.MarkSizeMm > 0 {
+				for _, p := range markPositions(area, r, c, rows, cols, opts) {
+					segments = append(segments, registrationMark(p, opts.MarkSizeMm, area, mark, opts.Layer)...)
+				}
+			}
+
+			origin := [2]float64{area.MinX, area.MinY}
+			transformSegments(segments, func(p [2]float64) [2]float64 { return sub(p, origin) })
+
+			n := len(tiles) + 1
+			if opts.NumberSizeMm > 0 {
+				at := [2]float64{opts.NumberSizeMm / 2, opts.NumberSizeMm / 2}
+				for _, stroke := range numberStrokes(n, at, opts.NumberSizeMm) {
+					segments = append(segments, svg.Segment{Stroke: mark, Layer: opts.Layer, Points: stroke})
+				}
+			}
+
+			tiles = append(tiles, &Job{
+				Name:       fmt.Sprintf("%s-tile-%d", j.Name, n),
+				WidthMm:    opts.SheetWidthMm,
+				HeightMm:   opts.SheetHeightMm,
+				Material:   j.Material,
+				Operations: append([]Operation{}, j.Operations...),
+				Segments:   segments,
+			})
+		}
+	}
+	return tiles, nil
+}
+
+// tileCount is how many tiles of size, step apart, cover length
+func tileCount(length, size, step float64) int {
+	if length <= size {
+		return 1
+	}
+	return int(math.Ceil((length-size)/step-fitTolerance)) + 1
+}
+
+// markPositions are the centres of the registration marks of the tile in
+// row r and column c. Every overlap with a neighbour gets a mark near
+// both of its ends, in the middle of the overlap, so the neighbour has the
+// same marks. They stay clear of the corners where the number goes.
+func markPositions(area bounds, r, c, rows, cols int, opts TileOptions) [][2]float64 {
+	inset := 3 * math.Max(opts.MarkSizeMm, opts.NumberSizeMm)
+	half := opts.OverlapMm / 2
+	var bands []float64
+	if c > 0 {
+		bands = append(bands, area.MinX+half)
+	}
+	if c < cols-1 {
+		bands = append(bands, area.MaxX-half)
+	}
+	var positions [][2]float64
+	for _, x := range bands {
+		positions = append(positions, [2]float64{x, area.MinY + inset}, [2]float64{x, area.MaxY - inset})
+	}
+	bands = nil
+	if r > 0 {
+		bands = append(bands, area.MinY+half)
+	}
+	if r < rows-1 {
+		bands = append(bands, area.MaxY-half)
+	}
+	for _, y := range bands {
+		positions = append(positions, [2]float64{area.MinX + inset, y}, [2]float64{area.MaxX - inset, y})
+	}
+	return positions
+}
+
+// scoreColor is the colour of the first score operation of the job
+func scoreColor(j *Job) string {
+	for _, op := range j.Operations {
+		if op.Kind == Score {
+			return op.Color
+		}
+	}
+	return defaultOperations[1].Color
+}
+
+// registrationMark is a cross centred on p, clipped to area
+func registrationMark(p [2]float64, size float64, area bounds, color, layer string) []svg.Segment {
+	half := size / 2
+	var mark []svg.Segment
+	for _, arm := range [][][2]float64{
+		{{p[0] - half, p[1]}, {p[0] + half, p[1]}},
+		{{p[0], p[1] - half}, {p[0], p[1] + half}},
+	} {
+		mark = append(mark, clipSegment(svg.Segment{Stroke: color, Layer: layer, Points: arm}, area)...)
+	}
+	return mark
+}
+
+// clipSegment returns the pieces of s inside area. A closed contour that
+// is entirely inside stays closed, one that crosses the edge is cut into
+// open pieces.
+func clipSegment(s svg.Segment, area bounds) []svg.Segment {
+	if area.contains(pointsBounds(s.Points), 0) {
+		inside := s
+		inside.Points = append([][2]float64{}, s.Points...)
+		return []svg.Segment{inside}
+	}
+	if !area.overlaps(pointsBounds(s.Points)) {
+		return nil
+	}
+
+	var pieces [][][2]float64
+	var current [][2]float64
+	for i := 0; i+1 < len(s.Points); i++ {
+		a, b, ok := clipLine(s.Points[i], s.Points[i+1], area)
+		if !ok {
+			continue
+		}
+		if len(current) > 0 && current[len(current)-1] != a {
+			pieces = append(pieces, current)
+			current = nil
+		}
+		if len(current) == 0 {
+			current = append(current, a)
+		}
+		if b != a {
+			current = append(current, b)
+		}
+	}
+	if len(current) > 0 {
+		pieces = append(pieces, current)
+	}
+
+	// the first and last piece of a contour join up where it starts
+	if s.Closed && len(pieces) > 1 {
+		first, last := pieces[0], pieces[len(pieces)-1]
+		if first[0] == s.Points[0] && last[len(last)-1] == s.Points[0] {
+			pieces[0] = append(last, first[1:]...)
+			pieces = pieces[:len(pieces)-1]
+		}
+	}
+
+	var clipped []svg.Segment
+	for _, p := range pieces {
+		if len(p) < 2 {
+			continue
+		}
+		piece := s
+		piece.Closed = false
+		piece.Points = p
+		clipped = append(clipped, piece)
+	}
+	return clipped
+}
+
+// clipLine clips the line from a to b to area with the Liang-Barsky method
+func clipLine(a, b [2]float64, area bounds) ([2]float64, [2]float64, bool) {
+	d := sub(b, a)
+	t0, t1 := 0.0, 1.0
+	for _, edge := range [4][2]float64{
+		{-d[0], a[0] - area.MinX},
+		{d[0], area.MaxX - a[0]},
+		{-d[1], a[1] - area.MinY},
+		{d[1], area.MaxY - a[1]},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return a, b, false
+		}
+	}
+	clippedA, clippedB := a, b
+	if t0 > 0 {
+		clippedA = add(a, mul(d, t0))
+	}
+	if t1 < 1 {
+		clippedB = add(a, mul(d, t1))
+	}
+	return clippedA, clippedB, true
+}
+
+// sevenSegments are the strokes of the segments of a digit in a box one
+// wide and two high, in the order a to g
+var sevenSegments = [7][2][2]float64{
+	{{0, 0}, {1, 0}}, {{1, 0}, {1, 1}}, {{1, 1}, {1, 2}}, {{0, 2}, {1, 2}},
+	{{0, 1}, {0, 2}}, {{0, 0}, {0, 1}}, {{0, 1}, {1, 1}},
+}
+
+// digitSegments lists which of the seven segments make up every digit
+var digitSegments = [10]string{"abcdef", "bc", "abdeg", "abcdg", "bcfg", "acdfg", "acdefg", "abc", "abcdefg", "abcdfg"}
+
+// numberStrokes draws n as seven segment digits of the given height with
+// their top left corner at p, a number any laser can score without fonts
+func numberStrokes(n int, p [2]float64, height float64) [][][2]float64 {
+	scale := height / 2
+	var strokes [][][2]float64
+	for i, digit := range strconv.Itoa(n) {
+		left := add(p, [2]float64{float64(i) * 1.5 * scale, 0})
+		for _, name := range digitSegments[digit-'0'] {
+			seg := sevenSegments[name-'a']
+			strokes = append(strokes, [][2]float64{add(left, mul(seg[0], scale)), add(left, mul(seg[1], scale))})
+		}
+	}
+	return strokes
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+import (
+	"github.com/matryer/is"
+	"github.com/rustyoz/svg"
+)
+
+func TestClipLine(t *testing.T) {
+	area := bounds{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10}
+	tests := []struct {
+		name   string
+		a, b   [2]float64
+		want   [2][2]float64
+		inside bool
+	}{
+		{"inside", [2]float64{1, 1}, [2]float64{9, 9}, [2][2]float64{{1, 1}, {9, 9}}, true},
+		{"crossing", [2]float64{5, 5}, [2]float64{15, 5}, [2][2]float64{{5, 5}, {10, 5}}, true},
+		{"through", [2]float64{-5, 5}, [2]float64{15, 5}, [2][2]float64{{0, 5}, {10, 5}}, true},
+		{"diagonal", [2]float64{-5, -5}, [2]float64{5, 5}, [2][2]float64{{0, 0}, {5, 5}}, true},
+		{"outside", [2]float64{11, 0}, [2]float64{11, 10}, [2][2]float64{}, false},
+		{"missing the corner", [2]float64{9, 12}, [2]float64{12, 9}, [2][2]float64{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			is := is.New(t)
+			a, b, ok := clipLine(tt.a, tt.b, area)
+			is.Equal(ok, tt.inside)
+			if ok {
+				is.Equal([2][2]float64{a, b}, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipSegment(t *testing.T) {
+	is := is.New(t)
+	area := bounds{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10}
+
+	// a square sticking out of the right edge, starting inside
+	s := svg.Segment{Closed: true, Stroke: "#000000", Points: closeRing(square(5, 2, 10))}
+	pieces := clipSegment(s, area)
+	is.Equal(len(pieces), 1) // the pieces on both sides of the start are joined
+	is.True(!pieces[0].Closed)
+	is.Equal(pieces[0].Points, [][2]float64{{5, 10}, {5, 2}, {10, 2}})
+
+	// a zig zag leaving and entering again
+	zigzag := svg.Segment{Points: [][2]float64{{2, 2}, {12, 5}, {2, 8}}}
+	is.Equal(len(clipSegment(zigzag, area)), 2)
+
+	// contours inside are kept closed and copied
+	inside := svg.Segment{Closed: true, Points: closeRing(square(1, 1, 2))}
+	kept := clipSegment(inside, area)
+	is.True(kept[0].Closed)
+	kept[0].Points[0][0] = 100
+	is.Equal(inside.Points[0][0], 1.0)
+}
+
+func TestTile(t *testing.T) {
+	is := is.New(t)
+	job := &Job{
+		Name:       "panel",
+		Operations: append([]Operation{}, defaultOperations...),
+		Segments: []svg.Segment{
+			{Closed: true, Stroke: "#000000", Points: closeRing([][2]float64{{0, 0}, {100, 0}, {100, 40}, {0, 40}})},
+		},
+	}
+	opts := TileOptions{SheetWidthMm: 60, SheetHeightMm: 50, OverlapMm: 10, MarkSizeMm: 4, NumberSizeMm: 4, Layer: "registration"}
+	tiles, err := tile(job, opts)
+	is.NoErr(err)
+	is.Equal(len(tiles), 2)
+	is.Equal(tiles[0].Name, "panel-tile-1")
+
+	for i, tl := range tiles {
+		var cut, marks []svg.Segment
+		for _, s := range tl.Segments {
+			if s.Layer == opts.Layer {
+				marks = append(marks, s)
+				continue
+			}
+			cut = append(cut, s)
+		}
+		// the first tile has 60mm of both long edges, the second the last
+		// 50mm, and both have one short edge
+		long := []float64{60, 50}[i]
+		is.True(math.Abs(cutLength(cut)-(2*long+40)) < 1e-9)
+		is.True(bounds{MaxX: 60, MaxY: 50}.contains(segmentsBounds(tl.Segments), 1e-9))
+		// two crosses and the number 1 or 2
+		is.True(len(marks) >= 4+2)
+	}
+
+	// the marks in the overlap are in the same place on the drawing
+	markAt := func(tl *Job, dx float64) [][2]float64 {
+		var centres [][2]float64
+		for _, s := range tl.Segments {
+			if s.Layer == opts.Layer && len(s.Points) == 2 && s.Points[0][1] == s.Points[1][1] && distance(s.Points[0], s.Points[1]) == 4 {
+				centres = append(centres, add(lerp(s.Points[0], s.Points[1], .5), [2]float64{dx, 0}))
+			}
+		}
+		return centres
+	}
+	is.Equal(markAt(tiles[0], 0), markAt(tiles[1], 50))
+	is.Equal(markAt(tiles[0], 0), [][2]float64{{55, 12}, {55, 38}})
+}
+
+func TestNumberStrokes(t *testing.T) {
+	is := is.New(t)
+	is.Equal(len(numberStrokes(8, [2]float64{}, 10)), 7)
+	is.Equal(len(numberStrokes(17, [2]float64{}, 10)), 2+3)
+	b := emptyBounds()
+	for _, s := range numberStrokes(10, [2]float64{1, 1}, 10) {
+		b = b.union(pointsBounds(s))
+	}
+	// a one has no strokes on its left
+	is.Equal(b, bounds{MinX: 1 + 5, MinY: 1, MaxX: 1 + 7.5 + 5, MaxY: 11})
+}